@@ -4,6 +4,7 @@ package flv
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 
@@ -118,8 +119,20 @@ func (m *muxer) mux(p *packet.Packet, pts uint32, w io.Writer) error {
 		return fmt.Errorf("unexpected type=%d", p.Type)
 	}
 
+	data := p.Data
+
+	// 音视频包没有封装好的 Tag Data 时, 根据 p.Header 和 p.Media 生成
+	if len(data) == 0 && p.Type != packet.PktMetadata {
+		var err error
+
+		data, err = m.tagData(p)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Flv data length
-	dataLen := uint32(len(p.Data))
+	dataLen := uint32(len(data))
 
 	/* 1字节, [0:1]Reserved, [2]Filter(unencrypted), [3:7]TagType */
 	/* 3字节, DataSize, 其中包含2字节的media header */
@@ -138,7 +151,7 @@ func (m *muxer) mux(p *packet.Packet, pts uint32, w io.Writer) error {
 	}
 
 	// 长度: dataLen
-	_, err = w.Write(p.Data)
+	_, err = w.Write(data)
 	if err != nil {
 		return err
 	}
@@ -153,3 +166,22 @@ func (m *muxer) mux(p *packet.Packet, pts uint32, w io.Writer) error {
 
 	return nil
 }
+
+// 根据 p.Header 生成 Tag Data 的头部, 拼接 p.Media 得到完整的 Tag Data
+func (m *muxer) tagData(p *packet.Packet) ([]byte, error) {
+	tag, ok := p.Header.(*Tag)
+	if !ok {
+		return nil, errors.New("missing tag data and flv tag header")
+	}
+
+	hdr, err := tag.MarshalMediaTagHeader(p.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 0, len(hdr)+len(p.Media))
+	data = append(data, hdr...)
+	data = append(data, p.Media...)
+
+	return data, nil
+}
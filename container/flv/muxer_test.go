@@ -39,3 +39,38 @@ func TestMuxer_Mux(t *testing.T) {
 		0x0, 0x0, 0x9, 0x0, 0x0, 0x0, 0x36,
 	}, buf.Bytes())
 }
+
+func TestMuxer_MuxExVideo(t *testing.T) {
+	at := assert.New(t)
+
+	mux := newMuxer()
+	buf := bytes.NewBuffer(nil)
+
+	data, err := mux.header(packet.PktVideo)
+	at.Nil(err)
+	buf.Write(data)
+
+	// 根据 Header 和 Media 生成 Tag Data
+	at.Nil(mux.mux(&packet.Packet{
+		Type:   packet.PktVideo,
+		Header: NewExVideoTag(KeyFrame, ExCodedFrames, FourCCHvc1, 80),
+		Media:  []byte{0x00, 0x00, 0x00, 0x02, 0x26, 0x01},
+	}, 1000, buf))
+
+	at.NotNil(mux.mux(&packet.Packet{
+		Type:  packet.PktVideo,
+		Media: []byte{0x00},
+	}, 1000, buf))
+
+	var p packet.Packet
+	r := NewReader(buf)
+	at.Nil(r.Read(&p))
+	at.Equal(uint32(1000), p.TimeStamp)
+	at.Equal([]byte{0x00, 0x00, 0x00, 0x02, 0x26, 0x01}, p.Media)
+
+	vh := p.Header.(packet.VideoPacketHeader)
+	at.True(vh.IsExHeader())
+	at.True(vh.IsCodecHevc())
+	at.True(vh.IsKeyFrame())
+	at.Equal(int32(80), vh.CompositionTime())
+}
@@ -0,0 +1,167 @@
+// Package flv 将裸流打包为flv音视频包
+package flv
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/moggle-mog/goav/packet"
+	"github.com/moggle-mog/goav/parser/aac"
+	"github.com/moggle-mog/goav/parser/h264"
+	"github.com/moggle-mog/goav/parser/mp3"
+)
+
+// AvcPacker 将Annex-b格式的H264访问单元打包为flv视频包
+type AvcPacker struct {
+	packer *h264.Packer
+}
+
+// NewAvcPacker H264打包器
+func NewAvcPacker() *AvcPacker {
+	return &AvcPacker{
+		packer: h264.NewPacker(),
+	}
+}
+
+// Pack 打包一个Annex-b格式的访问单元, dts和pts的单位为毫秒
+// SPS/PPS发生变化时, 先返回AVC序列头包, 再返回视频帧包; 收到SPS/PPS之前的视频帧无法解码, 会被丢弃
+func (a *AvcPacker) Pack(annexb []byte, dts, pts uint32) ([]*packet.Packet, error) {
+	avcc, isKeyFrame, err := a.packer.Pack(annexb)
+	if err != nil {
+		return nil, err
+	}
+
+	var pkts []*packet.Packet
+
+	// AVC序列头
+	if a.packer.SeqHdrChanged() {
+		pkts = append(pkts, newMediaPacket(packet.PktVideo, dts, NewVideoTag(KeyFrame, AvcH264, AvcSeqHdr, 0), a.packer.SequenceHeader()))
+	}
+
+	if len(avcc) == 0 || a.packer.SequenceHeader() == nil {
+		return pkts, nil
+	}
+
+	// 视频帧
+	frameType := uint8(InterFrame)
+	if isKeyFrame {
+		frameType = KeyFrame
+	}
+
+	tag := NewVideoTag(frameType, AvcH264, AvcNalu, int32(pts-dts))
+	pkts = append(pkts, newMediaPacket(packet.PktVideo, dts, tag, avcc))
+
+	return pkts, nil
+}
+
+// AacPacker 将ADTS格式的AAC打包为flv音频包
+type AacPacker struct {
+	config []byte /* 当前的 AudioSpecificConfig */
+}
+
+// NewAacPacker AAC打包器
+func NewAacPacker() *AacPacker {
+	return &AacPacker{}
+}
+
+// Pack 打包一段包含完整adts帧的数据, ts为第一帧的时间戳(毫秒), 之后每帧按1024个采样递增
+// 编码参数发生变化时, 先返回AAC序列头包, 再返回音频帧包; 每个 raw_data_block 生成一个音频帧包
+func (a *AacPacker) Pack(adts []byte, ts uint32) ([]*packet.Packet, error) {
+	frames, n, err := aac.SplitADTS(adts, false)
+	if err != nil {
+		return nil, err
+	}
+	if n != len(adts) {
+		return nil, errors.New("incomplete adts frame")
+	}
+
+	var pkts []*packet.Packet
+	var samples uint64
+
+	for _, frame := range frames {
+		// AAC序列头
+		config := frame.Header.AudioSpecificConfig()
+		if !bytes.Equal(config, a.config) {
+			a.config = config
+
+			tag := NewAudioTag(SoundAAC, SoundRate44100Hz, SoundSize16BitSamples, SoundTypeStereo, AacSeqHdr)
+			pkts = append(pkts, newMediaPacket(packet.PktAudio, ts+uint32(samples*1000/uint64(frame.Header.SampleRate())), tag, config))
+		}
+
+		for _, block := range frame.Blocks {
+			pts := ts + uint32(samples*1000/uint64(frame.Header.SampleRate()))
+			samples += 1024
+
+			tag := NewAudioTag(SoundAAC, SoundRate44100Hz, SoundSize16BitSamples, SoundTypeStereo, AacRaw)
+			pkts = append(pkts, newMediaPacket(packet.PktAudio, pts, tag, block))
+		}
+	}
+
+	return pkts, nil
+}
+
+// Mp3Packer 将mp3帧打包为flv音频包
+type Mp3Packer struct{}
+
+// NewMp3Packer mp3打包器
+func NewMp3Packer() *Mp3Packer {
+	return &Mp3Packer{}
+}
+
+// Pack 打包一段包含完整mp3帧的数据, ts为第一帧的时间戳(毫秒), 之后按每帧的采样数递增; 每帧生成一个音频帧包
+func (m *Mp3Packer) Pack(b []byte, ts uint32) ([]*packet.Packet, error) {
+	frames, n := mp3.SplitFrames(b)
+	if n != len(b) {
+		return nil, errors.New("incomplete mp3 frame")
+	}
+
+	var pkts []*packet.Packet
+	var samples uint64
+
+	for _, frame := range frames {
+		h := frame.Header
+		pts := ts + uint32(samples*1000/uint64(h.SampleRate))
+		samples += uint64(h.SamplesPerFrame)
+
+		soundType := uint8(SoundTypeStereo)
+		if h.Channels == 1 {
+			soundType = SoundTypeMono
+		}
+
+		tag := NewAudioTag(SoundMP3, mp3SoundRate(h.SampleRate), SoundSize16BitSamples, soundType, 0)
+		pkts = append(pkts, newMediaPacket(packet.PktAudio, pts, tag, frame.Data))
+	}
+
+	return pkts, nil
+}
+
+// mp3采样率对应的flv SoundRate, 没有对应值的采样率取相近的值
+func mp3SoundRate(sampleRate int) uint8 {
+	switch {
+	case sampleRate >= 44100:
+		return SoundRate44100Hz
+	case sampleRate >= 22050:
+		return SoundRate22000Hz
+	case sampleRate >= 11025:
+		return SoundRate11000Hz
+	}
+
+	return SoundRate5500Hz
+}
+
+// 根据Tag和裸流数据生成flv数据包, p.Media 指向 p.Data 中的裸流部分
+func newMediaPacket(mediaType int, ts uint32, tag *Tag, media []byte) *packet.Packet {
+	hdr, _ := tag.MarshalMediaTagHeader(mediaType)
+
+	data := make([]byte, 0, len(hdr)+len(media))
+	data = append(data, hdr...)
+	data = append(data, media...)
+
+	return &packet.Packet{
+		Type:      mediaType,
+		TimeStamp: ts,
+		Header:    tag,
+		Data:      data,
+		Media:     data[len(hdr):],
+	}
+}
@@ -0,0 +1,131 @@
+package flv
+
+import (
+	"testing"
+
+	"github.com/moggle-mog/goav/internal/testutil"
+	"github.com/moggle-mog/goav/packet"
+	"github.com/moggle-mog/goav/parser/h264"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testAvcSps = []byte{0x67, 0x4d, 0x00, 0x1e, 0xab, 0x40, 0x5a, 0x12, 0x6c, 0x09, 0x28, 0x28, 0x28, 0x2f, 0x80, 0x00, 0x01, 0xf4, 0x00, 0x00, 0x61, 0xa8, 0x4a}
+	testAvcPps = []byte{0x68, 0xde, 0x31, 0x12}
+)
+
+func TestAvcPacker_Pack(t *testing.T) {
+	at := assert.New(t)
+
+	a := NewAvcPacker()
+	idr := []byte{0x65, 0x88, 0x84}
+	slice := []byte{0x41, 0x9a, 0x02}
+
+	// case1: 收到参数集之前的视频帧被丢弃
+	pkts, err := a.Pack(testutil.JoinAnnexb(slice), 0, 0)
+	at.Nil(err)
+	at.Empty(pkts)
+
+	// case2: 关键帧带参数集, 先输出序列头
+	pkts, err = a.Pack(testutil.JoinAnnexb(testAvcSps, testAvcPps, idr), 40, 80)
+	at.Nil(err)
+	at.Len(pkts, 2)
+
+	seq, _ := h264.MarshalSequenceHeader([][]byte{testAvcSps}, [][]byte{testAvcPps})
+	at.Equal(packet.PktVideo, pkts[0].Type)
+	at.Equal(uint32(40), pkts[0].TimeStamp)
+	at.Equal(append([]byte{0x17, 0x00, 0x00, 0x00, 0x00}, seq...), pkts[0].Data)
+	at.Equal(seq, pkts[0].Media)
+	at.True(pkts[0].Header.(*Tag).IsSeqHdr())
+
+	avcc := append([]byte{0x00, 0x00, 0x00, 0x03}, idr...)
+	at.Equal(append([]byte{0x17, 0x01, 0x00, 0x00, 0x28}, avcc...), pkts[1].Data)
+	at.Equal(avcc, pkts[1].Media)
+	at.Equal(int32(40), pkts[1].Header.(*Tag).CompositionTime())
+
+	// case3: 非关键帧
+	pkts, err = a.Pack(testutil.JoinAnnexb(slice), 80, 80)
+	at.Nil(err)
+	at.Len(pkts, 1)
+	at.Equal(append([]byte{0x27, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x03}, slice...), pkts[0].Data)
+
+	// case4: 输出的数据包可以被解复用
+	d := NewDemuxer()
+	demuxed := &packet.Packet{Type: packet.PktVideo, Data: pkts[0].Data}
+	at.Nil(d.Demux(demuxed))
+	at.True(demuxed.Header.(*Tag).IsInterFrame())
+	at.Equal(pkts[0].Media, demuxed.Media)
+
+	// case5: 不是Annex-b数据
+	_, err = a.Pack(idr, 0, 0)
+	at.NotNil(err)
+}
+
+func TestAacPacker_Pack(t *testing.T) {
+	at := assert.New(t)
+
+	a := NewAacPacker()
+
+	// 2帧 AAC LC, 44100, 双声道
+	adts := []byte{
+		0xff, 0xf1, 0x50, 0x80, 0x01, 0x5f, 0xfc, 0x21, 0x00, 0x49,
+		0xff, 0xf1, 0x50, 0x80, 0x01, 0x3f, 0xfc, 0x21, 0x10,
+	}
+
+	// case1: 先输出序列头, 第二帧的时间戳按1024个采样递增
+	pkts, err := a.Pack(adts, 1000)
+	at.Nil(err)
+	at.Len(pkts, 3)
+
+	at.Equal(packet.PktAudio, pkts[0].Type)
+	at.Equal([]byte{0xaf, 0x00, 0x12, 0x10}, pkts[0].Data)
+	at.Equal([]byte{0x12, 0x10}, pkts[0].Media)
+	at.True(pkts[0].Header.(*Tag).IsAACSeqHdr())
+
+	at.Equal(uint32(1000), pkts[1].TimeStamp)
+	at.Equal([]byte{0xaf, 0x01, 0x21, 0x00, 0x49}, pkts[1].Data)
+	at.Equal(uint32(1023), pkts[2].TimeStamp)
+	at.Equal([]byte{0x21, 0x10}, pkts[2].Media)
+
+	// case2: 编码参数不变, 不再输出序列头
+	pkts, err = a.Pack(adts[:10], 2000)
+	at.Nil(err)
+	at.Len(pkts, 1)
+
+	// case3: 不完整的adts帧
+	_, err = a.Pack(adts[:12], 3000)
+	at.NotNil(err)
+}
+
+func TestMp3Packer_Pack(t *testing.T) {
+	at := assert.New(t)
+
+	m := NewMp3Packer()
+
+	// 2帧 MPEG-1 Layer3, 128kbps, 44100, 单声道, 每帧417字节
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0xc0})
+	data := append(append([]byte{}, frame...), frame...)
+
+	// case1: 每帧一个音频包, 时间戳按1152个采样递增
+	pkts, err := m.Pack(data, 1000)
+	at.Nil(err)
+	at.Len(pkts, 2)
+
+	at.Equal(packet.PktAudio, pkts[0].Type)
+	at.Equal(uint32(1000), pkts[0].TimeStamp)
+	at.Equal(byte(0x2e), pkts[0].Data[0])
+	at.Equal(frame, pkts[0].Media)
+	at.True(pkts[0].Header.(*Tag).IsSoundMP3())
+	at.Equal(uint32(1026), pkts[1].TimeStamp)
+
+	// case2: 输出的数据包可以被解复用
+	d := NewDemuxer()
+	demuxed := &packet.Packet{Type: packet.PktAudio, Data: pkts[1].Data}
+	at.Nil(d.Demux(demuxed))
+	at.Equal(frame, demuxed.Media)
+
+	// case3: 不完整的mp3帧
+	_, err = m.Pack(data[:500], 0)
+	at.NotNil(err)
+}
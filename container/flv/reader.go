@@ -0,0 +1,166 @@
+// Package flv 从io.Reader中读取flv文件或flv流, 解析出数据包
+package flv
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/moggle-mog/goav/packet"
+)
+
+const flvHdrLen = 9
+
+// Reader FLV读取器
+type Reader struct {
+	r        io.Reader
+	demuxer  *Demuxer
+	gotHdr   bool
+	hasVideo bool
+	hasAudio bool
+	tagHdr   []byte
+}
+
+// NewReader FLV读取器
+func NewReader(r io.Reader) *Reader {
+	return &Reader{
+		r:       r,
+		demuxer: NewDemuxer(),
+		tagHdr:  make([]byte, tagHdrLen),
+	}
+}
+
+// HasVideo FLV头中是否声明了视频
+func (r *Reader) HasVideo() bool {
+	return r.hasVideo
+}
+
+// HasAudio FLV头中是否声明了音频
+func (r *Reader) HasAudio() bool {
+	return r.hasAudio
+}
+
+// 读取FLV头和PreviousTagSize0
+func (r *Reader) readHeader() error {
+	hdr := make([]byte, flvHdrLen)
+
+	_, err := io.ReadFull(r.r, hdr)
+	if err != nil {
+		return err
+	}
+
+	// [0:2]签名"FLV", [3]版本号
+	if hdr[0] != 'F' || hdr[1] != 'L' || hdr[2] != 'V' {
+		return errors.New("invalid flv signature")
+	}
+
+	// [4]音视频标识
+	r.hasAudio = hdr[4]&0x04 != 0
+	r.hasVideo = hdr[4]&0x01 != 0
+
+	// [5:8]FLV头的长度, 跳过扩展的头部数据
+	offset := binary.BigEndian.Uint32(hdr[5:9])
+	if offset < flvHdrLen {
+		return fmt.Errorf("invalid flv header length=%d", offset)
+	}
+
+	_, err = io.CopyN(ioutil.Discard, r.r, int64(offset-flvHdrLen))
+	if err != nil {
+		return err
+	}
+
+	// PreviousTagSize0, 总是0
+	_, err = io.ReadFull(r.r, r.tagHdr[0:4])
+	if err != nil {
+		return err
+	}
+
+	r.gotHdr = true
+	return nil
+}
+
+// Read 读取一个FLV Tag, 填充 p.Type, p.TimeStamp, p.StreamID, p.Data, 并解复用出 p.Header 和 p.Media
+// 数据读取完毕时返回 io.EOF
+func (r *Reader) Read(p *packet.Packet) error {
+	if !r.gotHdr {
+		err := r.readHeader()
+		if err != nil {
+			return err
+		}
+	}
+
+	for {
+		_, err := io.ReadFull(r.r, r.tagHdr)
+		if err != nil {
+			return err
+		}
+
+		var tag flvTag
+
+		/* 1字节, [0:1]Reserved, [2]Filter, [3:7]TagType */
+		tag.fType = r.tagHdr[0] & 0x1f
+
+		/* 3字节, DataSize */
+		tag.dataSize = binary.BigEndian.Uint32(r.tagHdr[0:4]) & 0x00ffffff
+
+		/* 3字节时间戳的低24位, 1字节时间戳的高8位 */
+		tag.timeStamp = binary.BigEndian.Uint32(r.tagHdr[4:8])
+		tag.timeStamp = tag.timeStamp>>8 | tag.timeStamp<<24
+
+		/* 3字节, stream id */
+		tag.streamID = binary.BigEndian.Uint32(r.tagHdr[7:11]) & 0x00ffffff
+
+		data := make([]byte, tag.dataSize)
+		_, err = io.ReadFull(r.r, data)
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+
+		// PreviousTagSize
+		_, err = io.ReadFull(r.r, r.tagHdr[0:4])
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+
+		var pktType int
+		switch tag.fType {
+		case packet.TagVideo:
+			pktType = packet.PktVideo
+		case packet.TagAudio:
+			pktType = packet.PktAudio
+		case packet.TagScriptDataAMF0:
+			pktType = packet.PktMetadata
+		default:
+			// 跳过不认识的Tag
+			continue
+		}
+
+		*p = packet.Packet{
+			Type:      pktType,
+			TimeStamp: tag.timeStamp,
+			StreamID:  tag.streamID,
+			Data:      data,
+		}
+
+		err = r.demuxer.Demux(p)
+		if err != nil {
+			return err
+		}
+
+		if t, ok := p.Header.(*Tag); ok {
+			t.flv = tag
+		}
+
+		return nil
+	}
+}
+
+// Tag读取到一半时遇到的EOF, 应视为数据不完整
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,82 @@
+package flv
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/moggle-mog/goav/amf"
+	"github.com/moggle-mog/goav/packet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReader_Read(t *testing.T) {
+	at := assert.New(t)
+
+	buf := bytes.NewBuffer(nil)
+	m := NewMixer(buf)
+
+	at.Nil(m.SaveMetadata(amf.Object{
+		"Provider": "test provider",
+	}))
+	at.Nil(m.SaveAVCHeader(&packet.Packet{
+		Type: packet.PktVideo,
+		Data: []byte{0x17, 0x00, 0x00, 0x00, 0x00, 0x01, 0x4d, 0x00, 0x1e},
+	}))
+	at.Nil(m.SetFlvHeader())
+
+	// 时间戳超过24位, 需要使用扩展时间戳
+	at.Nil(m.Mux(&packet.Packet{
+		Type: packet.PktAudio,
+		Data: []byte{0xaf, 0x01, 0x21, 0x00, 0x49},
+	}, 0x01020304))
+
+	r := NewReader(buf)
+
+	// case1: 元数据
+	var p packet.Packet
+	at.Nil(r.Read(&p))
+	at.True(r.HasVideo())
+	at.False(r.HasAudio())
+	at.Equal(packet.PktMetadata, p.Type)
+	at.Equal(uint32(0), p.TimeStamp)
+
+	// case2: 视频序列头
+	at.Nil(r.Read(&p))
+	at.Equal(packet.PktVideo, p.Type)
+	at.Equal([]byte{0x01, 0x4d, 0x00, 0x1e}, p.Media)
+
+	vh := p.Header.(packet.VideoPacketHeader)
+	at.True(vh.IsCodecAvc())
+	at.True(vh.IsSeqHdr())
+
+	// case3: 音频数据
+	at.Nil(r.Read(&p))
+	at.Equal(packet.PktAudio, p.Type)
+	at.Equal(uint32(0x01020304), p.TimeStamp)
+	at.Equal([]byte{0x21, 0x00, 0x49}, p.Media)
+
+	ah := p.Header.(packet.AudioPacketHeader)
+	at.True(ah.IsSoundAAC())
+	at.False(ah.IsAACSeqHdr())
+
+	// case4: 读取结束
+	at.Equal(io.EOF, r.Read(&p))
+}
+
+func TestReader_ReadException(t *testing.T) {
+	at := assert.New(t)
+
+	// case1: 签名错误
+	r := NewReader(bytes.NewReader([]byte{0x46, 0x4c, 0x58, 0x01, 0x05, 0x00, 0x00, 0x00, 0x09, 0, 0, 0, 0}))
+
+	var p packet.Packet
+	at.NotNil(r.Read(&p))
+
+	// case2: Tag数据不完整
+	r = NewReader(bytes.NewReader([]byte{
+		0x46, 0x4c, 0x56, 0x01, 0x05, 0x00, 0x00, 0x00, 0x09, 0, 0, 0, 0,
+		0x08, 0x00, 0x00, 0x05, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xaf,
+	}))
+	at.Equal(io.ErrUnexpectedEOF, r.Read(&p))
+}
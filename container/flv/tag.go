@@ -2,6 +2,7 @@
 package flv
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 
@@ -92,6 +93,7 @@ type mediaTag struct {
 		5: On2 VP6 with alpha channel
 		6: Screen video version 2
 		7: AVC
+		12: HEVC(非标准扩展)
 	*/
 	codecID uint8
 
@@ -103,6 +105,35 @@ type mediaTag struct {
 	avcType uint8
 
 	compositionTime int32
+
+	/*
+		IsExHeader: UB[1]
+		Enhanced RTMP/FLV 扩展视频头标识, 置位时 frameType 只占3位
+	*/
+	isExHeader bool
+
+	/*
+		PacketType: UB[4]
+		0: SequenceStart
+		1: CodedFrames
+		2: SequenceEnd
+		3: CodedFramesX
+		4: Metadata
+		5: MPEG2TSSequenceStart
+	*/
+	packetType uint8
+
+	/*
+		VideoFourCC: UI32
+		avc1, hvc1, av01, vp09
+	*/
+	fourCC uint32
+
+	/*
+		VideoCommand: UI8
+		frameType为5且packetType不为Metadata时存在
+	*/
+	videoCommand uint8
 }
 
 // Tag Flv Body
@@ -111,12 +142,84 @@ type Tag struct {
 	media mediaTag
 }
 
+// NewVideoTag [视频]新建传统视频Tag, 用于封装flv视频包
+func NewVideoTag(frameType, codecID, avcType uint8, compositionTime int32) *Tag {
+	return &Tag{
+		media: mediaTag{
+			frameType:       frameType,
+			codecID:         codecID,
+			avcType:         avcType,
+			compositionTime: compositionTime,
+		},
+	}
+}
+
+// NewExVideoTag [视频]新建 Enhanced FLV 视频Tag, 用于封装flv视频包
+func NewExVideoTag(frameType, packetType uint8, fourCC uint32, compositionTime int32) *Tag {
+	return &Tag{
+		media: mediaTag{
+			isExHeader:      true,
+			frameType:       frameType,
+			packetType:      packetType,
+			fourCC:          fourCC,
+			codecID:         fourCCToCodecID(fourCC),
+			compositionTime: compositionTime,
+		},
+	}
+}
+
+// NewAudioTag [音频]新建音频Tag, 用于封装flv音频包
+func NewAudioTag(soundFormat, soundRate, soundSize, soundType, aacType uint8) *Tag {
+	return &Tag{
+		media: mediaTag{
+			soundFormat: soundFormat,
+			soundRate:   soundRate,
+			soundSize:   soundSize,
+			soundType:   soundType,
+			aacType:     aacType,
+		},
+	}
+}
+
+// 将 Enhanced FLV 的 FourCC 映射为传统的 CodecID, 无法映射时返回0
+func fourCCToCodecID(fourCC uint32) uint8 {
+	switch fourCC {
+	case FourCCAvc1:
+		return AvcH264
+	case FourCCHvc1:
+		return HevcH265
+	}
+
+	return 0
+}
+
+// 读取有符号的24位整数
+func readSI24(b []byte) int32 {
+	v := int32(b[0])<<16 | int32(b[1])<<8 | int32(b[2])
+	if v&0x800000 != 0 {
+		v -= 0x1000000
+	}
+	return v
+}
+
+// 写入有符号的24位整数
+func writeSI24(b []byte, v int32) {
+	b[0] = byte(v >> 16)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v)
+}
+
 // parseVideoHeader [视频]解析 Flv包体 内的 Tag数据头部, 将 Tag数据头部 赋值给 Tag媒体结构, 并返回已处理的字节数
 func (tag *Tag) parseVideoHeader(b []byte) (int, error) {
 	if len(b) < 5 {
 		return 0, errors.New("incomplete video header, len(b) < 5")
 	}
 
+	// Enhanced FLV 扩展视频头
+	if b[0]&0x80 != 0 {
+		return tag.parseExVideoHeader(b)
+	}
+
 	var n int
 
 	// [1] 帧类型 和 编码ID
@@ -131,15 +234,51 @@ func (tag *Tag) parseVideoHeader(b []byte) (int, error) {
 		tag.media.avcType = b[1]
 
 		// [3:5] 时间戳
-		for i := 2; i < 5; i++ {
-			tag.media.compositionTime = tag.media.compositionTime<<8 + int32(b[i])
-		}
+		tag.media.compositionTime = readSI24(b[2:5])
 		n += 4
 	}
 
 	return n, nil
 }
 
+// parseExVideoHeader [视频]解析 Enhanced FLV 的 ExVideoTagHeader, 并返回已处理的字节数
+func (tag *Tag) parseExVideoHeader(b []byte) (int, error) {
+	var n int
+
+	// [1] 扩展头标识, 帧类型 和 包类型
+	flags := b[0]
+	tag.media.isExHeader = true
+	tag.media.frameType = (flags >> 4) & 0x7
+	tag.media.packetType = flags & 0xf
+	n++
+
+	// 命令帧不携带FourCC
+	if tag.media.frameType == CommandFrame && tag.media.packetType != ExMetadata {
+		tag.media.videoCommand = b[1]
+		n++
+
+		return n, nil
+	}
+
+	// [2:5] FourCC
+	tag.media.fourCC = binary.BigEndian.Uint32(b[1:5])
+	tag.media.codecID = fourCCToCodecID(tag.media.fourCC)
+	n += 4
+
+	// avc1和hvc1的CodedFrames携带CompositionTime
+	if tag.media.packetType == ExCodedFrames && tag.media.codecID != 0 {
+		if len(b) < 8 {
+			return 0, errors.New("incomplete ex video header, len(b) < 8")
+		}
+
+		// [6:8] 时间戳
+		tag.media.compositionTime = readSI24(b[5:8])
+		n += 3
+	}
+
+	return n, nil
+}
+
 // parseAudioHeader [音频]解析 Flv包体 内的 Tag数据头部, 将 Tag数据头部 赋值给 Tag媒体结构, 并返回已处理的字节数
 func (tag *Tag) parseAudioHeader(b []byte) (int, error) {
 	if len(b) < 2 {
@@ -200,6 +339,37 @@ func (tag *Tag) IsCodecAvc() bool {
 	return tag.media.codecID == AvcH264
 }
 
+// IsCodecHevc [视频:h265]判断解码器是不是H265
+func (tag *Tag) IsCodecHevc() bool {
+	return tag.media.codecID == HevcH265
+}
+
+// IsExHeader [视频]判断是否是 Enhanced FLV 扩展视频头
+func (tag *Tag) IsExHeader() bool {
+	return tag.media.isExHeader
+}
+
+// PacketType [视频]返回 Enhanced FLV 的包类型, 仅在扩展视频头中有效
+func (tag *Tag) PacketType() uint8 {
+	return tag.media.packetType
+}
+
+// FourCC [视频]返回视频编码的FourCC, 传统视频头中的H264和H265会映射为avc1和hvc1
+func (tag *Tag) FourCC() uint32 {
+	if tag.media.isExHeader {
+		return tag.media.fourCC
+	}
+
+	switch tag.media.codecID {
+	case AvcH264:
+		return FourCCAvc1
+	case HevcH265:
+		return FourCCHvc1
+	}
+
+	return 0
+}
+
 // IsKeyFrame [视频:h264]判断数据是否是关键帧
 func (tag *Tag) IsKeyFrame() bool {
 	return tag.media.frameType == KeyFrame
@@ -212,11 +382,17 @@ func (tag *Tag) IsInterFrame() bool {
 
 // IsSeqHdr [视频:h264]判断数据是否是关键帧同时还是包序列的头
 func (tag *Tag) IsSeqHdr() bool {
+	if tag.media.isExHeader {
+		return tag.media.packetType == ExSequenceStart
+	}
 	return tag.media.frameType == KeyFrame && tag.media.avcType == AvcSeqHdr
 }
 
 // IsEndOfSeq [视频:h264]判断数据是否是关键帧同时还是包序列的尾
 func (tag *Tag) IsEndOfSeq() bool {
+	if tag.media.isExHeader {
+		return tag.media.packetType == ExSequenceEnd
+	}
 	return tag.media.frameType == KeyFrame && tag.media.avcType == AvcEndOfSeq
 }
 
@@ -227,6 +403,12 @@ func (tag *Tag) CodecID() uint8 {
 
 // CompositionTime [视频:h264]返回 CompositionTime
 func (tag *Tag) CompositionTime() int32 {
+	if tag.media.isExHeader {
+		if tag.media.packetType == ExCodedFrames {
+			return tag.media.compositionTime
+		}
+		return 0
+	}
 	if tag.media.avcType == AvcNalu {
 		return tag.media.compositionTime
 	}
@@ -247,3 +429,64 @@ func (tag *Tag) ParseMediaTagHeader(b []byte, mediaType int) (int, error) {
 
 	return 0, errors.New("unexpected media type")
 }
+
+// MarshalMediaTagHeader [音视频]将 Tag.media 编码为 Tag Data 的头部数据, 是 ParseMediaTagHeader 的逆过程
+func (tag *Tag) MarshalMediaTagHeader(mediaType int) ([]byte, error) {
+	switch mediaType {
+	case packet.PktVideo:
+		return tag.marshalVideoHeader(), nil
+	case packet.PktAudio:
+		return tag.marshalAudioHeader()
+	case packet.PktMetadata:
+		return nil, nil
+	}
+
+	return nil, errors.New("unexpected media type")
+}
+
+// [视频]编码视频头部数据
+func (tag *Tag) marshalVideoHeader() []byte {
+	if tag.media.isExHeader {
+		b := []byte{0x80 | (tag.media.frameType&0x7)<<4 | tag.media.packetType&0xf}
+
+		// 命令帧不携带FourCC
+		if tag.media.frameType == CommandFrame && tag.media.packetType != ExMetadata {
+			return append(b, tag.media.videoCommand)
+		}
+
+		b = append(b, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(b[1:5], tag.media.fourCC)
+
+		if tag.media.packetType == ExCodedFrames && tag.media.codecID != 0 {
+			b = append(b, 0, 0, 0)
+			writeSI24(b[5:8], tag.media.compositionTime)
+		}
+
+		return b
+	}
+
+	b := []byte{tag.media.frameType<<4 | tag.media.codecID&0xf}
+	if tag.media.frameType == InterFrame || tag.media.frameType == KeyFrame {
+		b = append(b, tag.media.avcType, 0, 0, 0)
+		writeSI24(b[2:5], tag.media.compositionTime)
+	}
+
+	return b
+}
+
+// [音频]编码音频头部数据
+func (tag *Tag) marshalAudioHeader() ([]byte, error) {
+	flags := tag.media.soundFormat<<4 |
+		(tag.media.soundRate&0x3)<<2 |
+		(tag.media.soundSize&0x1)<<1 |
+		tag.media.soundType&0x1
+
+	switch tag.media.soundFormat {
+	case SoundAAC:
+		return []byte{flags, tag.media.aacType}, nil
+	case SoundMP3:
+		return []byte{flags}, nil
+	}
+
+	return nil, fmt.Errorf("unexpected sound format number: %d", tag.media.soundFormat)
+}
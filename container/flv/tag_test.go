@@ -67,3 +67,100 @@ func TestTag_ParseAudio(t *testing.T) {
 	at.False(tag.IsAACSeqHdr())
 	at.Equal(byte(1), tag.AACType())
 }
+
+func TestTag_ParseExVideo(t *testing.T) {
+	at := assert.New(t)
+
+	// case1: hevc 序列头
+	var tag Tag
+
+	v := []byte{
+		0x90, 0x68, 0x76, 0x63, 0x31, 0x01,
+	}
+
+	n, err := tag.ParseMediaTagHeader(v, packet.PktVideo)
+	at.Nil(err)
+	at.Equal(5, n)
+
+	at.True(tag.IsExHeader())
+	at.True(tag.IsCodecHevc())
+	at.False(tag.IsCodecAvc())
+	at.True(tag.IsKeyFrame())
+	at.True(tag.IsSeqHdr())
+	at.Equal(uint8(ExSequenceStart), tag.PacketType())
+	at.Equal(uint32(FourCCHvc1), tag.FourCC())
+
+	// case2: hevc 带CompositionTime的视频帧
+	tag = Tag{}
+	v = []byte{
+		0xa1, 0x68, 0x76, 0x63, 0x31, 0xff, 0xff, 0xd8, 0x01,
+	}
+
+	n, err = tag.ParseMediaTagHeader(v, packet.PktVideo)
+	at.Nil(err)
+	at.Equal(8, n)
+
+	at.True(tag.IsInterFrame())
+	at.False(tag.IsSeqHdr())
+	at.Equal(int32(-40), tag.CompositionTime())
+
+	// case3: av1 视频帧没有CompositionTime
+	tag = Tag{}
+	v = []byte{
+		0x91, 0x61, 0x76, 0x30, 0x31, 0x12,
+	}
+
+	n, err = tag.ParseMediaTagHeader(v, packet.PktVideo)
+	at.Nil(err)
+	at.Equal(5, n)
+
+	at.Equal(uint32(FourCCAv01), tag.FourCC())
+	at.Equal(uint8(0), tag.CodecID())
+	at.Equal(int32(0), tag.CompositionTime())
+
+	// case4: vp9 序列结束
+	tag = Tag{}
+	v = []byte{
+		0x92, 0x76, 0x70, 0x30, 0x39,
+	}
+
+	n, err = tag.ParseMediaTagHeader(v, packet.PktVideo)
+	at.Nil(err)
+	at.Equal(5, n)
+	at.True(tag.IsEndOfSeq())
+
+	// case5: CompositionTime不完整
+	tag = Tag{}
+	v = []byte{
+		0x91, 0x68, 0x76, 0x63, 0x31, 0x00,
+	}
+
+	_, err = tag.ParseMediaTagHeader(v, packet.PktVideo)
+	at.NotNil(err)
+}
+
+func TestTag_MarshalMediaTagHeader(t *testing.T) {
+	at := assert.New(t)
+
+	// case1: 传统视频头
+	b, err := NewVideoTag(KeyFrame, AvcH264, AvcNalu, 40).MarshalMediaTagHeader(packet.PktVideo)
+	at.Nil(err)
+	at.Equal([]byte{0x17, 0x01, 0x00, 0x00, 0x28}, b)
+
+	// case2: 扩展视频头
+	b, err = NewExVideoTag(InterFrame, ExCodedFrames, FourCCHvc1, -40).MarshalMediaTagHeader(packet.PktVideo)
+	at.Nil(err)
+	at.Equal([]byte{0xa1, 0x68, 0x76, 0x63, 0x31, 0xff, 0xff, 0xd8}, b)
+
+	b, err = NewExVideoTag(KeyFrame, ExCodedFramesX, FourCCVp09, 0).MarshalMediaTagHeader(packet.PktVideo)
+	at.Nil(err)
+	at.Equal([]byte{0x93, 0x76, 0x70, 0x30, 0x39}, b)
+
+	// case3: 音频头
+	b, err = NewAudioTag(SoundAAC, SoundRate44100Hz, SoundSize16BitSamples, SoundTypeStereo, AacRaw).MarshalMediaTagHeader(packet.PktAudio)
+	at.Nil(err)
+	at.Equal([]byte{0xaf, 0x01}, b)
+
+	_, err = NewAudioTag(SoundSpeex, 0, 0, 0, 0).MarshalMediaTagHeader(packet.PktAudio)
+	at.NotNil(err)
+}
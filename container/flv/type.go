@@ -1,5 +1,7 @@
 package flv
 
+import "github.com/moggle-mog/goav/packet"
+
 // AVC type
 const (
 	// AvcSeqHdr AVC sequence header(1)
@@ -31,6 +33,34 @@ const (
 	KeyFrame = iota + 1
 	// InterFrame 分片帧(2)
 	InterFrame
+	// DisposableInterFrame 可丢弃的分片帧(3)
+	DisposableInterFrame
+	// GeneratedKeyFrame 服务端生成的关键帧(4)
+	GeneratedKeyFrame
+	// CommandFrame 视频信息或命令帧(5)
+	CommandFrame
+)
+
+// Enhanced FLV 视频包类型(ExVideoTagHeader中的PacketType), 定义在 packet 中供解析器使用
+const (
+	ExSequenceStart        = packet.ExSequenceStart
+	ExCodedFrames          = packet.ExCodedFrames
+	ExSequenceEnd          = packet.ExSequenceEnd
+	ExCodedFramesX         = packet.ExCodedFramesX
+	ExMetadata             = packet.ExMetadata
+	ExMPEG2TSSequenceStart = packet.ExMPEG2TSSequenceStart
+)
+
+// Enhanced FLV 视频编码的FourCC
+const (
+	// FourCCAvc1 'avc1'
+	FourCCAvc1 = 0x61766331
+	// FourCCHvc1 'hvc1'
+	FourCCHvc1 = 0x68766331
+	// FourCCAv01 'av01'
+	FourCCAv01 = 0x61763031
+	// FourCCVp09 'vp09'
+	FourCCVp09 = 0x76703039
 )
 
 // Meta Data
@@ -44,6 +74,9 @@ const (
 // AvcH264 H264的CodecID
 const AvcH264 = 7
 
+// HevcH265 H265的CodecID(非标准扩展, 国内CDN普遍使用)
+const HevcH265 = 12
+
 // Sound
 const (
 	SoundLinearPcmPlatformEndian = iota
@@ -0,0 +1,433 @@
+// Package ts 从io.Reader中读取TS流, 解析PAT/PMT, 按PID重组PES, 输出音视频数据包
+package ts
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/moggle-mog/goav/container/ts/table"
+	"github.com/moggle-mog/goav/packet"
+	"github.com/moggle-mog/goav/parser/h264"
+)
+
+const (
+	syncByte = 0x47
+	patPID   = 0x0000
+)
+
+// PSI表类型(table_id)
+const (
+	tableIDPat = 0x00
+	tableIDPmt = 0x02
+)
+
+// PAT/PMT分段的最大长度(section_length 不超过1021)
+const maxPsiSectionLen = 3 + 1021
+
+// PSI分段的重组缓存
+type section struct {
+	buf []byte
+}
+
+// PES的重组缓存
+type esStream struct {
+	header    ESHeader
+	buf       []byte
+	length    int  // PES包的总长度(含6字节固定头), 0 表示长度不定
+	started   bool // 是否收到了PES的起始包
+	randomAcc bool // 起始包带有随机接入标识
+	cc        byte // 上一个TS包的包递增计数器
+	ccValid   bool // 是否收到过带负载的TS包
+}
+
+// 检查包递增计数器, 返回false时丢弃重复的包; 计数器跳变(丢包)时丢弃未完成的PES
+func (s *esStream) checkCc(cc byte, discontinuity bool) bool {
+	last, valid := s.cc, s.ccValid
+	s.cc, s.ccValid = cc, true
+
+	if !valid || discontinuity {
+		return true
+	}
+	if cc == last {
+		return false
+	}
+
+	if cc != (last+1)&0x0f {
+		s.started = false
+		s.buf = s.buf[:0]
+	}
+	return true
+}
+
+// Demuxer TS解复用器, 支持H264, H265, AAC和mp3
+// 损坏的TS包, 分段和PES被丢弃, 之后的数据继续解析, 适用于SRT/UDP等可能丢包的输入
+type Demuxer struct {
+	r        io.Reader
+	pkt      [tsPacketLen]byte
+	pmtPIDs  map[uint16]bool      // PAT中的PMT PID
+	sections map[uint16]*section  // PID -> PSI分段
+	streams  map[uint16]*esStream // PID -> 基本流
+	queue    []*packet.Packet     // 已重组完成的数据包
+	eof      error                // 读取结束时的错误
+}
+
+// NewDemuxer TS解复用器
+func NewDemuxer(r io.Reader) *Demuxer {
+	return &Demuxer{
+		r:        r,
+		pmtPIDs:  make(map[uint16]bool),
+		sections: make(map[uint16]*section),
+		streams:  make(map[uint16]*esStream),
+	}
+}
+
+// Read 读取一个音视频数据包, p.Header 为 *ESHeader, p.Media 为基本流数据
+// 数据包只包含基本流, 不是flv tag: p.Data 和 p.TimeStamp 不设置, 时间戳为 ESHeader 中的33位PTS/DTS
+// 需要flv数据包时使用 flv.AvcPacker, flv.AacPacker 等重新打包
+// 读取结束时返回 io.EOF, 最后一个TS包不完整时返回 io.ErrUnexpectedEOF
+func (d *Demuxer) Read(p *packet.Packet) error {
+	for len(d.queue) == 0 {
+		if d.eof != nil {
+			return d.eof
+		}
+
+		err := d.readPacket()
+		if err != nil {
+			if err != io.EOF && err != io.ErrUnexpectedEOF {
+				return err
+			}
+
+			// 输出长度不定的PES
+			d.eof = err
+			d.flush()
+		}
+	}
+
+	*p = *d.queue[0]
+	d.queue = d.queue[1:]
+
+	return nil
+}
+
+// 读取并处理一个TS包
+func (d *Demuxer) readPacket() error {
+	// 同步字节
+	for {
+		_, err := io.ReadFull(d.r, d.pkt[:1])
+		if err != nil {
+			return err
+		}
+		if d.pkt[0] == syncByte {
+			break
+		}
+	}
+
+	_, err := io.ReadFull(d.r, d.pkt[1:])
+	if err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	d.handlePacket(d.pkt[:])
+	return nil
+}
+
+// 解析TS包头, 按PID分发; 自适应域长度错误的包被丢弃
+func (d *Demuxer) handlePacket(b []byte) {
+	// transport_error_indicator
+	if b[1]&0x80 != 0 {
+		return
+	}
+
+	pusi := b[1]&0x40 != 0
+	pid := uint16(b[1]&0x1f)<<8 | uint16(b[2])
+	afc := (b[3] >> 4) & 0x3
+	cc := b[3] & 0x0f
+
+	i := 4
+	randomAccess := false
+	discontinuity := false
+
+	// 自适应域
+	if afc&0x2 != 0 {
+		afLen := int(b[4])
+		if 5+afLen > tsPacketLen {
+			return
+		}
+		if afLen > 0 {
+			discontinuity = b[5]&0x80 != 0
+			randomAccess = b[5]&0x40 != 0
+		}
+		i += 1 + afLen
+	}
+
+	// 不含负载
+	if afc&0x1 == 0 || i >= tsPacketLen {
+		return
+	}
+	payload := b[i:]
+
+	if pid == patPID || d.pmtPIDs[pid] {
+		d.handleSection(pid, pusi, payload)
+		return
+	}
+
+	s, ok := d.streams[pid]
+	if ok && s.checkCc(cc, discontinuity) {
+		d.handlePes(s, pusi, randomAccess, payload)
+	}
+}
+
+// 重组PSI分段, 一个TS包中可以包含多个分段; pointer_field 错误时丢弃未完成的分段
+func (d *Demuxer) handleSection(pid uint16, pusi bool, payload []byte) {
+	s, ok := d.sections[pid]
+	if !ok {
+		s = &section{}
+		d.sections[pid] = s
+	}
+
+	if !pusi {
+		// 没有收到分段的起始包
+		if len(s.buf) == 0 {
+			return
+		}
+
+		d.appendSection(pid, s, payload)
+		return
+	}
+
+	pointer := int(payload[0])
+	if 1+pointer > len(payload) {
+		s.buf = s.buf[:0]
+		return
+	}
+
+	// pointer_field 之后的数据属于上一个分段
+	if len(s.buf) > 0 {
+		d.appendSection(pid, s, payload[1:1+pointer])
+	}
+
+	s.buf = s.buf[:0]
+	d.appendSection(pid, s, payload[1+pointer:])
+}
+
+// 向分段中追加数据, 分段完整时解析; 遇到填充字节时之后没有新的分段
+// 损坏的分段被丢弃, 等待下一个分段的起始包重新同步
+func (d *Demuxer) appendSection(pid uint16, s *section, b []byte) {
+	s.buf = append(s.buf, b...)
+
+	for len(s.buf) >= 3 {
+		if s.buf[0] == 0xff {
+			s.buf = s.buf[:0]
+			return
+		}
+
+		length := 3 + (int(s.buf[1]&0x0f)<<8 | int(s.buf[2]))
+		if length > maxPsiSectionLen {
+			s.buf = s.buf[:0]
+			return
+		}
+		if len(s.buf) < length {
+			return
+		}
+
+		err := d.parseSection(pid, s.buf[:length])
+		if err != nil {
+			s.buf = s.buf[:0]
+			return
+		}
+
+		s.buf = append(s.buf[:0], s.buf[length:]...)
+	}
+}
+
+// 校验CRC并解析PAT或PMT
+func (d *Demuxer) parseSection(pid uint16, sec []byte) error {
+	if len(sec) < 12 {
+		return errors.New("incomplete psi section")
+	}
+
+	crc := uint32(sec[len(sec)-4])<<24 | uint32(sec[len(sec)-3])<<16 | uint32(sec[len(sec)-2])<<8 | uint32(sec[len(sec)-1])
+	if GenerateCrc32(sec[:len(sec)-4]) != crc {
+		return fmt.Errorf("psi section crc mismatch, pid=%d", pid)
+	}
+
+	// current_next_indicator 为0时表示尚未生效
+	if sec[5]&0x1 == 0 {
+		return nil
+	}
+
+	switch {
+	case pid == patPID && sec[0] == tableIDPat:
+		d.parsePat(sec)
+	case sec[0] == tableIDPmt:
+		d.parsePmt(sec)
+	}
+
+	return nil
+}
+
+// 解析PAT, 记录PMT的PID
+func (d *Demuxer) parsePat(sec []byte) {
+	for i := 8; i+4 <= len(sec)-4; i += 4 {
+		programNumber := uint16(sec[i])<<8 | uint16(sec[i+1])
+		pid := uint16(sec[i+2]&0x1f)<<8 | uint16(sec[i+3])
+
+		// program_number 为0时是NIT
+		if programNumber != 0 {
+			d.pmtPIDs[pid] = true
+		}
+	}
+}
+
+// 解析PMT, 记录支持的基本流
+func (d *Demuxer) parsePmt(sec []byte) {
+	programInfoLen := int(sec[10]&0x0f)<<8 | int(sec[11])
+
+	for i := 12 + programInfoLen; i+5 <= len(sec)-4; {
+		streamType := sec[i]
+		pid := uint16(sec[i+1]&0x1f)<<8 | uint16(sec[i+2])
+		esInfoLen := int(sec[i+3]&0x0f)<<8 | int(sec[i+4])
+		i += 5 + esInfoLen
+
+		switch streamType {
+		case table.StreamTypeAvc, table.StreamTypeHevc, table.StreamTypeAac,
+			table.StreamTypeMpeg1Audio, table.StreamTypeMpeg2Audio:
+		default:
+			continue
+		}
+
+		s, ok := d.streams[pid]
+		if ok && s.header.StreamType == streamType {
+			continue
+		}
+
+		d.streams[pid] = &esStream{
+			header: ESHeader{
+				PID:        pid,
+				StreamType: streamType,
+			},
+		}
+	}
+}
+
+// 按PID重组PES
+func (d *Demuxer) handlePes(s *esStream, pusi, randomAccess bool, payload []byte) {
+	if pusi {
+		// 新的PES开始, 输出之前长度不定的PES
+		d.emit(s)
+
+		s.started = true
+		s.randomAcc = randomAccess
+		s.buf = append(s.buf[:0], payload...)
+		s.length = 0
+		if len(payload) >= 6 {
+			length := int(payload[4])<<8 | int(payload[5])
+			if length > 0 {
+				s.length = 6 + length
+			}
+		}
+	} else if s.started {
+		s.buf = append(s.buf, payload...)
+	}
+
+	// 长度确定的PES收齐后立即输出
+	if s.started && s.length > 0 && len(s.buf) >= s.length {
+		s.buf = s.buf[:s.length]
+		d.emit(s)
+	}
+}
+
+// 输出全部未完成的PES
+func (d *Demuxer) flush() {
+	for _, s := range d.streams {
+		d.emit(s)
+	}
+}
+
+// 解析PES头, 生成数据包
+func (d *Demuxer) emit(s *esStream) {
+	if !s.started {
+		return
+	}
+	s.started = false
+
+	// 长度确定但没有收齐的PES(中间丢包)
+	if s.length > 0 && len(s.buf) < s.length {
+		return
+	}
+
+	b := s.buf
+	if len(b) < 9 || b[0] != 0x00 || b[1] != 0x00 || b[2] != 0x01 {
+		return
+	}
+
+	flags := b[7] >> 6
+	hdrLen := 9 + int(b[8])
+	if hdrLen > len(b) {
+		return
+	}
+
+	// 没有时间戳的PES(HasTimestamp 为false), 由使用方按上一个包推算
+	h := s.header
+	switch flags {
+	case 0x2:
+		if len(b) < 14 {
+			return
+		}
+		h.PTS = decodeTs(b[9:])
+		h.DTS = h.PTS
+		h.HasTimestamp = true
+	case 0x3:
+		if len(b) < 19 {
+			return
+		}
+		h.PTS = decodeTs(b[9:])
+		h.DTS = decodeTs(b[14:])
+		h.HasTimestamp = true
+	}
+
+	media := make([]byte, len(b)-hdrLen)
+	copy(media, b[hdrLen:])
+
+	p := &packet.Packet{
+		Media: media,
+	}
+
+	if h.IsCodecAvc() || h.IsCodecHevc() {
+		p.Type = packet.PktVideo
+		h.KeyFrame = s.randomAcc || isKeyFrame(media, h.IsCodecHevc())
+	} else {
+		p.Type = packet.PktAudio
+	}
+
+	p.Header = &h
+	d.queue = append(d.queue, p)
+}
+
+// 从PES头中解码33位时间戳
+func decodeTs(b []byte) int64 {
+	return int64(b[0]>>1&0x07)<<30 | int64(b[1])<<22 | int64(b[2]>>1)<<15 | int64(b[3])<<7 | int64(b[4]>>1)
+}
+
+// 判断Annex-b数据中是否包含IDR(H264)或IRAP(H265)
+func isKeyFrame(b []byte, hevc bool) bool {
+	for _, nalu := range h264.SplitAnnexb(b) {
+		if hevc {
+			nalType := (nalu[0] >> 1) & 0x3f
+			if nalType >= 16 && nalType <= 23 {
+				return true
+			}
+			continue
+		}
+
+		if nalu[0]&0x1f == 5 {
+			return true
+		}
+	}
+
+	return false
+}
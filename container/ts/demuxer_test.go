@@ -0,0 +1,272 @@
+package ts
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/moggle-mog/goav/container/flv"
+	"github.com/moggle-mog/goav/container/ts/table"
+	"github.com/moggle-mog/goav/packet"
+	"github.com/stretchr/testify/assert"
+)
+
+// 生成一个TS包, 负载不足184字节时使用自适应域填充
+func testTsPacket(pid uint16, pusi bool, payload []byte) []byte {
+	b := []byte{0x47, byte(pid>>8) & 0x1f, byte(pid), 0x10}
+	if pusi {
+		b[1] |= 0x40
+	}
+
+	if len(payload) < tsDefaultDataLen {
+		b[3] |= 0x20
+		stuff := make([]byte, tsDefaultDataLen-len(payload))
+		stuff[0] = byte(len(stuff) - 1)
+		for i := 2; i < len(stuff); i++ {
+			stuff[i] = 0xff
+		}
+		b = append(b, stuff...)
+	}
+
+	return append(b, payload...)
+}
+
+func TestDemuxer_Read(t *testing.T) {
+	at := assert.New(t)
+
+	m := NewMuxer()
+	buf := bytes.NewBuffer([]byte{0x00, 0x01, 0x02})
+
+	buf.Write(m.PAT())
+	buf.Write(m.PMT(packet.PktVideo, packet.PktAudio))
+
+	// 跨多个TS包的H264关键帧
+	idr := make([]byte, 500)
+	copy(idr, []byte{0x00, 0x00, 0x00, 0x01, 0x09, 0xf0, 0x00, 0x00, 0x00, 0x01, 0x65, 0x88})
+	for i := 12; i < len(idr); i++ {
+		idr[i] = byte(i)
+	}
+
+	video := &packet.Packet{
+		Type:   packet.PktVideo,
+		Header: flv.NewVideoTag(flv.KeyFrame, flv.AvcH264, flv.AvcNalu, 0),
+		Media:  idr,
+	}
+	at.Nil(m.Mux(video, 40*avcHZ, 80*avcHZ, buf))
+
+	adts := []byte{0xff, 0xf1, 0x50, 0x80, 0x01, 0x3f, 0xfc, 0x21, 0x10}
+	audio := &packet.Packet{
+		Type:  packet.PktAudio,
+		Media: adts,
+	}
+	at.Nil(m.Mux(audio, 50*avcHZ, 50*avcHZ, buf))
+
+	d := NewDemuxer(buf)
+
+	// case1: 视频
+	var p packet.Packet
+	at.Nil(d.Read(&p))
+	at.Equal(packet.PktVideo, p.Type)
+	at.Equal(int64(40*avcHZ), p.Header.(*ESHeader).DTS)
+	at.True(p.Header.(*ESHeader).HasTimestamp)
+	at.Equal(idr, p.Media)
+	at.Nil(p.Data)
+	at.Zero(p.TimeStamp)
+
+	vh := p.Header.(packet.VideoPacketHeader)
+	at.True(vh.IsKeyFrame())
+	at.True(vh.IsCodecAvc())
+	at.Equal(int32(40), vh.CompositionTime())
+	at.Equal(uint8(flv.AvcH264), vh.CodecID())
+
+	// case2: 音频
+	at.Nil(d.Read(&p))
+	at.Equal(packet.PktAudio, p.Type)
+	at.Equal(int64(50*avcHZ), p.Header.(*ESHeader).DTS)
+	at.Equal(adts, p.Media)
+
+	ah := p.Header.(packet.AudioPacketHeader)
+	at.True(ah.IsSoundAAC())
+	at.Equal(uint8(flv.AacRaw), ah.AACType())
+
+	// case3: 读取结束
+	at.Equal(io.EOF, d.Read(&p))
+	at.Equal(io.EOF, d.Read(&p))
+}
+
+func TestDemuxer_ShortKeyFrame(t *testing.T) {
+	at := assert.New(t)
+
+	m := NewMuxer()
+	buf := bytes.NewBuffer(nil)
+	buf.Write(m.PAT())
+	buf.Write(m.PMT(packet.PktVideo))
+
+	// 带PCR的首包中, 不足一个TS包的PES在自适应域之后填充
+	idr := []byte{0x00, 0x00, 0x00, 0x01, 0x65, 0x88, 0x84}
+	video := &packet.Packet{
+		Type:   packet.PktVideo,
+		Header: flv.NewVideoTag(flv.KeyFrame, flv.AvcH264, flv.AvcNalu, 0),
+		Media:  idr,
+	}
+	at.Nil(m.Mux(video, 40*avcHZ, 40*avcHZ, buf))
+	at.Nil(m.Mux(video, 80*avcHZ, 80*avcHZ, buf))
+
+	d := NewDemuxer(buf)
+
+	var p packet.Packet
+	at.Nil(d.Read(&p))
+	at.Equal(int64(40*avcHZ), p.Header.(*ESHeader).DTS)
+	at.Equal(idr, p.Media)
+}
+
+func TestDemuxer_Section(t *testing.T) {
+	at := assert.New(t)
+
+	m := NewMuxer()
+	m.SetVideoStreamType(table.StreamTypeHevc)
+	pat := m.PAT()
+	pmt := m.PMT(packet.PktVideo)
+
+	// PMT分段跨越2个TS包
+	pmtSection := pmt[5:26]
+	buf := bytes.NewBuffer(nil)
+	buf.Write(pat)
+	buf.Write(testTsPacket(0x1001, true, append([]byte{0x00}, pmtSection[:10]...)))
+	buf.Write(testTsPacket(0x1001, false, pmtSection[10:]))
+
+	// 长度不定的H265 PES, 在读取结束时输出
+	pes := []byte{0x00, 0x00, 0x01, 0xe0, 0x00, 0x00, 0x80, 0x80, 0x05, 0x21, 0x00, 0x01, 0x00, 0x01}
+	pes = append(pes, 0x00, 0x00, 0x00, 0x01, 0x26, 0x01, 0xaf)
+	buf.Write(testTsPacket(defaultVideoPID, true, pes))
+
+	d := NewDemuxer(buf)
+
+	var p packet.Packet
+	at.Nil(d.Read(&p))
+	vh := p.Header.(*ESHeader)
+	at.True(vh.IsCodecHevc())
+	at.True(vh.IsKeyFrame())
+	at.Equal(uint8(flv.HevcH265), vh.CodecID())
+	at.Equal([]byte{0x00, 0x00, 0x00, 0x01, 0x26, 0x01, 0xaf}, p.Media)
+
+	at.Equal(io.EOF, d.Read(&p))
+
+	// CRC错误的分段被丢弃
+	bad := append([]byte{}, pat...)
+	bad[10] ^= 0xff
+	d = NewDemuxer(bytes.NewReader(bad))
+	at.Equal(io.EOF, d.Read(&p))
+
+	// 不完整的TS包
+	d = NewDemuxer(bytes.NewReader(pat[:100]))
+	at.Equal(io.ErrUnexpectedEOF, d.Read(&p))
+}
+
+func TestDemuxer_Timestamp(t *testing.T) {
+	at := assert.New(t)
+
+	m := NewMuxer()
+	m.SetVideoStreamType(table.StreamTypeHevc)
+	buf := bytes.NewBuffer(nil)
+	buf.Write(m.PAT())
+	buf.Write(m.PMT(packet.PktVideo))
+
+	nalu := []byte{0x00, 0x00, 0x00, 0x01, 0x26, 0x01, 0xaf}
+	pes := []byte{0x00, 0x00, 0x01, 0xe0, 0x00, 0x00, 0x80, 0x80, 0x05, 0x21, 0x00, 0x05, 0x00, 0x01}
+	buf.Write(testTsPacket(defaultVideoPID, true, append(pes, nalu...)))
+
+	// PES头中没有PTS
+	pes = []byte{0x00, 0x00, 0x01, 0xe0, 0x00, 0x00, 0x80, 0x00, 0x00}
+	noPts := testTsPacket(defaultVideoPID, true, append(pes, nalu...))
+	noPts[3] |= 0x01
+	buf.Write(noPts)
+
+	d := NewDemuxer(buf)
+
+	// case1: 带PTS
+	var p packet.Packet
+	at.Nil(d.Read(&p))
+	h := p.Header.(*ESHeader)
+	at.True(h.HasTimestamp)
+	at.Equal(int64(1<<16), h.DTS)
+
+	// case2: 没有PTS时不沿用上一个包的时间戳
+	at.Nil(d.Read(&p))
+	h = p.Header.(*ESHeader)
+	at.False(h.HasTimestamp)
+	at.Equal(int64(0), h.DTS)
+	at.Equal(nalu, p.Media)
+
+	// case3: PTS回绕而DTS未回绕
+	h = &ESHeader{DTS: maxTimestamp + 1 - 20*avcHZ, PTS: 20 * avcHZ}
+	at.Equal(int32(40), h.CompositionTime())
+}
+
+func TestDemuxer_Corrupted(t *testing.T) {
+	at := assert.New(t)
+
+	m := NewMuxer()
+	buf := bytes.NewBuffer(nil)
+
+	// 损坏的PAT: CRC错误, pointer_field 超出负载
+	bad := append([]byte{}, m.PAT()...)
+	bad[10] ^= 0xff
+	buf.Write(bad)
+	buf.Write(testTsPacket(patPID, true, []byte{0xc0, 0x00}))
+
+	buf.Write(m.PAT())
+	buf.Write(m.PMT(packet.PktVideo))
+
+	// 自适应域长度超出TS包
+	afBad := testTsPacket(defaultVideoPID, true, []byte{0x00, 0x00, 0x01, 0xe0})
+	afBad[4] = 0xc0
+	buf.Write(afBad)
+
+	// 每帧跨越3个TS包
+	frame := func(n byte) []byte {
+		b := make([]byte, 400)
+		copy(b, []byte{0x00, 0x00, 0x00, 0x01, 0x65, 0x88})
+		for i := 6; i < len(b); i++ {
+			b[i] = n
+		}
+		return b
+	}
+
+	var frames []byte
+	for i := 0; i < 3; i++ {
+		w := bytes.NewBuffer(nil)
+		video := &packet.Packet{
+			Type:   packet.PktVideo,
+			Header: flv.NewVideoTag(flv.KeyFrame, flv.AvcH264, flv.AvcNalu, 0),
+			Media:  frame(byte(i)),
+		}
+		at.Nil(m.Mux(video, int64(i+1)*40*avcHZ, int64(i+1)*40*avcHZ, w))
+		at.Len(w.Bytes(), 3*tsPacketLen)
+
+		// 改为长度不定的PES(如超过65535字节的视频帧), 只能依靠包递增计数器发现丢包
+		b := w.Bytes()
+		off := 5 + int(b[4])
+		b[off+4], b[off+5] = 0, 0
+		frames = append(frames, b...)
+	}
+
+	// case1: 第1帧丢失中间的TS包, 包递增计数器跳变, 丢弃该帧
+	buf.Write(frames[:tsPacketLen])
+	buf.Write(frames[2*tsPacketLen : 3*tsPacketLen])
+
+	// case2: 重复的TS包被丢弃
+	buf.Write(frames[3*tsPacketLen : 5*tsPacketLen])
+	buf.Write(frames[4*tsPacketLen:])
+
+	d := NewDemuxer(buf)
+
+	var p packet.Packet
+	at.Nil(d.Read(&p))
+	at.Equal(frame(1), p.Media)
+
+	at.Nil(d.Read(&p))
+	at.Equal(frame(2), p.Media)
+
+	at.Equal(io.EOF, d.Read(&p))
+}
@@ -0,0 +1,109 @@
+package ts
+
+import (
+	"github.com/moggle-mog/goav/container/flv"
+	"github.com/moggle-mog/goav/container/ts/table"
+)
+
+// PTS/DTS的最大值(33位)
+const maxTimestamp = 0x1ffffffff
+
+// ESHeader TS解复用出的基本流信息, 视频实现 packet.VideoPacketHeader, 音频实现 packet.AudioPacketHeader
+// 视频数据为Annex-b格式, AAC为ADTS格式, mp3为原始帧; 数据不是flv tag, 不能直接交给flv的 packet.Writer
+type ESHeader struct {
+	PID          uint16 // 基本流所在的PID
+	StreamType   byte   // PMT中的流类型
+	PTS          int64  // 显示时间戳, 33位, 单位: 1/90000秒, 可能回绕
+	DTS          int64  // 解码时间戳, 33位, 单位: 1/90000秒, 可能回绕
+	HasTimestamp bool   // PES头中是否带有时间戳, 为false时PTS和DTS无效
+	KeyFrame     bool   // 视频是否是关键帧(包含IDR/IRAP或带有随机接入标识)
+}
+
+// IsKeyFrame [视频]是否是关键帧
+func (h *ESHeader) IsKeyFrame() bool {
+	return h.KeyFrame
+}
+
+// IsInterFrame [视频]是否是非关键帧
+func (h *ESHeader) IsInterFrame() bool {
+	return !h.KeyFrame
+}
+
+// IsSeqHdr [视频]参数集随视频帧在带内传输, 没有单独的序列头
+func (h *ESHeader) IsSeqHdr() bool {
+	return false
+}
+
+// IsEndOfSeq [视频]没有单独的序列结束包
+func (h *ESHeader) IsEndOfSeq() bool {
+	return false
+}
+
+// IsCodecAvc [视频]是否是H264
+func (h *ESHeader) IsCodecAvc() bool {
+	return h.StreamType == table.StreamTypeAvc
+}
+
+// IsCodecHevc [视频]是否是H265
+func (h *ESHeader) IsCodecHevc() bool {
+	return h.StreamType == table.StreamTypeHevc
+}
+
+// CodecID [视频]对应的flv CodecID
+func (h *ESHeader) CodecID() uint8 {
+	if h.IsCodecHevc() {
+		return flv.HevcH265
+	}
+	return flv.AvcH264
+}
+
+// CompositionTime [视频]pts和dts的差值(模2^33, PTS回绕而DTS未回绕时仍然正确), 单位: ms
+func (h *ESHeader) CompositionTime() int32 {
+	return int32(((h.PTS - h.DTS) & maxTimestamp) / avcHZ)
+}
+
+// IsExHeader [视频]不是Enhanced FLV扩展头
+func (h *ESHeader) IsExHeader() bool {
+	return false
+}
+
+// PacketType [视频]视频帧
+func (h *ESHeader) PacketType() uint8 {
+	return flv.ExCodedFrames
+}
+
+// FourCC [视频]对应的FourCC
+func (h *ESHeader) FourCC() uint32 {
+	if h.IsCodecHevc() {
+		return flv.FourCCHvc1
+	}
+	return flv.FourCCAvc1
+}
+
+// SoundFormat [音频]对应的flv音频格式
+func (h *ESHeader) SoundFormat() uint8 {
+	if h.IsSoundMP3() {
+		return flv.SoundMP3
+	}
+	return flv.SoundAAC
+}
+
+// AACType [音频]ADTS帧中不包含序列头
+func (h *ESHeader) AACType() uint8 {
+	return flv.AacRaw
+}
+
+// IsSoundAAC [音频]是否是AAC
+func (h *ESHeader) IsSoundAAC() bool {
+	return h.StreamType == table.StreamTypeAac
+}
+
+// IsSoundMP3 [音频]是否是mp3
+func (h *ESHeader) IsSoundMP3() bool {
+	return h.StreamType == table.StreamTypeMpeg1Audio || h.StreamType == table.StreamTypeMpeg2Audio
+}
+
+// IsAACSeqHdr [音频]ADTS帧中不包含序列头
+func (h *ESHeader) IsAACSeqHdr() bool {
+	return false
+}
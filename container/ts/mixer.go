@@ -3,15 +3,22 @@ package ts
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"time"
 
 	"github.com/moggle-mog/goav/container/ts/table"
 	"github.com/moggle-mog/goav/packet"
 	"github.com/moggle-mog/goav/parser"
+	"github.com/moggle-mog/goav/parser/mp3"
 
 	"github.com/moggle-mog/goav/amf"
 )
 
+// 默认的音频时间戳同步阈值, 单位: ms
+const defaultSyncMs = 10
+
 type cache struct {
 	metadata  *bytes.Buffer // 用来缓存元数据
 	avcSeqHdr *bytes.Buffer // 用来缓存AVC的序列头
@@ -20,10 +27,20 @@ type cache struct {
 	types     *packet.Types // 媒体类型
 }
 
+// 输出PAT, SDT和节目共用的SI表, 单节目时为Muxer, 多节目时为各节目共用的MPTS
+type tableSource interface {
+	PAT() []byte
+	packSdt(desc *bytes.Buffer) ([]byte, error)
+	NIT() ([]byte, error)
+	EIT(eit *table.Eit) ([]byte, error)
+	TDT(now time.Time, totDesc []byte) []byte
+}
+
 // Mixer ts音视频混合器
 type Mixer struct {
-	ts    io.Writer
-	cache *cache
+	ts     io.Writer
+	cache  *cache
+	tables tableSource
 
 	// 音视频解码
 	muxer  *Muxer
@@ -32,12 +49,62 @@ type Mixer struct {
 	// 音视频同步
 	pts, dts int64
 	sync     *sync
+	syncMs   int64
+
+	tracks map[int]*MixerAudioTrack // 额外的音频轨道
+
+	// 表的重复发送
+	psiRepeat  repeater // PAT/PMT
+	sdtRepeat  repeater // SDT
+	nitRepeat  repeater // NIT
+	eitRepeat  repeater // EIT present/following
+	tdtRepeat  repeater // TDT/TOT
+	tableState int      // 见 tableNone 等
+	shared     bool     // 多节目时PAT, SDT, NIT和TDT/TOT由MPTS重复输出, 只重复输出自己的PMT和EIT
+
+	// SI表
+	schedule   ScheduleProvider // 节目单, 为空时不输出EIT
+	clock      func() time.Time // EIT和TDT/TOT使用的时钟
+	country    string           // TOT中本地时间偏移的国家代码
+	timeTables bool             // 是否输出TDT/TOT
+	eitVersion tableVersion     // EIT的版本号, 事件变化时递增
+}
+
+// 表的重复输出计时, 单位: 90kHz
+type repeater struct {
+	interval int64 // 0 表示只在 SetTsHeader 时输出
+	last     int64 // 最近一次输出的时间
+}
+
+// 到达间隔时返回true并重新计时, 时间戳回退时也重新输出
+func (r *repeater) due(dts int64) bool {
+	if r.interval <= 0 || (dts-r.last < r.interval && dts >= r.last) {
+		return false
+	}
+
+	r.last = dts
+	return true
+}
+
+// 以毫秒为精度换算为90kHz的时间
+func toClock(d time.Duration) int64 {
+	return int64(d) * avcHZ / int64(time.Millisecond)
 }
 
+// 表的输出状态
+const (
+	tableNone    = iota // 尚未调用 SetTsHeader, 不重复输出
+	tableWritten        // 已输出, 下一个数据包的时间作为输出时间
+	tableTiming         // 按间隔重复输出
+)
+
 // NewMixer ts音视频混合器
 func NewMixer(w io.Writer) *Mixer {
+	muxer := NewMuxer()
+
 	return &Mixer{
-		ts: w,
+		ts:     w,
+		tables: muxer,
 		cache: &cache{
 			metadata:  bytes.NewBuffer(make([]byte, 0, 512)),
 			avcSeqHdr: bytes.NewBuffer(make([]byte, 0, 512)),
@@ -45,12 +112,61 @@ func NewMixer(w io.Writer) *Mixer {
 			media:     bytes.NewBuffer(make([]byte, 0, 512)),
 			types:     packet.NewTypes(),
 		},
-		muxer:  NewMuxer(),
+		muxer:  muxer,
 		parser: parser.NewCodecParser(),
-		sync:   newSync(10),
+		sync:   newSync(defaultSyncMs),
+		syncMs: defaultSyncMs,
+		tracks: make(map[int]*MixerAudioTrack),
+		clock:  time.Now,
 	}
 }
 
+// SetSyncThreshold 设置音频时间戳同步的阈值(ms), 音频包的时间戳与按采样数推算的时间相差不超过阈值时使用推算的时间
+func (m *Mixer) SetSyncThreshold(ms int64) error {
+	if ms <= 0 {
+		return fmt.Errorf("invalid sync threshold(%d)", ms)
+	}
+
+	m.sync = newSync(ms)
+	m.syncMs = ms
+	for _, t := range m.tracks {
+		t.sync = newSync(ms)
+	}
+	return nil
+}
+
+// SetTableInterval 设置 PAT/PMT 和 SDT 的重复间隔(如100ms和2s), 0 表示只在 SetTsHeader 时输出
+// 调用 SetTsHeader 后, 按数据包的dts计时, 到达间隔时在数据包前重新输出
+func (m *Mixer) SetTableInterval(psi, sdt time.Duration) error {
+	if psi < 0 || sdt < 0 {
+		return fmt.Errorf("invalid table interval(%v, %v)", psi, sdt)
+	}
+
+	m.psiRepeat.interval = toClock(psi)
+	m.sdtRepeat.interval = toClock(sdt)
+	return nil
+}
+
+// SetMuxerOptions 设置PID, 节目号和 transport_stream_id, 需要在 SetTsHeader 之前调用
+func (m *Mixer) SetMuxerOptions(opts MuxerOptions) error {
+	return m.muxer.SetOptions(opts)
+}
+
+// SetPcrInterval 设置PCR的最大间隔, 默认40ms
+func (m *Mixer) SetPcrInterval(d time.Duration) error {
+	return m.muxer.SetPcrInterval(d)
+}
+
+// SetMuxDelay 设置复用延时, 默认600ms, PCR比dts提前该时长
+func (m *Mixer) SetMuxDelay(d time.Duration) error {
+	return m.muxer.SetMuxDelay(d)
+}
+
+// SetSampleAES 设置 SAMPLE-AES 的密钥和初始向量, key为空时不加密, 需要在 SetTsHeader 之前调用以更新PMT
+func (m *Mixer) SetSampleAES(key, iv []byte) error {
+	return m.muxer.SetSampleAES(key, iv)
+}
+
 // SetWriter 设置输出
 func (m *Mixer) SetWriter(w io.Writer) {
 	m.ts = w
@@ -76,9 +192,99 @@ func (m *Mixer) Mux(p *packet.Packet) error {
 		return err
 	}
 
+	// mp3没有序列头, 根据帧头设置PMT中的流类型
+	if p.Type == packet.PktAudio {
+		ah, ok := p.Header.(packet.AudioPacketHeader)
+		if ok && ah.IsSoundMP3() {
+			m.saveMP3StreamType(p.Media)
+		}
+	}
+
+	err = m.repeatTables(m.dts)
+	if err != nil {
+		return err
+	}
+
 	return m.muxer.Mux(p, m.dts, m.pts, m.ts)
 }
 
+// 到达重复间隔时重新输出 PAT/PMT 和 SDT, 时间戳回退时重新计时
+func (m *Mixer) repeatTables(dts int64) error {
+	switch m.tableState {
+	case tableNone:
+		return nil
+	case tableWritten:
+		for _, r := range []*repeater{&m.psiRepeat, &m.sdtRepeat, &m.nitRepeat, &m.eitRepeat, &m.tdtRepeat} {
+			r.last = dts
+		}
+		m.tableState = tableTiming
+		return nil
+	}
+
+	if !m.shared && m.sdtRepeat.due(dts) {
+		err := m.writeSdt()
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.psiRepeat.due(dts) {
+		err := m.writePsi()
+		if err != nil {
+			return err
+		}
+	}
+
+	if !m.shared && m.nitRepeat.due(dts) {
+		err := m.writeNit()
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.eitRepeat.due(dts) {
+		err := m.writeEit()
+		if err != nil {
+			return err
+		}
+	}
+
+	if !m.shared && m.tdtRepeat.due(dts) {
+		return m.writeTdt()
+	}
+
+	return nil
+}
+
+// 输出 PAT 和 PMT, 多节目时只输出PMT
+func (m *Mixer) writePsi() error {
+	if !m.shared {
+		_, err := m.ts.Write(m.tables.PAT())
+		if err != nil {
+			return err
+		}
+	}
+
+	pmt, err := m.muxer.packPmt(m.cache.types.ToSlice()...)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.ts.Write(pmt)
+	return err
+}
+
+// 输出SDT
+func (m *Mixer) writeSdt() error {
+	sdt, err := m.tables.packSdt(m.cache.metadata)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.ts.Write(sdt)
+	return err
+}
+
 // SaveMetadata 保存元数据
 func (m *Mixer) SaveMetadata(md amf.Object) error {
 	provider, ok := md["Provider"].(string)
@@ -102,10 +308,18 @@ func (m *Mixer) SaveMetadata(md amf.Object) error {
 	return nil
 }
 
-// SaveAVCHeader 保存AVC序列头（flv->avc sequence header）
+// SaveAVCHeader 保存AVC或HEVC序列头（flv->avc/hevc sequence header）
 func (m *Mixer) SaveAVCHeader(p *packet.Packet) error {
 	m.cache.types.IsVideo()
 
+	// 根据视频编码设置PMT中的流类型
+	vh, ok := p.Header.(packet.VideoPacketHeader)
+	if ok && vh.IsCodecHevc() {
+		m.muxer.SetVideoStreamType(table.StreamTypeHevc)
+	} else {
+		m.muxer.SetVideoStreamType(table.StreamTypeAvc)
+	}
+
 	err := m.parse(p, m.cache.avcSeqHdr)
 	if err != nil {
 		return err
@@ -119,6 +333,9 @@ func (m *Mixer) SaveAVCHeader(p *packet.Packet) error {
 func (m *Mixer) SaveAACHeader(p *packet.Packet) error {
 	m.cache.types.IsAudio()
 
+	// 解析前p.Media为 AudioSpecificConfig
+	m.muxer.SetAudioConfig(p.Media)
+
 	err := m.parse(p, m.cache.aacSeqHdr)
 	if err != nil {
 		return err
@@ -128,33 +345,63 @@ func (m *Mixer) SaveAACHeader(p *packet.Packet) error {
 	return m.muxer.Mux(p, 0, 0, m.cache.aacSeqHdr)
 }
 
-// SetTsHeader 封装PAT和PMT
-func (m *Mixer) SetTsHeader() error {
-	mediaType := m.cache.types.ToSlice()
-	metadata := m.cache.metadata
+// 根据mp3帧头的版本设置音频流类型
+func (m *Mixer) saveMP3StreamType(frame []byte) {
+	streamType, ok := mp3StreamType(frame)
+	if !ok {
+		return
+	}
+
+	m.cache.types.IsAudio()
+	m.muxer.SetAudioStreamType(streamType)
+}
+
+// mp3的流类型, MPEG-1为0x03, MPEG-2/2.5为0x04
+func mp3StreamType(frame []byte) (byte, bool) {
+	h, err := mp3.ParseHeader(frame)
+	if err != nil {
+		return 0, false
+	}
 
-	sdt := m.muxer.SDT(metadata)
-	pat := m.muxer.PAT()
-	pmt := m.muxer.PMT(mediaType...)
+	if h.Version == mp3.Version1 {
+		return table.StreamTypeMpeg1Audio, true
+	}
+	return table.StreamTypeMpeg2Audio, true
+}
 
+// SetTsHeader 封装SDT, PAT和PMT, 以及设置了的NIT, EIT和TDT/TOT,
+// 之后按 SetTableInterval 和 SetSIInterval 的间隔重复输出; PCR重新计时
+func (m *Mixer) SetTsHeader() error {
 	// 输出SDT表
-	_, err := m.ts.Write(sdt)
+	err := m.writeSdt()
 	if err != nil {
 		return err
 	}
 
-	// 输出PAT表
-	_, err = m.ts.Write(pat)
+	// 输出PAT表和PMT表
+	err = m.writePsi()
 	if err != nil {
 		return err
 	}
 
-	// 输出PMT表
-	_, err = m.ts.Write(pmt)
+	// 输出SI表
+	err = m.writeNit()
+	if err != nil {
+		return err
+	}
+
+	err = m.writeEit()
 	if err != nil {
 		return err
 	}
 
+	err = m.writeTdt()
+	if err != nil {
+		return err
+	}
+
+	m.tableState = tableWritten
+	m.muxer.resetPcr()
 	return nil
 }
 
@@ -167,22 +414,53 @@ func (m *Mixer) SetTsHeader() error {
 // 视频的PTS=DTS+时间增量
 // 音频的PTS=DTS
 func (m *Mixer) Update(p *packet.Packet, pktTs, avcTs uint32) error {
-	m.dts = int64(pktTs * avcHZ)
+	m.dts = int64(pktTs) * avcHZ
 
 	switch p.Type {
 	case packet.PktVideo:
-		m.pts = m.dts + int64(avcTs*avcHZ)
+		m.pts = m.dts + int64(avcTs)*avcHZ
 	case packet.PktAudio:
-		// 音频采样率
-		sampleRate, err := m.parser.SampleRate()
+		// 音频采样率和该包的采样数
+		sampleRate, samples, err := audioSamples(p, m.parser)
 		if err != nil {
 			return err
 		}
 
-		// 以DTS为基准, 校正音频PTS, 音频时间片换算成以视频为单位的时间片(1秒钟的音频长度/音频速率 = 流逝时间)
-		m.sync.syncAudioTs(&m.dts, sampleRate)
+		// 以DTS为基准, 校正音频PTS, 音频时间片换算成以视频为单位的时间片(音频包的采样数/音频速率 = 流逝时间)
+		m.sync.syncAudioTs(&m.dts, sampleRate, samples)
 		m.pts = m.dts
 	}
 
 	return nil
 }
+
+// 返回音频的采样率和音频包的采样数
+// mp3的一个音频包可以包含多个帧, 且没有序列头, 直接从帧头中获取; 其他编码从解析器中获取
+func audioSamples(p *packet.Packet, cp *parser.CodecParser) (int, int, error) {
+	ah, ok := p.Header.(packet.AudioPacketHeader)
+	if ok && ah.IsSoundMP3() {
+		frames, _ := mp3.SplitFrames(p.Media)
+		if len(frames) == 0 {
+			return 0, 0, errors.New("no mp3 frame in audio packet")
+		}
+
+		samples := 0
+		for _, frame := range frames {
+			samples += frame.Header.SamplesPerFrame
+		}
+
+		return frames[0].Header.SampleRate, samples, nil
+	}
+
+	sampleRate, err := cp.SampleRate()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	samples, err := cp.SamplesPerFrame()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return sampleRate, samples, nil
+}
@@ -3,6 +3,7 @@ package ts
 import (
 	"bytes"
 	"testing"
+	"time"
 
 	"github.com/moggle-mog/goav/container/flv"
 	"github.com/moggle-mog/goav/packet"
@@ -28,9 +29,10 @@ func TestMixer_SetTsHeader(t *testing.T) {
 	at.Nil(d.Demux(p))
 	at.Nil(m.SaveAVCHeader(p))
 	at.Equal([]byte{0x47, 0x41, 0x0, 0x31}, p.Media)
+	// PCR比dts提前默认的复用延时600ms, 从33位时间戳的末尾回绕
 	at.Equal([]byte{
-		0x47, 0x41, 0x0, 0x31, 0x7, 0x50, 0x0, 0x0,
-		0x0, 0x0, 0x7e, 0x0, 0x9d, 0x0, 0xff, 0xff,
+		0x47, 0x41, 0x0, 0x31, 0xa5, 0x50, 0xff, 0xff,
+		0x96, 0x88, 0x7e, 0x0, 0xff, 0xff, 0xff, 0xff,
 		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
 		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
 		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
@@ -143,9 +145,9 @@ func TestMixer_SetTsHeader(t *testing.T) {
 		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
 		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
 		0x47, 0x50, 0x1, 0x10, 0x0, 0x2, 0xb0, 0x17,
-		0x0, 0x1, 0xc1, 0x0, 0x0, 0xe1, 0x1, 0xf0,
+		0x0, 0x1, 0xc1, 0x0, 0x0, 0xe1, 0x0, 0xf0,
 		0x0, 0x1b, 0xe1, 0x0, 0xf0, 0x0, 0xf, 0xe1,
-		0x1, 0xf0, 0x0, 0xc7, 0xe0, 0xef, 0x9e, 0xff,
+		0x1, 0xf0, 0x0, 0x2f, 0x44, 0xb9, 0x9b, 0xff,
 		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
 		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
 		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
@@ -178,3 +180,165 @@ func TestMixer_SetTsHeader(t *testing.T) {
 	}, 2000, 0))
 	at.Equal(int64(180000), m.pts)
 }
+
+func TestMixer_MuxMp3(t *testing.T) {
+	at := assert.New(t)
+
+	buf := bytes.NewBuffer(nil)
+	m := NewMixer(buf)
+	d := flv.NewDemuxer()
+
+	// MPEG-1 layer 3, 128kbps, 44100
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x64})
+
+	p := &packet.Packet{
+		Type: packet.PktAudio,
+		Data: append([]byte{0x2f}, frame...),
+	}
+
+	at.Nil(d.Demux(p))
+	at.Nil(m.Update(p, 0, 0))
+	at.Nil(m.Mux(p))
+
+	// mp3帧原样写入pes, 使用MPEG音频的stream id
+	ts := buf.Bytes()
+	at.Equal(0, len(ts)%tsPacketLen)
+	at.Equal([]byte{0x47, 0x41, 0x01}, ts[:3])
+	at.Equal([]byte{0x00, 0x00, 0x01, 0xc0}, ts[4:8])
+	at.Equal(frame[:4], ts[18:22])
+
+	// PMT中的流类型为0x03
+	buf.Reset()
+	at.Nil(m.SetTsHeader())
+	pmt := buf.Bytes()[2*tsPacketLen:]
+	at.Equal([]byte{0x03, 0xe1, 0x01, 0xf0, 0x00}, pmt[17:22])
+}
+
+func TestMixer_SetSyncThreshold(t *testing.T) {
+	at := assert.New(t)
+
+	m := NewMixer(bytes.NewBuffer(nil))
+	d := flv.NewDemuxer()
+
+	at.NotNil(m.SetSyncThreshold(0))
+	at.Nil(m.SetSyncThreshold(100))
+
+	// HE-AAC, 输出采样率44100, 每帧2048个采样
+	p := &packet.Packet{Type: packet.PktAudio, Data: []byte{0xaf, 0x00, 0x2b, 0x92, 0x08, 0x00}}
+	at.Nil(d.Demux(p))
+	at.Nil(m.SaveAACHeader(p))
+
+	p = &packet.Packet{Type: packet.PktAudio, Data: []byte{0xaf, 0x01, 0x21}}
+	at.Nil(d.Demux(p))
+
+	at.Nil(m.Update(p, 0, 0))
+	at.Equal(int64(0), m.dts)
+
+	// 与推算时间相差不超过100ms, 使用推算的时间
+	at.Nil(m.Update(p, 140, 0))
+	at.Equal(int64(4179), m.dts)
+	at.Equal(m.dts, m.pts)
+}
+
+func TestMixer_SetTableInterval(t *testing.T) {
+	at := assert.New(t)
+
+	buf := bytes.NewBuffer(nil)
+	m := NewMixer(buf)
+	d := flv.NewDemuxer()
+
+	at.NotNil(m.SetTableInterval(-1, 0))
+	at.Nil(m.SetTableInterval(100*time.Millisecond, 500*time.Millisecond))
+
+	// MPEG-1 layer 3, 128kbps, 44100, 每帧1152个采样(约26ms)
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x64})
+
+	mux := func(ts uint32) {
+		p := &packet.Packet{
+			Type: packet.PktAudio,
+			Data: append([]byte{0x2f}, frame...),
+		}
+		at.Nil(d.Demux(p))
+		at.Nil(m.Update(p, ts, 0))
+		at.Nil(m.Mux(p))
+	}
+
+	// case1: 调用 SetTsHeader 之前不输出表
+	mux(0)
+	count, _ := testCountPackets(buf.Bytes())
+	at.Equal(0, count[patPID])
+
+	// case2: 之后按间隔重复输出, 约1秒内 PAT/PMT 输出10次, SDT输出2次
+	buf.Reset()
+	at.Nil(m.SetTsHeader())
+	for i := uint32(1); i <= 39; i++ {
+		mux(i * 26)
+	}
+
+	count, pcr := testCountPackets(buf.Bytes())
+	at.Equal(1+9, count[patPID])
+	at.Equal(1+9, count[0x1001])
+	at.Equal(1+1, count[0x11])
+	at.Equal(3*39, count[defaultAudioPID])
+	at.Equal(39, pcr[defaultAudioPID])
+
+	// case3: 包递增计数器连续
+	var cc []byte
+	ts := buf.Bytes()
+	for i := 0; i < len(ts); i += tsPacketLen {
+		if ts[i+1] == 0x40 && ts[i+2] == 0x00 {
+			cc = append(cc, ts[i+3]&0x0f)
+		}
+	}
+	at.Equal([]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, cc)
+}
+
+func TestMixer_AudioTrack(t *testing.T) {
+	at := assert.New(t)
+
+	buf := bytes.NewBuffer(nil)
+	m := NewMixer(buf)
+	d := flv.NewDemuxer()
+
+	// case1: 轨道不存在
+	_, err := m.AudioTrack(1)
+	at.NotNil(err)
+
+	at.Nil(m.SetMuxerOptions(MuxerOptions{
+		AudioLanguage: "chi",
+		AudioTracks:   []AudioTrack{{PID: 0x102, Language: "eng"}},
+	}))
+	_, err = m.AudioTrack(0)
+	at.NotNil(err)
+
+	track, err := m.AudioTrack(1)
+	at.Nil(err)
+	same, _ := m.AudioTrack(1)
+	at.True(track == same)
+
+	// case2: 轨道的mp3帧写入轨道的PID, PMT中的流类型随帧头更新
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x64})
+
+	p := &packet.Packet{Type: packet.PktAudio, Data: append([]byte{0x2f}, frame...)}
+	at.Nil(d.Demux(p))
+	at.Nil(track.Update(p, 0))
+	at.Nil(track.Mux(p))
+
+	ts := buf.Bytes()
+	at.Equal([]byte{0x47, 0x41, 0x02}, ts[:3])
+	at.Equal(frame[:4], ts[18:22])
+
+	buf.Reset()
+	at.Nil(m.SetTsHeader())
+	at.True(bytes.Contains(buf.Bytes(), []byte{0x03, 0xe1, 0x02, 0xf0, 0x06, 0x0a, 0x04, 'e', 'n', 'g', 0x00}))
+
+	// case3: 轨道的时间戳单独同步
+	p = &packet.Packet{Type: packet.PktAudio, Data: append([]byte{0x2f}, frame...)}
+	at.Nil(d.Demux(p))
+	at.Nil(track.Update(p, 30))
+	at.Equal(int64(2351), track.dts)
+	at.Equal(int64(0), m.dts)
+}
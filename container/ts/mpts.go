@@ -0,0 +1,582 @@
+// Package ts 多节目TS流(MPTS): 多路音视频共用一个TS输出, 每路为一个节目
+package ts
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	gosync "sync"
+	"time"
+
+	"github.com/moggle-mog/goav/container/ts/table"
+	"github.com/moggle-mog/goav/packet"
+)
+
+// MPTS 多节目TS流混合器
+// 每个节目有各自的PMT PID, PCR PID和基本流, 共用PAT(列出全部节目)和SDT(每个节目一个业务)
+// 共用的PAT, SDT, NIT和TDT/TOT按MPTS的时钟重复输出一次, 各节目按自己的时间戳重复输出PMT和EIT
+type MPTS struct {
+	mu gosync.Mutex
+	w  io.Writer
+
+	transportStreamID uint16
+	originalNetworkID uint16
+	programs          []*MPTSProgram
+
+	psiInterval time.Duration // 各节目 PMT 的重复间隔
+	eitInterval time.Duration // 各节目 EIT 的重复间隔
+	started     bool          // 是否已输出过表
+
+	// 共用表的重复发送, 单位: 90kHz
+	patRepeat repeater
+	sdtRepeat repeater
+	nitRepeat repeater
+	tdtRepeat repeater
+
+	clock      func() time.Time // 共用表重复输出和TDT/TOT使用的时钟
+	country    string           // TOT中本地时间偏移的国家代码
+	timeTables bool             // 是否输出TDT/TOT
+
+	network *network // NIT中的网络, 为空时不输出NIT
+
+	patCc byte
+	sdtCc byte
+	nitCc byte
+	eitCc byte
+	tdtCc byte
+	pat   []byte
+	sdt   []byte
+	nit   []byte
+	eit   []byte
+	tdt   []byte
+
+	patVersion tableVersion // PAT的版本号, 节目变化时递增
+	sdtVersion tableVersion // SDT的版本号, 业务变化时递增
+}
+
+// MPTSProgram MPTS中的一个节目, 实现 packet.Writer
+type MPTSProgram struct {
+	mpts  *MPTS
+	mixer *Mixer
+	opts  MuxerOptions
+}
+
+// NewMPTS 多节目TS流混合器, transportStreamID 和 originalNetworkID 为0时使用默认值
+func NewMPTS(w io.Writer, transportStreamID, originalNetworkID uint16) *MPTS {
+	if transportStreamID == 0 {
+		transportStreamID = defaultTransportStreamID
+	}
+	if originalNetworkID == 0 {
+		originalNetworkID = defaultOriginalNetworkID
+	}
+
+	return &MPTS{
+		w:                 w,
+		transportStreamID: transportStreamID,
+		originalNetworkID: originalNetworkID,
+		clock:             time.Now,
+	}
+}
+
+// AddProgram 添加节目, opts 中的 TransportStreamID 和 OriginalNetworkID 被忽略
+// 节目号和PID不能与已有的节目重复; 已输出过表时, 立即输出新版本的PAT, SDT和新节目的PMT
+func (m *MPTS) AddProgram(opts MuxerOptions) (*MPTSProgram, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	opts.TransportStreamID = m.transportStreamID
+	opts.OriginalNetworkID = m.originalNetworkID
+	opts.setDefaults()
+
+	err := opts.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pg := range m.programs {
+		if pg.opts.ProgramNumber == opts.ProgramNumber {
+			return nil, fmt.Errorf("program number %d already exists", opts.ProgramNumber)
+		}
+
+		for _, pid := range opts.pids() {
+			for _, used := range pg.opts.pids() {
+				if pid == used {
+					return nil, fmt.Errorf("pid 0x%x already used by program %d", pid, pg.opts.ProgramNumber)
+				}
+			}
+		}
+	}
+
+	mixer := NewMixer(m.w)
+	mixer.tables = m
+	mixer.shared = true
+	err = mixer.muxer.SetOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = mixer.SetTableInterval(m.psiInterval, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	err = mixer.SetSIInterval(0, m.eitInterval, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	pg := &MPTSProgram{
+		mpts:  m,
+		mixer: mixer,
+		opts:  opts,
+	}
+	m.programs = append(m.programs, pg)
+
+	if m.started {
+		err = m.writeProgramTables(pg)
+		if err != nil {
+			m.programs = m.programs[:len(m.programs)-1]
+			return nil, err
+		}
+	}
+
+	return pg, nil
+}
+
+// 输出后添加的节目: PAT和SDT的内容变化, 版本号递增
+func (m *MPTS) writeProgramTables(pg *MPTSProgram) error {
+	err := m.writeSdt()
+	if err != nil {
+		return err
+	}
+
+	_, err = m.w.Write(m.PAT())
+	if err != nil {
+		return err
+	}
+
+	err = m.writePmt(pg)
+	if err != nil {
+		return err
+	}
+
+	err = m.writeNit()
+	if err != nil {
+		return err
+	}
+
+	pg.mixer.tableState = tableWritten
+	return nil
+}
+
+// Program 按节目号查找节目
+func (m *MPTS) Program(programNumber uint16) (*MPTSProgram, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, pg := range m.programs {
+		if pg.opts.ProgramNumber == programNumber {
+			return pg, true
+		}
+	}
+
+	return nil, false
+}
+
+// SetTableInterval 设置 PAT/PMT 和 SDT 的重复间隔, 见 Mixer.SetTableInterval
+// PAT和SDT按MPTS的时钟重复输出, 各节目按自己的时间戳重复输出自己的PMT
+func (m *MPTS) SetTableInterval(psi, sdt time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if psi < 0 || sdt < 0 {
+		return fmt.Errorf("invalid table interval(%v, %v)", psi, sdt)
+	}
+
+	for _, pg := range m.programs {
+		err := pg.mixer.SetTableInterval(psi, 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	m.psiInterval = psi
+	m.patRepeat.interval = toClock(psi)
+	m.sdtRepeat.interval = toClock(sdt)
+	return nil
+}
+
+// SetSIInterval 设置 NIT, EIT 和 TDT/TOT 的重复间隔, 见 Mixer.SetSIInterval
+// NIT和TDT/TOT按MPTS的时钟重复输出(SetNetwork, SetClock), 各节目按自己的时间戳重复输出EIT(Mixer.SetSchedule)
+func (m *MPTS) SetSIInterval(nit, eit, tdt time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if nit < 0 || eit < 0 || tdt < 0 {
+		return fmt.Errorf("invalid si interval(%v, %v, %v)", nit, eit, tdt)
+	}
+
+	for _, pg := range m.programs {
+		err := pg.mixer.SetSIInterval(0, eit, 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	m.eitInterval = eit
+	m.nitRepeat.interval = toClock(nit)
+	m.tdtRepeat.interval = toClock(tdt)
+	return nil
+}
+
+// SetClock 设置共用表重复输出和TDT/TOT使用的时钟并开始输出TDT/TOT, now 为空时使用系统时间
+// countryCode 见 Mixer.SetClock; 各节目EIT使用的时钟通过节目的 Mixer.SetClock 设置
+func (m *MPTS) SetClock(now func() time.Time, countryCode string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if countryCode != "" && len(countryCode) != 3 {
+		return fmt.Errorf("invalid country code(%s)", countryCode)
+	}
+
+	if now == nil {
+		now = time.Now
+	}
+
+	m.clock = now
+	m.country = countryCode
+	m.timeTables = true
+	return nil
+}
+
+// MPTS时钟的当前时间, 单位: 90kHz
+func (m *MPTS) now() int64 {
+	return toClock(time.Duration(m.clock().UnixNano()))
+}
+
+// 到达重复间隔时重新输出共用的 SDT, PAT, NIT 和 TDT/TOT
+func (m *MPTS) repeatTables() error {
+	now := m.now()
+
+	if m.sdtRepeat.due(now) {
+		err := m.writeSdt()
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.patRepeat.due(now) {
+		_, err := m.w.Write(m.PAT())
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.nitRepeat.due(now) {
+		err := m.writeNit()
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.tdtRepeat.due(now) {
+		return m.writeTdt()
+	}
+
+	return nil
+}
+
+// 输出NIT, 没有设置网络时不输出
+func (m *MPTS) writeNit() error {
+	nit, err := m.NIT()
+	if err != nil || nit == nil {
+		return err
+	}
+
+	_, err = m.w.Write(nit)
+	return err
+}
+
+// 输出SDT
+func (m *MPTS) writeSdt() error {
+	sdt, err := m.packSdt(nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.w.Write(sdt)
+	return err
+}
+
+// 输出节目的PMT
+func (m *MPTS) writePmt(pg *MPTSProgram) error {
+	mixer := pg.mixer
+	pmt, err := mixer.muxer.packPmt(mixer.cache.types.ToSlice()...)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.w.Write(pmt)
+	return err
+}
+
+// 输出TDT和TOT, 没有调用 SetClock 时不输出
+func (m *MPTS) writeTdt() error {
+	if !m.timeTables {
+		return nil
+	}
+
+	now := m.clock()
+	totDesc, err := totDescriptors(now, m.country)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.w.Write(m.TDT(now, totDesc))
+	return err
+}
+
+// SetNetwork 设置NIT中的网络ID和网络名称, NIT的业务列表中包含全部节目; networkID 为0时不输出NIT
+func (m *MPTS) SetNetwork(networkID uint16, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, err := newNetwork(networkID, name)
+	if err != nil {
+		return err
+	}
+
+	m.network = n
+	return nil
+}
+
+// SetTsHeader 输出SDT, PAT, 全部节目的PMT和设置了的SI表
+func (m *MPTS) SetTsHeader() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.writeTables()
+}
+
+func (m *MPTS) writeTables() error {
+	err := m.writeSdt()
+	if err != nil {
+		return err
+	}
+
+	_, err = m.w.Write(m.PAT())
+	if err != nil {
+		return err
+	}
+
+	for _, pg := range m.programs {
+		mixer := pg.mixer
+
+		err = m.writePmt(pg)
+		if err != nil {
+			return err
+		}
+
+		mixer.tableState = tableWritten
+		mixer.muxer.resetPcr()
+	}
+
+	err = m.writeNit()
+	if err != nil {
+		return err
+	}
+
+	for _, pg := range m.programs {
+		err = pg.mixer.writeEit()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = m.writeTdt()
+	if err != nil {
+		return err
+	}
+
+	now := m.now()
+	for _, r := range []*repeater{&m.patRepeat, &m.sdtRepeat, &m.nitRepeat, &m.tdtRepeat} {
+		r.last = now
+	}
+
+	m.started = true
+	return nil
+}
+
+// PAT 列出全部节目的PAT
+func (m *MPTS) PAT() []byte {
+	pat := table.NewPat(m.transportStreamID)
+	if m.network != nil {
+		pat.AddProgram(0, nitPID)
+	}
+	for _, pg := range m.programs {
+		pat.AddProgram(pg.opts.ProgramNumber, pg.opts.PmtPID)
+	}
+
+	// 每个节目至少使用3个PID, 节目数不会超过256个分段
+	sections, _ := pat.Sections()
+	pat.Version = m.patVersion.next(bytes.Join(sections, nil))
+
+	sections, _ = pat.Sections()
+	m.pat = packSections(patPID, &m.patCc, m.pat[:0], sections...)
+	return m.pat
+}
+
+// SDT 每个节目一个业务, 业务描述符来自各节目的元数据, 忽略desc; 出错时返回nil
+func (m *MPTS) SDT(desc *bytes.Buffer) []byte {
+	b, _ := m.packSdt(desc)
+	return b
+}
+
+// 生成并封装SDT, 节目较多时分为多个分段
+func (m *MPTS) packSdt(_ *bytes.Buffer) ([]byte, error) {
+	sdt := table.NewSdt(m.transportStreamID, m.originalNetworkID)
+	for i, pg := range m.programs {
+		sdt.AddService(pg.opts.ProgramNumber, pg.mixer.cache.metadata.Bytes())
+		sdt.Services[i].EITPresentFollowing = pg.mixer.muxer.eitPF
+	}
+
+	sections, err := sdt.Sections()
+	if err != nil {
+		return nil, err
+	}
+	sdt.Version = m.sdtVersion.next(bytes.Join(sections, nil))
+
+	sections, _ = sdt.Sections()
+	m.sdt = packSections(sdtPID, &m.sdtCc, m.sdt[:0], sections...)
+	return m.sdt, nil
+}
+
+// Options 节目的PID和节目设置
+func (pg *MPTSProgram) Options() MuxerOptions {
+	return pg.opts
+}
+
+// Mixer 节目的混合器, 可用于设置同步阈值和PCR间隔; 不能通过它修改PID
+func (pg *MPTSProgram) Mixer() *Mixer {
+	return pg.mixer
+}
+
+// SetService 设置SDT中节目对应业务的提供者和名称(业务类型为1, 数字电视)
+func (pg *MPTSProgram) SetService(provider, name string) error {
+	pg.mpts.mu.Lock()
+	defer pg.mpts.mu.Unlock()
+
+	desc := table.NewDescriptor()
+	err := desc.Service(1, provider, name)
+	if err != nil {
+		return err
+	}
+
+	pg.mixer.cache.metadata = desc.GetBuffer()
+	return nil
+}
+
+// Write 写入节目的一个数据包(Header为flv tag), 序列头用于更新PMT, 元数据等其他数据包被忽略
+// 收到首个音视频帧时, 如果尚未调用 MPTS.SetTsHeader, 先输出全部的表
+func (pg *MPTSProgram) Write(p *packet.Packet) error {
+	pg.mpts.mu.Lock()
+	defer pg.mpts.mu.Unlock()
+
+	// Mixer会修改p.Media, 使用副本避免影响调用方缓存的数据包
+	q := *p
+
+	var cts uint32
+	switch q.Type {
+	case packet.PktVideo:
+		vh, ok := q.Header.(packet.VideoPacketHeader)
+		if !ok {
+			return fmt.Errorf("invalid video packet header")
+		}
+
+		if vh.IsSeqHdr() {
+			return pg.saveHeader(pg.mixer.SaveAVCHeader(&q))
+		}
+		cts = uint32(vh.CompositionTime())
+	case packet.PktAudio:
+		ah, ok := q.Header.(packet.AudioPacketHeader)
+		if !ok {
+			return fmt.Errorf("invalid audio packet header")
+		}
+
+		if ah.IsSoundAAC() && ah.IsAACSeqHdr() {
+			return pg.saveHeader(pg.mixer.SaveAACHeader(&q))
+		}
+	default:
+		return nil
+	}
+
+	if !pg.mpts.started {
+		err := pg.mpts.writeTables()
+		if err != nil {
+			return err
+		}
+	}
+
+	err := pg.mpts.repeatTables()
+	if err != nil {
+		return err
+	}
+
+	err = pg.mixer.Update(&q, q.TimeStamp, cts)
+	if err != nil {
+		return err
+	}
+
+	return pg.mixer.Mux(&q)
+}
+
+// 输出表之后才收到的序列头改变了节目的流类型时, 重新输出节目的PMT(PMT的版本号递增), 流类型不变时不输出
+func (pg *MPTSProgram) saveHeader(err error) error {
+	if err != nil || !pg.mpts.started {
+		return err
+	}
+
+	mixer := pg.mixer
+	if !mixer.muxer.pmtChanged(mixer.cache.types.ToSlice()...) {
+		return nil
+	}
+
+	return mixer.writePsi()
+}
+
+// NIT 业务列表中包含全部节目, 没有设置网络时返回nil
+func (m *MPTS) NIT() ([]byte, error) {
+	if m.network == nil {
+		return nil, nil
+	}
+
+	programNumbers := make([]uint16, 0, len(m.programs))
+	for _, pg := range m.programs {
+		programNumbers = append(programNumbers, pg.opts.ProgramNumber)
+	}
+
+	sections, err := m.network.sections(m.transportStreamID, m.originalNetworkID, programNumbers)
+	if err != nil {
+		return nil, err
+	}
+
+	m.nit = packSections(nitPID, &m.nitCc, m.nit[:0], sections...)
+	return m.nit, nil
+}
+
+// EIT 各节目的EIT使用同一个PID和包递增计数器
+func (m *MPTS) EIT(eit *table.Eit) ([]byte, error) {
+	sections, err := eit.Sections()
+	if err != nil {
+		return nil, err
+	}
+
+	m.eit = packSections(eitPID, &m.eitCc, m.eit[:0], sections...)
+	return m.eit, nil
+}
+
+// TDT 各节目的TDT/TOT使用同一个PID和包递增计数器
+func (m *MPTS) TDT(now time.Time, totDesc []byte) []byte {
+	m.tdt = packTimeTables(&m.tdtCc, m.tdt[:0], now, totDesc)
+	return m.tdt
+}
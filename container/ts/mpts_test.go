@@ -0,0 +1,227 @@
+package ts
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/moggle-mog/goav/container/flv"
+	"github.com/moggle-mog/goav/internal/testutil"
+	"github.com/moggle-mog/goav/packet"
+	"github.com/stretchr/testify/assert"
+)
+
+// 生成n帧H264和AAC的flv数据包(含序列头), 每40ms一帧
+func testFlvPackets(t *testing.T, n int) []*packet.Packet {
+	avc := flv.NewAvcPacker()
+	aac := flv.NewAacPacker()
+
+	sps := []byte{0x67, 0x4d, 0x00, 0x1e, 0xab, 0x40, 0x5a, 0x12, 0x6c, 0x09, 0x28, 0x28, 0x28, 0x2f, 0x80, 0x00, 0x01, 0xf4, 0x00, 0x00, 0x61, 0xa8, 0x4a}
+	pps := []byte{0x68, 0xde, 0x31, 0x12}
+	adts := []byte{0xff, 0xf1, 0x50, 0x80, 0x01, 0x5f, 0xfc, 0x21, 0x00, 0x49}
+
+	var pkts []*packet.Packet
+	for i := 0; i < n; i++ {
+		ts := uint32(i * 40)
+
+		frame := testutil.JoinAnnexb([]byte{0x41, 0x9a, 0x02})
+		if i == 0 {
+			frame = testutil.JoinAnnexb(sps, pps, []byte{0x65, 0x88, 0x84})
+		}
+
+		ps, err := avc.Pack(frame, ts, ts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkts = append(pkts, ps...)
+
+		ps, err = aac.Pack(adts, ts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkts = append(pkts, ps...)
+	}
+
+	return pkts
+}
+
+func TestMPTS_AddProgram(t *testing.T) {
+	at := assert.New(t)
+
+	m := NewMPTS(bytes.NewBuffer(nil), 0x10, 0)
+
+	pg, err := m.AddProgram(MuxerOptions{ProgramNumber: 1})
+	at.Nil(err)
+	at.Equal(uint16(0x10), pg.Options().TransportStreamID)
+
+	// case1: 节目号重复
+	_, err = m.AddProgram(MuxerOptions{ProgramNumber: 1, VideoPID: 0x200, AudioPID: 0x201, PmtPID: 0x1002})
+	at.NotNil(err)
+
+	// case2: PID与其他节目冲突
+	_, err = m.AddProgram(MuxerOptions{ProgramNumber: 2, VideoPID: 0x200, AudioPID: 0x201})
+	at.NotNil(err)
+	_, err = m.AddProgram(MuxerOptions{ProgramNumber: 2, VideoPID: 0x101, AudioPID: 0x201, PmtPID: 0x1002})
+	at.NotNil(err)
+
+	_, err = m.AddProgram(MuxerOptions{ProgramNumber: 2, VideoPID: 0x200, AudioPID: 0x201, PmtPID: 0x1002})
+	at.Nil(err)
+
+	pg, ok := m.Program(2)
+	at.True(ok)
+	at.Equal(uint16(0x200), pg.Options().VideoPID)
+
+	_, ok = m.Program(3)
+	at.False(ok)
+}
+
+func TestMPTS_Write(t *testing.T) {
+	at := assert.New(t)
+
+	buf := bytes.NewBuffer(nil)
+	m := NewMPTS(buf, 0, 0)
+
+	pg1, err := m.AddProgram(MuxerOptions{ProgramNumber: 1})
+	at.Nil(err)
+	at.Nil(pg1.SetService("provider", "camera1"))
+
+	pg2, err := m.AddProgram(MuxerOptions{ProgramNumber: 2, VideoPID: 0x200, AudioPID: 0x201, PmtPID: 0x1002})
+	at.Nil(err)
+	at.Nil(pg2.SetService("provider", "camera2"))
+
+	// 两路交替写入
+	pkts1 := testFlvPackets(t, 10)
+	pkts2 := testFlvPackets(t, 10)
+	for i := range pkts1 {
+		at.Nil(pg1.Write(pkts1[i]))
+		at.Nil(pg2.Write(pkts2[i]))
+	}
+
+	// case1: 首个音视频帧前输出SDT, PAT和全部PMT
+	ts := buf.Bytes()
+	at.Equal([]byte{0x47, 0x40, 0x11}, ts[:3])
+	at.True(bytes.Contains(ts[:tsPacketLen], []byte("camera1")))
+	at.True(bytes.Contains(ts[:tsPacketLen], []byte("camera2")))
+	at.Equal([]byte{0x47, 0x40, 0x00}, ts[tsPacketLen:tsPacketLen+3])
+	at.Equal([]byte{0x00, 0x01, 0xf0, 0x01, 0x00, 0x02, 0xf0, 0x02}, ts[tsPacketLen+13:tsPacketLen+21])
+	at.Equal([]byte{0x47, 0x50, 0x01}, ts[2*tsPacketLen:2*tsPacketLen+3])
+	at.Equal([]byte{0x47, 0x50, 0x02}, ts[3*tsPacketLen:3*tsPacketLen+3])
+
+	// case2: 每个节目的PCR_PID为各自的视频PID
+	at.Equal([]byte{0xe1, 0x00}, ts[2*tsPacketLen+13:2*tsPacketLen+15])
+	at.Equal([]byte{0xe2, 0x00}, ts[3*tsPacketLen+13:3*tsPacketLen+15])
+
+	// case3: 解复用得到两个节目的全部音视频帧
+	count := make(map[uint16]int)
+	d := NewDemuxer(bytes.NewReader(ts))
+	for {
+		var p packet.Packet
+		err = d.Read(&p)
+		if err == io.EOF {
+			break
+		}
+		at.Nil(err)
+		count[p.Header.(*ESHeader).PID]++
+	}
+	at.Equal(map[uint16]int{0x100: 10, 0x101: 10, 0x200: 10, 0x201: 10}, count)
+}
+
+// 返回PID上每个表分段的版本号
+func readVersions(ts []byte, pid int) []byte {
+	var versions []byte
+	for i := 0; i+tsPacketLen <= len(ts); i += tsPacketLen {
+		pkt := ts[i : i+tsPacketLen]
+		if int(pkt[1]&0x1f)<<8|int(pkt[2]) != pid || pkt[1]&0x40 == 0 {
+			continue
+		}
+		section := pkt[5+pkt[4]:]
+		versions = append(versions, (section[5]>>1)&0x1f)
+	}
+	return versions
+}
+
+func TestMPTS_TableVersion(t *testing.T) {
+	at := assert.New(t)
+
+	buf := bytes.NewBuffer(nil)
+	m := NewMPTS(buf, 0, 0)
+
+	pg1, err := m.AddProgram(MuxerOptions{ProgramNumber: 1})
+	at.Nil(err)
+
+	pkts := testFlvPackets(t, 2)
+	for _, p := range pkts {
+		at.Nil(pg1.Write(p))
+	}
+	// 首个视频帧前输出表, 之后才收到的音频序列头增加了流类型, 只重新输出PMT
+	at.Equal([]byte{0}, readVersions(buf.Bytes(), 0))
+	at.Equal([]byte{0, 1}, readVersions(buf.Bytes(), 0x1001))
+
+	// case1: 输出后添加节目, 立即输出新版本的PAT和新节目的PMT
+	buf.Reset()
+	pg2, err := m.AddProgram(MuxerOptions{ProgramNumber: 2, VideoPID: 0x200, AudioPID: 0x201, PmtPID: 0x1002})
+	at.Nil(err)
+	at.Equal([]byte{1}, readVersions(buf.Bytes(), 0))
+	at.Equal([]byte{0}, readVersions(buf.Bytes(), 0x1002))
+
+	// case2: 新节目的视频和音频序列头各增加一个流类型, PMT的版本号递增
+	buf.Reset()
+	for _, p := range testFlvPackets(t, 2) {
+		at.Nil(pg2.Write(p))
+	}
+	at.Equal([]byte{1, 2}, readVersions(buf.Bytes(), 0x1002))
+	at.Empty(readVersions(buf.Bytes(), 0))
+
+	// case3: 重复的序列头不改变流类型, 不重新输出PMT
+	buf.Reset()
+	at.Nil(pg1.Write(pkts[0]))
+	at.Nil(pg1.Write(pkts[1]))
+	at.Empty(readVersions(buf.Bytes(), 0x1001))
+}
+
+func TestMPTS_Repeat(t *testing.T) {
+	at := assert.New(t)
+
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	buf := bytes.NewBuffer(nil)
+	m := NewMPTS(buf, 0, 0)
+	at.Nil(m.SetNetwork(0x3001, "cable"))
+	at.Nil(m.SetClock(func() time.Time { return now }, ""))
+	at.Nil(m.SetTableInterval(100*time.Millisecond, 200*time.Millisecond))
+	at.Nil(m.SetSIInterval(200*time.Millisecond, 0, 200*time.Millisecond))
+	at.NotNil(m.SetTableInterval(-time.Second, 0))
+
+	pg1, err := m.AddProgram(MuxerOptions{ProgramNumber: 1})
+	at.Nil(err)
+	pg2, err := m.AddProgram(MuxerOptions{ProgramNumber: 2, VideoPID: 0x200, AudioPID: 0x201, PmtPID: 0x1002})
+	at.Nil(err)
+
+	// 两路交替写入, 时钟每两个数据包前进40ms, 共400ms; PAT在120ms, 240ms和360ms处重复输出
+	pkts1 := testFlvPackets(t, 10)
+	pkts2 := testFlvPackets(t, 10)
+	for i := range pkts1 {
+		at.Nil(pg1.Write(pkts1[i]))
+		at.Nil(pg2.Write(pkts2[i]))
+		if i%2 == 1 {
+			now = now.Add(40 * time.Millisecond)
+		}
+	}
+
+	// case1: 共用的表按MPTS的时钟各输出一次, 不随节目数量重复
+	ts := buf.Bytes()
+	count := func(pid uint16) int {
+		return len(testFilterPID(ts, pid)) / tsPacketLen
+	}
+	at.Equal(1+3, count(patPID))
+	at.Equal(1+2, count(sdtPID))
+	at.Equal(1+2, count(nitPID))
+
+	// TDT和TOT各一个TS包
+	at.Equal(2*(1+2), count(tdtPID))
+
+	// case2: 各节目按自己的时间戳重复输出PMT, 另有一次是音频序列头增加了流类型
+	at.Equal(1+1+3, count(0x1001))
+	at.Equal(1+1+3, count(0x1002))
+}
@@ -3,11 +3,14 @@ package ts
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/moggle-mog/goav/container/ts/table"
 	"github.com/moggle-mog/goav/packet"
+	"github.com/moggle-mog/goav/parser/aac"
 )
 
 const (
@@ -15,51 +18,511 @@ const (
 	tsPacketLen      = 188
 )
 
+// program_info_length 的前两位必须为0
+const maxProgramInfoLen = 0x3ff
+
+// 默认的PID和节目设置
+const (
+	defaultVideoPID          = 0x100
+	defaultAudioPID          = 0x101
+	defaultPmtPID            = 0x1001
+	defaultProgramNumber     = 0x1
+	defaultTransportStreamID = 0x1
+	defaultOriginalNetworkID = 0xff01
+)
+
+// 保留的PID
 const (
-	videoPID = 0x100
-	audioPID = 0x101
+	nitPID     = 0x0010
+	sdtPID     = 0x0011
+	eitPID     = 0x0012
+	tdtPID     = 0x0014 // TDT和TOT
+	nullPID    = 0x1fff
+	minUserPID = 0x0020 // 0x0000-0x001f 为PAT, CAT和DVB SI保留
 )
 
+// MuxerOptions TS复用器的PID和节目设置, 为0的字段使用默认值
+type MuxerOptions struct {
+	VideoPID          uint16 // 视频PID, 默认 0x100
+	AudioPID          uint16 // 音频PID, 默认 0x101
+	PmtPID            uint16 // PMT的PID, 默认 0x1001
+	ProgramNumber     uint16 // 节目号(SDT中的service_id), 默认 1
+	TransportStreamID uint16 // transport_stream_id, 默认 1
+	OriginalNetworkID uint16 // SDT中的original_network_id, 默认 0xff01
+
+	AudioLanguage string       // 音频的ISO 639-2语言代码(如 "chi"), 不为空时在PMT中写入 ISO_639_language_descriptor
+	AudioTracks   []AudioTrack // 额外的音频轨道(如解说), 轨道号依次为1, 2, ...; 轨道0为 AudioPID
+
+	ProgramDescriptors []byte // 节目级描述符, 写入PMT的program_info, 可由 table.Descriptor 生成
+}
+
+// AudioTrack 额外的音频轨道
+type AudioTrack struct {
+	PID       uint16
+	Language  string // ISO 639-2语言代码, 为空时不写入语言描述符
+	AudioType byte   // ISO_639_language_descriptor 中的 audio_type, 如 table.AudioTypeVisualImpairedCommentary
+}
+
+// 填充默认值
+func (opts *MuxerOptions) setDefaults() {
+	if opts.VideoPID == 0 {
+		opts.VideoPID = defaultVideoPID
+	}
+	if opts.AudioPID == 0 {
+		opts.AudioPID = defaultAudioPID
+	}
+	if opts.PmtPID == 0 {
+		opts.PmtPID = defaultPmtPID
+	}
+	if opts.ProgramNumber == 0 {
+		opts.ProgramNumber = defaultProgramNumber
+	}
+	if opts.TransportStreamID == 0 {
+		opts.TransportStreamID = defaultTransportStreamID
+	}
+	if opts.OriginalNetworkID == 0 {
+		opts.OriginalNetworkID = defaultOriginalNetworkID
+	}
+}
+
+// 使用的全部PID: 视频, 音频, PMT, 额外的音频轨道
+func (opts *MuxerOptions) pids() []uint16 {
+	pids := []uint16{opts.VideoPID, opts.AudioPID, opts.PmtPID}
+	for _, t := range opts.AudioTracks {
+		pids = append(pids, t.PID)
+	}
+	return pids
+}
+
+// PID的用途, 用于错误信息
+func pidName(i int) string {
+	switch i {
+	case 0:
+		return "video"
+	case 1:
+		return "audio"
+	case 2:
+		return "pmt"
+	}
+	return fmt.Sprintf("audio track %d", i-2)
+}
+
+// 检查PID冲突, 保留的PID和语言代码
+func (opts *MuxerOptions) validate() error {
+	used := make(map[uint16]int)
+	for i, pid := range opts.pids() {
+		if pid < minUserPID || pid >= nullPID {
+			return fmt.Errorf("invalid %s pid(0x%x)", pidName(i), pid)
+		}
+		if j, ok := used[pid]; ok {
+			return fmt.Errorf("%s pid conflicts with %s pid(0x%x)", pidName(i), pidName(j), pid)
+		}
+		used[pid] = i
+	}
+
+	if opts.AudioLanguage != "" && len(opts.AudioLanguage) != 3 {
+		return fmt.Errorf("invalid audio language(%s)", opts.AudioLanguage)
+	}
+	for i, t := range opts.AudioTracks {
+		if t.Language != "" && len(t.Language) != 3 {
+			return fmt.Errorf("invalid language(%s) of audio track %d", t.Language, i+1)
+		}
+	}
+
+	if len(opts.ProgramDescriptors) > maxProgramInfoLen {
+		return fmt.Errorf("program descriptors too long(%d)", len(opts.ProgramDescriptors))
+	}
+
+	return nil
+}
+
+// 音频轨道的复用状态
+type audioTrack struct {
+	pid        uint16
+	streamType byte   /* 音频流类型 */
+	cc         byte   /* 包递增计数器 */
+	config     []byte /* AAC的 AudioSpecificConfig, SAMPLE-AES 的PMT中需要 */
+	language   string
+	audioType  byte
+}
+
+// PMT中音频的ES描述符
+func (t *audioTrack) descriptors(aes bool) []byte {
+	var b []byte
+	if aes && t.streamType == table.StreamTypeAac {
+		b = table.SampleAESAudioDescriptor(sampleAESAudioType(t.config), t.config)
+	}
+
+	if t.language != "" {
+		desc := table.NewDescriptor()
+		if desc.ISO639Language(t.language, t.audioType) == nil {
+			b = append(b, desc.GetBuffer().Bytes()...)
+		}
+	}
+
+	return b
+}
+
+// 默认的PCR最大间隔(40ms), 单位: 90kHz
+const defaultPcrInterval = 40 * avcHZ
+
+// 默认的复用延时(600ms), PCR比dts提前该时长, 留给解码器缓冲数据, 单位: 90kHz
+const defaultMuxDelay = 600 * avcHZ
+
+// 时间戳回退超过1秒时视为不连续, PCR随之回退并设置 discontinuity_indicator, 单位: 90kHz
+const pcrDiscontinuity = 1000 * avcHZ
+
 // Muxer TS复用器
 type Muxer struct {
-	videoCc  byte /* 包递增计数器 */
-	audioCc  byte /* 包递增计数器 */
-	patCc    byte /* 包递增计数器 */
-	pmtCc    byte /* 包递增计数器 */
-	sdt      [tsPacketLen]byte
-	pat      [tsPacketLen]byte
-	pmt      [tsPacketLen]byte
-	tsPacket [tsPacketLen]byte
+	videoType byte   /* 视频流类型 */
+	videoCc   byte   /* 包递增计数器 */
+	patCc     byte   /* 包递增计数器 */
+	pmtCc     byte   /* 包递增计数器 */
+	sdtCc     byte   /* 包递增计数器 */
+	nitCc     byte   /* 包递增计数器 */
+	eitCc     byte   /* 包递增计数器 */
+	tdtCc     byte   /* 包递增计数器 */
+	sdt       []byte /* SDT的TS包, 可能有多个 */
+	pat       []byte /* PAT的TS包, 可能有多个 */
+	pmt       []byte /* PMT的TS包, 可能有多个 */
+	nit       []byte /* NIT的TS包 */
+	eit       []byte /* EIT的TS包 */
+	tdt       []byte /* TDT和TOT的TS包 */
+	tsPacket  [tsPacketLen]byte
+
+	patVersion tableVersion /* PAT的版本号 */
+	pmtVersion tableVersion /* PMT的版本号 */
+	sdtVersion tableVersion /* SDT的版本号 */
+
+	aes *sampleAES /* SAMPLE-AES 加密器, 为空时不加密 */
+
+	opts    MuxerOptions  /* PID和节目设置 */
+	network *network      /* NIT中的网络, 为空时不输出NIT */
+	eitPF   bool          /* 是否输出EIT present/following, 写入SDT的 EIT_present_following_flag */
+	audio   []*audioTrack /* 音频轨道, 0为 AudioPID */
+
+	pcrPID      uint16 /* PMT中的PCR_PID, 有视频时为视频PID, 纯音频时为音频PID */
+	pcrInterval int64  /* PCR的最大间隔, 单位: 90kHz */
+	pcrWritten  bool   /* 是否已写入过PCR(resetPcr 后重新计时) */
+	pcrStarted  bool   /* 是否写入过PCR, resetPcr 后仍保留, 用于判断PCR是否回退 */
+	lastPcr     int64  /* 最近一次写入的PCR */
+	pcrDts      int64  /* PCR_PID上一个PES的dts, 用于估计帧间隔 */
+	muxDelay    int64  /* 复用延时, PCR = dts - muxDelay, 单位: 90kHz */
+
+	pidDts map[uint16]int64 /* 各PID上一个PES的dts, PCR不能超过尚在传输的数据的dts */
 }
 
 // NewMuxer TS复用器
 func NewMuxer() *Muxer {
-	return &Muxer{}
+	var opts MuxerOptions
+	opts.setDefaults()
+
+	muxer := &Muxer{
+		videoType:   table.StreamTypeAvc,
+		pcrInterval: defaultPcrInterval,
+		muxDelay:    defaultMuxDelay,
+	}
+	muxer.applyOptions(opts)
+
+	return muxer
+}
+
+// SetOptions 设置PID和节目设置, 为0的字段使用默认值; PID冲突或使用保留的PID时返回错误
+func (muxer *Muxer) SetOptions(opts MuxerOptions) error {
+	opts.setDefaults()
+
+	err := opts.validate()
+	if err != nil {
+		return err
+	}
+
+	muxer.applyOptions(opts)
+	return nil
+}
+
+// 使用新的设置, 保留已有音频轨道的流类型, 计数器和配置
+func (muxer *Muxer) applyOptions(opts MuxerOptions) {
+	tracks := []AudioTrack{{PID: opts.AudioPID, Language: opts.AudioLanguage}}
+	tracks = append(tracks, opts.AudioTracks...)
+
+	audio := make([]*audioTrack, len(tracks))
+	for i, t := range tracks {
+		if i < len(muxer.audio) {
+			audio[i] = muxer.audio[i]
+		} else {
+			audio[i] = &audioTrack{streamType: table.StreamTypeAac}
+		}
+
+		audio[i].pid = t.PID
+		audio[i].language = t.Language
+		audio[i].audioType = t.AudioType
+	}
+
+	muxer.opts = opts
+	muxer.audio = audio
+	muxer.pcrPID = opts.VideoPID
+	muxer.pidDts = make(map[uint16]int64)
+}
+
+// 音频轨道, 不存在时返回nil
+func (muxer *Muxer) track(i int) *audioTrack {
+	if i < 0 || i >= len(muxer.audio) {
+		return nil
+	}
+	return muxer.audio[i]
+}
+
+// Options 返回当前的PID和节目设置
+func (muxer *Muxer) Options() MuxerOptions {
+	return muxer.opts
+}
+
+// SetPcrInterval 设置PCR的最大间隔, 默认40ms
+// PCR_PID上的PES按帧间隔估计, 下一帧会超过间隔时写入PCR; 其他PID的数据到达时已超过间隔, 则在PCR_PID上插入只含PCR的TS包
+func (muxer *Muxer) SetPcrInterval(d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("invalid pcr interval(%v)", d)
+	}
+
+	muxer.pcrInterval = int64(d) * avcHZ / int64(time.Millisecond)
+	return nil
+}
+
+// SetMuxDelay 设置复用延时, 默认600ms; PCR比dts提前该时长, 开始时PCR从33位时间戳的末尾回绕
+func (muxer *Muxer) SetMuxDelay(d time.Duration) error {
+	if d < 0 {
+		return fmt.Errorf("invalid mux delay(%v)", d)
+	}
+
+	muxer.muxDelay = int64(d) * avcHZ / int64(time.Millisecond)
+	return nil
+}
+
+// 由dts得到PCR: 比dts提前复用延时, 且不超过各PID上一个PES的dts;
+// 上一个PES早于dts超过 pcrDiscontinuity 的PID视为已中断, 不再限制PCR
+func (muxer *Muxer) pcrOf(dts int64) int64 {
+	pcr := dts - muxer.muxDelay
+	for _, last := range muxer.pidDts {
+		if last < pcr && last >= dts-pcrDiscontinuity {
+			pcr = last
+		}
+	}
+	return pcr
+}
+
+// 重新开始PCR计时, PCR_PID上的下一个PES会写入PCR
+func (muxer *Muxer) resetPcr() {
+	muxer.pcrWritten = false
+}
+
+// PCR_PID上的PES是否需要写入PCR, 帧间隔按dts估计
+func (muxer *Muxer) pcrDue(dts, pcr int64) bool {
+	var interval int64
+	if dts > muxer.pcrDts {
+		interval = dts - muxer.pcrDts
+	}
+	muxer.pcrDts = dts
+
+	if !muxer.pcrWritten || pcr < muxer.lastPcr-pcrDiscontinuity {
+		return true
+	}
+
+	return pcr+interval-muxer.lastPcr > muxer.pcrInterval
+}
+
+// 检查要写入的PCR, PCR保持单调递增:
+// 不大于上次的PCR时不写入(如音频先于视频到达时插入的PCR), 回退超过 pcrDiscontinuity 或 resetPcr 后回退时标记不连续
+func (muxer *Muxer) nextPcr(pcr int64) (next int64, discontinuity bool, ok bool) {
+	if !muxer.pcrStarted {
+		return pcr, false, true
+	}
+
+	if pcr < muxer.lastPcr && (!muxer.pcrWritten || pcr < muxer.lastPcr-pcrDiscontinuity) {
+		return pcr, true, true
+	}
+
+	if pcr <= muxer.lastPcr {
+		return 0, false, false
+	}
+
+	return pcr, false, true
+}
+
+// 记录写入的PCR
+func (muxer *Muxer) savePcr(pcr int64) {
+	muxer.lastPcr = pcr
+	muxer.pcrWritten = true
+	muxer.pcrStarted = true
+}
+
+// 在PCR_PID上写入只含自适应域和PCR的TS包, 不含负载时包递增计数器不变
+func (muxer *Muxer) writePcr(pcr int64, w io.Writer) error {
+	cc := muxer.videoCc
+	for _, t := range muxer.audio {
+		if t.pid == muxer.pcrPID {
+			cc = t.cc
+		}
+	}
+
+	pes := table.NewPes()
+
+	muxer.tsPacket[0] = 0x47
+	muxer.tsPacket[1] = byte(muxer.pcrPID >> 8)
+	muxer.tsPacket[2] = byte(muxer.pcrPID)
+	muxer.tsPacket[3] = 0x20 | cc
+	muxer.tsPacket[4] = tsPacketLen - 5
+	muxer.tsPacket[5] = 0x10
+	pes.WritePcr(muxer.tsPacket[6:], pcr&maxTimestamp)
+	for i := 12; i < tsPacketLen; i++ {
+		muxer.tsPacket[i] = 0xff
+	}
+
+	muxer.savePcr(pcr)
+	_, err := w.Write(muxer.tsPacket[:])
+	return err
+}
+
+// SetVideoStreamType 设置PMT中视频的流类型, 支持 table.StreamTypeAvc 和 table.StreamTypeHevc
+func (muxer *Muxer) SetVideoStreamType(streamType byte) {
+	muxer.videoType = streamType
+}
+
+// SetAudioStreamType 设置PMT中音频的流类型, 支持 table.StreamTypeAac, table.StreamTypeMpeg1Audio 和 table.StreamTypeMpeg2Audio
+func (muxer *Muxer) SetAudioStreamType(streamType byte) {
+	muxer.audio[0].streamType = streamType
+}
+
+// SetSampleAES 设置 SAMPLE-AES 的密钥和初始向量(均为16字节), key为空时不加密
+// 加密后PMT中的流类型为 table.StreamTypeAvcSampleAES 和 table.StreamTypeAacSampleAES, 不支持H265和mp3
+func (muxer *Muxer) SetSampleAES(key, iv []byte) error {
+	if len(key) == 0 {
+		muxer.aes = nil
+		return nil
+	}
+
+	s, err := newSampleAES(key, iv)
+	if err != nil {
+		return err
+	}
+
+	muxer.aes = s
+	return nil
+}
+
+// SetAudioConfig 设置AAC的 AudioSpecificConfig, 用于生成 SAMPLE-AES 的PMT
+func (muxer *Muxer) SetAudioConfig(config []byte) {
+	muxer.audio[0].setConfig(config)
+}
+
+func (t *audioTrack) setConfig(config []byte) {
+	t.config = append(t.config[:0], config...)
+}
+
+// 加密音视频数据
+func (muxer *Muxer) encrypt(p *packet.Packet, track *audioTrack) ([]byte, error) {
+	switch p.Type {
+	case packet.PktVideo:
+		if muxer.videoType != table.StreamTypeAvc {
+			return nil, errors.New("sample-aes supports h264 video only")
+		}
+		return muxer.aes.encryptVideo(p.Media), nil
+	case packet.PktAudio:
+		if track.streamType != table.StreamTypeAac {
+			return nil, errors.New("sample-aes supports aac audio only")
+		}
+		return muxer.aes.encryptAudio(p.Media)
+	}
+
+	return p.Media, nil
+}
+
+// AAC的 SAMPLE-AES 音频类型
+func sampleAESAudioType(config []byte) string {
+	cfg, err := aac.ParseConfig(config)
+	if err == nil {
+		switch {
+		case cfg.PS:
+			return "zacp"
+		case cfg.SBR:
+			return "zach"
+		}
+	}
+
+	return "zaac"
 }
 
 // Mux 复用TS流(使用到: p.Header(FLV信息), p.data(FLV数据),p.Media(音视频数据), p.Timestamp)
 // 视频数据含有B帧时, pts需要在dts的基础上加偏移量; 如果不含B帧, 则pts=dts
 func (muxer *Muxer) Mux(p *packet.Packet, dts, pts int64, w io.Writer) error {
-	var pid int
+	return muxer.mux(p, 0, dts, pts, w)
+}
+
+// MuxTrack 复用音频轨道track(0为 AudioPID, 1起为 MuxerOptions.AudioTracks)的音频数据
+func (muxer *Muxer) MuxTrack(track int, p *packet.Packet, dts, pts int64, w io.Writer) error {
+	if p.Type != packet.PktAudio {
+		return fmt.Errorf("audio track supports audio only,type=%d", p.Type)
+	}
+
+	return muxer.mux(p, track, dts, pts, w)
+}
+
+func (muxer *Muxer) mux(p *packet.Packet, track int, dts, pts int64, w io.Writer) error {
+	var pid uint16
+	var cc *byte
 	var header = p.Header
 	var isKeyFrame bool
+	var media = p.Media
+
+	at := muxer.track(track)
+	if at == nil {
+		return fmt.Errorf("audio track %d not found", track)
+	}
 
 	switch p.Type {
 	case packet.PktVideo:
-		pid = videoPID
+		pid = muxer.opts.VideoPID
+		cc = &muxer.videoCc
 
 		vh := header.(packet.VideoPacketHeader)
 		isKeyFrame = vh.IsKeyFrame()
 	case packet.PktAudio:
-		pid = audioPID
+		pid = at.pid
+		cc = &at.cc
 	default:
 		return fmt.Errorf("support audio and video only,type=%d", p.Type)
 	}
 
+	// PCR_PID上的PES在首包中写入PCR, 视频关键帧总是写入PCR(PCR不能回退);
+	// 其他PID的数据到达时距离上次PCR已超过间隔, 先插入只含PCR的TS包
+	muxer.pidDts[pid] = dts
+	pcr := muxer.pcrOf(dts)
+
+	withPcr := false
+	var pcrDisc bool
+	if pid == muxer.pcrPID {
+		if muxer.pcrDue(dts, pcr) || isKeyFrame {
+			pcr, pcrDisc, withPcr = muxer.nextPcr(pcr)
+		}
+	} else if muxer.pcrWritten && pcr-muxer.lastPcr >= muxer.pcrInterval {
+		err := muxer.writePcr(pcr, w)
+		if err != nil {
+			return err
+		}
+	}
+
+	// SAMPLE-AES 加密
+	if muxer.aes != nil && len(media) > 0 {
+		var err error
+		media, err = muxer.encrypt(p, at)
+		if err != nil {
+			return err
+		}
+	}
+
 	// 生成pes头, 获取头的长度以及pes包总长度
 	pes := table.NewPes()
-	pesHeaderLen := pes.GeneratePesHeader(p.Type, len(p.Media), pts, dts)
-	pesTotalLen := len(p.Media) + pesHeaderLen
+	pesHeaderLen := pes.GeneratePesHeader(p.Type, len(media), pts, dts)
+	pesTotalLen := len(media) + pesHeaderLen
 
 	// 填充ts头
 	pes.TsHeader[1] = byte(pid >> 8)
@@ -80,39 +543,33 @@ func (muxer *Muxer) Mux(p *packet.Packet, dts, pts int64, w io.Writer) error {
 		}
 
 		// 更新音视频计数器
-		switch p.Type {
-		case packet.PktVideo:
-			muxer.videoCc++
-			if muxer.videoCc > 0xf {
-				muxer.videoCc = 0
-			}
-
-			muxer.tsPacket[3] |= muxer.videoCc
-		case packet.PktAudio:
-			muxer.audioCc++
-			if muxer.audioCc > 0xf {
-				muxer.audioCc = 0
-			}
-
-			muxer.tsPacket[3] |= muxer.audioCc
+		*cc++
+		if *cc > 0xf {
+			*cc = 0
 		}
 
+		muxer.tsPacket[3] |= *cc
+
 		// 去除包头4个字节, 从第5个字节开始算
 		i := byte(4)
 
-		// 首个视频关键帧需要加pcr的自适应域
-		if firstPes && isKeyFrame {
+		// PES的首包中加入pcr的自适应域
+		if firstPes && withPcr {
 			// 既有负载也有附加区域
 			muxer.tsPacket[3] |= 0x20
 
 			// 自适应域长度
 			muxer.tsPacket[4] = 0x7
 
-			// 包含PCR
+			// 包含PCR, 时间戳回退时设置 discontinuity_indicator
 			muxer.tsPacket[5] = 0x50
+			if pcrDisc {
+				muxer.tsPacket[5] |= 0x80
+			}
 
 			// 写入PCR
-			pes.WritePcr(muxer.tsPacket[6:], dts)
+			pes.WritePcr(muxer.tsPacket[6:], pcr&maxTimestamp)
+			muxer.savePcr(pcr)
 
 			i += 1 + muxer.tsPacket[4]
 		}
@@ -121,16 +578,24 @@ func (muxer *Muxer) Mux(p *packet.Packet, dts, pts int64, w io.Writer) error {
 		maxPayloadLen := tsPacketLen - i
 
 		// 计算待填充的长度
-		if pesTotalLen < tsDefaultDataLen {
+		if pesTotalLen < int(maxPayloadLen) {
 			// 除去pes外, 还应填充的无效字节长度
 			remainBytes := maxPayloadLen - byte(pesTotalLen)
 
 			// pes的有效数据长度
 			maxPayloadLen = byte(pesTotalLen)
 
-			// 首包或尾包有自适应域, 填充无效字符
-			muxer.tsPacket[3] |= 0x20
-			pes.WriteStuff(muxer.tsPacket[i:], remainBytes)
+			if muxer.tsPacket[3]&0x20 != 0 {
+				// 已有带PCR的自适应域, 在其后追加填充字节
+				muxer.tsPacket[4] += remainBytes
+				for j := byte(0); j < remainBytes; j++ {
+					muxer.tsPacket[i+j] = 0xff
+				}
+			} else {
+				// 首包或尾包有自适应域, 填充无效字符
+				muxer.tsPacket[3] |= 0x20
+				pes.WriteStuff(muxer.tsPacket[i:], remainBytes)
+			}
 
 			i += remainBytes
 		}
@@ -164,11 +629,11 @@ func (muxer *Muxer) Mux(p *packet.Packet, dts, pts int64, w io.Writer) error {
 
 		// 如果还有剩余的空间, 则继续填充pes包体
 		if maxPayloadLen > 0 {
-			if dataIndex+int(maxPayloadLen) > len(p.Media) {
-				return fmt.Errorf("index is too long(%d + %d > %d)", dataIndex, maxPayloadLen, len(p.Media))
+			if dataIndex+int(maxPayloadLen) > len(media) {
+				return fmt.Errorf("index is too long(%d + %d > %d)", dataIndex, maxPayloadLen, len(media))
 			}
 
-			copy(muxer.tsPacket[i:], p.Media[dataIndex:dataIndex+int(maxPayloadLen)])
+			copy(muxer.tsPacket[i:], media[dataIndex:dataIndex+int(maxPayloadLen)])
 			dataIndex += int(maxPayloadLen)
 			pesTotalLen -= int(maxPayloadLen)
 		}
@@ -185,136 +650,127 @@ func (muxer *Muxer) Mux(p *packet.Packet, dts, pts int64, w io.Writer) error {
 	return nil
 }
 
-// SDT make service description table
+// SDT make service description table, desc过长时返回nil
 func (muxer *Muxer) SDT(desc *bytes.Buffer) []byte {
-	sdt := table.NewSdt()
-
-	// 填充TS头
-	i := 0
-	copy(muxer.sdt[i:], sdt.TsHeader)
-	i += len(sdt.TsHeader)
-
-	// 修正长度, 填充SDT头
-	sectionLen := 17 + desc.Len()
-	sdt.SdtHeader[1] |= byte(sectionLen>>8) & 0x0F
-	sdt.SdtHeader[2] = byte(sectionLen)
-	sdt.SdtHeader[14] |= byte((sectionLen-17)>>8) & 0x0F
-	sdt.SdtHeader[15] = byte(sectionLen - 17)
-	copy(muxer.sdt[i:], sdt.SdtHeader)
-	i += len(sdt.SdtHeader)
-
-	// 填充描述信息
-	copy(muxer.sdt[i:], desc.Bytes())
-	i += desc.Len()
+	b, _ := muxer.packSdt(desc)
+	return b
+}
 
-	// 计算CRC32
-	crc32Value := GenerateCrc32(muxer.sdt[len(sdt.TsHeader):i])
-	muxer.sdt[i] = byte(crc32Value >> 24)
-	i++
-	muxer.sdt[i] = byte(crc32Value >> 16)
-	i++
-	muxer.sdt[i] = byte(crc32Value >> 8)
-	i++
-	muxer.sdt[i] = byte(crc32Value)
-	i++
+// 生成并封装SDT, desc过长(超过分段的最大长度)时返回错误
+func (muxer *Muxer) packSdt(desc *bytes.Buffer) ([]byte, error) {
+	sdt := table.NewSdt(muxer.opts.TransportStreamID, muxer.opts.OriginalNetworkID)
+	sdt.AddService(muxer.opts.ProgramNumber, desc.Bytes())
+	sdt.Services[0].EITPresentFollowing = muxer.eitPF
 
-	for j := 0; j < tsPacketLen-i; j++ {
-		muxer.sdt[i+j] = 0xff
+	sections, err := sdt.Sections()
+	if err != nil {
+		return nil, err
 	}
+	sdt.Version = muxer.sdtVersion.next(bytes.Join(sections, nil))
 
-	return muxer.sdt[:]
+	// 版本号变化后重新生成分段
+	sections, _ = sdt.Sections()
+	muxer.sdt = packSections(sdtPID, &muxer.sdtCc, muxer.sdt[:0], sections...)
+	return muxer.sdt, nil
 }
 
 // PAT make program associate table
 func (muxer *Muxer) PAT() []byte {
-	pat := table.NewPat()
-
-	// 填写包递增计数器, 共4位, 超出则归零
-	if muxer.patCc > 0xf {
-		muxer.patCc = 0
+	pat := table.NewPat(muxer.opts.TransportStreamID)
+	if muxer.network != nil {
+		pat.AddProgram(0, nitPID)
 	}
-	pat.TsHeader[3] |= muxer.patCc & 0x0f
-	muxer.patCc++
+	pat.AddProgram(muxer.opts.ProgramNumber, muxer.opts.PmtPID)
+
+	// 最多2个节目, 不会出错
+	sections, _ := pat.Sections()
+	pat.Version = muxer.patVersion.next(bytes.Join(sections, nil))
+
+	sections, _ = pat.Sections()
+	muxer.pat = packSections(patPID, &muxer.patCc, muxer.pat[:0], sections...)
+	return muxer.pat
+}
 
-	i := 0
-	copy(muxer.pat[i:], pat.TsHeader)
-	i += len(pat.TsHeader)
+// PMT make program map table, mediaType: PktVideo or PktAudio; PMT过长时返回nil
+func (muxer *Muxer) PMT(mediaType ...int) []byte {
+	b, _ := muxer.packPmt(mediaType...)
+	return b
+}
 
-	copy(muxer.pat[i:], pat.PatHeader)
-	i += len(pat.PatHeader)
+// 生成并封装PMT, PMT只有一个分段, 描述符或音频轨道过多, 超过1021字节时返回错误
+func (muxer *Muxer) packPmt(mediaType ...int) ([]byte, error) {
+	pmt := muxer.pmtTable(mediaType...)
 
-	// 计算CRC32
-	crc32Value := GenerateCrc32(pat.PatHeader)
-	muxer.pat[i] = byte(crc32Value >> 24)
-	i++
-	muxer.pat[i] = byte(crc32Value >> 16)
-	i++
-	muxer.pat[i] = byte(crc32Value >> 8)
-	i++
-	muxer.pat[i] = byte(crc32Value)
-	i++
+	section, err := pmt.Section()
+	if err != nil {
+		return nil, err
+	}
 
-	for j := 0; j < tsPacketLen-i; j++ {
-		muxer.pat[i+j] = 0xff
+	if pmt.PcrPID != nullPID {
+		muxer.pcrPID = pmt.PcrPID
 	}
 
-	return muxer.pat[:]
+	// 流类型或基本流变化时(如改为mp3, HEVC, SAMPLE-AES, 或之后才收到序列头)递增版本号
+	pmt.Version = muxer.pmtVersion.next(section)
+
+	section, _ = pmt.Section()
+	muxer.pmt = packSections(muxer.opts.PmtPID, &muxer.pmtCc, muxer.pmt[:0], section)
+	return muxer.pmt, nil
 }
 
-// PMT make program map table, mediaType: PktVideo or PktAudio
-func (muxer *Muxer) PMT(mediaType ...int) []byte {
-	pmt := table.NewPmt()
-	pro := table.NewProgram()
+// PMT的内容是否与上次输出的不同(或尚未输出过), PMT过长时也返回true, 由 packPmt 返回错误
+func (muxer *Muxer) pmtChanged(mediaType ...int) bool {
+	section, err := muxer.pmtTable(mediaType...).Section()
+	return err != nil || muxer.pmtVersion.changed(section)
+}
+
+// 生成PMT(版本号为0)
+func (muxer *Muxer) pmtTable(mediaType ...int) *table.Pmt {
+	// 节目参考时钟(PCR_PID): 有视频时使用视频PID, 纯音频时使用音频PID, 没有基本流时为 0x1fff
+	// 额外的音频轨道总是列在PMT中
+	pcrPID := uint16(nullPID)
+	if len(muxer.audio) > 1 {
+		pcrPID = muxer.audio[1].pid
+	}
+	for _, v := range mediaType {
+		if v == packet.PktVideo {
+			pcrPID = muxer.opts.VideoPID
+			break
+		}
+		if v == packet.PktAudio {
+			pcrPID = muxer.audio[0].pid
+		}
+	}
+	pmt := table.NewPmt(muxer.opts.ProgramNumber, pcrPID)
+	pmt.ProgramInfo = muxer.opts.ProgramDescriptors
 
 	// 填充节目信息
-	var programInfo bytes.Buffer
 	for _, v := range mediaType {
 		switch v {
 		case packet.PktVideo:
-			// 视频节目参考时钟(PCR_PID)所在TS分组的PID: 0x00
-			pmt.PmtHeader[9] = 0x00
-			programInfo.Write(pro.Avc)
+			if muxer.aes != nil && muxer.videoType == table.StreamTypeAvc {
+				pmt.AddStream(table.StreamTypeAvcSampleAES, muxer.opts.VideoPID, table.SampleAESVideoDescriptor())
+				continue
+			}
+			pmt.AddStream(muxer.videoType, muxer.opts.VideoPID, nil)
 		case packet.PktAudio:
-			// 音频节目参考时钟(PCR_PID)所在TS分组的PID: 0x01
-			pmt.PmtHeader[9] = 0x01
-			programInfo.Write(pro.Aac)
+			muxer.addAudioStream(pmt, muxer.audio[0])
 		}
 	}
 
-	// section length
-	pmt.PmtHeader[2] = byte(programInfo.Len() + 9 + 4)
-
-	// 填写包递增计数器, 共4位, 超出则归零
-	if muxer.pmtCc > 0xf {
-		muxer.pmtCc = 0
+	for _, t := range muxer.audio[1:] {
+		muxer.addAudioStream(pmt, t)
 	}
-	pmt.TsHeader[3] |= muxer.pmtCc & 0x0f
-	muxer.pmtCc++
-
-	i := 0
-	copy(muxer.pmt[i:], pmt.TsHeader)
-	i += len(pmt.TsHeader)
 
-	copy(muxer.pmt[i:], pmt.PmtHeader)
-	i += len(pmt.PmtHeader)
-
-	copy(muxer.pmt[i:], programInfo.Bytes())
-	i += programInfo.Len()
-
-	// 计算CRC32
-	crc32Value := GenerateCrc32(muxer.pmt[len(pmt.TsHeader):i])
-	muxer.pmt[i] = byte(crc32Value >> 24)
-	i++
-	muxer.pmt[i] = byte(crc32Value >> 16)
-	i++
-	muxer.pmt[i] = byte(crc32Value >> 8)
-	i++
-	muxer.pmt[i] = byte(crc32Value)
-	i++
+	return pmt
+}
 
-	for j := 0; j < tsPacketLen-i; j++ {
-		muxer.pmt[i+j] = 0xff
+// PMT中添加音频轨道
+func (muxer *Muxer) addAudioStream(pmt *table.Pmt, t *audioTrack) {
+	streamType := t.streamType
+	if muxer.aes != nil && streamType == table.StreamTypeAac {
+		streamType = table.StreamTypeAacSampleAES
 	}
 
-	return muxer.pmt[:]
+	pmt.AddStream(streamType, t.pid, t.descriptors(muxer.aes != nil))
 }
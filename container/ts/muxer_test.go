@@ -3,7 +3,9 @@ package ts
 import (
 	"bytes"
 	"testing"
+	"time"
 
+	"github.com/moggle-mog/goav/container/flv"
 	"github.com/moggle-mog/goav/container/ts/table"
 	"github.com/moggle-mog/goav/packet"
 	"github.com/stretchr/testify/assert"
@@ -174,3 +176,378 @@ func TestMuxer_Table(t *testing.T) {
 		0xff, 0xff, 0xff,
 	}, buf.Bytes())
 }
+
+func TestMuxer_PMTHevc(t *testing.T) {
+	at := assert.New(t)
+
+	mux := NewMuxer()
+	mux.SetVideoStreamType(table.StreamTypeHevc)
+
+	pmt := mux.PMT(packet.PktVideo)
+	at.Equal([]byte{
+		0x47, 0x50, 0x1, 0x10, 0x0, 0x2, 0xb0, 0x12,
+		0x0, 0x1, 0xc1, 0x0, 0x0, 0xe1, 0x0, 0xf0,
+		0x0, 0x24, 0xe1, 0x0, 0xf0, 0x0,
+	}, pmt[:22])
+}
+
+func TestMuxer_PMTMp3(t *testing.T) {
+	at := assert.New(t)
+
+	mux := NewMuxer()
+	mux.SetAudioStreamType(table.StreamTypeMpeg2Audio)
+
+	pmt := mux.PMT(packet.PktAudio)
+	at.Equal([]byte{
+		0x47, 0x50, 0x1, 0x10, 0x0, 0x2, 0xb0, 0x12,
+		0x0, 0x1, 0xc1, 0x0, 0x0, 0xe1, 0x1, 0xf0,
+		0x0, 0x4, 0xe1, 0x1, 0xf0, 0x0,
+	}, pmt[:22])
+}
+
+// 按PID统计TS包的数量, 以及带有PCR的包的数量
+func testCountPackets(ts []byte) (map[int]int, map[int]int) {
+	count := make(map[int]int)
+	pcr := make(map[int]int)
+	for i := 0; i+tsPacketLen <= len(ts); i += tsPacketLen {
+		b := ts[i : i+tsPacketLen]
+		pid := int(b[1]&0x1f)<<8 | int(b[2])
+		count[pid]++
+		if b[3]&0x20 != 0 && b[4] > 0 && b[5]&0x10 != 0 {
+			pcr[pid]++
+		}
+	}
+	return count, pcr
+}
+
+func TestMuxer_Pcr(t *testing.T) {
+	at := assert.New(t)
+
+	at.NotNil(NewMuxer().SetPcrInterval(0))
+
+	// case1: 纯音频时PCR_PID为音频PID, 音频帧间隔23ms, 每个PES都写入PCR
+	m := NewMuxer()
+	pmt := m.PMT(packet.PktAudio)
+	at.Equal([]byte{0xe1, 0x01}, pmt[13:15])
+
+	buf := bytes.NewBuffer(nil)
+	for i := 0; i < 10; i++ {
+		at.Nil(m.Mux(&packet.Packet{Type: packet.PktAudio, Media: []byte{0xff, 0xf1}}, int64(i*23*avcHZ), int64(i*23*avcHZ), buf))
+	}
+	count, pcr := testCountPackets(buf.Bytes())
+	at.Equal(10, count[defaultAudioPID])
+	at.Equal(10, pcr[defaultAudioPID])
+
+	// case2: 有视频时PCR_PID为视频PID
+	m = NewMuxer()
+	at.Nil(m.SetPcrInterval(100 * time.Millisecond))
+	pmt = m.PMT(packet.PktVideo, packet.PktAudio)
+	at.Equal([]byte{0xe1, 0x00}, pmt[13:15])
+
+	d := flv.NewDemuxer()
+	key := &packet.Packet{Type: packet.PktVideo, Data: []byte{0x17, 0x01, 0x00, 0x00, 0x00}}
+	at.Nil(d.Demux(key))
+	key.Media = []byte{0x00, 0x00, 0x00, 0x01, 0x65}
+
+	buf.Reset()
+	at.Nil(m.Mux(key, 0, 0, buf))
+
+	// case3: 视频中断时, 音频到达时超过间隔则在视频PID上插入只含PCR的包, 包递增计数器不变
+	// 在120ms, 240ms, 360ms处插入
+	for i := 1; i <= 9; i++ {
+		at.Nil(m.Mux(&packet.Packet{Type: packet.PktAudio, Media: []byte{0xff, 0xf1}}, int64(i*40*avcHZ), int64(i*40*avcHZ), buf))
+	}
+	count, pcr = testCountPackets(buf.Bytes())
+	at.Equal(9, count[defaultAudioPID])
+	at.Equal(0, pcr[defaultAudioPID])
+	at.Equal(1+3, count[defaultVideoPID])
+	at.Equal(1+3, pcr[defaultVideoPID])
+
+	last := buf.Bytes()[buf.Len()-2*tsPacketLen:]
+	at.Equal([]byte{0x47, 0x01, 0x00, 0x20 | m.videoCc, 0xb7, 0x10}, last[:6])
+	at.Equal(byte(0xff), last[tsPacketLen-1])
+}
+
+// 读取PID上的PCR(90kHz)和 discontinuity_indicator
+func readPcrs(ts []byte, pid int) ([]int64, []bool) {
+	var pcrs []int64
+	var disc []bool
+	for i := 0; i+tsPacketLen <= len(ts); i += tsPacketLen {
+		b := ts[i : i+tsPacketLen]
+		if int(b[1]&0x1f)<<8|int(b[2]) != pid || b[3]&0x20 == 0 || b[4] == 0 || b[5]&0x10 == 0 {
+			continue
+		}
+		pcr := int64(b[6])<<25 | int64(b[7])<<17 | int64(b[8])<<9 | int64(b[9])<<1 | int64(b[10]>>7)
+		pcrs = append(pcrs, pcr)
+		disc = append(disc, b[5]&0x80 != 0)
+	}
+	return pcrs, disc
+}
+
+func TestMuxer_PcrMonotonic(t *testing.T) {
+	at := assert.New(t)
+
+	m := NewMuxer()
+	at.Nil(m.SetMuxDelay(0))
+	m.PMT(packet.PktVideo, packet.PktAudio)
+	buf := bytes.NewBuffer(nil)
+
+	d := flv.NewDemuxer()
+	video := func(ms int64, key bool) {
+		flag := byte(0x27)
+		if key {
+			flag = 0x17
+		}
+		p := &packet.Packet{Type: packet.PktVideo, Data: []byte{flag, 0x01, 0x00, 0x00, 0x00}}
+		at.Nil(d.Demux(p))
+		p.Media = []byte{0x00, 0x00, 0x00, 0x01, 0x41}
+		at.Nil(m.Mux(p, ms*avcHZ, ms*avcHZ, buf))
+	}
+	audio := func(ms int64) {
+		at.Nil(m.Mux(&packet.Packet{Type: packet.PktAudio, Media: []byte{0xff, 0xf1}}, ms*avcHZ, ms*avcHZ, buf))
+	}
+
+	// case1: PCR不超过各PID上一个PES的dts(音频60ms到达后视频80ms的PCR为60ms), 且不回退
+	video(0, true)
+	audio(60)
+	video(40, true)
+	video(80, false)
+	audio(120)
+	video(120, false)
+	video(160, false)
+
+	pcrs, disc := readPcrs(buf.Bytes(), defaultVideoPID)
+	at.Equal([]int64{0, 40 * avcHZ, 60 * avcHZ, 120 * avcHZ}, pcrs)
+	at.Equal([]bool{false, false, false, false}, disc)
+
+	// case2: 时间戳回退超过1秒时PCR随之回退, 并设置 discontinuity_indicator
+	buf.Reset()
+	video(5000, false)
+	video(0, true)
+	pcrs, disc = readPcrs(buf.Bytes(), defaultVideoPID)
+	at.Equal([]int64{5000 * avcHZ, 0}, pcrs)
+	at.Equal([]bool{false, true}, disc)
+
+	// case3: resetPcr 之后回退也设置 discontinuity_indicator, 不回退时不设置
+	buf.Reset()
+	m.resetPcr()
+	video(40, true)
+	m.resetPcr()
+	video(20, true)
+	pcrs, disc = readPcrs(buf.Bytes(), defaultVideoPID)
+	at.Equal([]int64{40 * avcHZ, 20 * avcHZ}, pcrs)
+	at.Equal([]bool{false, true}, disc)
+}
+
+func TestMuxer_MuxDelay(t *testing.T) {
+	at := assert.New(t)
+
+	at.NotNil(NewMuxer().SetMuxDelay(-time.Millisecond))
+
+	m := NewMuxer()
+	m.PMT(packet.PktVideo, packet.PktAudio)
+	buf := bytes.NewBuffer(nil)
+
+	d := flv.NewDemuxer()
+	key := &packet.Packet{Type: packet.PktVideo, Data: []byte{0x17, 0x01, 0x00, 0x00, 0x00}}
+	at.Nil(d.Demux(key))
+	key.Media = []byte{0x00, 0x00, 0x00, 0x01, 0x65}
+	audio := &packet.Packet{Type: packet.PktAudio, Media: []byte{0xff, 0xf1}}
+
+	// case1: PCR比dts提前默认的复用延时600ms
+	at.Nil(m.Mux(key, 2000*avcHZ, 2000*avcHZ, buf))
+	pcrs, _ := readPcrs(buf.Bytes(), defaultVideoPID)
+	at.Equal([]int64{1400 * avcHZ}, pcrs)
+
+	// case2: 音频落后视频800ms, PCR不超过音频的dts
+	m = NewMuxer()
+	buf.Reset()
+	at.Nil(m.Mux(audio, 1200*avcHZ, 1200*avcHZ, buf))
+	at.Nil(m.Mux(key, 2000*avcHZ, 2000*avcHZ, buf))
+	at.Nil(m.Mux(audio, 1240*avcHZ, 1240*avcHZ, buf))
+	at.Nil(m.Mux(key, 2080*avcHZ, 2080*avcHZ, buf))
+
+	// case3: 音频中断超过1秒后不再限制PCR
+	at.Nil(m.Mux(key, 2300*avcHZ, 2300*avcHZ, buf))
+
+	pcrs, _ = readPcrs(buf.Bytes(), defaultVideoPID)
+	at.Equal([]int64{1200 * avcHZ, 1240 * avcHZ, 1700 * avcHZ}, pcrs)
+
+	// case4: 开始时PCR从33位时间戳的末尾回绕
+	m = NewMuxer()
+	at.Nil(m.SetMuxDelay(500 * time.Millisecond))
+	buf.Reset()
+	at.Nil(m.Mux(key, 100*avcHZ, 100*avcHZ, buf))
+	pcrs, _ = readPcrs(buf.Bytes(), defaultVideoPID)
+	at.Equal([]int64{maxTimestamp + 1 - 400*avcHZ}, pcrs)
+}
+
+func TestMuxer_TableVersion(t *testing.T) {
+	at := assert.New(t)
+
+	m := NewMuxer()
+	version := func(ts []byte) byte {
+		return ts[10] >> 1 & 0x1f
+	}
+
+	// case1: 内容不变时版本号不变
+	at.Equal(byte(0), version(m.PMT(packet.PktVideo, packet.PktAudio)))
+	at.Equal(byte(0), version(m.PMT(packet.PktVideo, packet.PktAudio)))
+	at.Equal(byte(0), version(m.PAT()))
+	at.Equal(byte(0), version(m.PAT()))
+
+	// case2: 流类型变化, 之后才收到序列头, 业务名称变化时递增
+	m.SetAudioStreamType(table.StreamTypeMpeg1Audio)
+	at.Equal(byte(1), version(m.PMT(packet.PktVideo, packet.PktAudio)))
+	m.SetVideoStreamType(table.StreamTypeHevc)
+	at.Equal(byte(2), version(m.PMT(packet.PktVideo, packet.PktAudio)))
+	at.Equal(byte(2), version(m.PMT(packet.PktVideo, packet.PktAudio)))
+
+	at.Equal(byte(0), version(m.SDT(bytes.NewBufferString("a"))))
+	at.Equal(byte(1), version(m.SDT(bytes.NewBufferString("b"))))
+
+	// case3: 版本号为5位, 再变化30次后(2+30)归零
+	for i := 1; i <= 30; i++ {
+		m.SetAudioStreamType(table.StreamTypeMpeg1Audio + byte(i%2))
+		m.PMT(packet.PktVideo, packet.PktAudio)
+	}
+	at.Equal(byte(0), version(m.PMT(packet.PktVideo, packet.PktAudio)))
+}
+
+func TestMuxer_SetOptions(t *testing.T) {
+	at := assert.New(t)
+
+	// case1: PID冲突或使用保留的PID
+	m := NewMuxer()
+	at.NotNil(m.SetOptions(MuxerOptions{VideoPID: 0x200, AudioPID: 0x200}))
+	at.NotNil(m.SetOptions(MuxerOptions{PmtPID: 0x100}))
+	at.NotNil(m.SetOptions(MuxerOptions{AudioPID: 0x11}))
+	at.NotNil(m.SetOptions(MuxerOptions{VideoPID: 0x1fff}))
+	at.Equal(uint16(defaultVideoPID), m.Options().VideoPID)
+
+	// case2: 未设置的字段使用默认值
+	at.Nil(m.SetOptions(MuxerOptions{
+		VideoPID:          0x31,
+		AudioPID:          0x34,
+		PmtPID:            0x30,
+		ProgramNumber:     0x65,
+		TransportStreamID: 0x3e8,
+	}))
+	at.Equal(uint16(defaultOriginalNetworkID), m.Options().OriginalNetworkID)
+
+	pat := m.PAT()
+	at.Equal([]byte{0x47, 0x40, 0x00, 0x10, 0x00, 0x00, 0xb0, 0x0d, 0x03, 0xe8, 0xc1, 0x00, 0x00, 0x00, 0x65, 0xe0, 0x30}, pat[:17])
+
+	pmt := m.PMT(packet.PktVideo, packet.PktAudio)
+	at.Equal([]byte{
+		0x47, 0x40, 0x30, 0x10, 0x00, 0x02, 0xb0, 0x17, 0x00, 0x65, 0xc1, 0x00, 0x00, 0xe0, 0x31, 0xf0, 0x00,
+		0x1b, 0xe0, 0x31, 0xf0, 0x00, 0x0f, 0xe0, 0x34, 0xf0, 0x00,
+	}, pmt[:27])
+
+	sdt := m.SDT(bytes.NewBuffer(nil))
+	at.Equal([]byte{0x47, 0x40, 0x11, 0x10, 0x00, 0x42, 0xf0, 0x11, 0x03, 0xe8, 0xc1, 0x00, 0x00, 0xff, 0x01, 0xff, 0x00, 0x65}, sdt[:18])
+
+	// case3: 解复用后得到设置的PID
+	buf := bytes.NewBuffer(nil)
+	buf.Write(pat)
+	buf.Write(pmt)
+	at.Nil(m.Mux(&packet.Packet{Type: packet.PktAudio, Media: []byte{0xff, 0xf1}}, 0, 0, buf))
+
+	var p packet.Packet
+	at.Nil(NewDemuxer(buf).Read(&p))
+	at.Equal(uint16(0x34), p.Header.(*ESHeader).PID)
+}
+
+func TestMuxer_ProgramDescriptors(t *testing.T) {
+	at := assert.New(t)
+
+	desc := table.NewDescriptor()
+	at.Nil(desc.Registration("HDMV"))
+	at.Nil(desc.ISO639Language("chi", table.AudioTypeUndefined))
+
+	// case1: 节目级描述符写入program_info
+	m := NewMuxer()
+	at.Nil(m.SetOptions(MuxerOptions{ProgramDescriptors: desc.GetBuffer().Bytes()}))
+
+	pmt := m.PMT(packet.PktVideo)
+	at.Equal([]byte{0xf0, 0x0c}, pmt[15:17])
+	at.Equal([]byte{0x05, 0x04, 'H', 'D', 'M', 'V', 0x0a, 0x04, 'c', 'h', 'i', 0x00}, pmt[17:29])
+	at.Equal([]byte{0x1b, 0xe1, 0x00}, pmt[29:32])
+
+	// case2: 描述符变化时PMT的版本号递增
+	at.Nil(m.SetOptions(MuxerOptions{}))
+	pmt = m.PMT(packet.PktVideo)
+	at.Equal(byte(0xc3), pmt[10])
+	at.Equal([]byte{0xf0, 0x00}, pmt[15:17])
+
+	// case3: 超过program_info_length的范围
+	at.NotNil(m.SetOptions(MuxerOptions{ProgramDescriptors: make([]byte, 0x400)}))
+
+	// case4: PMT超过1021字节时不截断, Mixer 返回错误
+	opts := MuxerOptions{ProgramDescriptors: make([]byte, maxProgramInfoLen)}
+	at.Nil(m.SetOptions(opts))
+	at.Nil(m.PMT(packet.PktVideo, packet.PktAudio))
+
+	buf := bytes.NewBuffer(nil)
+	mixer := NewMixer(buf)
+	at.Nil(mixer.SetMuxerOptions(opts))
+	at.NotNil(mixer.SetTsHeader())
+	at.Nil(testFilterPID(buf.Bytes(), m.Options().PmtPID))
+}
+
+func TestMuxer_AudioTracks(t *testing.T) {
+	at := assert.New(t)
+
+	m := NewMuxer()
+
+	// case1: 语言代码错误, 轨道PID冲突
+	at.NotNil(m.SetOptions(MuxerOptions{AudioLanguage: "zh"}))
+	at.NotNil(m.SetOptions(MuxerOptions{AudioTracks: []AudioTrack{{PID: 0x102, Language: "english"}}}))
+	at.NotNil(m.SetOptions(MuxerOptions{AudioTracks: []AudioTrack{{PID: defaultAudioPID}}}))
+	at.NotNil(m.SetOptions(MuxerOptions{AudioTracks: []AudioTrack{{PID: 0x102}, {PID: 0x102}}}))
+
+	at.Nil(m.SetOptions(MuxerOptions{
+		AudioLanguage: "chi",
+		AudioTracks: []AudioTrack{
+			{PID: 0x102, Language: "eng"},
+			{PID: 0x103, Language: "chi", AudioType: table.AudioTypeVisualImpairedCommentary},
+		},
+	}))
+
+	// case2: PMT中列出全部音频轨道和语言描述符
+	pmt := m.PMT(packet.PktVideo, packet.PktAudio)
+	at.True(bytes.Contains(pmt, []byte{0x0f, 0xe1, 0x01, 0xf0, 0x06, 0x0a, 0x04, 'c', 'h', 'i', 0x00}))
+	at.True(bytes.Contains(pmt, []byte{0x0f, 0xe1, 0x02, 0xf0, 0x06, 0x0a, 0x04, 'e', 'n', 'g', 0x00}))
+	at.True(bytes.Contains(pmt, []byte{0x0f, 0xe1, 0x03, 0xf0, 0x06, 0x0a, 0x04, 'c', 'h', 'i', 0x03}))
+
+	// case3: 纯额外轨道时PCR_PID为第一个额外轨道
+	at.Equal([]byte{0xe1, 0x02}, m.PMT()[13:15])
+
+	// case4: 各轨道使用各自的PID和计数器
+	buf := bytes.NewBuffer(nil)
+	buf.Write(m.PAT())
+	buf.Write(m.PMT(packet.PktAudio))
+
+	adts := &packet.Packet{Type: packet.PktAudio, Media: []byte{0xff, 0xf1}}
+	at.Nil(m.Mux(adts, 0, 0, buf))
+	at.Nil(m.MuxTrack(1, adts, 0, 0, buf))
+	at.Nil(m.MuxTrack(1, adts, 0, 0, buf))
+	at.Nil(m.MuxTrack(2, adts, 0, 0, buf))
+	at.Equal(byte(1), m.audio[0].cc)
+	at.Equal(byte(2), m.audio[1].cc)
+	at.Equal(byte(1), m.audio[2].cc)
+
+	at.NotNil(m.MuxTrack(3, adts, 0, 0, buf))
+	at.NotNil(m.MuxTrack(1, &packet.Packet{Type: packet.PktVideo}, 0, 0, buf))
+
+	d := NewDemuxer(buf)
+	var pids []uint16
+	for {
+		var p packet.Packet
+		if d.Read(&p) != nil {
+			break
+		}
+		pids = append(pids, p.Header.(*ESHeader).PID)
+	}
+	at.Equal([]uint16{0x101, 0x102, 0x102, 0x103}, pids)
+}
@@ -0,0 +1,102 @@
+// Package ts SAMPLE-AES 加密(Apple HLS Sample Encryption), 支持H264和AAC
+package ts
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+
+	"github.com/moggle-mog/goav/parser/aac"
+	"github.com/moggle-mog/goav/parser/bits"
+	"github.com/moggle-mog/goav/parser/h264"
+)
+
+const (
+	sampleAESVideoLeader = 32  // nalu开头的明文字节数(包含nalu头)
+	sampleAESVideoSkip   = 144 // 每个加密块之后的明文字节数
+	sampleAESVideoMin    = 48  // 长度不超过48字节的nalu不加密
+	sampleAESAudioLeader = 16  // adts头之后的明文字节数
+)
+
+// SAMPLE-AES 加密器, 每个nalu或adts帧都从初始向量开始做CBC加密
+type sampleAES struct {
+	block cipher.Block
+	iv    []byte
+}
+
+func newSampleAES(key, iv []byte) (*sampleAES, error) {
+	if len(iv) != aes.BlockSize {
+		return nil, errors.New("sample-aes iv must be 16 bytes")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sampleAES{
+		block: block,
+		iv:    append([]byte(nil), iv...),
+	}, nil
+}
+
+// 加密Annex-b格式的访问单元, 只加密 slice 和 IDR slice
+func (s *sampleAES) encryptVideo(annexb []byte) []byte {
+	dst := make([]byte, 0, len(annexb)+64)
+
+	for _, nalu := range h264.SplitAnnexb(annexb) {
+		dst = append(dst, 0x00, 0x00, 0x00, 0x01)
+
+		naluType := nalu[0] & 0x1f
+		if (naluType == 1 || naluType == 5) && len(nalu) > sampleAESVideoMin {
+			nalu = s.encryptNalu(nalu)
+		}
+
+		dst = append(dst, nalu...)
+	}
+
+	return dst
+}
+
+// 去除防竞争字节后, 跳过32字节的明文, 之后每160字节加密前16字节(剩余不超过16字节时不加密), 最后重新插入防竞争字节
+func (s *sampleAES) encryptNalu(nalu []byte) []byte {
+	rbsp := bits.RemoveEmulationPrevention(nalu)
+	mode := cipher.NewCBCEncrypter(s.block, s.iv)
+
+	for i := sampleAESVideoLeader; i < len(rbsp); i += sampleAESVideoSkip {
+		if len(rbsp)-i > aes.BlockSize {
+			mode.CryptBlocks(rbsp[i:i+aes.BlockSize], rbsp[i:i+aes.BlockSize])
+			i += aes.BlockSize
+		}
+	}
+
+	return bits.AddEmulationPrevention(rbsp)
+}
+
+// 加密adts帧: adts头和之后16字节为明文, 其后完整的16字节块全部加密, 末尾不足16字节的部分为明文
+func (s *sampleAES) encryptAudio(adts []byte) ([]byte, error) {
+	dst := append([]byte(nil), adts...)
+
+	for i := 0; i < len(dst); {
+		h, err := aac.ParseADTSHeader(dst[i:])
+		if err != nil {
+			return nil, err
+		}
+		if i+h.FrameLength > len(dst) {
+			return nil, errors.New("incomplete adts frame")
+		}
+
+		frame := dst[i+h.HeaderLength() : i+h.FrameLength]
+		if len(frame) > sampleAESAudioLeader {
+			n := (len(frame) - sampleAESAudioLeader) / aes.BlockSize * aes.BlockSize
+			payload := frame[sampleAESAudioLeader : sampleAESAudioLeader+n]
+
+			mode := cipher.NewCBCEncrypter(s.block, s.iv)
+			mode.CryptBlocks(payload, payload)
+		}
+
+		i += h.FrameLength
+	}
+
+	return dst, nil
+}
@@ -0,0 +1,148 @@
+package ts
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"testing"
+
+	"github.com/moggle-mog/goav/container/ts/table"
+	"github.com/moggle-mog/goav/internal/testutil"
+	"github.com/moggle-mog/goav/packet"
+	"github.com/moggle-mog/goav/parser/bits"
+	"github.com/moggle-mog/goav/parser/h264"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testAESKey = []byte("0123456789abcdef")
+	testAESIV  = []byte("fedcba9876543210")
+)
+
+// 按 SAMPLE-AES 的规则解密nalu
+func decryptNalu(t *testing.T, nalu []byte) []byte {
+	block, err := aes.NewCipher(testAESKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rbsp := bits.RemoveEmulationPrevention(nalu)
+	mode := cipher.NewCBCDecrypter(block, testAESIV)
+	for i := 32; i < len(rbsp); i += 144 {
+		if len(rbsp)-i > 16 {
+			mode.CryptBlocks(rbsp[i:i+16], rbsp[i:i+16])
+			i += 16
+		}
+	}
+
+	return bits.AddEmulationPrevention(rbsp)
+}
+
+func TestSampleAES_EncryptVideo(t *testing.T) {
+	at := assert.New(t)
+
+	s, err := newSampleAES(testAESKey, testAESIV)
+	at.Nil(err)
+
+	// 400字节的IDR, 包含需要防竞争的数据
+	idr := make([]byte, 400)
+	idr[0] = 0x65
+	for i := 1; i < len(idr); i++ {
+		idr[i] = byte(i)
+	}
+	sps := []byte{0x67, 0x4d, 0x00, 0x1e}
+	short := append([]byte{0x41}, make([]byte, 40)...)
+	short[20] = 0x01
+	short[40] = 0x02
+	short = bits.AddEmulationPrevention(short)
+
+	annexb := testutil.JoinAnnexb(sps, idr, short)
+	enc := s.encryptVideo(annexb)
+
+	nalus := h264.SplitAnnexb(enc)
+	at.Len(nalus, 3)
+
+	// case1: 参数集和不超过48字节的slice不加密
+	at.Equal(sps, nalus[0])
+	at.Equal(short, nalus[2])
+
+	// case2: 前32字节为明文, 第1个和第11个16字节块加密, 其余为明文
+	at.Equal(idr[:32], nalus[1][:32])
+	at.NotEqual(idr[32:48], nalus[1][32:48])
+	at.Equal(idr[48:192], nalus[1][48:192])
+	at.NotEqual(idr[192:208], nalus[1][192:208])
+	at.Equal(idr[208:352], nalus[1][208:352])
+	at.NotEqual(idr[352:368], nalus[1][352:368])
+	at.Equal(idr[368:], nalus[1][368:])
+
+	// case3: 加密结果不包含start code, 可以解密
+	at.False(bytes.Contains(nalus[1], []byte{0x00, 0x00, 0x01}))
+	at.Equal(idr, decryptNalu(t, nalus[1]))
+
+	// case4: 密钥长度错误
+	_, err = newSampleAES(testAESKey[:5], testAESIV)
+	at.NotNil(err)
+	_, err = newSampleAES(testAESKey, testAESIV[:5])
+	at.NotNil(err)
+}
+
+func TestSampleAES_EncryptAudio(t *testing.T) {
+	at := assert.New(t)
+
+	s, err := newSampleAES(testAESKey, testAESIV)
+	at.Nil(err)
+
+	// 7字节adts头 + 60字节数据, 两帧
+	frame := make([]byte, 67)
+	copy(frame, []byte{0xff, 0xf1, 0x50, 0x80, 0x08, 0x7f, 0xfc})
+	for i := 7; i < len(frame); i++ {
+		frame[i] = byte(i)
+	}
+	adts := append(append([]byte{}, frame...), frame...)
+
+	enc, err := s.encryptAudio(adts)
+	at.Nil(err)
+	at.Len(enc, len(adts))
+
+	// case1: adts头和之后16字节为明文, 之后2个完整的块加密, 末尾12字节为明文
+	block, _ := aes.NewCipher(testAESKey)
+	expected := append([]byte{}, frame...)
+	cipher.NewCBCEncrypter(block, testAESIV).CryptBlocks(expected[23:55], expected[23:55])
+
+	at.Equal(expected, enc[:67])
+	at.Equal(expected, enc[67:])
+	at.Equal(frame[55:], enc[55:67])
+
+	// case2: 不完整的adts帧
+	_, err = s.encryptAudio(adts[:70])
+	at.NotNil(err)
+}
+
+func TestMuxer_SampleAES(t *testing.T) {
+	at := assert.New(t)
+
+	m := NewMuxer()
+	m.SetAudioConfig([]byte{0x12, 0x10})
+	at.Nil(m.SetSampleAES(testAESKey, testAESIV))
+
+	// case1: PMT中使用加密的流类型和描述符
+	pmt := m.PMT(packet.PktVideo, packet.PktAudio)
+	at.True(bytes.Contains(pmt, []byte{0xdb, 0xe1, 0x00, 0xf0, 0x06, 0x0f, 0x04, 'z', 'a', 'v', 'c'}))
+	at.True(bytes.Contains(pmt, []byte{
+		0xcf, 0xe1, 0x01, 0xf0, 0x16,
+		0x0f, 0x04, 'a', 'a', 'c', 'd',
+		0x05, 0x0e, 'a', 'p', 'a', 'd', 'z', 'a', 'a', 'c', 0x00, 0x00, 0x01, 0x02, 0x12, 0x10,
+	}))
+
+	// case2: 不支持mp3
+	m.SetAudioStreamType(table.StreamTypeMpeg1Audio)
+	err := m.Mux(&packet.Packet{Type: packet.PktAudio, Media: []byte{0xff}}, 0, 0, &TestWriter{})
+	at.NotNil(err)
+
+	// case3: 关闭加密后恢复未加密的流类型
+	m.SetAudioStreamType(table.StreamTypeAac)
+	at.Nil(m.SetSampleAES(nil, nil))
+	pmt = m.PMT(packet.PktVideo, packet.PktAudio)
+	at.True(bytes.Contains(pmt, []byte{0x1b, 0xe1, 0x00, 0xf0, 0x00}))
+	at.True(bytes.Contains(pmt, []byte{0x0f, 0xe1, 0x01, 0xf0, 0x00}))
+}
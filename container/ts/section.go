@@ -0,0 +1,93 @@
+// Package ts PSI/SI分段的TS封装, 分段较长时跨多个TS包
+package ts
+
+import "bytes"
+
+// 表的版本号(version_number), 分段内容变化时递增, 解码器据此更新表
+type tableVersion struct {
+	last    []byte // 上一次的分段(版本号为0时生成)
+	version byte
+}
+
+// 分段是否与上一次的不同, 尚未输出过时也返回true
+func (v *tableVersion) changed(section []byte) bool {
+	return v.last == nil || !bytes.Equal(section, v.last)
+}
+
+// 与上一次的分段比较, 内容变化时版本号递增(模32), 返回要使用的版本号
+func (v *tableVersion) next(section []byte) byte {
+	if v.last != nil && !bytes.Equal(section, v.last) {
+		v.version = (v.version + 1) & 0x1f
+	}
+
+	v.last = append(v.last[:0], section...)
+	return v.version
+}
+
+// 将分段(不含CRC_32)追加CRC_32后依次封装为TS包, 追加到dst后返回
+func packSections(pid uint16, cc *byte, dst []byte, sections ...[]byte) []byte {
+	crcSections := make([][]byte, 0, len(sections))
+	for _, section := range sections {
+		crc32Value := GenerateCrc32(section)
+		crcSections = append(crcSections, append(section[:len(section):len(section)],
+			byte(crc32Value>>24), byte(crc32Value>>16), byte(crc32Value>>8), byte(crc32Value)))
+	}
+
+	return packPayload(pid, cc, dst, crcSections...)
+}
+
+// 将完整的分段(如没有CRC_32的TDT)依次封装为TS包, 追加到dst后返回
+// 多个分段首尾相连; 包含分段起始的TS包设置 payload_unit_start_indicator,
+// 并在负载的第一个字节写入 pointer_field(到第一个起始分段的偏移); 最后一个TS包的剩余部分填充 0xff
+func packPayload(pid uint16, cc *byte, dst []byte, sections ...[]byte) []byte {
+	var data []byte
+	var starts []int
+	for _, section := range sections {
+		starts = append(starts, len(data))
+		data = append(data, section...)
+	}
+
+	pos, next := 0, 0
+	for pos < len(data) {
+		// 分段在本包中起始, 且 pointer_field 之后还能容纳分段的第一个字节
+		pusi := next < len(starts) && starts[next]-pos < tsDefaultDataLen-1
+
+		// 填写包递增计数器, 共4位, 超出则归零
+		if *cc > 0xf {
+			*cc = 0
+		}
+		start := len(dst)
+		flags := byte(0x00)
+		if pusi {
+			flags = 0x40
+		}
+		dst = append(dst, 0x47, flags|byte(pid>>8)&0x1f, byte(pid), 0x10|*cc&0x0f)
+		*cc++
+
+		end := pos + tsDefaultDataLen
+		if pusi {
+			dst = append(dst, byte(starts[next]-pos))
+			end--
+		} else if next < len(starts) && starts[next] < end {
+			// 下一个分段的起始落在本包最后一个字节, 没有位置写 pointer_field, 移到下一个包
+			end = starts[next]
+		}
+		if end > len(data) {
+			end = len(data)
+		}
+		dst = append(dst, data[pos:end]...)
+
+		// 本包中起始的分段由 pointer_field 和前一个分段的长度确定
+		for next < len(starts) && starts[next] < end {
+			next++
+		}
+		pos = end
+
+		// 填充 0xff
+		for len(dst)-start < tsPacketLen {
+			dst = append(dst, 0xff)
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,158 @@
+package ts
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/moggle-mog/goav/container/ts/table"
+	"github.com/moggle-mog/goav/packet"
+	"github.com/stretchr/testify/assert"
+)
+
+// 按 pointer_field 重组TS包中的分段(含CRC_32), 检查包递增计数器连续
+func testReadSections(t *testing.T, ts []byte) [][]byte {
+	at := assert.New(t)
+
+	var sections [][]byte
+	var buf []byte
+	for i := 0; i < len(ts); i += tsPacketLen {
+		pkt := ts[i : i+tsPacketLen]
+		if i > 0 {
+			at.Equal((ts[i-tsPacketLen+3]+1)&0x0f, pkt[3]&0x0f)
+		}
+
+		payload := pkt[4:]
+		if pkt[1]&0x40 != 0 {
+			pointer := int(payload[0])
+			buf = append(buf, payload[1:1+pointer]...)
+			payload = payload[1+pointer:]
+		}
+		buf = append(buf, payload...)
+
+		for len(buf) >= 3 && buf[0] != 0xff {
+			length := 3 + (int(buf[1]&0x0f)<<8 | int(buf[2]))
+			if len(buf) < length {
+				break
+			}
+			sections = append(sections, append([]byte{}, buf[:length]...))
+			buf = buf[length:]
+		}
+		if len(buf) > 0 && buf[0] == 0xff {
+			buf = buf[:0]
+		}
+	}
+
+	return sections
+}
+
+// 生成 section_length 正确的分段, 总长n字节(不含CRC_32)
+func testSection(tableID byte, n int) []byte {
+	b := make([]byte, n)
+	b[0] = tableID
+	b[1] = 0xb0 | byte((n+1)>>8)&0x0f
+	b[2] = byte(n + 1)
+	for i := 3; i < n; i++ {
+		b[i] = byte(i)
+	}
+	return b
+}
+
+func TestPackSections(t *testing.T) {
+	at := assert.New(t)
+
+	// case1: 短分段在一个TS包中, 其余填充 0xff
+	var cc byte
+	short := testSection(0x00, 12)
+	ts := packSections(patPID, &cc, nil, short)
+	at.Len(ts, tsPacketLen)
+	at.Equal([]byte{0x47, 0x40, 0x00, 0x10, 0x00}, ts[:5])
+	at.Equal(short, ts[5:17])
+	at.Equal(byte(0xff), ts[tsPacketLen-1])
+
+	// case2: 长分段跨越多个TS包, 只有首包设置 payload_unit_start_indicator
+	long := testSection(0x02, 400)
+	ts = packSections(0x1001, &cc, nil, long, short)
+	at.Len(ts, 3*tsPacketLen)
+	at.Equal([]byte{0x47, 0x50, 0x01, 0x11, 0x00}, ts[:5])
+	at.Equal([]byte{0x47, 0x10, 0x01, 0x12}, ts[tsPacketLen:tsPacketLen+4])
+
+	// 第二个分段在第3个包中起始, pointer_field 指向它
+	at.Equal([]byte{0x47, 0x50, 0x01, 0x13, byte(404 - 183 - 184)}, ts[2*tsPacketLen:2*tsPacketLen+5])
+
+	sections := testReadSections(t, ts)
+	at.Len(sections, 2)
+	at.Equal(long, sections[0][:400])
+	at.Equal(short, sections[1][:12])
+	at.Equal(GenerateCrc32(long), uint32(sections[0][400])<<24|uint32(sections[0][401])<<16|uint32(sections[0][402])<<8|uint32(sections[0][403]))
+
+	// case3: 下一个分段起始于TS包的最后一个字节时, 移到下一个包
+	edge := testSection(0x02, 362)
+	ts = packSections(0x1001, &cc, nil, edge, short)
+	at.Len(ts, 3*tsPacketLen)
+	at.Equal(byte(0x10), ts[tsPacketLen+1]&0xf0)
+	at.Equal(byte(0xff), ts[2*tsPacketLen-1])
+	at.Equal([]byte{0x47, 0x50, 0x01}, ts[2*tsPacketLen:2*tsPacketLen+3])
+	at.Equal(byte(0x00), ts[2*tsPacketLen+4])
+
+	sections = testReadSections(t, ts)
+	at.Len(sections, 2)
+	at.Equal(edge, sections[0][:362])
+	at.Equal(short, sections[1][:12])
+
+	// case4: 追加到已有数据之后, 包递增计数器超过15时归零
+	cc = 0xf
+	ts = packSections(patPID, &cc, []byte{0x01}, short, short)
+	at.Len(ts, 1+tsPacketLen)
+	at.Equal(byte(0x1f), ts[4])
+	at.Equal(byte(0), cc&0x0f)
+}
+
+func TestMuxer_LongSDT(t *testing.T) {
+	at := assert.New(t)
+
+	m := NewMuxer()
+
+	// 较长的中文业务名称, SDT超过一个TS包
+	desc := table.NewDescriptor()
+	at.Nil(desc.Service(1, "中央广播电视总台", strings.Repeat("综合频道", 14)))
+	at.NotNil(table.NewDescriptor().Service(1, "provider", strings.Repeat("综合频道", 25)))
+
+	sdt := m.SDT(desc.GetBuffer())
+	at.Len(sdt, 2*tsPacketLen)
+
+	sections := testReadSections(t, sdt)
+	at.Len(sections, 1)
+	at.Equal(byte(0x42), sections[0][0])
+	at.True(bytes.Contains(sections[0], desc.GetBuffer().Bytes()))
+
+	// 再次生成时包递增计数器继续递增
+	sdt = m.SDT(desc.GetBuffer())
+	at.Equal([]byte{0x12, 0x13}, []byte{sdt[3], sdt[tsPacketLen+3]})
+}
+
+func TestMuxer_LongPMT(t *testing.T) {
+	at := assert.New(t)
+
+	// 30个带语言描述符的音频轨道, PMT超过一个TS包
+	var tracks []AudioTrack
+	for i := 0; i < 30; i++ {
+		tracks = append(tracks, AudioTrack{PID: uint16(0x200 + i), Language: "eng"})
+	}
+
+	m := NewMuxer()
+	at.Nil(m.SetOptions(MuxerOptions{AudioTracks: tracks}))
+
+	buf := bytes.NewBuffer(nil)
+	buf.Write(m.PAT())
+	pmt := m.PMT(packet.PktAudio)
+	at.Len(pmt, 2*tsPacketLen)
+	buf.Write(pmt)
+
+	// 解复用时能识别最后一个轨道
+	at.Nil(m.MuxTrack(30, &packet.Packet{Type: packet.PktAudio, Media: []byte{0xff, 0xf1}}, 0, 0, buf))
+
+	var p packet.Packet
+	at.Nil(NewDemuxer(buf).Read(&p))
+	at.Equal(uint16(0x21d), p.Header.(*ESHeader).PID)
+}
@@ -0,0 +1,280 @@
+// Package ts DVB SI表(NIT, EIT present/following, TDT/TOT)的生成和重复输出
+package ts
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/moggle-mog/goav/container/ts/table"
+)
+
+// 一个业务列表描述符最多容纳的业务数(描述符长度只有1个字节)
+const maxServiceListItems = 0xff / 3
+
+// NIT中的网络
+type network struct {
+	id   uint16
+	name string
+}
+
+// 网络ID为0时返回nil(不输出NIT)
+func newNetwork(networkID uint16, name string) (*network, error) {
+	if networkID == 0 {
+		return nil, nil
+	}
+
+	// 提前检查网络名称, 生成NIT时不再出错
+	err := table.NewDescriptor().NetworkName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &network{id: networkID, name: name}, nil
+}
+
+// 生成NIT分段, 传输流的业务列表中包含全部节目(业务类型为数字电视)
+func (n *network) sections(transportStreamID, originalNetworkID uint16, programNumbers []uint16) ([][]byte, error) {
+	nit := table.NewNit(n.id)
+
+	desc := table.NewDescriptor()
+	_ = desc.NetworkName(n.name)
+	nit.NetworkDescriptors = desc.GetBuffer().Bytes()
+
+	services := make([]table.ServiceListItem, 0, len(programNumbers))
+	for _, num := range programNumbers {
+		services = append(services, table.ServiceListItem{ServiceID: num, ServiceType: table.ServiceTypeDigitalTV})
+	}
+
+	desc = table.NewDescriptor()
+	for len(services) > 0 {
+		cnt := len(services)
+		if cnt > maxServiceListItems {
+			cnt = maxServiceListItems
+		}
+		_ = desc.ServiceList(services[:cnt]...)
+		services = services[cnt:]
+	}
+	nit.AddTransportStream(transportStreamID, originalNetworkID, desc.GetBuffer().Bytes())
+
+	return nit.Sections()
+}
+
+// 封装TDT和TOT
+func packTimeTables(cc *byte, dst []byte, now time.Time, totDesc []byte) []byte {
+	dst = packPayload(tdtPID, cc, dst, table.NewTdt(now).Section())
+	return packSections(tdtPID, cc, dst, table.NewTot(now, totDesc).Section())
+}
+
+// SetNetwork 设置NIT中的网络ID和网络名称, 设置后PAT中包含NIT; networkID 为0时不输出NIT
+func (muxer *Muxer) SetNetwork(networkID uint16, name string) error {
+	n, err := newNetwork(networkID, name)
+	if err != nil {
+		return err
+	}
+
+	muxer.network = n
+	return nil
+}
+
+// NIT make network information table, 没有设置网络时返回nil
+func (muxer *Muxer) NIT() ([]byte, error) {
+	if muxer.network == nil {
+		return nil, nil
+	}
+
+	opts := muxer.opts
+	sections, err := muxer.network.sections(opts.TransportStreamID, opts.OriginalNetworkID, []uint16{opts.ProgramNumber})
+	if err != nil {
+		return nil, err
+	}
+
+	muxer.nit = packSections(nitPID, &muxer.nitCc, muxer.nit[:0], sections...)
+	return muxer.nit, nil
+}
+
+// EIT make event information table(present/following), 事件的描述符过长时返回错误
+func (muxer *Muxer) EIT(eit *table.Eit) ([]byte, error) {
+	sections, err := eit.Sections()
+	if err != nil {
+		return nil, err
+	}
+
+	muxer.eit = packSections(eitPID, &muxer.eitCc, muxer.eit[:0], sections...)
+	return muxer.eit, nil
+}
+
+// TDT make time and date table and time offset table, totDesc为TOT中的描述符
+func (muxer *Muxer) TDT(now time.Time, totDesc []byte) []byte {
+	muxer.tdt = packTimeTables(&muxer.tdtCc, muxer.tdt[:0], now, totDesc)
+	return muxer.tdt
+}
+
+// Event 节目单中的事件, 用于EIT
+type Event struct {
+	EventID  uint16
+	Start    time.Time
+	Duration time.Duration
+	Language string // ISO 639-2 的三字母代码, 如 "chi"
+	Name     string // 事件名称
+	Text     string // 事件简介
+}
+
+// 转换为EIT中的事件, 名称和简介写入短事件描述符
+func (e *Event) eitEvent(runningStatus byte) (*table.EitEvent, error) {
+	desc := table.NewDescriptor()
+	err := desc.ShortEvent(e.Language, e.Name, e.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	return &table.EitEvent{
+		EventID:       e.EventID,
+		StartTime:     e.Start,
+		Duration:      e.Duration,
+		RunningStatus: runningStatus,
+		Descriptors:   desc.GetBuffer().Bytes(),
+	}, nil
+}
+
+// ScheduleProvider 节目单, 返回业务在now时的当前事件和下一个事件, 没有事件时返回nil
+type ScheduleProvider interface {
+	PresentFollowing(serviceID uint16, now time.Time) (present, following *Event, err error)
+}
+
+// ScheduleProviderFunc 函数形式的 ScheduleProvider
+type ScheduleProviderFunc func(serviceID uint16, now time.Time) (present, following *Event, err error)
+
+// PresentFollowing 调用f
+func (f ScheduleProviderFunc) PresentFollowing(serviceID uint16, now time.Time) (*Event, *Event, error) {
+	return f(serviceID, now)
+}
+
+// SetNetwork 设置NIT中的网络ID和网络名称, networkID 为0时不输出NIT, 需要在 SetTsHeader 之前调用
+// 多节目时使用 MPTS.SetNetwork
+func (m *Mixer) SetNetwork(networkID uint16, name string) error {
+	return m.muxer.SetNetwork(networkID, name)
+}
+
+// SetSchedule 设置节目单, 每次输出EIT时从节目单获取当前和下一个事件; provider 为空时不输出EIT
+// SDT中业务的 EIT_present_following_flag 随之设置
+func (m *Mixer) SetSchedule(provider ScheduleProvider) {
+	m.schedule = provider
+	m.muxer.eitPF = provider != nil
+}
+
+// SetClock 设置EIT和TDT/TOT使用的时钟并开始输出TDT/TOT, now 为空时使用系统时间
+// countryCode 不为空时(ISO 3166 的三字母代码, 如 "CHN"), TOT中写入按时钟时区计算的本地时间偏移
+// 多节目时节目的时钟只用于EIT, TDT/TOT 使用 MPTS.SetClock
+func (m *Mixer) SetClock(now func() time.Time, countryCode string) error {
+	if countryCode != "" && len(countryCode) != 3 {
+		return fmt.Errorf("invalid country code(%s)", countryCode)
+	}
+
+	if now == nil {
+		now = time.Now
+	}
+
+	m.clock = now
+	m.country = countryCode
+	m.timeTables = true
+	return nil
+}
+
+// SetSIInterval 设置NIT, EIT present/following 和 TDT/TOT 的重复间隔(如10s, 2s和30s), 0 表示只在 SetTsHeader 时输出
+func (m *Mixer) SetSIInterval(nit, eit, tdt time.Duration) error {
+	if nit < 0 || eit < 0 || tdt < 0 {
+		return fmt.Errorf("invalid si interval(%v, %v, %v)", nit, eit, tdt)
+	}
+
+	m.nitRepeat.interval = toClock(nit)
+	m.eitRepeat.interval = toClock(eit)
+	m.tdtRepeat.interval = toClock(tdt)
+	return nil
+}
+
+// 输出NIT, 没有设置网络时不输出
+func (m *Mixer) writeNit() error {
+	nit, err := m.tables.NIT()
+	if err != nil || nit == nil {
+		return err
+	}
+
+	_, err = m.ts.Write(nit)
+	return err
+}
+
+// 输出EIT present/following, 事件变化时版本号递增
+func (m *Mixer) writeEit() error {
+	if m.schedule == nil {
+		return nil
+	}
+
+	opts := m.muxer.Options()
+	present, following, err := m.schedule.PresentFollowing(opts.ProgramNumber, m.clock())
+	if err != nil {
+		return err
+	}
+
+	eit := table.NewEit(opts.ProgramNumber, opts.TransportStreamID, opts.OriginalNetworkID)
+	if present != nil {
+		eit.Present, err = present.eitEvent(table.RunningStatusRunning)
+		if err != nil {
+			return err
+		}
+	}
+	if following != nil {
+		eit.Following, err = following.eitEvent(table.RunningStatusNotRunning)
+		if err != nil {
+			return err
+		}
+	}
+
+	// 版本号为0时生成的分段用于比较
+	sections, err := eit.Sections()
+	if err != nil {
+		return err
+	}
+	eit.Version = m.eitVersion.next(bytes.Join(sections, nil))
+
+	b, err := m.tables.EIT(eit)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.ts.Write(b)
+	return err
+}
+
+// 输出TDT和TOT, 没有调用 SetClock 时不输出
+func (m *Mixer) writeTdt() error {
+	if !m.timeTables {
+		return nil
+	}
+
+	now := m.clock()
+	totDesc, err := totDescriptors(now, m.country)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.ts.Write(m.tables.TDT(now, totDesc))
+	return err
+}
+
+// TOT的描述符: countryCode 不为空时为按时钟时区计算的本地时间偏移
+func totDescriptors(now time.Time, countryCode string) ([]byte, error) {
+	if countryCode == "" {
+		return nil, nil
+	}
+
+	_, offset := now.Zone()
+	d := time.Duration(offset) * time.Second
+
+	desc := table.NewDescriptor()
+	err := desc.LocalTimeOffset(countryCode, d, now, d)
+	if err != nil {
+		return nil, err
+	}
+	return desc.GetBuffer().Bytes(), nil
+}
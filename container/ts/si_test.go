@@ -0,0 +1,153 @@
+package ts
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/moggle-mog/goav/container/flv"
+	"github.com/moggle-mog/goav/packet"
+	"github.com/stretchr/testify/assert"
+)
+
+// 取出PID的全部TS包
+func testFilterPID(ts []byte, pid uint16) []byte {
+	var b []byte
+	for i := 0; i+tsPacketLen <= len(ts); i += tsPacketLen {
+		if uint16(ts[i+1]&0x1f)<<8|uint16(ts[i+2]) == pid {
+			b = append(b, ts[i:i+tsPacketLen]...)
+		}
+	}
+	return b
+}
+
+func TestMixer_SI(t *testing.T) {
+	at := assert.New(t)
+
+	buf := bytes.NewBuffer(nil)
+	m := NewMixer(buf)
+	d := flv.NewDemuxer()
+
+	at.NotNil(m.SetNetwork(0x3001, string(make([]byte, 256))))
+	at.Nil(m.SetNetwork(0x3001, "cable"))
+	at.NotNil(m.SetClock(nil, "CN"))
+	at.NotNil(m.SetSIInterval(-1, 0, 0))
+	at.Nil(m.SetSIInterval(0, 100*time.Millisecond, 500*time.Millisecond))
+
+	start := time.Date(2026, 10, 17, 20, 0, 0, 0, time.FixedZone("CST", 8*3600))
+	now := start
+	at.Nil(m.SetClock(func() time.Time { return now }, "CHN"))
+
+	news := &Event{EventID: 1, Start: start, Duration: 30 * time.Minute, Language: "chi", Name: "新闻", Text: "今日要闻"}
+	film := &Event{EventID: 2, Start: start.Add(30 * time.Minute), Duration: 2 * time.Hour, Language: "chi", Name: "电影"}
+	var serviceIDs []uint16
+	m.SetSchedule(ScheduleProviderFunc(func(serviceID uint16, t time.Time) (*Event, *Event, error) {
+		serviceIDs = append(serviceIDs, serviceID)
+		if t.Before(film.Start) {
+			return news, film, nil
+		}
+		return film, nil, nil
+	}))
+
+	// case1: SetTsHeader 时输出NIT, EIT和TDT/TOT, PAT中包含NIT
+	at.Nil(m.SetTsHeader())
+	ts := buf.Bytes()
+	at.Equal([]byte{0x00, 0x00, 0xe0, 0x10}, m.tables.PAT()[13:17])
+
+	nit := testReadSections(t, testFilterPID(ts, nitPID))
+	at.Len(nit, 1)
+	at.True(bytes.Contains(nit[0], []byte{0x40, 0x05, 'c', 'a', 'b', 'l', 'e'}))
+	at.True(bytes.Contains(nit[0], []byte{0x41, 0x03, 0x00, 0x01, 0x01}))
+
+	eit := testReadSections(t, testFilterPID(ts, eitPID))
+	at.Len(eit, 2)
+	at.Equal([]byte{0x00, 0x01}, eit[0][14:16])
+	at.Equal(byte(0x80), eit[0][24]&0xe0)
+	at.Equal([]byte{0x00, 0x02}, eit[1][14:16])
+	at.Equal(byte(0x20), eit[1][24]&0xe0)
+	at.Equal([]uint16{defaultProgramNumber}, serviceIDs)
+
+	// 设置了节目单, SDT中的 EIT_present_following_flag 为1
+	sdt := testReadSections(t, testFilterPID(ts, sdtPID))
+	at.Len(sdt, 1)
+	at.Equal([]byte{0x00, 0x01, 0xfd}, sdt[0][11:14])
+
+	// TDT为UTC时间, TOT中的本地时间偏移为+8小时
+	tdt := testFilterPID(ts, tdtPID)
+	at.Len(tdt, 2*tsPacketLen)
+	at.Equal([]byte{0x70, 0x70, 0x05, 0xef, 0x92, 0x12, 0x00, 0x00}, tdt[5:13])
+	at.Equal([]byte{0x58, 0x0d, 'C', 'H', 'N', 0xfc, 0x08, 0x00}, tdt[tsPacketLen+15:tsPacketLen+23])
+
+	// case2: 按间隔重复输出, 事件变化时EIT版本号递增
+	buf.Reset()
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x64})
+	for i := uint32(0); i <= 39; i++ {
+		if i == 20 {
+			now = film.Start
+		}
+
+		p := &packet.Packet{Type: packet.PktAudio, Data: append([]byte{0x2f}, frame...)}
+		at.Nil(d.Demux(p))
+		at.Nil(m.Update(p, i*26, 0))
+		at.Nil(m.Mux(p))
+	}
+
+	count, _ := testCountPackets(buf.Bytes())
+	at.Equal(0, count[nitPID])
+	at.Equal(9, count[eitPID])
+	at.Equal(2, count[tdtPID])
+
+	eit = testReadSections(t, testFilterPID(buf.Bytes(), eitPID))
+	at.Equal(byte(0xc1), eit[0][5])
+	at.Equal(byte(0xc3), eit[len(eit)-1][5])
+	at.Equal([]byte{0x00, 0x02}, eit[len(eit)-2][14:16])
+	at.Len(eit[len(eit)-1], 18)
+}
+
+func TestMPTS_SI(t *testing.T) {
+	at := assert.New(t)
+
+	buf := bytes.NewBuffer(nil)
+	m := NewMPTS(buf, 0, 0)
+	at.Nil(m.SetNetwork(0x3001, "cable"))
+	at.Nil(m.SetSIInterval(0, 80*time.Millisecond, 0))
+
+	schedule := ScheduleProviderFunc(func(serviceID uint16, t time.Time) (*Event, *Event, error) {
+		return &Event{EventID: serviceID, Start: t, Duration: time.Hour, Language: "eng", Name: "live"}, nil, nil
+	})
+
+	pg1, err := m.AddProgram(MuxerOptions{ProgramNumber: 1})
+	at.Nil(err)
+	pg1.Mixer().SetSchedule(schedule)
+
+	pg2, err := m.AddProgram(MuxerOptions{ProgramNumber: 2, VideoPID: 0x200, AudioPID: 0x201, PmtPID: 0x1002})
+	at.Nil(err)
+	pg2.Mixer().SetSchedule(schedule)
+
+	pkts1 := testFlvPackets(t, 10)
+	pkts2 := testFlvPackets(t, 10)
+	for i := range pkts1 {
+		at.Nil(pg1.Write(pkts1[i]))
+		at.Nil(pg2.Write(pkts2[i]))
+	}
+
+	// case1: NIT的业务列表中包含全部节目, PAT中包含NIT
+	ts := buf.Bytes()
+	nit := testReadSections(t, testFilterPID(ts, nitPID))
+	at.Len(nit, 1)
+	at.True(bytes.Contains(nit[0], []byte{0x41, 0x06, 0x00, 0x01, 0x01, 0x00, 0x02, 0x01}))
+	at.Equal([]byte{0x00, 0x00, 0xe0, 0x10}, m.PAT()[13:17])
+
+	// case2: 各节目的EIT共用PID和包递增计数器, service_id 为节目号
+	eit := testReadSections(t, testFilterPID(ts, eitPID))
+	at.True(len(eit) > 4)
+	at.Equal([]byte{0x00, 0x01}, eit[0][3:5])
+	at.Equal([]byte{0x00, 0x02}, eit[2][3:5])
+
+	// case3: 只有设置了节目单的业务在SDT中标记 EIT present/following
+	pg2.Mixer().SetSchedule(nil)
+	sdt := m.SDT(nil)
+	at.Equal([]byte{0x00, 0x01, 0xfd}, sdt[16:19])
+	at.Equal([]byte{0x00, 0x02, 0xfc}, sdt[21:24])
+}
@@ -2,18 +2,16 @@ package ts
 
 // 音视频频率
 const (
-	// AACSL AAC的频率
-	aacSL = 1024
-
 	// AVCHZ H264的频率
 	avcHZ = 90
 )
 
 // sync 音视频同步
 type sync struct {
-	frameNum int64 // 累计帧数
-	frameDts int64 // 基准时间
-	syncMs   int64 // ms, 同步 |pts-dts|>syncMs 的"pts"和"dts"
+	samples    int64 // 累计采样数
+	sampleRate int   // 当前的采样率
+	frameDts   int64 // 基准时间
+	syncMs     int64 // ms, 同步 |pts-dts|>syncMs 的"pts"和"dts"
 }
 
 // newSync 音视频时间戳同步
@@ -27,12 +25,21 @@ func newSync(ms int64) *sync {
 }
 
 // SyncAudioTs 音视频同步，根据视频dts时间调整音频时间
-// dts: 传入音频的解码时间戳, 传出音频的播放时间戳, 单位: ms
+// dts: 传入音频的解码时间戳, 传出音频的播放时间戳, 单位: 1/90000秒
 // sampleRate: 音频采样率, 单位: HZ
-func (s *sync) syncAudioTs(dts *int64, sampleRate int) {
-	// 根据采样率, 换算音频相对于视频的时间增量
-	tsIncrement := avcHZ * 1000 * aacSL / sampleRate
-	pts := s.frameDts + s.frameNum*int64(tsIncrement)
+// samples: 该音频包的采样数(每帧的采样数*帧数)
+func (s *sync) syncAudioTs(dts *int64, sampleRate int, samples int) {
+	// 采样率变化时, 以变化前的累计时间作为新的基准
+	if sampleRate != s.sampleRate {
+		if s.sampleRate > 0 {
+			s.frameDts += s.samples * avcHZ * 1000 / int64(s.sampleRate)
+		}
+		s.samples = 0
+		s.sampleRate = sampleRate
+	}
+
+	// 根据累计的采样数换算音频的时间, 先乘后除, 避免每帧的舍入误差累积
+	pts := s.frameDts + s.samples*avcHZ*1000/int64(sampleRate)
 
 	// 计算出pts和dts之间的差值
 	var ptsDtsGap int64
@@ -44,12 +51,12 @@ func (s *sync) syncAudioTs(dts *int64, sampleRate int) {
 
 	// 差值在阈值内，dts=pts
 	if ptsDtsGap <= s.syncMs {
-		s.frameNum++
+		s.samples += int64(samples)
 		*dts = pts
 		return
 	}
 
 	// 差值在阈值外，dts=dts
-	s.frameNum = 1
+	s.samples = int64(samples)
 	s.frameDts = *dts
 }
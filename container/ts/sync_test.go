@@ -13,22 +13,54 @@ func TestNewAvSync(t *testing.T) {
 	var dts int64
 
 	dts = 0
-	s.syncAudioTs(&dts, 44100)
+	s.syncAudioTs(&dts, 44100, 1024)
 	at.Equal(int64(0), dts)
 
 	dts = 2000
-	s.syncAudioTs(&dts, 44100)
+	s.syncAudioTs(&dts, 44100, 1024)
 	at.Equal(int64(2089), dts)
 
 	dts = 5000
-	s.syncAudioTs(&dts, 44100)
-	at.Equal(int64(4178), dts)
+	s.syncAudioTs(&dts, 44100, 1024)
+	at.Equal(int64(4179), dts)
 
 	dts = 10000
-	s.syncAudioTs(&dts, 44100)
+	s.syncAudioTs(&dts, 44100, 1024)
 	at.Equal(int64(10000), dts)
 
 	dts = 12000
-	s.syncAudioTs(&dts, 44100)
+	s.syncAudioTs(&dts, 44100, 1024)
 	at.Equal(int64(12089), dts)
 }
+
+func TestSync_SamplesPerFrame(t *testing.T) {
+	at := assert.New(t)
+
+	// case1: mp3(1152个采样/帧)一小时后没有累计误差
+	s := newSync(10)
+	var dts int64
+
+	frames := int64(3600 * 44100 / 1152)
+	for i := int64(0); i <= frames; i++ {
+		dts = i * 1152 * 90000 / 44100
+		s.syncAudioTs(&dts, 44100, 1152)
+	}
+	at.Equal(frames*1152*90000/44100, dts)
+
+	// case2: HE-AAC(2048个输出采样/帧)
+	s = newSync(10)
+	for _, expected := range []int64{0, 4179, 8359} {
+		dts = expected
+		s.syncAudioTs(&dts, 44100, 2048)
+		at.Equal(expected, dts)
+	}
+
+	// case3: 采样率变化, 以变化前的时间为基准
+	dts = 12000
+	s.syncAudioTs(&dts, 22050, 1024)
+	at.Equal(int64(12538), dts)
+
+	dts = 16000
+	s.syncAudioTs(&dts, 22050, 1024)
+	at.Equal(int64(16717), dts)
+}
@@ -3,6 +3,16 @@ package table
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// ISO_639_language_descriptor 中的音频类型(audio_type)
+const (
+	AudioTypeUndefined                = 0x00
+	AudioTypeCleanEffects             = 0x01
+	AudioTypeHearingImpaired          = 0x02
+	AudioTypeVisualImpairedCommentary = 0x03
 )
 
 // Descriptor 描述表
@@ -24,6 +34,11 @@ func (d *Descriptor) GetBuffer() *bytes.Buffer {
 
 // Service serviceType: pmt表的program pid
 func (d *Descriptor) Service(serviceType byte, serviceProviderName string, serviceName string) error {
+	// 描述符长度只有1个字节
+	if len(serviceProviderName)+len(serviceName)+3 > 0xff {
+		return fmt.Errorf("service descriptor too long, provider=%s, service=%s", serviceProviderName, serviceName)
+	}
+
 	serviceProviderNameLen := byte(len(serviceProviderName))
 
 	serviceNameLen := byte(len(serviceName))
@@ -59,6 +74,10 @@ func (d *Descriptor) Service(serviceType byte, serviceProviderName string, servi
 
 // NetworkName 网络名称
 func (d *Descriptor) NetworkName(name string) error {
+	if len(name) > 0xff {
+		return fmt.Errorf("network name too long(%s)", name)
+	}
+
 	nameLen := len(name)
 	descriptorLen := byte(nameLen)
 
@@ -93,3 +112,139 @@ func (d *Descriptor) CountryAvailability(isAvailable bool, countryCode uint32) e
 
 	return nil
 }
+
+// ISO639Language 语言描述符(PMT中音频的ES描述符), language 为 ISO 639-2 的三字母代码, 如 "chi", "eng"
+func (d *Descriptor) ISO639Language(language string, audioType byte) error {
+	if len(language) != 3 {
+		return fmt.Errorf("invalid iso 639 language code(%s)", language)
+	}
+
+	_, err := d.data.Write([]byte{0x0a, 4})
+	if err != nil {
+		return err
+	}
+
+	_, err = d.data.WriteString(language)
+	if err != nil {
+		return err
+	}
+
+	return d.data.WriteByte(audioType)
+}
+
+// Registration 注册描述符(PMT中的节目级或ES描述符), formatIdentifier 为4个字符的格式标识, 如 "HDMV"
+func (d *Descriptor) Registration(formatIdentifier string) error {
+	if len(formatIdentifier) != 4 {
+		return fmt.Errorf("invalid format identifier(%s)", formatIdentifier)
+	}
+
+	_, err := d.data.Write([]byte{0x05, 4})
+	if err != nil {
+		return err
+	}
+
+	_, err = d.data.WriteString(formatIdentifier)
+	return err
+}
+
+// ServiceListItem 业务列表描述符中的业务
+type ServiceListItem struct {
+	ServiceID   uint16
+	ServiceType byte // 如 ServiceTypeDigitalTV
+}
+
+// ServiceList 业务列表(NIT中传输流的描述符)
+func (d *Descriptor) ServiceList(services ...ServiceListItem) error {
+	if 3*len(services) > 0xff {
+		return fmt.Errorf("too many services(%d) in service list", len(services))
+	}
+
+	_, err := d.data.Write([]byte{0x41, byte(3 * len(services))})
+	if err != nil {
+		return err
+	}
+
+	for _, s := range services {
+		_, err = d.data.Write([]byte{byte(s.ServiceID >> 8), byte(s.ServiceID), s.ServiceType})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ShortEvent 短事件(EIT中事件的名称和简介), language 为 ISO 639-2 的三字母代码
+func (d *Descriptor) ShortEvent(language, name, text string) error {
+	if len(language) != 3 {
+		return fmt.Errorf("invalid iso 639 language code(%s)", language)
+	}
+
+	descriptorLen := 3 + 1 + len(name) + 1 + len(text)
+	if descriptorLen > 0xff {
+		return fmt.Errorf("short event descriptor too long, name=%s", name)
+	}
+
+	_, err := d.data.Write([]byte{0x4d, byte(descriptorLen)})
+	if err != nil {
+		return err
+	}
+
+	_, err = d.data.WriteString(language)
+	if err != nil {
+		return err
+	}
+
+	err = d.data.WriteByte(byte(len(name)))
+	if err != nil {
+		return err
+	}
+
+	_, err = d.data.WriteString(name)
+	if err != nil {
+		return err
+	}
+
+	err = d.data.WriteByte(byte(len(text)))
+	if err != nil {
+		return err
+	}
+
+	_, err = d.data.WriteString(text)
+	return err
+}
+
+// LocalTimeOffset 本地时间偏移(TOT中的描述符), countryCode 为 ISO 3166 的三字母代码, 如 "CHN"
+// offset 为当前相对UTC的偏移, 到 timeOfChange 时变为 nextOffset(如夏令时), 没有变化时两者相同
+func (d *Descriptor) LocalTimeOffset(countryCode string, offset time.Duration, timeOfChange time.Time, nextOffset time.Duration) error {
+	if len(countryCode) != 3 {
+		return fmt.Errorf("invalid country code(%s)", countryCode)
+	}
+
+	// country_region_id=0, reserved, local_time_offset_polarity(1为UTC以西)
+	polarity := byte(0xfc)
+	if offset < 0 {
+		polarity |= 0x01
+		offset, nextOffset = -offset, -nextOffset
+	}
+
+	b := []byte{0x58, 13}
+	b = append(b, countryCode...)
+	b = append(b, polarity)
+	b = appendTimeOffset(b, offset)
+	b = appendUTCTime(b, timeOfChange)
+	b = appendTimeOffset(b, nextOffset)
+
+	_, err := d.data.Write(b)
+	return err
+}
+
+// 2字节的时间偏移: 4位BCD编码的时分
+func appendTimeOffset(b []byte, d time.Duration) []byte {
+	m := int(d / time.Minute)
+	if m < 0 {
+		m = 0
+	}
+
+	return append(b, bcd(m/60), bcd(m%60))
+}
@@ -2,6 +2,7 @@ package table
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -42,3 +43,67 @@ func TestDescriptor_CountryAvailability(t *testing.T) {
 		0x49, 0x4, 0x80, 0x0, 0x0, 0x4, 0xd2,
 	}, sdtDesc.GetBuffer().Bytes())
 }
+
+func TestDescriptor_ISO639Language(t *testing.T) {
+	at := assert.New(t)
+
+	desc := NewDescriptor()
+	at.Nil(desc.ISO639Language("eng", AudioTypeVisualImpairedCommentary))
+	at.Equal([]byte{0x0a, 0x04, 'e', 'n', 'g', 0x03}, desc.GetBuffer().Bytes())
+
+	// 语言代码必须为3个字符
+	at.NotNil(NewDescriptor().ISO639Language("en", AudioTypeUndefined))
+}
+
+func TestDescriptor_Registration(t *testing.T) {
+	at := assert.New(t)
+
+	desc := NewDescriptor()
+	at.Nil(desc.Registration("HDMV"))
+	at.Equal([]byte{0x05, 0x04, 'H', 'D', 'M', 'V'}, desc.GetBuffer().Bytes())
+
+	// 格式标识必须为4个字符
+	at.NotNil(NewDescriptor().Registration("HDM"))
+}
+
+func TestDescriptor_ServiceList(t *testing.T) {
+	at := assert.New(t)
+
+	desc := NewDescriptor()
+	at.Nil(desc.ServiceList(ServiceListItem{ServiceID: 1, ServiceType: ServiceTypeDigitalTV}, ServiceListItem{ServiceID: 0x102, ServiceType: ServiceTypeDigitalRadio}))
+	at.Equal([]byte{0x41, 0x06, 0x00, 0x01, 0x01, 0x01, 0x02, 0x02}, desc.GetBuffer().Bytes())
+
+	at.NotNil(NewDescriptor().ServiceList(make([]ServiceListItem, 86)...))
+}
+
+func TestDescriptor_ShortEvent(t *testing.T) {
+	at := assert.New(t)
+
+	desc := NewDescriptor()
+	at.Nil(desc.ShortEvent("chi", "news", "today"))
+	at.Equal([]byte{0x4d, 0x0e, 'c', 'h', 'i', 0x04, 'n', 'e', 'w', 's', 0x05, 't', 'o', 'd', 'a', 'y'}, desc.GetBuffer().Bytes())
+
+	// case2: 语言代码错误, 过长
+	at.NotNil(NewDescriptor().ShortEvent("zh", "news", ""))
+	at.NotNil(NewDescriptor().ShortEvent("chi", "news", string(make([]byte, 250))))
+}
+
+func TestDescriptor_LocalTimeOffset(t *testing.T) {
+	at := assert.New(t)
+
+	change := time.Date(1993, 10, 13, 12, 45, 0, 0, time.UTC)
+
+	desc := NewDescriptor()
+	at.Nil(desc.LocalTimeOffset("CHN", 8*time.Hour, change, 8*time.Hour))
+	at.Equal([]byte{
+		0x58, 0x0d, 'C', 'H', 'N', 0xfc, 0x08, 0x00, 0xc0, 0x79, 0x12, 0x45, 0x00, 0x08, 0x00,
+	}, desc.GetBuffer().Bytes())
+
+	// case2: UTC以西
+	desc = NewDescriptor()
+	at.Nil(desc.LocalTimeOffset("USA", -(4*time.Hour + 30*time.Minute), change, -5*time.Hour))
+	at.Equal([]byte{0xfd, 0x04, 0x30}, desc.GetBuffer().Bytes()[5:8])
+	at.Equal([]byte{0x05, 0x00}, desc.GetBuffer().Bytes()[13:])
+
+	at.NotNil(NewDescriptor().LocalTimeOffset("CN", 0, change, 0))
+}
@@ -0,0 +1,81 @@
+package table
+
+import "time"
+
+// EitEvent EIT中的事件(节目单中的一个节目)
+type EitEvent struct {
+	EventID       uint16
+	StartTime     time.Time
+	Duration      time.Duration
+	RunningStatus byte   // 如 RunningStatusRunning
+	Descriptors   []byte // 短事件描述符等
+}
+
+// Eit 当前TS的 present/following 事件信息表
+type Eit struct {
+	ServiceID         uint16
+	TransportStreamID uint16
+	OriginalNetworkID uint16
+	Version           byte
+	Present           *EitEvent // 当前事件, 为空时分段中没有事件
+	Following         *EitEvent // 下一个事件, 为空时分段中没有事件
+}
+
+// NewEit 新建业务的Eit表
+func NewEit(serviceID, transportStreamID, originalNetworkID uint16) *Eit {
+	return &Eit{
+		ServiceID:         serviceID,
+		TransportStreamID: transportStreamID,
+		OriginalNetworkID: originalNetworkID,
+	}
+}
+
+// Sections 生成EIT分段(table_id: 0x4e), 分段0为当前事件, 分段1为下一个事件, 均不含CRC_32
+// 事件的描述符过长, 分段超过4093字节时返回错误
+func (eit *Eit) Sections() ([][]byte, error) {
+	present, err := eit.section(0, eit.Present)
+	if err != nil {
+		return nil, err
+	}
+
+	following, err := eit.section(1, eit.Following)
+	if err != nil {
+		return nil, err
+	}
+
+	return [][]byte{present, following}, nil
+}
+
+func (eit *Eit) section(sectionNumber byte, e *EitEvent) ([]byte, error) {
+	bodyLen := 6
+	if e != nil {
+		bodyLen += 12 + len(e.Descriptors)
+	}
+
+	err := checkSectionLength(0x4e, bodyLen, maxSiSectionLength)
+	if err != nil {
+		return nil, err
+	}
+
+	b := sectionHeader(0x4e, privateSectionFlags, eit.ServiceID, eit.Version, bodyLen)
+	b[6], b[7] = sectionNumber, 1
+
+	// segment_last_section_number, last_table_id
+	b = append(b,
+		byte(eit.TransportStreamID>>8), byte(eit.TransportStreamID),
+		byte(eit.OriginalNetworkID>>8), byte(eit.OriginalNetworkID),
+		0x01, 0x4e,
+	)
+	if e == nil {
+		return b, nil
+	}
+
+	b = append(b, byte(e.EventID>>8), byte(e.EventID))
+	b = appendUTCTime(b, e.StartTime)
+	b = appendDuration(b, e.Duration)
+
+	// running_status, free_CA_mode=0, descriptors_loop_length
+	n := len(e.Descriptors)
+	b = append(b, e.RunningStatus<<5|byte(n>>8)&0x0f, byte(n))
+	return append(b, e.Descriptors...), nil
+}
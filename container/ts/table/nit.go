@@ -0,0 +1,101 @@
+package table
+
+import "fmt"
+
+// 业务类型(service_type)
+const (
+	ServiceTypeDigitalTV    = 0x01
+	ServiceTypeDigitalRadio = 0x02
+)
+
+// NitTransportStream NIT中的传输流
+type NitTransportStream struct {
+	TransportStreamID uint16
+	OriginalNetworkID uint16
+	Descriptors       []byte // 业务列表描述符等
+}
+
+// Nit 网络信息表
+type Nit struct {
+	NetworkID          uint16
+	Version            byte
+	NetworkDescriptors []byte // 网络名称描述符等
+	TransportStreams   []NitTransportStream
+}
+
+// NewNit 新建Nit表
+func NewNit(networkID uint16) *Nit {
+	return &Nit{
+		NetworkID: networkID,
+	}
+}
+
+// AddTransportStream 添加传输流及其描述符
+func (nit *Nit) AddTransportStream(transportStreamID, originalNetworkID uint16, descriptors []byte) {
+	nit.TransportStreams = append(nit.TransportStreams, NitTransportStream{
+		TransportStreamID: transportStreamID,
+		OriginalNetworkID: originalNetworkID,
+		Descriptors:       descriptors,
+	})
+}
+
+// Sections 生成NIT分段(table_id: 0x40, 当前网络), 不含CRC_32
+// 传输流较多时按传输流分为多个分段, 每个分段不超过4093字节, 网络描述符只在第一个分段中;
+// 网络描述符或单个传输流放不进一个分段时返回错误
+func (nit *Nit) Sections() ([][]byte, error) {
+	err := checkSectionLength(0x40, 2+len(nit.NetworkDescriptors)+2, maxSiSectionLength)
+	if err != nil {
+		return nil, err
+	}
+
+	var sections [][]byte
+	networkDescriptors := nit.NetworkDescriptors
+	streams := nit.TransportStreams
+	for len(sections) == 0 || len(streams) > 0 {
+		maxLen := maxBodyLen(maxSiSectionLength) - 2 - len(networkDescriptors) - 2
+
+		cnt, loopLen := 0, 0
+		for _, ts := range streams {
+			if loopLen+6+len(ts.Descriptors) > maxLen {
+				break
+			}
+			cnt++
+			loopLen += 6 + len(ts.Descriptors)
+		}
+		if cnt == 0 && len(streams) > 0 {
+			if len(networkDescriptors) > 0 && len(sections) == 0 {
+				// 网络描述符单独占用第一个分段
+				sections = append(sections, nit.section(networkDescriptors, nil, 0))
+				networkDescriptors = nil
+				continue
+			}
+			return nil, fmt.Errorf("descriptors of transport stream %d too long(%d)", streams[0].TransportStreamID, len(streams[0].Descriptors))
+		}
+
+		sections = append(sections, nit.section(networkDescriptors, streams[:cnt], loopLen))
+		networkDescriptors = nil
+		streams = streams[cnt:]
+	}
+
+	return numberSections(0x40, sections)
+}
+
+func (nit *Nit) section(networkDescriptors []byte, streams []NitTransportStream, loopLen int) []byte {
+	bodyLen := 2 + len(networkDescriptors) + 2 + loopLen
+
+	b := sectionHeader(0x40, privateSectionFlags, nit.NetworkID, nit.Version, bodyLen)
+	b = appendLength(b, len(networkDescriptors))
+	b = append(b, networkDescriptors...)
+
+	b = appendLength(b, loopLen)
+	for _, ts := range streams {
+		b = append(b,
+			byte(ts.TransportStreamID>>8), byte(ts.TransportStreamID),
+			byte(ts.OriginalNetworkID>>8), byte(ts.OriginalNetworkID),
+		)
+		b = appendLength(b, len(ts.Descriptors))
+		b = append(b, ts.Descriptors...)
+	}
+
+	return b
+}
@@ -1,23 +1,54 @@
 package table
 
+// PatProgram PAT中的节目
+type PatProgram struct {
+	ProgramNumber uint16 // 节目号, 0 表示NIT
+	PID           uint16 // PMT(或NIT)的PID
+}
+
 // Pat TS的Pat表
 type Pat struct {
-	TsHeader  []byte
-	PatHeader []byte
+	TransportStreamID uint16
+	Version           byte
+	Programs          []PatProgram
 }
 
 // NewPat 新建Pat表
-func NewPat() *Pat {
+func NewPat(transportStreamID uint16) *Pat {
 	return &Pat{
-		/*
-			组成: 4字节固定头 + 1字节指针域
-			pid: 0x0000
-		*/
-		TsHeader: []byte{0x47, 0x40, 0x00, 0x10, 0x00},
-		/*
-			program number: 0x1
-			program mapping table pid: 0x1001
-		*/
-		PatHeader: []byte{0x00, 0xb0, 0x0d, 0x00, 0x01, 0xc1, 0x00, 0x00, 0x00, 0x01, 0xf0, 0x01},
+		TransportStreamID: transportStreamID,
 	}
 }
+
+// AddProgram 添加节目及其PMT的PID
+func (pat *Pat) AddProgram(programNumber, pmtPID uint16) {
+	pat.Programs = append(pat.Programs, PatProgram{
+		ProgramNumber: programNumber,
+		PID:           pmtPID,
+	})
+}
+
+// Sections 生成PAT分段(table_id: 0x00), 不含CRC_32; 节目较多时分为多个分段, 每个分段不超过1021字节
+func (pat *Pat) Sections() ([][]byte, error) {
+	perSection := maxBodyLen(maxPsiSectionLength) / 4
+
+	var sections [][]byte
+	programs := pat.Programs
+	for len(sections) == 0 || len(programs) > 0 {
+		cnt := len(programs)
+		if cnt > perSection {
+			cnt = perSection
+		}
+
+		b := sectionHeader(0x00, sectionFlags, pat.TransportStreamID, pat.Version, 4*cnt)
+		for _, p := range programs[:cnt] {
+			b = append(b, byte(p.ProgramNumber>>8), byte(p.ProgramNumber))
+			b = appendPID(b, p.PID)
+		}
+
+		sections = append(sections, b)
+		programs = programs[cnt:]
+	}
+
+	return numberSections(0x00, sections)
+}
@@ -1,22 +1,61 @@
 package table
 
-// Pmt Ts的Pmt表
+// PmtStream PMT中的基本流
+type PmtStream struct {
+	StreamType  byte
+	PID         uint16
+	Descriptors []byte // ES_info中的描述符
+}
+
+// Pmt TS的Pmt表
 type Pmt struct {
-	TsHeader  []byte
-	PmtHeader []byte
+	ProgramNumber uint16
+	Version       byte
+	PcrPID        uint16 // 没有PCR时为 0x1fff
+	ProgramInfo   []byte // 节目级的描述符
+	Streams       []PmtStream
 }
 
 // NewPmt 新建Pmt表
-func NewPmt() *Pmt {
+func NewPmt(programNumber, pcrPID uint16) *Pmt {
 	return &Pmt{
-		/*
-			组成: 4字节固定头 + 1字节指针域
-			pid: 0x1001
-		*/
-		TsHeader: []byte{0x47, 0x50, 0x01, 0x10, 0x00},
-		/*
-			program number: 0x1
-		*/
-		PmtHeader: []byte{0x02, 0xb0, 0xff, 0x00, 0x01, 0xc1, 0x00, 0x00, 0xe1, 0x00, 0xf0, 0x00},
+		ProgramNumber: programNumber,
+		PcrPID:        pcrPID,
+	}
+}
+
+// AddStream 添加基本流
+func (pmt *Pmt) AddStream(streamType byte, pid uint16, descriptors []byte) {
+	pmt.Streams = append(pmt.Streams, PmtStream{
+		StreamType:  streamType,
+		PID:         pid,
+		Descriptors: descriptors,
+	})
+}
+
+// Section 生成PMT分段(table_id: 0x02), 不含CRC_32; PMT只有一个分段, 超过1021字节时返回错误
+func (pmt *Pmt) Section() ([]byte, error) {
+	bodyLen := 4 + len(pmt.ProgramInfo)
+	for _, s := range pmt.Streams {
+		bodyLen += 5 + len(s.Descriptors)
 	}
+
+	err := checkSectionLength(0x02, bodyLen, maxPsiSectionLength)
+	if err != nil {
+		return nil, err
+	}
+
+	b := sectionHeader(0x02, sectionFlags, pmt.ProgramNumber, pmt.Version, bodyLen)
+	b = appendPID(b, pmt.PcrPID)
+	b = appendLength(b, len(pmt.ProgramInfo))
+	b = append(b, pmt.ProgramInfo...)
+
+	for _, s := range pmt.Streams {
+		b = append(b, s.StreamType)
+		b = appendPID(b, s.PID)
+		b = appendLength(b, len(s.Descriptors))
+		b = append(b, s.Descriptors...)
+	}
+
+	return b, nil
 }
@@ -1,23 +1,36 @@
 package table
 
-// Program Ts的节目表
-type Program struct {
-	Avc []byte
-	Aac []byte
+// 节目流类型(stream_type)
+const (
+	StreamTypeMpeg1Audio = 0x03
+	StreamTypeMpeg2Audio = 0x04
+	StreamTypeAac        = 0x0f
+	StreamTypeAvc        = 0x1b
+	StreamTypeHevc       = 0x24
+
+	// SAMPLE-AES 加密的流类型
+	StreamTypeAvcSampleAES = 0xdb
+	StreamTypeAacSampleAES = 0xcf
+)
+
+// SampleAESVideoDescriptor SAMPLE-AES 加密的h.264的ES描述符: private_data_indicator_descriptor('zavc')
+func SampleAESVideoDescriptor() []byte {
+	return []byte{0x0f, 0x04, 'z', 'a', 'v', 'c'}
 }
 
-// NewProgram 新建节目表
-func NewProgram() *Program {
-	return &Program{
-		/*
-			stream type: h.264(AVC video stream as defined in ITU-T Rec. H.264 | ISO/IEC 14496-10 Video (h.264))
-			stream type pid: 0x100
-		*/
-		Avc: []byte{0x1b, 0xe1, 0x00, 0xf0, 0x00},
-		/*
-			stream type: aac(ISO/IEC 13818-7 Audio with ADTS transport syntax)
-			stream type pid: 0x101
-		*/
-		Aac: []byte{0x0f, 0xe1, 0x01, 0xf0, 0x00},
-	}
+// SampleAESAudioDescriptor SAMPLE-AES 加密的AAC的ES描述符
+// audioType 为 zaac(AAC-LC), zach(HE-AAC) 或 zacp(HE-AACv2), config 为 AudioSpecificConfig
+// descriptor: private_data_indicator_descriptor('aacd'), registration_descriptor('apad' + audio_setup_information)
+func SampleAESAudioDescriptor(audioType string, config []byte) []byte {
+	setup := make([]byte, 0, 16+len(config))
+	setup = append(setup, 'a', 'p', 'a', 'd')
+	setup = append(setup, audioType...)
+	setup = append(setup, 0x00, 0x00, 0x01, byte(len(config))) // priming, version, setup_data_length
+	setup = append(setup, config...)
+
+	b := []byte{0x0f, 0x04, 'a', 'a', 'c', 'd'}
+	b = append(b, 0x05, byte(len(setup)))
+	b = append(b, setup...)
+
+	return b
 }
@@ -1,23 +1,92 @@
 package table
 
+import "fmt"
+
+// 业务的运行状态(running_status)
+const (
+	RunningStatusUndefined  = 0
+	RunningStatusNotRunning = 1
+	RunningStatusRunning    = 4
+)
+
+// SdtService SDT中的业务
+type SdtService struct {
+	ServiceID     uint16 // 与PMT中的节目号相同
+	RunningStatus byte
+	Descriptors   []byte // 业务描述符等
+
+	EITPresentFollowing bool // 当前TS中是否有该业务的EIT present/following
+}
+
 // Sdt Ts的Sdt表
 type Sdt struct {
-	TsHeader  []byte
-	SdtHeader []byte
+	TransportStreamID uint16
+	OriginalNetworkID uint16
+	Version           byte
+	Services          []SdtService
 }
 
 // NewSdt 新建Sdt表
-func NewSdt() *Sdt {
+func NewSdt(transportStreamID, originalNetworkID uint16) *Sdt {
 	return &Sdt{
-		/*
-			组成: 4字节固定头 + 1字节指针域
-			pid: 0x0011
-		*/
-		TsHeader: []byte{0x47, 0x40, 0x11, 0x10, 0x00},
-		/*
-			transport stream id: 0x1
-		*/
-		SdtHeader: []byte{0x42, 0xF0, 0x00, 0x00, 0x01, 0xC1, 0x00, 0x00, 0xFF, 0x01,
-			0xFF, 0x00, 0x01, 0xFC, 0x80, 0x00},
+		TransportStreamID: transportStreamID,
+		OriginalNetworkID: originalNetworkID,
 	}
 }
+
+// AddService 添加正在运行的业务
+func (sdt *Sdt) AddService(serviceID uint16, descriptors []byte) {
+	sdt.Services = append(sdt.Services, SdtService{
+		ServiceID:     serviceID,
+		RunningStatus: RunningStatusRunning,
+		Descriptors:   descriptors,
+	})
+}
+
+// Sections 生成SDT分段(table_id: 0x42, 当前TS), 不含CRC_32
+// 业务较多时按业务分为多个分段, 每个分段不超过4093字节; 单个业务放不进一个分段时返回错误
+func (sdt *Sdt) Sections() ([][]byte, error) {
+	maxLen := maxBodyLen(maxSiSectionLength) - 3
+
+	var sections [][]byte
+	services := sdt.Services
+	for len(sections) == 0 || len(services) > 0 {
+		cnt, bodyLen := 0, 0
+		for _, s := range services {
+			if bodyLen+5+len(s.Descriptors) > maxLen {
+				break
+			}
+			cnt++
+			bodyLen += 5 + len(s.Descriptors)
+		}
+		if cnt == 0 && len(services) > 0 {
+			return nil, fmt.Errorf("descriptors of service %d too long(%d)", services[0].ServiceID, len(services[0].Descriptors))
+		}
+
+		sections = append(sections, sdt.section(services[:cnt], bodyLen))
+		services = services[cnt:]
+	}
+
+	return numberSections(0x42, sections)
+}
+
+func (sdt *Sdt) section(services []SdtService, loopLen int) []byte {
+	b := sectionHeader(0x42, privateSectionFlags, sdt.TransportStreamID, sdt.Version, 3+loopLen)
+	b = append(b, byte(sdt.OriginalNetworkID>>8), byte(sdt.OriginalNetworkID), 0xff)
+
+	for _, s := range services {
+		// reserved_future_use, EIT_schedule_flag=0, EIT_present_following_flag
+		flags := byte(0xfc)
+		if s.EITPresentFollowing {
+			flags |= 0x01
+		}
+		b = append(b, byte(s.ServiceID>>8), byte(s.ServiceID), flags)
+
+		// running_status, free_CA_mode=0, descriptors_loop_length
+		n := len(s.Descriptors)
+		b = append(b, s.RunningStatus<<5|byte(n>>8)&0x0f, byte(n))
+		b = append(b, s.Descriptors...)
+	}
+
+	return b
+}
@@ -0,0 +1,68 @@
+package table
+
+import "fmt"
+
+// 分段头中 section_length 之前的标志位
+const (
+	sectionFlags        = 0xb0 // section_syntax_indicator=1, '0', reserved
+	privateSectionFlags = 0xf0 // section_syntax_indicator=1, reserved_future_use=1, reserved(DVB SI)
+)
+
+// section_length 的最大值: PSI(PAT/PMT)为1021, DVB SI(SDT/NIT/EIT)为4093
+const (
+	maxPsiSectionLength = 1021
+	maxSiSectionLength  = 4093
+)
+
+// 一个表最多256个分段
+const maxSections = 256
+
+// 长分段中头(8字节)和CRC_32之外的最大数据长度
+func maxBodyLen(maxLength int) int {
+	return maxLength - 5 - 4
+}
+
+// 长分段的公共头(8字节), bodyLen 为头之后的数据长度(不含CRC_32)
+// section_length 包含头中其后的5字节和4字节的CRC_32, 分段号为0, 多个分段时由 numberSections 设置
+func sectionHeader(tableID, flags byte, ext uint16, version byte, bodyLen int) []byte {
+	length := 5 + bodyLen + 4
+
+	// reserved, version_number, current_next_indicator=1, section_number, last_section_number
+	return []byte{
+		tableID, flags | byte(length>>8)&0x0f, byte(length),
+		byte(ext >> 8), byte(ext),
+		0xc1 | (version&0x1f)<<1,
+		0x00, 0x00,
+	}
+}
+
+// 检查分段长度, 超过 section_length 的最大值时返回错误, 不截断
+func checkSectionLength(tableID byte, bodyLen, maxLength int) error {
+	length := 5 + bodyLen + 4
+	if length > maxLength {
+		return fmt.Errorf("table 0x%02x section too long(%d > %d)", tableID, length, maxLength)
+	}
+	return nil
+}
+
+// 设置各分段的 section_number 和 last_section_number
+func numberSections(tableID byte, sections [][]byte) ([][]byte, error) {
+	if len(sections) > maxSections {
+		return nil, fmt.Errorf("table 0x%02x has too many sections(%d)", tableID, len(sections))
+	}
+
+	for i, b := range sections {
+		b[6], b[7] = byte(i), byte(len(sections)-1)
+	}
+	return sections, nil
+}
+
+// 13位的PID, 高3位为保留位
+func appendPID(b []byte, pid uint16) []byte {
+	return append(b, 0xe0|byte(pid>>8)&0x1f, byte(pid))
+}
+
+// 12位的长度, 高4位为保留位
+func appendLength(b []byte, n int) []byte {
+	return append(b, 0xf0|byte(n>>8)&0x0f, byte(n))
+}
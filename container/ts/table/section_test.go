@@ -0,0 +1,223 @@
+package table
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 只有一个分段的表
+func testSection(t *testing.T, sections [][]byte, err error) []byte {
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sections) != 1 {
+		t.Fatalf("%d sections", len(sections))
+	}
+	return sections[0]
+}
+
+// 分段的 section_length
+func testSectionLength(section []byte) int {
+	return int(section[1]&0x0f)<<8 | int(section[2])
+}
+
+func TestPat_Section(t *testing.T) {
+	at := assert.New(t)
+
+	pat := NewPat(0x1)
+	pat.AddProgram(0x1, 0x1001)
+
+	sections, err := pat.Sections()
+	at.Equal([]byte{
+		0x00, 0xb0, 0x0d, 0x00, 0x01, 0xc1, 0x00, 0x00,
+		0x00, 0x01, 0xf0, 0x01,
+	}, testSection(t, sections, err))
+
+	// case2: 版本号和多个节目
+	pat = NewPat(0x1234)
+	pat.Version = 3
+	pat.AddProgram(0x0, 0x10)
+	pat.AddProgram(0x2, 0x200)
+	sections, err = pat.Sections()
+	at.Equal([]byte{
+		0x00, 0xb0, 0x11, 0x12, 0x34, 0xc7, 0x00, 0x00,
+		0x00, 0x00, 0xe0, 0x10, 0x00, 0x02, 0xe2, 0x00,
+	}, testSection(t, sections, err))
+
+	// case3: 节目较多时分为多个分段, 每个分段不超过1021字节
+	pat = NewPat(0x1)
+	for i := 0; i < 300; i++ {
+		pat.AddProgram(uint16(i+1), 0x100)
+	}
+	sections, err = pat.Sections()
+	at.Nil(err)
+	at.Len(sections, 2)
+	at.Equal(1021, testSectionLength(sections[0]))
+	at.Equal(5+47*4+4, testSectionLength(sections[1]))
+	at.Equal([]byte{0x00, 0x01}, sections[0][6:8])
+	at.Equal([]byte{0x01, 0x01}, sections[1][6:8])
+	at.Equal([]byte{0x00, 0xfe}, sections[1][8:10])
+}
+
+func TestPmt_Section(t *testing.T) {
+	at := assert.New(t)
+
+	pmt := NewPmt(0x1, 0x100)
+	pmt.AddStream(StreamTypeAvc, 0x100, nil)
+	pmt.AddStream(StreamTypeAac, 0x101, nil)
+
+	section, err := pmt.Section()
+	at.Nil(err)
+	at.Equal([]byte{
+		0x02, 0xb0, 0x17, 0x00, 0x01, 0xc1, 0x00, 0x00,
+		0xe1, 0x00, 0xf0, 0x00,
+		0x1b, 0xe1, 0x00, 0xf0, 0x00,
+		0x0f, 0xe1, 0x01, 0xf0, 0x00,
+	}, section)
+
+	// case2: 节目级和ES级的描述符
+	pmt = NewPmt(0x2, 0x1fff)
+	pmt.ProgramInfo = []byte{0x05, 0x00}
+	pmt.AddStream(StreamTypeAvcSampleAES, 0x300, SampleAESVideoDescriptor())
+	section, err = pmt.Section()
+	at.Nil(err)
+	at.Equal([]byte{
+		0x02, 0xb0, 0x1a, 0x00, 0x02, 0xc1, 0x00, 0x00,
+		0xff, 0xff, 0xf0, 0x02, 0x05, 0x00,
+		0xdb, 0xe3, 0x00, 0xf0, 0x06, 0x0f, 0x04, 'z', 'a', 'v', 'c',
+	}, section)
+
+	// case3: PMT只有一个分段, 超过1021字节时返回错误
+	pmt.ProgramInfo = make([]byte, 1021-13-11+1)
+	_, err = pmt.Section()
+	at.NotNil(err)
+
+	pmt.ProgramInfo = pmt.ProgramInfo[:len(pmt.ProgramInfo)-1]
+	section, err = pmt.Section()
+	at.Nil(err)
+	at.Equal(1021, testSectionLength(section))
+}
+
+func TestSdt_Section(t *testing.T) {
+	at := assert.New(t)
+
+	sdt := NewSdt(0x1, 0xff01)
+	sdt.AddService(0x1, []byte{0x48, 0x03, 0x01, 0x00, 0x00})
+
+	sections, err := sdt.Sections()
+	at.Equal([]byte{
+		0x42, 0xf0, 0x16, 0x00, 0x01, 0xc1, 0x00, 0x00,
+		0xff, 0x01, 0xff,
+		0x00, 0x01, 0xfc, 0x80, 0x05, 0x48, 0x03, 0x01, 0x00, 0x00,
+	}, testSection(t, sections, err))
+
+	// 有EIT present/following 的业务
+	sdt.Services[0].EITPresentFollowing = true
+	sections, err = sdt.Sections()
+	at.Equal(byte(0xfd), testSection(t, sections, err)[13])
+
+	// case2: 业务较多时按业务分为多个分段, 每个分段不超过4093字节
+	sdt = NewSdt(0x1, 0xff01)
+	for i := 0; i < 30; i++ {
+		sdt.AddService(uint16(i+1), make([]byte, 250))
+	}
+	sections, err = sdt.Sections()
+	at.Nil(err)
+	at.Len(sections, 2)
+	at.Equal(5+3+16*255+4, testSectionLength(sections[0]))
+	at.Equal(5+3+14*255+4, testSectionLength(sections[1]))
+	at.Equal([]byte{0x00, 0x01}, sections[0][6:8])
+	at.Equal([]byte{0x01, 0x01}, sections[1][6:8])
+	at.Equal([]byte{0xff, 0x01, 0xff, 0x00, 0x11}, sections[1][8:13])
+
+	// case3: 单个业务放不进一个分段时返回错误
+	sdt.AddService(0x100, make([]byte, 4093-5-3-4-5+1))
+	_, err = sdt.Sections()
+	at.NotNil(err)
+}
+
+func TestNit_Section(t *testing.T) {
+	at := assert.New(t)
+
+	nit := NewNit(0x3001)
+	nit.NetworkDescriptors = []byte{0x40, 0x02, 'n', 't'}
+	nit.AddTransportStream(0x1, 0xff01, []byte{0x41, 0x03, 0x00, 0x01, 0x01})
+
+	sections, err := nit.Sections()
+	at.Equal([]byte{
+		0x40, 0xf0, 0x1c, 0x30, 0x01, 0xc1, 0x00, 0x00,
+		0xf0, 0x04, 0x40, 0x02, 'n', 't',
+		0xf0, 0x0b, 0x00, 0x01, 0xff, 0x01, 0xf0, 0x05, 0x41, 0x03, 0x00, 0x01, 0x01,
+	}, testSection(t, sections, err))
+
+	// case2: 传输流较多时分为多个分段, 网络描述符只在第一个分段中
+	for i := 0; i < 20; i++ {
+		nit.AddTransportStream(uint16(i+2), 0xff01, make([]byte, 250))
+	}
+	sections, err = nit.Sections()
+	at.Nil(err)
+	at.Len(sections, 2)
+	for i, section := range sections {
+		at.True(testSectionLength(section) <= 4093)
+		at.Equal([]byte{byte(i), 0x01}, section[6:8])
+	}
+	at.Equal([]byte{0xf0, 0x04}, sections[0][8:10])
+	at.Equal([]byte{0xf0, 0x00}, sections[1][8:10])
+
+	// case3: 单个传输流放不进一个分段时返回错误
+	nit.AddTransportStream(0x100, 0xff01, make([]byte, 4093))
+	_, err = nit.Sections()
+	at.NotNil(err)
+}
+
+func TestEit_Sections(t *testing.T) {
+	at := assert.New(t)
+
+	eit := NewEit(0x1, 0x2, 0xff01)
+	eit.Version = 2
+	eit.Present = &EitEvent{
+		EventID:       0x10,
+		StartTime:     time.Date(1993, 10, 13, 12, 45, 0, 0, time.UTC),
+		Duration:      time.Hour + 45*time.Minute + 30*time.Second,
+		RunningStatus: RunningStatusRunning,
+		Descriptors:   []byte{0x4d, 0x00},
+	}
+
+	sections, err := eit.Sections()
+	at.Nil(err)
+	at.Len(sections, 2)
+
+	// case1: 分段0为当前事件, 时间为MJD+BCD
+	at.Equal([]byte{
+		0x4e, 0xf0, 0x1d, 0x00, 0x01, 0xc5, 0x00, 0x01,
+		0x00, 0x02, 0xff, 0x01, 0x01, 0x4e,
+		0x00, 0x10, 0xc0, 0x79, 0x12, 0x45, 0x00, 0x01, 0x45, 0x30, 0x80, 0x02, 0x4d, 0x00,
+	}, sections[0])
+
+	// case2: 没有下一个事件时分段1为空
+	at.Equal([]byte{
+		0x4e, 0xf0, 0x0f, 0x00, 0x01, 0xc5, 0x01, 0x01,
+		0x00, 0x02, 0xff, 0x01, 0x01, 0x4e,
+	}, sections[1])
+
+	// case3: 事件的描述符过长时返回错误
+	eit.Following = &EitEvent{EventID: 0x11, Descriptors: make([]byte, 4093)}
+	_, err = eit.Sections()
+	at.NotNil(err)
+}
+
+func TestTdt_Section(t *testing.T) {
+	at := assert.New(t)
+
+	now := time.Date(1993, 10, 13, 20, 45, 9, 0, time.FixedZone("CST", 8*3600))
+	at.Equal([]byte{0x70, 0x70, 0x05, 0xc0, 0x79, 0x12, 0x45, 0x09}, NewTdt(now).Section())
+
+	at.Equal([]byte{
+		0x73, 0x70, 0x0d, 0xc0, 0x79, 0x12, 0x45, 0x09, 0xf0, 0x02, 0x58, 0x00,
+	}, NewTot(now, []byte{0x58, 0x00}).Section())
+
+	// 1970年之前的日期
+	at.Equal([]byte{0x9e, 0x8a, 0x23, 0x59, 0x59}, appendUTCTime(nil, time.Date(1969, 12, 31, 23, 59, 59, 0, time.UTC)))
+}
@@ -0,0 +1,81 @@
+package table
+
+import "time"
+
+// 1970-01-01 的修正儒略日(MJD)
+const mjdUnixEpoch = 40587
+
+// Tdt 时间和日期表
+type Tdt struct {
+	UTCTime time.Time
+}
+
+// NewTdt 新建Tdt表
+func NewTdt(utcTime time.Time) *Tdt {
+	return &Tdt{
+		UTCTime: utcTime,
+	}
+}
+
+// Section 生成TDT分段(table_id: 0x70), TDT为短分段, 没有CRC_32
+func (tdt *Tdt) Section() []byte {
+	// section_syntax_indicator=0, reserved_future_use=1, reserved, section_length=5
+	b := []byte{0x70, 0x70, 0x05}
+	return appendUTCTime(b, tdt.UTCTime)
+}
+
+// Tot 时间偏移表
+type Tot struct {
+	UTCTime     time.Time
+	Descriptors []byte // 本地时间偏移描述符等
+}
+
+// NewTot 新建Tot表
+func NewTot(utcTime time.Time, descriptors []byte) *Tot {
+	return &Tot{
+		UTCTime:     utcTime,
+		Descriptors: descriptors,
+	}
+}
+
+// Section 生成TOT分段(table_id: 0x73), 不含CRC_32
+func (tot *Tot) Section() []byte {
+	length := 5 + 2 + len(tot.Descriptors) + 4
+
+	b := []byte{0x73, 0x70 | byte(length>>8)&0x0f, byte(length)}
+	b = appendUTCTime(b, tot.UTCTime)
+	b = appendLength(b, len(tot.Descriptors))
+	return append(b, tot.Descriptors...)
+}
+
+// 5字节的UTC时间: 16位的MJD日期 + 6位BCD编码的时分秒
+func appendUTCTime(b []byte, t time.Time) []byte {
+	t = t.UTC()
+
+	days := t.Unix() / 86400
+	if t.Unix() < 0 && t.Unix()%86400 != 0 {
+		days--
+	}
+	mjd := uint16(mjdUnixEpoch + days)
+
+	b = append(b, byte(mjd>>8), byte(mjd))
+	return append(b, bcd(t.Hour()), bcd(t.Minute()), bcd(t.Second()))
+}
+
+// 3字节的时长: 6位BCD编码的时分秒, 超过99小时按99小时计
+func appendDuration(b []byte, d time.Duration) []byte {
+	s := int(d / time.Second)
+	if s < 0 {
+		s = 0
+	}
+	if s > 99*3600+59*60+59 {
+		s = 99*3600 + 59*60 + 59
+	}
+
+	return append(b, bcd(s/3600), bcd(s/60%60), bcd(s%60))
+}
+
+// 两位十进制数的BCD编码
+func bcd(n int) byte {
+	return byte(n/10%10)<<4 | byte(n%10)
+}
@@ -0,0 +1,97 @@
+// Package ts 同一节目中的多个音频轨道(如不同语言的解说)
+package ts
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/moggle-mog/goav/packet"
+	"github.com/moggle-mog/goav/parser"
+)
+
+// MixerAudioTrack Mixer中额外的音频轨道, 与主音频分别解析和同步, 使用相同的时间基准
+type MixerAudioTrack struct {
+	m      *Mixer
+	track  int
+	parser *parser.CodecParser
+	sync   *sync
+	dts    int64
+	seqHdr *bytes.Buffer
+	media  *bytes.Buffer
+}
+
+// AudioTrack 返回额外的音频轨道(1起, 对应 MuxerOptions.AudioTracks), 轨道需要先通过 SetMuxerOptions 设置
+func (m *Mixer) AudioTrack(track int) (*MixerAudioTrack, error) {
+	if track < 1 || m.muxer.track(track) == nil {
+		return nil, fmt.Errorf("audio track %d not found", track)
+	}
+
+	t, ok := m.tracks[track]
+	if !ok {
+		t = &MixerAudioTrack{
+			m:      m,
+			track:  track,
+			parser: parser.NewCodecParser(),
+			sync:   newSync(m.syncMs),
+			seqHdr: bytes.NewBuffer(make([]byte, 0, 512)),
+			media:  bytes.NewBuffer(make([]byte, 0, 512)),
+		}
+		m.tracks[track] = t
+	}
+
+	return t, nil
+}
+
+// SaveAACHeader 保存轨道的AAC序列头（flv->aac sequence header）
+func (t *MixerAudioTrack) SaveAACHeader(p *packet.Packet) error {
+	// 解析前p.Media为 AudioSpecificConfig
+	t.m.muxer.track(t.track).setConfig(p.Media)
+
+	t.seqHdr.Reset()
+	err := t.parser.Parse(p, t.seqHdr)
+	if err != nil {
+		return err
+	}
+	p.Media = t.seqHdr.Bytes()
+
+	t.seqHdr.Reset()
+	return t.m.muxer.MuxTrack(t.track, p, 0, 0, t.seqHdr)
+}
+
+// Update 计算轨道音频包的dts(pts=dts), pktTs 为数据包的时间(ms)
+func (t *MixerAudioTrack) Update(p *packet.Packet, pktTs uint32) error {
+	sampleRate, samples, err := audioSamples(p, t.parser)
+	if err != nil {
+		return err
+	}
+
+	t.dts = int64(pktTs) * avcHZ
+	t.sync.syncAudioTs(&t.dts, sampleRate, samples)
+	return nil
+}
+
+// Mux 转换为ts格式, 写入Mixer的输出
+func (t *MixerAudioTrack) Mux(p *packet.Packet) error {
+	t.media.Reset()
+	err := t.parser.Parse(p, t.media)
+	if err != nil {
+		return err
+	}
+	p.Media = t.media.Bytes()
+
+	// mp3没有序列头, 根据帧头设置PMT中的流类型
+	ah, ok := p.Header.(packet.AudioPacketHeader)
+	if ok && ah.IsSoundMP3() {
+		streamType, ok := mp3StreamType(p.Media)
+		if ok {
+			t.m.muxer.track(t.track).streamType = streamType
+		}
+	}
+
+	err = t.m.repeatTables(t.dts)
+	if err != nil {
+		return err
+	}
+
+	return t.m.muxer.MuxTrack(t.track, p, t.dts, t.dts, t.m.ts)
+}
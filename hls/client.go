@@ -0,0 +1,498 @@
+// Package hls 拉取HLS直播流, 将TS切片解复用为flv数据包
+package hls
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/moggle-mog/goav/container/flv"
+	"github.com/moggle-mog/goav/container/ts"
+	"github.com/moggle-mog/goav/container/ts/table"
+	"github.com/moggle-mog/goav/hls/m3u8"
+	"github.com/moggle-mog/goav/packet"
+)
+
+// 直播流从距离末尾至少 liveStartSegments 个目标时长的切片开始拉取
+const liveStartSegments = 3
+
+// 时间戳为33位, 单位: 1/90000秒
+const (
+	tsWrap     = int64(1) << 33
+	tsHalfWrap = int64(1) << 32
+	tsHZ       = 90
+)
+
+// ClientConfig 拉流配置
+type ClientConfig struct {
+	HTTPClient    *http.Client                        // 默认使用 http.DefaultClient
+	SelectVariant func([]*m3u8.Variant) *m3u8.Variant // 从主播放列表中选择码流, 默认选择带宽最高的码流
+}
+
+// Client HLS拉流客户端, 按顺序下载切片, 将TS解复用后打包为flv数据包写入 packet.Writer
+// 支持H264, AAC和mp3; 不支持加密的切片和H265
+type Client struct {
+	url string
+	w   packet.Writer
+	cfg ClientConfig
+
+	started bool   // 是否已确定起始切片
+	nextSeq uint64 // 下一个要下载的切片序号
+	key     string // 当前生效的加密方式
+
+	// 不带偏移的 EXT-X-BYTERANGE 紧接上一个子范围
+	rangeURI string
+	rangeEnd int64
+
+	avc    *flv.AvcPacker
+	aac    *flv.AacPacker
+	mp3    *flv.Mp3Packer
+	tl     timeline
+	clocks map[uint16]*esClock // PID -> 基本流的时间
+}
+
+// NewClient HLS拉流客户端, url 可以是主播放列表或媒体播放列表
+func NewClient(url string, w packet.Writer, cfg ClientConfig) *Client {
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	if cfg.SelectVariant == nil {
+		cfg.SelectVariant = maxBandwidth
+	}
+
+	return &Client{
+		url:    url,
+		w:      w,
+		cfg:    cfg,
+		avc:    flv.NewAvcPacker(),
+		aac:    flv.NewAacPacker(),
+		mp3:    flv.NewMp3Packer(),
+		clocks: make(map[uint16]*esClock),
+	}
+}
+
+// 默认选择带宽最高的码流
+func maxBandwidth(variants []*m3u8.Variant) *m3u8.Variant {
+	var best *m3u8.Variant
+	for _, v := range variants {
+		if best == nil || v.Bandwidth > best.Bandwidth {
+			best = v
+		}
+	}
+
+	return best
+}
+
+// Run 拉取直播流, 直到播放列表结束(EXT-X-ENDLIST)、出错或ctx取消
+// 播放列表有新切片时按目标时长重新加载, 否则按目标时长的一半重新加载
+func (c *Client) Run(ctx context.Context) error {
+	playlistURL, media, err := c.resolve(ctx)
+	if err != nil {
+		return err
+	}
+
+	for {
+		changed, err := c.process(ctx, playlistURL, media)
+		if err != nil {
+			return err
+		}
+
+		if media.EndList {
+			return nil
+		}
+
+		reload := time.Duration(media.TargetDuration) * time.Second
+		if !changed {
+			reload /= 2
+		}
+
+		timer := time.NewTimer(reload)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+
+		media, err = c.fetchMedia(ctx, playlistURL)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// 获取媒体播放列表, 如果是主播放列表则选择码流
+func (c *Client) resolve(ctx context.Context) (*url.URL, *m3u8.MediaPlaylist, error) {
+	u, err := url.Parse(c.url)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b, err := c.get(ctx, u, nil, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pl, err := m3u8.Parse(b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch pl := pl.(type) {
+	case *m3u8.MediaPlaylist:
+		return u, pl, nil
+	case *m3u8.MasterPlaylist:
+		var variants []*m3u8.Variant
+		for _, v := range pl.Variants {
+			if !v.IFrame && !isHevc(v.Codecs) {
+				variants = append(variants, v)
+			}
+		}
+
+		v := c.cfg.SelectVariant(variants)
+		if v == nil {
+			return nil, nil, errors.New("no supported variant stream")
+		}
+
+		u, err = u.Parse(v.URI)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		media, err := c.fetchMedia(ctx, u)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return u, media, nil
+	}
+
+	return nil, nil, errors.New("unknown playlist type")
+}
+
+// CODECS 中是否包含H265
+func isHevc(codecs string) bool {
+	for _, codec := range strings.Split(codecs, ",") {
+		codec = strings.TrimSpace(codec)
+		if strings.HasPrefix(codec, "hvc1") || strings.HasPrefix(codec, "hev1") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *Client) fetchMedia(ctx context.Context, u *url.URL) (*m3u8.MediaPlaylist, error) {
+	b, err := c.get(ctx, u, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return m3u8.ParseMedia(b)
+}
+
+// 按顺序下载播放列表中的新切片, 返回是否有新切片
+func (c *Client) process(ctx context.Context, base *url.URL, media *m3u8.MediaPlaylist) (bool, error) {
+	// 只处理完整的切片
+	segments := media.Segments
+	if n := len(segments); n > 0 && segments[n-1].URI == "" {
+		segments = segments[:n-1]
+	}
+
+	if !c.started {
+		c.started = true
+		c.nextSeq = media.MediaSequence + uint64(c.startIndex(media, segments))
+	}
+
+	// 切片已移出播放列表, 从第一个切片开始并视为不连续
+	discontinuity := false
+	if c.nextSeq < media.MediaSequence {
+		c.nextSeq = media.MediaSequence
+		discontinuity = true
+	}
+
+	changed := false
+	for i, seg := range segments {
+		for _, key := range seg.Keys {
+			c.key = key.Method
+		}
+
+		seq := media.MediaSequence + uint64(i)
+		if seq < c.nextSeq {
+			continue
+		}
+
+		if seg.Discontinuity || discontinuity {
+			c.discontinuity()
+			discontinuity = false
+		}
+
+		if c.key != "" && c.key != m3u8.KeyMethodNone {
+			return changed, fmt.Errorf("unsupported segment encryption(%s)", c.key)
+		}
+
+		if !seg.Gap {
+			err := c.segment(ctx, base, seg)
+			if err != nil {
+				return changed, err
+			}
+		}
+
+		c.nextSeq = seq + 1
+		changed = true
+	}
+
+	return changed, nil
+}
+
+// 点播从第一个切片开始, 直播从距离末尾至少3个目标时长的切片开始
+func (c *Client) startIndex(media *m3u8.MediaPlaylist, segments []*m3u8.Segment) int {
+	if media.EndList || media.PlaylistType == m3u8.PlaylistTypeVOD {
+		return 0
+	}
+
+	var duration float64
+	for i := len(segments) - 1; i >= 0; i-- {
+		duration += segments[i].Duration
+		if duration >= float64(liveStartSegments*media.TargetDuration) {
+			return i
+		}
+	}
+
+	return 0
+}
+
+// 编码参数或时间戳不连续, 重新输出序列头, 从各基本流最后一帧结束的时间继续输出
+func (c *Client) discontinuity() {
+	c.avc = flv.NewAvcPacker()
+	c.aac = flv.NewAacPacker()
+	c.mp3 = flv.NewMp3Packer()
+
+	var end uint32
+	for _, clk := range c.clocks {
+		if e := clk.next(); e > end {
+			end = e
+		}
+	}
+	c.tl.reset(end)
+}
+
+// 下载并解复用一个切片
+func (c *Client) segment(ctx context.Context, base *url.URL, seg *m3u8.Segment) error {
+	u, err := base.Parse(seg.URI)
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	if br := seg.ByteRange; br != nil {
+		offset = br.Offset
+		if offset < 0 {
+			if c.rangeURI != u.String() {
+				return fmt.Errorf("byte range without offset(%s)", seg.URI)
+			}
+			offset = c.rangeEnd
+		}
+
+		c.rangeURI = u.String()
+		c.rangeEnd = offset + br.Length
+	}
+
+	b, err := c.get(ctx, u, seg.ByteRange, offset)
+	if err != nil {
+		return err
+	}
+
+	d := ts.NewDemuxer(bytes.NewReader(b))
+	for {
+		var p packet.Packet
+
+		err = d.Read(&p)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = c.write(&p)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// 将基本流打包为flv数据包并输出
+func (c *Client) write(p *packet.Packet) error {
+	h, ok := p.Header.(*ts.ESHeader)
+	if !ok {
+		return errors.New("invalid ts packet header")
+	}
+
+	clk, ok := c.clocks[h.PID]
+	if !ok {
+		clk = &esClock{}
+		c.clocks[h.PID] = clk
+	}
+
+	var dts, pts uint32
+	if h.HasTimestamp {
+		dts = c.tl.ms(h.DTS)
+		pts = dts
+
+		// PTS和DTS的差值按模2^33计算, PTS已回绕而DTS未回绕时仍然正确
+		if cts := (h.PTS - h.DTS) & (tsWrap - 1); cts < tsHalfWrap {
+			pts += uint32(cts / tsHZ)
+		}
+	} else {
+		dts = clk.next()
+		pts = dts
+	}
+	clk.update(dts)
+
+	var pkts []*packet.Packet
+	var err error
+
+	switch h.StreamType {
+	case table.StreamTypeAvc:
+		pkts, err = c.avc.Pack(p.Media, dts, pts)
+	case table.StreamTypeAac:
+		pkts, err = c.aac.Pack(p.Media, pts)
+	case table.StreamTypeMpeg1Audio, table.StreamTypeMpeg2Audio:
+		pkts, err = c.mp3.Pack(p.Media, pts)
+	case table.StreamTypeHevc:
+		return errors.New("hevc ingest is not supported")
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, pkt := range pkts {
+		err = c.w.Write(pkt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 下载资源, br 不为空时只下载 [offset, offset+br.Length) 的子范围
+func (c *Client) get(ctx context.Context, u *url.URL, br *m3u8.ByteRange, offset int64) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	if br != nil {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+br.Length-1))
+	}
+
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("get %s: %s", u, resp.Status)
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// 服务器不支持Range请求时, 自行截取子范围
+	if br != nil && resp.StatusCode == http.StatusOK {
+		if offset+br.Length > int64(len(b)) {
+			return nil, fmt.Errorf("byte range out of bounds(%s)", u)
+		}
+		b = b[offset : offset+br.Length]
+	}
+
+	return b, nil
+}
+
+// 基本流上一个PES的时间, 用于推算没有时间戳的PES
+type esClock struct {
+	started bool
+	last    uint32 // 上一个PES的dts(ms)
+	delta   uint32 // 相邻两个PES的间隔(ms)
+}
+
+// 没有时间戳的PES紧接上一个PES, 按相邻PES的间隔推算
+func (clk *esClock) next() uint32 {
+	return clk.last + clk.delta
+}
+
+func (clk *esClock) update(dts uint32) {
+	if clk.started && dts > clk.last {
+		clk.delta = dts - clk.last
+	}
+	clk.started = true
+	clk.last = dts
+}
+
+// 将TS的33位时间戳转换为连续的毫秒时间戳
+// 处理时间戳回绕, 不连续时从上一次输出的时间戳继续
+type timeline struct {
+	started bool
+	wrap    int64  // 回绕的累计偏移
+	last    int64  // 上一个时间戳(已展开)
+	origin  int64  // 起始时间戳(已展开)
+	base    int64  // 起始时间戳对应的输出时间(ms)
+	lastOut uint32 // 上一次输出的时间(ms)
+}
+
+// 不连续后从end(最后一帧结束的时间)继续, end不早于上一次输出的时间
+func (tl *timeline) reset(end uint32) {
+	tl.started = false
+	tl.base = int64(tl.lastOut)
+	if int64(end) > tl.base {
+		tl.base = int64(end)
+	}
+}
+
+func (tl *timeline) ms(ts int64) uint32 {
+	if !tl.started {
+		tl.started = true
+		tl.wrap = 0
+		tl.origin = ts
+		tl.last = ts
+	}
+
+	ts += tl.wrap
+	if ts < tl.last-tsHalfWrap {
+		tl.wrap += tsWrap
+		ts += tsWrap
+	} else if ts > tl.last+tsHalfWrap {
+		tl.wrap -= tsWrap
+		ts -= tsWrap
+	}
+	tl.last = ts
+
+	out := tl.base + (ts-tl.origin)/tsHZ
+	if out < 0 {
+		out = 0
+	}
+
+	if uint32(out) > tl.lastOut {
+		tl.lastOut = uint32(out)
+	}
+
+	return uint32(out)
+}
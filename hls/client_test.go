@@ -0,0 +1,279 @@
+package hls
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/moggle-mog/goav/container/ts"
+	"github.com/moggle-mog/goav/container/ts/table"
+	"github.com/moggle-mog/goav/internal/testutil"
+	"github.com/moggle-mog/goav/packet"
+	"github.com/stretchr/testify/assert"
+)
+
+// 收集客户端输出的数据包
+type testCollector struct {
+	pkts []*packet.Packet
+}
+
+func (c *testCollector) Write(p *packet.Packet) error {
+	c.pkts = append(c.pkts, p)
+	return nil
+}
+
+func (c *testCollector) count(mediaType int, seqHdr bool) int {
+	n := 0
+	for _, p := range c.pkts {
+		if p.Type != mediaType {
+			continue
+		}
+
+		var isSeqHdr bool
+		switch p.Type {
+		case packet.PktVideo:
+			isSeqHdr = p.Header.(packet.VideoPacketHeader).IsSeqHdr()
+		case packet.PktAudio:
+			isSeqHdr = p.Header.(packet.AudioPacketHeader).IsAACSeqHdr()
+		}
+
+		if isSeqHdr == seqHdr {
+			n++
+		}
+	}
+
+	return n
+}
+
+// 用打包器生成切片
+func testSegments(t *testing.T, cfg Config, runs ...uint32) *MemoryStorage {
+	s := NewMemoryStorage()
+	pk := NewPackager(s, cfg)
+
+	for _, duration := range runs {
+		for _, p := range testPackets(t, 0, duration, 1000, true) {
+			if err := pk.Write(p); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := pk.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func TestClient_Run(t *testing.T) {
+	at := assert.New(t)
+
+	// 两段时间戳都从0开始的流, 第二段之前有 EXT-X-DISCONTINUITY
+	s := testSegments(t, Config{TargetDuration: time.Second, WindowSize: 10}, 3000, 2000)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/master.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "#EXTM3U\n"+
+			"#EXT-X-STREAM-INF:BANDWIDTH=9000000,CODECS=\"hvc1.1.6.L93.B0\"\nhevc/index.m3u8\n"+
+			"#EXT-X-STREAM-INF:BANDWIDTH=1000000,CODECS=\"avc1.4d001e,mp4a.40.2\"\nlive/index.m3u8\n"+
+			"#EXT-X-STREAM-INF:BANDWIDTH=500000,CODECS=\"avc1.4d001e,mp4a.40.2\"\nlow/index.m3u8\n")
+	})
+	mux.Handle("/live/", http.StripPrefix("/live", NewHandler(NewPackager(s, Config{}), s)))
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// case1: 跳过H265码流, 选择带宽最高的码流, 拉取到播放列表结束
+	c := &testCollector{}
+	at.Nil(NewClient(srv.URL+"/master.m3u8", c, ClientConfig{}).Run(context.Background()))
+
+	// case2: 不连续时重新输出序列头
+	at.Equal(2, c.count(packet.PktVideo, true))
+	at.Equal(125, c.count(packet.PktVideo, false))
+	at.Equal(2, c.count(packet.PktAudio, true))
+	at.Equal(125, c.count(packet.PktAudio, false))
+
+	// case3: 时间戳连续递增, 不连续后从上一帧结束的时间继续(上一帧2960ms, 帧间隔40ms)
+	var last uint32
+	var lastVideo *packet.Packet
+	for _, p := range c.pkts {
+		if p.Type != packet.PktVideo {
+			continue
+		}
+		at.True(p.TimeStamp >= last, "%d < %d", p.TimeStamp, last)
+		last = p.TimeStamp
+		lastVideo = p
+	}
+	at.Equal(uint32(2960+40+1960), lastVideo.TimeStamp)
+
+	// case4: 第一个视频包是序列头, 第一个视频帧是关键帧
+	at.True(c.pkts[0].Header.(packet.VideoPacketHeader).IsSeqHdr())
+	for _, p := range c.pkts {
+		if p.Type == packet.PktVideo && !p.Header.(packet.VideoPacketHeader).IsSeqHdr() {
+			at.True(p.Header.(packet.VideoPacketHeader).IsKeyFrame())
+			break
+		}
+	}
+
+	// case5: 不支持加密的切片
+	mux.HandleFunc("/key.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "#EXTM3U\n#EXT-X-TARGETDURATION:1\n#EXT-X-KEY:METHOD=AES-128,URI=\"k\"\n#EXTINF:1,\nlive/segment0.ts\n#EXT-X-ENDLIST\n")
+	})
+	err := NewClient(srv.URL+"/key.m3u8", c, ClientConfig{}).Run(context.Background())
+	at.NotNil(err)
+
+	// case6: 播放列表不存在
+	err = NewClient(srv.URL+"/none.m3u8", c, ClientConfig{}).Run(context.Background())
+	at.NotNil(err)
+}
+
+func TestClient_RunLive(t *testing.T) {
+	at := assert.New(t)
+
+	s := testSegments(t, Config{TargetDuration: time.Second, WindowSize: 10}, 6000)
+
+	var mu sync.Mutex
+	var reloads int
+	var fetched []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/index.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		// 第一次返回切片0-3, 之后返回切片2-5并结束
+		first, last, end := 0, 3, ""
+		if reloads > 0 {
+			first, last, end = 2, 5, "#EXT-X-ENDLIST\n"
+		}
+		reloads++
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "#EXTM3U\n#EXT-X-TARGETDURATION:1\n#EXT-X-MEDIA-SEQUENCE:%d\n", first)
+		for i := first; i <= last; i++ {
+			fmt.Fprintf(&b, "#EXTINF:1.000,\nsegment%d.ts\n", i)
+		}
+		b.WriteString(end)
+		fmt.Fprint(w, b.String())
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/")
+
+		mu.Lock()
+		fetched = append(fetched, name)
+		mu.Unlock()
+
+		b, ok := s.Get(name)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(b)
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// case1: 直播流从距离末尾3个目标时长的切片开始, 重新加载后按顺序下载新切片
+	c := &testCollector{}
+	at.Nil(NewClient(srv.URL+"/index.m3u8", c, ClientConfig{}).Run(context.Background()))
+	at.Equal([]string{"segment1.ts", "segment2.ts", "segment3.ts", "segment4.ts", "segment5.ts"}, fetched)
+	at.Equal(2, reloads)
+
+	// case2: 没有不连续, 只输出一次序列头
+	at.Equal(1, c.count(packet.PktVideo, true))
+	at.Equal(125, c.count(packet.PktVideo, false))
+
+	// case3: 取消
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	reloads = 0
+	at.Equal(context.Canceled, NewClient(srv.URL+"/index.m3u8", c, ClientConfig{}).Run(ctx))
+}
+
+func TestTimeline(t *testing.T) {
+	at := assert.New(t)
+
+	var tl timeline
+
+	// case1: 以第一个时间戳为起点
+	at.Equal(uint32(0), tl.ms(90000))
+	at.Equal(uint32(1000), tl.ms(180000))
+
+	// case2: 33位时间戳回绕
+	tl = timeline{}
+	at.Equal(uint32(0), tl.ms(tsWrap-90000))
+	at.Equal(uint32(2000), tl.ms(90000))
+
+	// case3: 不连续时从最后一帧结束的时间继续
+	tl.reset(2040)
+	at.Equal(uint32(2040), tl.ms(500))
+	at.Equal(uint32(2080), tl.ms(500+40*90))
+
+	// case4: 结束时间早于上一次输出的时间
+	tl.reset(1000)
+	at.Equal(uint32(2080), tl.ms(500))
+}
+
+func TestClient_Untimed(t *testing.T) {
+	at := assert.New(t)
+
+	w := &testCollector{}
+	c := NewClient("", w, ClientConfig{})
+
+	write := func(pts int64, hasTimestamp bool) {
+		h := &ts.ESHeader{PID: 0x101, StreamType: table.StreamTypeAac, PTS: pts, DTS: pts, HasTimestamp: hasTimestamp}
+		at.Nil(c.write(&packet.Packet{Type: packet.PktAudio, Header: h, Media: testAdts}))
+	}
+
+	// 没有时间戳的PES按相邻PES的间隔推算, 不重复上一个时间戳
+	write(90000, true)
+	write(90000+23*tsHZ, true)
+	write(0, false)
+	write(0, false)
+
+	var stamps []uint32
+	for _, p := range w.pkts {
+		if !p.Header.(packet.AudioPacketHeader).IsAACSeqHdr() {
+			stamps = append(stamps, p.TimeStamp)
+		}
+	}
+	at.Equal([]uint32{0, 23, 46, 69}, stamps)
+}
+
+func TestClient_Timestamp(t *testing.T) {
+	at := assert.New(t)
+
+	w := &testCollector{}
+	c := NewClient("", w, ClientConfig{})
+
+	idr := testutil.JoinAnnexb(testSps, testPps, []byte{0x65, 0x88, 0x84})
+	write := func(dts, pts int64) {
+		h := &ts.ESHeader{PID: 0x100, StreamType: table.StreamTypeAvc, PTS: pts, DTS: dts, HasTimestamp: true, KeyFrame: true}
+		at.Nil(c.write(&packet.Packet{Type: packet.PktVideo, Header: h, Media: idr}))
+	}
+
+	// case1: PTS已回绕而DTS未回绕
+	write(tsWrap-40*tsHZ, tsWrap-40*tsHZ)
+	write(tsWrap-20*tsHZ, 60*tsHZ)
+
+	// case2: 不连续后从最后一帧结束的时间继续
+	c.discontinuity()
+	write(90000, 90000)
+
+	var dts, cts []uint32
+	for _, p := range w.pkts {
+		vh := p.Header.(packet.VideoPacketHeader)
+		if !vh.IsSeqHdr() {
+			dts = append(dts, p.TimeStamp)
+			cts = append(cts, uint32(vh.CompositionTime()))
+		}
+	}
+	at.Equal([]uint32{0, 20, 40}, dts)
+	at.Equal([]uint32{0, 80, 0}, cts)
+}
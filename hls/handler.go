@@ -0,0 +1,153 @@
+// Package hls 提供播放列表和切片的HTTP服务, 支持LL-HLS的阻塞式播放列表请求
+package hls
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 阻塞式请求的参数(LL-HLS)
+const (
+	queryMsn  = "_HLS_msn"
+	queryPart = "_HLS_part"
+)
+
+// Handler 提供播放列表和切片的HTTP服务
+// 播放列表请求携带 _HLS_msn(和 _HLS_part)时, 阻塞到播放列表包含对应的切片(部分切片)后返回;
+// 请求 EXT-X-PRELOAD-HINT 指向的部分切片时, 阻塞到部分切片生成后返回
+type Handler struct {
+	pk *Packager
+	r  Reader
+}
+
+// NewHandler HLS的HTTP服务, r 用于读取 pk 写入存储的文件
+func NewHandler(pk *Packager, r Reader) *Handler {
+	return &Handler{
+		pk: pk,
+		r:  r,
+	}
+}
+
+// ServeHTTP 实现 http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := path.Base(req.URL.Path)
+	if name == h.pk.cfg.PlaylistName {
+		h.servePlaylist(w, req)
+		return
+	}
+
+	// 等待预加载的部分切片生成
+	for {
+		pending, updated := h.pk.pending(name)
+		if !pending {
+			break
+		}
+
+		if !h.wait(req, updated) {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	h.serveFile(w, req, name, "video/mp2t", "max-age=60")
+}
+
+func (h *Handler) servePlaylist(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+
+	msnValue := query.Get(queryMsn)
+	partValue := query.Get(queryPart)
+	if msnValue == "" {
+		if partValue != "" {
+			http.Error(w, "_HLS_part without _HLS_msn", http.StatusBadRequest)
+			return
+		}
+
+		h.serveFile(w, req, h.pk.cfg.PlaylistName, "application/vnd.apple.mpegurl", "no-cache")
+		return
+	}
+
+	msn, err := strconv.ParseUint(msnValue, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid _HLS_msn", http.StatusBadRequest)
+		return
+	}
+
+	partIdx := -1
+	if partValue != "" {
+		partIdx, err = strconv.Atoi(partValue)
+		if err != nil || partIdx < 0 {
+			http.Error(w, "invalid _HLS_part", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// 请求的切片超过最新切片2个以上时, 立即返回错误
+	last, ok := h.pk.lastSeq()
+	if ok && msn > last+2 {
+		http.Error(w, "_HLS_msn is too far in the future", http.StatusBadRequest)
+		return
+	}
+
+	for {
+		ready, updated := h.pk.ready(msn, partIdx)
+		if ready {
+			break
+		}
+
+		if !h.wait(req, updated) {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	h.serveFile(w, req, h.pk.cfg.PlaylistName, "application/vnd.apple.mpegurl", "max-age=60")
+}
+
+// 等待播放列表更新, 超过3倍目标时长或请求取消时返回false
+func (h *Handler) wait(req *http.Request, updated <-chan struct{}) bool {
+	timer := time.NewTimer(3 * h.pk.cfg.TargetDuration)
+	defer timer.Stop()
+
+	select {
+	case <-updated:
+		return true
+	case <-timer.C:
+		return false
+	case <-req.Context().Done():
+		return false
+	}
+}
+
+func (h *Handler) serveFile(w http.ResponseWriter, req *http.Request, name, contentType, cacheControl string) {
+	if strings.HasPrefix(name, ".") {
+		http.NotFound(w, req)
+		return
+	}
+
+	b, ok := h.r.Get(name)
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.WriteHeader(http.StatusOK)
+
+	if req.Method == http.MethodHead {
+		return
+	}
+
+	_, _ = w.Write(b)
+}
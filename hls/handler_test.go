@@ -0,0 +1,121 @@
+package hls
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testGet(t *testing.T, url string) (int, string) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp.StatusCode, string(b)
+}
+
+func TestHandler_ServeHTTP(t *testing.T) {
+	at := assert.New(t)
+
+	s := NewMemoryStorage()
+	pk := NewPackager(s, Config{
+		TargetDuration: time.Second,
+		PartTarget:     200 * time.Millisecond,
+	})
+
+	srv := httptest.NewServer(NewHandler(pk, s))
+	defer srv.Close()
+
+	pkts := testPackets(t, 0, 3000, 1000, false)
+
+	// 写入第一个切片的前半部分
+	for _, p := range pkts[:15] {
+		at.Nil(pk.Write(p))
+	}
+
+	// case1: 普通请求立即返回
+	code, body := testGet(t, srv.URL+"/index.m3u8")
+	at.Equal(http.StatusOK, code)
+	at.True(strings.Contains(body, "#EXT-X-PRELOAD-HINT:TYPE=PART,URI=\"segment0.2.ts\""), body)
+
+	// case2: 参数错误
+	code, _ = testGet(t, srv.URL+"/index.m3u8?_HLS_part=1")
+	at.Equal(http.StatusBadRequest, code)
+	code, _ = testGet(t, srv.URL+"/index.m3u8?_HLS_msn=a")
+	at.Equal(http.StatusBadRequest, code)
+	code, _ = testGet(t, srv.URL+"/index.m3u8?_HLS_msn=3")
+	at.Equal(http.StatusBadRequest, code)
+
+	// case3: 已有的部分切片立即返回
+	code, body = testGet(t, srv.URL+"/index.m3u8?_HLS_msn=0&_HLS_part=1")
+	at.Equal(http.StatusOK, code)
+	at.True(strings.Contains(body, "segment0.1.ts"), body)
+
+	// case4: 阻塞到部分切片和切片生成
+	type result struct {
+		code int
+		body string
+	}
+	partDone := make(chan result, 1)
+	segDone := make(chan result, 1)
+	hintDone := make(chan result, 1)
+	go func() {
+		code, body := testGet(t, srv.URL+"/index.m3u8?_HLS_msn=0&_HLS_part=3")
+		partDone <- result{code, body}
+	}()
+	go func() {
+		code, body := testGet(t, srv.URL+"/index.m3u8?_HLS_msn=1")
+		segDone <- result{code, body}
+	}()
+	go func() {
+		code, body := testGet(t, srv.URL+"/segment0.2.ts")
+		hintDone <- result{code, body}
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-partDone:
+		t.Fatal("blocking request returned early")
+	case <-segDone:
+		t.Fatal("blocking request returned early")
+	case <-hintDone:
+		t.Fatal("preload hint returned early")
+	default:
+	}
+
+	for _, p := range pkts[15:] {
+		at.Nil(pk.Write(p))
+	}
+
+	res := <-partDone
+	at.Equal(http.StatusOK, res.code)
+	at.True(strings.Contains(res.body, "segment0.3.ts"), res.body)
+
+	res = <-hintDone
+	at.Equal(http.StatusOK, res.code)
+	b, _ := s.Get("segment0.2.ts")
+	at.Equal(string(b), res.body)
+
+	res = <-segDone
+	at.Equal(http.StatusOK, res.code)
+	at.True(strings.Contains(res.body, "#EXTINF:1.000,\nsegment1.ts\n"), res.body)
+
+	// case5: 结束后立即返回, 不存在的文件返回404
+	at.Nil(pk.Close())
+	code, _ = testGet(t, srv.URL+"/index.m3u8?_HLS_msn=4")
+	at.Equal(http.StatusOK, code)
+	code, _ = testGet(t, srv.URL+"/segment9.ts")
+	at.Equal(http.StatusNotFound, code)
+}
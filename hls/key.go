@@ -0,0 +1,73 @@
+// Package hls 切片加密(AES-128 整段加密和 SAMPLE-AES)
+package hls
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+)
+
+// Key 切片加密密钥
+type Key struct {
+	Key []byte // 16字节的AES-128密钥
+	IV  []byte // 16字节的初始向量, 为空时使用切片的媒体序号, 不写入播放列表
+	URI string // 客户端获取密钥的地址, 写入 EXT-X-KEY
+}
+
+// KeyProvider 提供切片加密密钥
+type KeyProvider interface {
+	// Key 返回从序号为seq的切片开始使用的密钥
+	Key(seq uint64) (*Key, error)
+}
+
+// KeyProviderFunc 函数形式的 KeyProvider
+type KeyProviderFunc func(seq uint64) (*Key, error)
+
+// Key 调用f(seq)
+func (f KeyProviderFunc) Key(seq uint64) (*Key, error) {
+	return f(seq)
+}
+
+func (k *Key) validate() error {
+	if len(k.Key) != aes.BlockSize {
+		return fmt.Errorf("invalid key length(%d)", len(k.Key))
+	}
+	if len(k.IV) != 0 && len(k.IV) != aes.BlockSize {
+		return fmt.Errorf("invalid iv length(%d)", len(k.IV))
+	}
+	if k.URI == "" {
+		return fmt.Errorf("missing key uri")
+	}
+
+	return nil
+}
+
+// 切片的初始向量, 未指定时为128位大端的媒体序号
+func (k *Key) iv(seq uint64) []byte {
+	if len(k.IV) > 0 {
+		return k.IV
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint64(iv[8:], seq)
+	return iv
+}
+
+// AES-128-CBC 加密, PKCS7 填充
+func encryptAES128(key, iv, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	padding := aes.BlockSize - len(data)%aes.BlockSize
+
+	dst := make([]byte, len(data)+padding)
+	copy(dst, data)
+	copy(dst[len(data):], bytes.Repeat([]byte{byte(padding)}, padding))
+
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(dst, dst)
+	return dst, nil
+}
@@ -0,0 +1,141 @@
+package hls
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moggle-mog/goav/hls/m3u8"
+	"github.com/stretchr/testify/assert"
+)
+
+// 每次返回不同的密钥
+func keyProvider(calls *[]uint64) KeyProvider {
+	return KeyProviderFunc(func(seq uint64) (*Key, error) {
+		*calls = append(*calls, seq)
+		return &Key{
+			Key: bytes.Repeat([]byte{byte(seq)}, 16),
+			URI: fmt.Sprintf("key%d", seq),
+		}, nil
+	})
+}
+
+func TestPackager_AES128(t *testing.T) {
+	at := assert.New(t)
+
+	var calls []uint64
+
+	s := NewMemoryStorage()
+	pk := NewPackager(s, Config{
+		TargetDuration: 2 * time.Second,
+		WindowSize:     3,
+		Encryption:     m3u8.KeyMethodAES128,
+		KeyProvider:    keyProvider(&calls),
+		KeyRotation:    2,
+	})
+
+	for _, p := range testPackets(t, 0, 8000, 2000, true) {
+		at.Nil(pk.Write(p))
+	}
+	at.Nil(pk.Close())
+
+	// case1: 每2个切片更换一次密钥
+	at.Equal([]uint64{0, 2}, calls)
+
+	// case2: 密钥变化时写入 EXT-X-KEY, 窗口中的第一个切片总是带有 EXT-X-KEY
+	at.Equal("#EXTM3U\n"+
+		"#EXT-X-VERSION:3\n"+
+		"#EXT-X-TARGETDURATION:2\n"+
+		"#EXT-X-MEDIA-SEQUENCE:1\n"+
+		"#EXT-X-KEY:METHOD=AES-128,URI=\"key0\"\n"+
+		"#EXTINF:2.000,\nsegment1.ts\n"+
+		"#EXT-X-KEY:METHOD=AES-128,URI=\"key2\"\n"+
+		"#EXTINF:2.000,\nsegment2.ts\n"+
+		"#EXTINF:2.000,\nsegment3.ts\n"+
+		"#EXT-X-ENDLIST\n", testPlaylist(t, s))
+
+	// case3: 以媒体序号作为初始向量解密, 得到TS数据
+	seg, ok := s.Get("segment3.ts")
+	at.True(ok)
+	at.Equal(0, len(seg)%aes.BlockSize)
+
+	block, err := aes.NewCipher(bytes.Repeat([]byte{2}, 16))
+	at.Nil(err)
+
+	iv := make([]byte, 16)
+	iv[15] = 3
+	plain := make([]byte, len(seg))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, seg)
+
+	padding := int(plain[len(plain)-1])
+	at.Equal(bytes.Repeat([]byte{byte(padding)}, padding), plain[len(plain)-padding:])
+	plain = plain[:len(plain)-padding]
+	at.Equal(0, len(plain)%188)
+	at.Equal(byte(0x47), plain[0])
+}
+
+func TestPackager_SampleAES(t *testing.T) {
+	at := assert.New(t)
+
+	var calls []uint64
+
+	s := NewMemoryStorage()
+	pk := NewPackager(s, Config{
+		TargetDuration: 2 * time.Second,
+		Encryption:     m3u8.KeyMethodSampleAES,
+		KeyProvider:    keyProvider(&calls),
+	})
+
+	for _, p := range testPackets(t, 0, 4000, 2000, true) {
+		at.Nil(pk.Write(p))
+	}
+	at.Nil(pk.Close())
+
+	// case1: 不更换密钥
+	at.Equal([]uint64{0}, calls)
+	at.Equal("#EXTM3U\n"+
+		"#EXT-X-VERSION:5\n"+
+		"#EXT-X-TARGETDURATION:2\n"+
+		"#EXT-X-MEDIA-SEQUENCE:0\n"+
+		"#EXT-X-KEY:METHOD=SAMPLE-AES,URI=\"key0\"\n"+
+		"#EXTINF:2.000,\nsegment0.ts\n"+
+		"#EXTINF:2.000,\nsegment1.ts\n"+
+		"#EXT-X-ENDLIST\n", testPlaylist(t, s))
+
+	// case2: 切片本身不加密, PMT中使用加密的流类型
+	seg, ok := s.Get("segment1.ts")
+	at.True(ok)
+	at.Equal(byte(0x47), seg[0])
+	at.True(strings.Contains(string(seg), "zavc"))
+	at.True(strings.Contains(string(seg), "apad"))
+}
+
+func TestPackager_KeyError(t *testing.T) {
+	at := assert.New(t)
+
+	pkts := testPackets(t, 0, 40, 2000, false)
+
+	// case1: 缺少 KeyProvider
+	pk := NewPackager(NewMemoryStorage(), Config{Encryption: m3u8.KeyMethodAES128})
+	at.Nil(pk.Write(pkts[0]))
+	at.NotNil(pk.Write(pkts[1]))
+
+	// case2: 密钥长度错误
+	pk = NewPackager(NewMemoryStorage(), Config{
+		Encryption: m3u8.KeyMethodAES128,
+		KeyProvider: KeyProviderFunc(func(seq uint64) (*Key, error) {
+			return &Key{Key: []byte{0x01}, URI: "key"}, nil
+		}),
+	})
+	at.Nil(pk.Write(pkts[0]))
+	at.NotNil(pk.Write(pkts[1]))
+
+	// case3: 不支持的加密方式
+	pk = NewPackager(NewMemoryStorage(), Config{Encryption: "SAMPLE-AES-CTR"})
+	at.Nil(pk.Write(pkts[0]))
+	at.NotNil(pk.Write(pkts[1]))
+}
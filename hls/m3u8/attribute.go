@@ -0,0 +1,175 @@
+// Package m3u8 属性列表(attribute-list)的解析和生成
+package m3u8
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Attribute 属性, Value 为播放列表中的原始值(带引号的字符串保留引号)
+type Attribute struct {
+	Key   string
+	Value string
+}
+
+type attributes []Attribute
+
+// 解析属性列表: KEY=VALUE,KEY="VALUE",...
+func parseAttributes(s string) (attributes, error) {
+	var attrs attributes
+
+	for i := 0; i < len(s); {
+		eq := strings.IndexByte(s[i:], '=')
+		if eq <= 0 {
+			return nil, fmt.Errorf("invalid attribute list(%s)", s)
+		}
+
+		key := s[i : i+eq]
+		i += eq + 1
+
+		end := i
+		if end < len(s) && s[end] == '"' {
+			quote := strings.IndexByte(s[end+1:], '"')
+			if quote < 0 {
+				return nil, fmt.Errorf("unterminated quoted string in attribute(%s)", key)
+			}
+			end += quote + 2
+		} else {
+			comma := strings.IndexByte(s[end:], ',')
+			if comma < 0 {
+				end = len(s)
+			} else {
+				end += comma
+			}
+		}
+
+		attrs = append(attrs, Attribute{Key: strings.TrimSpace(key), Value: s[i:end]})
+
+		if end < len(s) {
+			if s[end] != ',' {
+				return nil, fmt.Errorf("invalid attribute separator after %s", key)
+			}
+			end++
+		}
+		i = end
+	}
+
+	return attrs, nil
+}
+
+// 属性的值, 去除引号
+func (attrs attributes) get(key string) (string, bool) {
+	for _, attr := range attrs {
+		if attr.Key == key {
+			return strings.Trim(attr.Value, "\""), true
+		}
+	}
+
+	return "", false
+}
+
+func (attrs attributes) str(key string) string {
+	v, _ := attrs.get(key)
+	return v
+}
+
+func (attrs attributes) yes(key string) bool {
+	return attrs.str(key) == "YES"
+}
+
+func (attrs attributes) integer(key string) (int64, error) {
+	v, ok := attrs.get(key)
+	if !ok {
+		return 0, nil
+	}
+
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid integer %s=%s", key, v)
+	}
+
+	return n, nil
+}
+
+func (attrs attributes) decimal(key string) (float64, error) {
+	v, ok := attrs.get(key)
+	if !ok {
+		return 0, nil
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid decimal %s=%s", key, v)
+	}
+
+	return f, nil
+}
+
+// 生成属性列表
+type attrWriter struct {
+	b strings.Builder
+}
+
+func (w *attrWriter) raw(key, value string) {
+	if w.b.Len() > 0 {
+		w.b.WriteByte(',')
+	}
+	w.b.WriteString(key)
+	w.b.WriteByte('=')
+	w.b.WriteString(value)
+}
+
+// 带引号的字符串, 为空时不输出
+func (w *attrWriter) quoted(key, value string) {
+	if value != "" {
+		w.raw(key, "\""+value+"\"")
+	}
+}
+
+// 枚举值, 为空时不输出
+func (w *attrWriter) enum(key, value string) {
+	if value != "" {
+		w.raw(key, value)
+	}
+}
+
+// 为真时输出 YES
+func (w *attrWriter) yes(key string, value bool) {
+	if value {
+		w.raw(key, "YES")
+	}
+}
+
+// 整数, 为0时不输出
+func (w *attrWriter) integer(key string, value int64) {
+	if value != 0 {
+		w.raw(key, strconv.FormatInt(value, 10))
+	}
+}
+
+// 小数, 为0时不输出
+func (w *attrWriter) decimal(key string, value float64) {
+	if value != 0 {
+		w.raw(key, formatDecimal(value))
+	}
+}
+
+func (w *attrWriter) String() string {
+	return w.b.String()
+}
+
+// 小数优先保留3位小数, 3位小数无法准确表示时使用最短的精确表示
+func formatDecimal(f float64) string {
+	s := strconv.FormatFloat(f, 'f', 3, 64)
+	if v, err := strconv.ParseFloat(s, 64); err == nil && v == f {
+		return s
+	}
+
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return "0"
+	}
+
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
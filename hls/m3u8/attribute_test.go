@@ -0,0 +1,52 @@
+package m3u8
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAttributes(t *testing.T) {
+	at := assert.New(t)
+
+	// case1: 带引号的字符串可以包含逗号和等号
+	attrs, err := parseAttributes(`BANDWIDTH=1280000,CODECS="avc1.4d401f,mp4a.40.2",URI="a.m3u8?x=1",FRAME-RATE=29.970`)
+	at.Nil(err)
+	at.Equal(attributes{
+		{Key: "BANDWIDTH", Value: "1280000"},
+		{Key: "CODECS", Value: `"avc1.4d401f,mp4a.40.2"`},
+		{Key: "URI", Value: `"a.m3u8?x=1"`},
+		{Key: "FRAME-RATE", Value: "29.970"},
+	}, attrs)
+	at.Equal("avc1.4d401f,mp4a.40.2", attrs.str("CODECS"))
+
+	n, err := attrs.integer("BANDWIDTH")
+	at.Nil(err)
+	at.Equal(int64(1280000), n)
+
+	f, err := attrs.decimal("FRAME-RATE")
+	at.Nil(err)
+	at.Equal(29.97, f)
+
+	// case2: 格式错误
+	_, err = parseAttributes(`URI="a.m3u8`)
+	at.NotNil(err)
+	_, err = parseAttributes(`URI="a"X,`)
+	at.NotNil(err)
+	_, err = parseAttributes(`BANDWIDTH`)
+	at.NotNil(err)
+
+	_, err = attributes{{Key: "BANDWIDTH", Value: "x"}}.integer("BANDWIDTH")
+	at.NotNil(err)
+}
+
+func TestFormatDecimal(t *testing.T) {
+	at := assert.New(t)
+
+	// case1: 3位小数可以准确表示
+	at.Equal("4.000", formatDecimal(4))
+	at.Equal("1.960", formatDecimal(1.96))
+
+	// case2: 保留原始精度
+	at.Equal("9.97663", formatDecimal(9.97663))
+}
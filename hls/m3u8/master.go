@@ -0,0 +1,373 @@
+// Package m3u8 主播放列表
+package m3u8
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	tagStreamInf       = "#EXT-X-STREAM-INF:"
+	tagIFrameStreamInf = "#EXT-X-I-FRAME-STREAM-INF:"
+	tagMedia           = "#EXT-X-MEDIA:"
+	tagSessionData     = "#EXT-X-SESSION-DATA:"
+	tagSessionKey      = "#EXT-X-SESSION-KEY:"
+)
+
+// 备选流的类型(EXT-X-MEDIA TYPE)
+const (
+	MediaTypeAudio          = "AUDIO"
+	MediaTypeVideo          = "VIDEO"
+	MediaTypeSubtitles      = "SUBTITLES"
+	MediaTypeClosedCaptions = "CLOSED-CAPTIONS"
+)
+
+// Variant 码流, EXT-X-STREAM-INF 或 EXT-X-I-FRAME-STREAM-INF
+type Variant struct {
+	URI              string
+	Bandwidth        int64
+	AverageBandwidth int64
+	Codecs           string
+	Width, Height    int64 // RESOLUTION
+	FrameRate        float64
+	HDCPLevel        string
+	VideoRange       string
+	Audio            string // 音频备选流的 GROUP-ID
+	Video            string // 视频备选流的 GROUP-ID
+	Subtitles        string // 字幕备选流的 GROUP-ID
+	ClosedCaptions   string // 隐藏字幕的 GROUP-ID 或 NONE
+	IFrame           bool   // 是否是 I帧码流(EXT-X-I-FRAME-STREAM-INF)
+}
+
+// Rendition 备选流, EXT-X-MEDIA
+type Rendition struct {
+	Type            string
+	GroupID         string
+	Name            string
+	Language        string
+	AssocLanguage   string
+	Default         bool
+	AutoSelect      bool
+	Forced          bool
+	InstreamID      string
+	Characteristics string
+	Channels        string
+	URI             string
+}
+
+// SessionData EXT-X-SESSION-DATA
+type SessionData struct {
+	DataID   string
+	Value    string
+	URI      string
+	Language string
+}
+
+// MasterPlaylist 主播放列表
+type MasterPlaylist struct {
+	Version             int
+	IndependentSegments bool
+	Start               *Start
+	SessionData         []*SessionData
+	SessionKeys         []*Key
+	Renditions          []*Rendition
+	Variants            []*Variant // 包含 I帧码流
+	Custom              []string   // 未识别的标签和注释, 原样输出
+}
+
+// ParseMaster 解析主播放列表
+func ParseMaster(b []byte) (*MasterPlaylist, error) {
+	lines, err := splitLines(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseMaster(lines)
+}
+
+func parseMaster(lines []string) (*MasterPlaylist, error) {
+	p := &MasterPlaylist{}
+
+	var pending *Variant
+	for _, line := range lines {
+		var err error
+
+		switch {
+		case !strings.HasPrefix(line, "#"):
+			if pending == nil {
+				return nil, fmt.Errorf("unexpected uri(%s)", line)
+			}
+			pending.URI = line
+			p.Variants = append(p.Variants, pending)
+			pending = nil
+		case strings.HasPrefix(line, tagStreamInf):
+			pending, err = parseVariant(line, tagStreamInf)
+		case strings.HasPrefix(line, tagIFrameStreamInf):
+			var v *Variant
+			v, err = parseVariant(line, tagIFrameStreamInf)
+			if err == nil {
+				p.Variants = append(p.Variants, v)
+			}
+		case strings.HasPrefix(line, tagMedia):
+			var r *Rendition
+			r, err = parseRendition(line)
+			if err == nil {
+				p.Renditions = append(p.Renditions, r)
+			}
+		case strings.HasPrefix(line, tagSessionData):
+			var attrs attributes
+			attrs, err = tagAttributes(line, tagSessionData)
+			if err == nil {
+				p.SessionData = append(p.SessionData, &SessionData{
+					DataID:   attrs.str("DATA-ID"),
+					Value:    attrs.str("VALUE"),
+					URI:      attrs.str("URI"),
+					Language: attrs.str("LANGUAGE"),
+				})
+			}
+		case strings.HasPrefix(line, tagSessionKey):
+			var key *Key
+			key, err = parseKey(line, tagSessionKey)
+			if err == nil {
+				p.SessionKeys = append(p.SessionKeys, key)
+			}
+		case strings.HasPrefix(line, tagVersion):
+			p.Version, err = parseVersion(line)
+		case line == tagIndependentSegments:
+			p.IndependentSegments = true
+		case strings.HasPrefix(line, tagStart):
+			p.Start, err = parseStart(line)
+		default:
+			p.Custom = append(p.Custom, line)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if pending != nil {
+		return nil, errors.New("missing uri after #EXT-X-STREAM-INF")
+	}
+
+	return p, nil
+}
+
+func parseVariant(line, tag string) (*Variant, error) {
+	attrs, err := tagAttributes(line, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Variant{
+		Codecs:         attrs.str("CODECS"),
+		HDCPLevel:      attrs.str("HDCP-LEVEL"),
+		VideoRange:     attrs.str("VIDEO-RANGE"),
+		Audio:          attrs.str("AUDIO"),
+		Video:          attrs.str("VIDEO"),
+		Subtitles:      attrs.str("SUBTITLES"),
+		ClosedCaptions: attrs.str("CLOSED-CAPTIONS"),
+		IFrame:         tag == tagIFrameStreamInf,
+	}
+
+	v.Bandwidth, err = attrs.integer("BANDWIDTH")
+	if err != nil {
+		return nil, err
+	}
+
+	v.AverageBandwidth, err = attrs.integer("AVERAGE-BANDWIDTH")
+	if err != nil {
+		return nil, err
+	}
+
+	v.FrameRate, err = attrs.decimal("FRAME-RATE")
+	if err != nil {
+		return nil, err
+	}
+
+	if res, ok := attrs.get("RESOLUTION"); ok {
+		_, err = fmt.Sscanf(res, "%dx%d", &v.Width, &v.Height)
+		if err != nil {
+			return nil, fmt.Errorf("invalid resolution(%s)", res)
+		}
+	}
+
+	if v.IFrame {
+		v.URI = attrs.str("URI")
+	}
+
+	return v, nil
+}
+
+func parseRendition(line string) (*Rendition, error) {
+	attrs, err := tagAttributes(line, tagMedia)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Rendition{
+		Type:            attrs.str("TYPE"),
+		GroupID:         attrs.str("GROUP-ID"),
+		Name:            attrs.str("NAME"),
+		Language:        attrs.str("LANGUAGE"),
+		AssocLanguage:   attrs.str("ASSOC-LANGUAGE"),
+		Default:         attrs.yes("DEFAULT"),
+		AutoSelect:      attrs.yes("AUTOSELECT"),
+		Forced:          attrs.yes("FORCED"),
+		InstreamID:      attrs.str("INSTREAM-ID"),
+		Characteristics: attrs.str("CHARACTERISTICS"),
+		Channels:        attrs.str("CHANNELS"),
+		URI:             attrs.str("URI"),
+	}
+	if r.Type == "" || r.GroupID == "" || r.Name == "" {
+		return nil, errors.New("#EXT-X-MEDIA missing TYPE, GROUP-ID or NAME")
+	}
+
+	return r, nil
+}
+
+func (v *Variant) attributes() string {
+	var w attrWriter
+	w.raw("BANDWIDTH", fmt.Sprint(v.Bandwidth))
+	w.integer("AVERAGE-BANDWIDTH", v.AverageBandwidth)
+	w.quoted("CODECS", v.Codecs)
+	if v.Width > 0 && v.Height > 0 {
+		w.raw("RESOLUTION", fmt.Sprintf("%dx%d", v.Width, v.Height))
+	}
+	if !v.IFrame {
+		w.decimal("FRAME-RATE", v.FrameRate)
+	}
+	w.enum("HDCP-LEVEL", v.HDCPLevel)
+	w.enum("VIDEO-RANGE", v.VideoRange)
+	if !v.IFrame {
+		w.quoted("AUDIO", v.Audio)
+	}
+	w.quoted("VIDEO", v.Video)
+	if !v.IFrame {
+		w.quoted("SUBTITLES", v.Subtitles)
+		if v.ClosedCaptions == "NONE" {
+			w.enum("CLOSED-CAPTIONS", v.ClosedCaptions)
+		} else {
+			w.quoted("CLOSED-CAPTIONS", v.ClosedCaptions)
+		}
+	} else {
+		w.quoted("URI", v.URI)
+	}
+
+	return w.String()
+}
+
+func (r *Rendition) attributes() string {
+	var w attrWriter
+	w.enum("TYPE", r.Type)
+	w.quoted("GROUP-ID", r.GroupID)
+	w.quoted("NAME", r.Name)
+	w.quoted("LANGUAGE", r.Language)
+	w.quoted("ASSOC-LANGUAGE", r.AssocLanguage)
+	w.yes("DEFAULT", r.Default)
+	w.yes("AUTOSELECT", r.AutoSelect)
+	w.yes("FORCED", r.Forced)
+	w.quoted("INSTREAM-ID", r.InstreamID)
+	w.quoted("CHARACTERISTICS", r.Characteristics)
+	w.quoted("CHANNELS", r.Channels)
+	w.quoted("URI", r.URI)
+
+	return w.String()
+}
+
+// String 生成主播放列表
+func (p *MasterPlaylist) String() string {
+	var b strings.Builder
+
+	b.WriteString(tagHeader + "\n")
+	if p.Version > 0 {
+		fmt.Fprintf(&b, "%s%d\n", tagVersion, p.Version)
+	}
+	if p.IndependentSegments {
+		b.WriteString(tagIndependentSegments + "\n")
+	}
+	if p.Start != nil {
+		b.WriteString(p.Start.String() + "\n")
+	}
+	for _, line := range p.Custom {
+		b.WriteString(line + "\n")
+	}
+
+	for _, sd := range p.SessionData {
+		var w attrWriter
+		w.quoted("DATA-ID", sd.DataID)
+		w.quoted("VALUE", sd.Value)
+		w.quoted("URI", sd.URI)
+		w.quoted("LANGUAGE", sd.Language)
+		b.WriteString(tagSessionData + w.String() + "\n")
+	}
+	for _, key := range p.SessionKeys {
+		b.WriteString(tagSessionKey + key.attributes() + "\n")
+	}
+	for _, r := range p.Renditions {
+		b.WriteString(tagMedia + r.attributes() + "\n")
+	}
+
+	for _, v := range p.Variants {
+		if !v.IFrame {
+			b.WriteString(tagStreamInf + v.attributes() + "\n" + v.URI + "\n")
+		}
+	}
+	for _, v := range p.Variants {
+		if v.IFrame {
+			b.WriteString(tagIFrameStreamInf + v.attributes() + "\n")
+		}
+	}
+
+	return b.String()
+}
+
+// Validate 检查码流的必填属性以及引用的备选流分组是否存在
+func (p *MasterPlaylist) Validate() error {
+	groups := make(map[string]bool)
+	for _, r := range p.Renditions {
+		switch r.Type {
+		case MediaTypeAudio, MediaTypeVideo, MediaTypeSubtitles:
+		case MediaTypeClosedCaptions:
+			if r.URI != "" {
+				return fmt.Errorf("closed captions rendition(%s) must not have uri", r.Name)
+			}
+		default:
+			return fmt.Errorf("invalid rendition type(%s)", r.Type)
+		}
+		if r.Type == MediaTypeSubtitles && r.URI == "" {
+			return fmt.Errorf("subtitles rendition(%s) missing uri", r.Name)
+		}
+		groups[r.Type+"/"+r.GroupID] = true
+	}
+
+	if len(p.Variants) == 0 {
+		return errors.New("no variant stream")
+	}
+
+	for _, v := range p.Variants {
+		if v.URI == "" {
+			return errors.New("variant stream missing uri")
+		}
+		if v.Bandwidth <= 0 {
+			return fmt.Errorf("variant stream(%s) missing bandwidth", v.URI)
+		}
+
+		refs := map[string]string{
+			MediaTypeAudio:     v.Audio,
+			MediaTypeVideo:     v.Video,
+			MediaTypeSubtitles: v.Subtitles,
+		}
+		if v.ClosedCaptions != "NONE" {
+			refs[MediaTypeClosedCaptions] = v.ClosedCaptions
+		}
+		for typ, group := range refs {
+			if group != "" && !groups[typ+"/"+group] {
+				return fmt.Errorf("variant stream(%s) references unknown %s group(%s)", v.URI, typ, group)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package m3u8
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testMaster = `#EXTM3U
+#EXT-X-VERSION:6
+#EXT-X-INDEPENDENT-SEGMENTS
+#EXT-X-START:TIME-OFFSET=-12.000,PRECISE=YES
+#EXT-X-CUSTOM-TAG:1
+#EXT-X-SESSION-DATA:DATA-ID="com.example.title",VALUE="live",LANGUAGE="en"
+#EXT-X-SESSION-KEY:METHOD=AES-128,URI="https://example.com/key",IV=0x000102030405060708090A0B0C0D0E0F
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",LANGUAGE="en",DEFAULT=YES,AUTOSELECT=YES,CHANNELS="2",URI="audio/en.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="Deutsch",LANGUAGE="de",AUTOSELECT=YES,CHANNELS="2",URI="audio/de.m3u8"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",LANGUAGE="en",FORCED=YES,URI="subs/en.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=2560000,AVERAGE-BANDWIDTH=2000000,CODECS="avc1.4d401f,mp4a.40.2",RESOLUTION=1280x720,FRAME-RATE=29.970,AUDIO="aac",SUBTITLES="subs",CLOSED-CAPTIONS=NONE
+720p/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=640000,CODECS="avc1.42e01e,mp4a.40.2",RESOLUTION=640x360,AUDIO="aac"
+360p/index.m3u8
+#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=86000,CODECS="avc1.4d401f",RESOLUTION=1280x720,URI="720p/iframe.m3u8"
+`
+
+func TestParseMaster(t *testing.T) {
+	at := assert.New(t)
+
+	// case1: 解析
+	pl, err := Parse([]byte(testMaster))
+	at.Nil(err)
+
+	p, ok := pl.(*MasterPlaylist)
+	at.True(ok)
+	at.Equal(6, p.Version)
+	at.True(p.IndependentSegments)
+	at.Equal(&Start{TimeOffset: -12, Precise: true}, p.Start)
+	at.Equal([]string{"#EXT-X-CUSTOM-TAG:1"}, p.Custom)
+	at.Equal([]*SessionData{{DataID: "com.example.title", Value: "live", Language: "en"}}, p.SessionData)
+	at.Len(p.SessionKeys, 1)
+	at.Equal([]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}, p.SessionKeys[0].IV)
+
+	at.Len(p.Renditions, 3)
+	at.Equal(&Rendition{
+		Type:       MediaTypeAudio,
+		GroupID:    "aac",
+		Name:       "English",
+		Language:   "en",
+		Default:    true,
+		AutoSelect: true,
+		Channels:   "2",
+		URI:        "audio/en.m3u8",
+	}, p.Renditions[0])
+
+	at.Len(p.Variants, 3)
+	at.Equal(&Variant{
+		URI:              "720p/index.m3u8",
+		Bandwidth:        2560000,
+		AverageBandwidth: 2000000,
+		Codecs:           "avc1.4d401f,mp4a.40.2",
+		Width:            1280,
+		Height:           720,
+		FrameRate:        29.97,
+		Audio:            "aac",
+		Subtitles:        "subs",
+		ClosedCaptions:   "NONE",
+	}, p.Variants[0])
+	at.True(p.Variants[2].IFrame)
+	at.Equal("720p/iframe.m3u8", p.Variants[2].URI)
+
+	// case2: 生成后与原始内容一致
+	at.Equal(testMaster, p.String())
+	at.Nil(p.Validate())
+
+	// case3: 格式错误
+	_, err = ParseMaster([]byte("#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1\n"))
+	at.NotNil(err)
+	_, err = ParseMaster([]byte("#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1,RESOLUTION=abc\na.m3u8\n"))
+	at.NotNil(err)
+	_, err = ParseMaster([]byte("#EXT-X-STREAM-INF:BANDWIDTH=1\na.m3u8\n"))
+	at.NotNil(err)
+	_, err = ParseMaster([]byte("#EXTM3U\n#EXT-X-MEDIA:TYPE=AUDIO\n"))
+	at.NotNil(err)
+}
+
+func TestMasterPlaylist_Validate(t *testing.T) {
+	at := assert.New(t)
+
+	// case1: 引用了不存在的备选流分组
+	p := &MasterPlaylist{
+		Variants: []*Variant{{URI: "a.m3u8", Bandwidth: 1, Audio: "aac"}},
+	}
+	at.NotNil(p.Validate())
+
+	p.Renditions = []*Rendition{{Type: MediaTypeAudio, GroupID: "aac", Name: "en"}}
+	at.Nil(p.Validate())
+
+	// case2: 缺少带宽
+	p.Variants[0].Bandwidth = 0
+	at.NotNil(p.Validate())
+
+	// case3: 没有码流
+	at.NotNil((&MasterPlaylist{}).Validate())
+}
@@ -0,0 +1,669 @@
+// Package m3u8 媒体播放列表
+package m3u8
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	tagTargetDuration        = "#EXT-X-TARGETDURATION:"
+	tagMediaSequence         = "#EXT-X-MEDIA-SEQUENCE:"
+	tagDiscontinuitySequence = "#EXT-X-DISCONTINUITY-SEQUENCE:"
+	tagPlaylistType          = "#EXT-X-PLAYLIST-TYPE:"
+	tagIFramesOnly           = "#EXT-X-I-FRAMES-ONLY"
+	tagServerControl         = "#EXT-X-SERVER-CONTROL:"
+	tagPartInf               = "#EXT-X-PART-INF:"
+	tagEndList               = "#EXT-X-ENDLIST"
+	tagInf                   = "#EXTINF:"
+	tagByteRange             = "#EXT-X-BYTERANGE:"
+	tagDiscontinuity         = "#EXT-X-DISCONTINUITY"
+	tagKey                   = "#EXT-X-KEY:"
+	tagMap                   = "#EXT-X-MAP:"
+	tagProgramDateTime       = "#EXT-X-PROGRAM-DATE-TIME:"
+	tagDateRange             = "#EXT-X-DATERANGE:"
+	tagGap                   = "#EXT-X-GAP"
+	tagPart                  = "#EXT-X-PART:"
+	tagPreloadHint           = "#EXT-X-PRELOAD-HINT:"
+	tagRenditionReport       = "#EXT-X-RENDITION-REPORT:"
+)
+
+// 播放列表类型(EXT-X-PLAYLIST-TYPE)
+const (
+	PlaylistTypeEvent = "EVENT"
+	PlaylistTypeVOD   = "VOD"
+)
+
+// Map EXT-X-MAP, 媒体初始化片段
+type Map struct {
+	URI       string
+	ByteRange *ByteRange
+}
+
+// DateRange EXT-X-DATERANGE
+type DateRange struct {
+	ID               string
+	Class            string
+	StartDate        time.Time
+	EndDate          time.Time // 零值表示未指定
+	Duration         *float64
+	PlannedDuration  *float64
+	EndOnNext        bool
+	ClientAttributes []Attribute // X-<client-attribute> 和 SCTE35-* 等其他属性, 原样输出
+}
+
+// Part 部分切片, EXT-X-PART(LL-HLS)
+type Part struct {
+	URI         string
+	Duration    float64
+	Independent bool
+	ByteRange   *ByteRange
+	Gap         bool
+}
+
+// ServerControl EXT-X-SERVER-CONTROL(LL-HLS)
+type ServerControl struct {
+	CanBlockReload    bool
+	CanSkipUntil      float64
+	CanSkipDateRanges bool
+	HoldBack          float64
+	PartHoldBack      float64
+}
+
+// PreloadHint EXT-X-PRELOAD-HINT(LL-HLS)
+type PreloadHint struct {
+	Type            string // PART 或 MAP
+	URI             string
+	ByteRangeStart  int64
+	ByteRangeLength int64 // 0表示直到资源结束
+}
+
+// RenditionReport EXT-X-RENDITION-REPORT(LL-HLS)
+type RenditionReport struct {
+	URI      string
+	LastMSN  uint64
+	LastPart int64 // 小于0表示未指定
+}
+
+// Segment 媒体切片及其前面的标签
+type Segment struct {
+	URI             string // 为空表示正在生成的切片(LL-HLS), 只输出其标签和部分切片
+	Duration        float64
+	Title           string
+	ByteRange       *ByteRange
+	Discontinuity   bool
+	Keys            []*Key // 从该切片开始生效的密钥
+	Map             *Map   // 从该切片开始生效的初始化片段
+	ProgramDateTime time.Time
+	DateRanges      []*DateRange
+	Gap             bool
+	Parts           []*Part
+	Custom          []string // 未识别的标签和注释, 原样输出
+}
+
+// MediaPlaylist 媒体播放列表
+type MediaPlaylist struct {
+	Version               int
+	IndependentSegments   bool
+	Start                 *Start
+	TargetDuration        int64
+	ServerControl         *ServerControl
+	PartTarget            float64 // EXT-X-PART-INF, 0表示没有部分切片
+	MediaSequence         uint64
+	DiscontinuitySequence uint64
+	PlaylistType          string
+	IFramesOnly           bool
+	Custom                []string // 未识别的标签和注释, 原样输出
+	Segments              []*Segment
+	PreloadHints          []*PreloadHint
+	RenditionReports      []*RenditionReport
+	EndList               bool
+}
+
+// ParseMedia 解析媒体播放列表
+func ParseMedia(b []byte) (*MediaPlaylist, error) {
+	lines, err := splitLines(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseMedia(lines)
+}
+
+func parseMedia(lines []string) (*MediaPlaylist, error) {
+	p := &MediaPlaylist{}
+
+	// 正在解析的切片, 遇到URI时结束
+	var pending *Segment
+	var hasInf bool
+	seg := func() *Segment {
+		if pending == nil {
+			pending = &Segment{}
+		}
+		return pending
+	}
+
+	for _, line := range lines {
+		var err error
+
+		switch {
+		case !strings.HasPrefix(line, "#"):
+			if !hasInf {
+				return nil, fmt.Errorf("missing #EXTINF before uri(%s)", line)
+			}
+			pending.URI = line
+			p.Segments = append(p.Segments, pending)
+			pending = nil
+			hasInf = false
+		case strings.HasPrefix(line, tagInf):
+			s := seg()
+			s.Duration, s.Title, err = parseInf(line)
+			hasInf = true
+		case strings.HasPrefix(line, tagByteRange):
+			seg().ByteRange, err = parseByteRange(line[len(tagByteRange):])
+		case line == tagDiscontinuity:
+			seg().Discontinuity = true
+		case strings.HasPrefix(line, tagKey):
+			var key *Key
+			key, err = parseKey(line, tagKey)
+			if err == nil {
+				s := seg()
+				s.Keys = append(s.Keys, key)
+			}
+		case strings.HasPrefix(line, tagMap):
+			seg().Map, err = parseMap(line)
+		case strings.HasPrefix(line, tagProgramDateTime):
+			seg().ProgramDateTime, err = parseTime(line[len(tagProgramDateTime):])
+		case strings.HasPrefix(line, tagDateRange):
+			var dr *DateRange
+			dr, err = parseDateRange(line)
+			if err == nil {
+				s := seg()
+				s.DateRanges = append(s.DateRanges, dr)
+			}
+		case line == tagGap:
+			seg().Gap = true
+		case strings.HasPrefix(line, tagPart):
+			var pt *Part
+			pt, err = parsePart(line)
+			if err == nil {
+				s := seg()
+				s.Parts = append(s.Parts, pt)
+			}
+		case strings.HasPrefix(line, tagVersion):
+			p.Version, err = parseVersion(line)
+		case line == tagIndependentSegments:
+			p.IndependentSegments = true
+		case strings.HasPrefix(line, tagStart):
+			p.Start, err = parseStart(line)
+		case strings.HasPrefix(line, tagTargetDuration):
+			p.TargetDuration, err = strconv.ParseInt(line[len(tagTargetDuration):], 10, 64)
+		case strings.HasPrefix(line, tagServerControl):
+			p.ServerControl, err = parseServerControl(line)
+		case strings.HasPrefix(line, tagPartInf):
+			var attrs attributes
+			attrs, err = tagAttributes(line, tagPartInf)
+			if err == nil {
+				p.PartTarget, err = attrs.decimal("PART-TARGET")
+			}
+		case strings.HasPrefix(line, tagMediaSequence):
+			p.MediaSequence, err = strconv.ParseUint(line[len(tagMediaSequence):], 10, 64)
+		case strings.HasPrefix(line, tagDiscontinuitySequence):
+			p.DiscontinuitySequence, err = strconv.ParseUint(line[len(tagDiscontinuitySequence):], 10, 64)
+		case strings.HasPrefix(line, tagPlaylistType):
+			p.PlaylistType = line[len(tagPlaylistType):]
+		case line == tagIFramesOnly:
+			p.IFramesOnly = true
+		case strings.HasPrefix(line, tagPreloadHint):
+			var hint *PreloadHint
+			hint, err = parsePreloadHint(line)
+			if err == nil {
+				p.PreloadHints = append(p.PreloadHints, hint)
+			}
+		case strings.HasPrefix(line, tagRenditionReport):
+			var report *RenditionReport
+			report, err = parseRenditionReport(line)
+			if err == nil {
+				p.RenditionReports = append(p.RenditionReports, report)
+			}
+		case line == tagEndList:
+			p.EndList = true
+		default:
+			if pending == nil && len(p.Segments) == 0 {
+				p.Custom = append(p.Custom, line)
+			} else {
+				s := seg()
+				s.Custom = append(s.Custom, line)
+			}
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid line(%s): %v", line, err)
+		}
+	}
+
+	if pending != nil {
+		if hasInf {
+			return nil, errors.New("missing uri after #EXTINF")
+		}
+
+		// 正在生成的切片
+		p.Segments = append(p.Segments, pending)
+	}
+
+	return p, nil
+}
+
+func parseVersion(line string) (int, error) {
+	return strconv.Atoi(line[len(tagVersion):])
+}
+
+// #EXTINF:<duration>,[<title>]
+func parseInf(line string) (float64, string, error) {
+	value := line[len(tagInf):]
+
+	var title string
+	if comma := strings.IndexByte(value, ','); comma >= 0 {
+		value, title = value[:comma], value[comma+1:]
+	}
+
+	duration, err := strconv.ParseFloat(value, 64)
+	if err != nil || duration < 0 {
+		return 0, "", fmt.Errorf("invalid duration(%s)", value)
+	}
+
+	return duration, title, nil
+}
+
+func parseMap(line string) (*Map, error) {
+	attrs, err := tagAttributes(line, tagMap)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Map{URI: attrs.str("URI")}
+	if m.URI == "" {
+		return nil, errors.New("#EXT-X-MAP missing URI")
+	}
+
+	if br, ok := attrs.get("BYTERANGE"); ok {
+		m.ByteRange, err = parseByteRange(br)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+func parseDateRange(line string) (*DateRange, error) {
+	attrs, err := tagAttributes(line, tagDateRange)
+	if err != nil {
+		return nil, err
+	}
+
+	dr := &DateRange{}
+	for _, attr := range attrs {
+		value := strings.Trim(attr.Value, "\"")
+
+		switch attr.Key {
+		case "ID":
+			dr.ID = value
+		case "CLASS":
+			dr.Class = value
+		case "START-DATE":
+			dr.StartDate, err = parseTime(value)
+		case "END-DATE":
+			dr.EndDate, err = parseTime(value)
+		case "DURATION":
+			dr.Duration, err = parseDecimalPtr(value)
+		case "PLANNED-DURATION":
+			dr.PlannedDuration, err = parseDecimalPtr(value)
+		case "END-ON-NEXT":
+			dr.EndOnNext = value == "YES"
+		default:
+			dr.ClientAttributes = append(dr.ClientAttributes, attr)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if dr.ID == "" {
+		return nil, errors.New("#EXT-X-DATERANGE missing ID")
+	}
+
+	return dr, nil
+}
+
+func parseDecimalPtr(s string) (*float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid decimal(%s)", s)
+	}
+
+	return &f, nil
+}
+
+func parsePart(line string) (*Part, error) {
+	attrs, err := tagAttributes(line, tagPart)
+	if err != nil {
+		return nil, err
+	}
+
+	pt := &Part{
+		URI:         attrs.str("URI"),
+		Independent: attrs.yes("INDEPENDENT"),
+		Gap:         attrs.yes("GAP"),
+	}
+	if pt.URI == "" {
+		return nil, errors.New("#EXT-X-PART missing URI")
+	}
+
+	pt.Duration, err = attrs.decimal("DURATION")
+	if err != nil {
+		return nil, err
+	}
+
+	if br, ok := attrs.get("BYTERANGE"); ok {
+		pt.ByteRange, err = parseByteRange(br)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return pt, nil
+}
+
+func parseServerControl(line string) (*ServerControl, error) {
+	attrs, err := tagAttributes(line, tagServerControl)
+	if err != nil {
+		return nil, err
+	}
+
+	sc := &ServerControl{
+		CanBlockReload:    attrs.yes("CAN-BLOCK-RELOAD"),
+		CanSkipDateRanges: attrs.yes("CAN-SKIP-DATERANGES"),
+	}
+
+	sc.CanSkipUntil, err = attrs.decimal("CAN-SKIP-UNTIL")
+	if err != nil {
+		return nil, err
+	}
+
+	sc.HoldBack, err = attrs.decimal("HOLD-BACK")
+	if err != nil {
+		return nil, err
+	}
+
+	sc.PartHoldBack, err = attrs.decimal("PART-HOLD-BACK")
+	if err != nil {
+		return nil, err
+	}
+
+	return sc, nil
+}
+
+func parsePreloadHint(line string) (*PreloadHint, error) {
+	attrs, err := tagAttributes(line, tagPreloadHint)
+	if err != nil {
+		return nil, err
+	}
+
+	hint := &PreloadHint{
+		Type: attrs.str("TYPE"),
+		URI:  attrs.str("URI"),
+	}
+	if hint.Type == "" || hint.URI == "" {
+		return nil, errors.New("#EXT-X-PRELOAD-HINT missing TYPE or URI")
+	}
+
+	hint.ByteRangeStart, err = attrs.integer("BYTERANGE-START")
+	if err != nil {
+		return nil, err
+	}
+
+	hint.ByteRangeLength, err = attrs.integer("BYTERANGE-LENGTH")
+	if err != nil {
+		return nil, err
+	}
+
+	return hint, nil
+}
+
+func parseRenditionReport(line string) (*RenditionReport, error) {
+	attrs, err := tagAttributes(line, tagRenditionReport)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RenditionReport{
+		URI:      attrs.str("URI"),
+		LastPart: -1,
+	}
+
+	if msn, ok := attrs.get("LAST-MSN"); ok {
+		report.LastMSN, err = strconv.ParseUint(msn, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LAST-MSN(%s)", msn)
+		}
+	}
+
+	if _, ok := attrs.get("LAST-PART"); ok {
+		report.LastPart, err = attrs.integer("LAST-PART")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+func (dr *DateRange) attributes() string {
+	var w attrWriter
+	w.quoted("ID", dr.ID)
+	w.quoted("CLASS", dr.Class)
+	if !dr.StartDate.IsZero() {
+		w.quoted("START-DATE", formatTime(dr.StartDate))
+	}
+	if !dr.EndDate.IsZero() {
+		w.quoted("END-DATE", formatTime(dr.EndDate))
+	}
+	if dr.Duration != nil {
+		w.raw("DURATION", formatDecimal(*dr.Duration))
+	}
+	if dr.PlannedDuration != nil {
+		w.raw("PLANNED-DURATION", formatDecimal(*dr.PlannedDuration))
+	}
+	w.yes("END-ON-NEXT", dr.EndOnNext)
+	for _, attr := range dr.ClientAttributes {
+		w.raw(attr.Key, attr.Value)
+	}
+
+	return w.String()
+}
+
+func (pt *Part) attributes() string {
+	var w attrWriter
+	w.raw("DURATION", formatDecimal(pt.Duration))
+	w.quoted("URI", pt.URI)
+	w.yes("INDEPENDENT", pt.Independent)
+	if pt.ByteRange != nil {
+		w.quoted("BYTERANGE", pt.ByteRange.String())
+	}
+	w.yes("GAP", pt.Gap)
+
+	return w.String()
+}
+
+func (sc *ServerControl) attributes() string {
+	var w attrWriter
+	w.yes("CAN-BLOCK-RELOAD", sc.CanBlockReload)
+	w.decimal("CAN-SKIP-UNTIL", sc.CanSkipUntil)
+	w.yes("CAN-SKIP-DATERANGES", sc.CanSkipDateRanges)
+	w.decimal("HOLD-BACK", sc.HoldBack)
+	w.decimal("PART-HOLD-BACK", sc.PartHoldBack)
+
+	return w.String()
+}
+
+func (hint *PreloadHint) attributes() string {
+	var w attrWriter
+	w.enum("TYPE", hint.Type)
+	w.quoted("URI", hint.URI)
+	w.integer("BYTERANGE-START", hint.ByteRangeStart)
+	w.integer("BYTERANGE-LENGTH", hint.ByteRangeLength)
+
+	return w.String()
+}
+
+func (report *RenditionReport) attributes() string {
+	var w attrWriter
+	w.quoted("URI", report.URI)
+	w.raw("LAST-MSN", strconv.FormatUint(report.LastMSN, 10))
+	if report.LastPart >= 0 {
+		w.raw("LAST-PART", strconv.FormatInt(report.LastPart, 10))
+	}
+
+	return w.String()
+}
+
+// 写入切片的标签和URI
+func (s *Segment) write(b *strings.Builder) {
+	for _, line := range s.Custom {
+		b.WriteString(line + "\n")
+	}
+	if s.Discontinuity {
+		b.WriteString(tagDiscontinuity + "\n")
+	}
+	for _, key := range s.Keys {
+		b.WriteString(tagKey + key.attributes() + "\n")
+	}
+	if s.Map != nil {
+		var w attrWriter
+		w.quoted("URI", s.Map.URI)
+		if s.Map.ByteRange != nil {
+			w.quoted("BYTERANGE", s.Map.ByteRange.String())
+		}
+		b.WriteString(tagMap + w.String() + "\n")
+	}
+	if !s.ProgramDateTime.IsZero() {
+		b.WriteString(tagProgramDateTime + formatTime(s.ProgramDateTime) + "\n")
+	}
+	for _, dr := range s.DateRanges {
+		b.WriteString(tagDateRange + dr.attributes() + "\n")
+	}
+	if s.Gap {
+		b.WriteString(tagGap + "\n")
+	}
+	for _, pt := range s.Parts {
+		b.WriteString(tagPart + pt.attributes() + "\n")
+	}
+
+	if s.URI == "" {
+		return
+	}
+
+	fmt.Fprintf(b, "%s%s,%s\n", tagInf, formatDecimal(s.Duration), s.Title)
+	if s.ByteRange != nil {
+		b.WriteString(tagByteRange + s.ByteRange.String() + "\n")
+	}
+	b.WriteString(s.URI + "\n")
+}
+
+// String 生成媒体播放列表
+func (p *MediaPlaylist) String() string {
+	var b strings.Builder
+
+	b.WriteString(tagHeader + "\n")
+	if p.Version > 0 {
+		fmt.Fprintf(&b, "%s%d\n", tagVersion, p.Version)
+	}
+	if p.IndependentSegments {
+		b.WriteString(tagIndependentSegments + "\n")
+	}
+	if p.Start != nil {
+		b.WriteString(p.Start.String() + "\n")
+	}
+	fmt.Fprintf(&b, "%s%d\n", tagTargetDuration, p.TargetDuration)
+	if p.ServerControl != nil {
+		b.WriteString(tagServerControl + p.ServerControl.attributes() + "\n")
+	}
+	if p.PartTarget > 0 {
+		b.WriteString(tagPartInf + "PART-TARGET=" + formatDecimal(p.PartTarget) + "\n")
+	}
+	fmt.Fprintf(&b, "%s%d\n", tagMediaSequence, p.MediaSequence)
+	if p.DiscontinuitySequence > 0 {
+		fmt.Fprintf(&b, "%s%d\n", tagDiscontinuitySequence, p.DiscontinuitySequence)
+	}
+	if p.PlaylistType != "" {
+		b.WriteString(tagPlaylistType + p.PlaylistType + "\n")
+	}
+	if p.IFramesOnly {
+		b.WriteString(tagIFramesOnly + "\n")
+	}
+	for _, line := range p.Custom {
+		b.WriteString(line + "\n")
+	}
+
+	for _, s := range p.Segments {
+		s.write(&b)
+	}
+
+	for _, hint := range p.PreloadHints {
+		b.WriteString(tagPreloadHint + hint.attributes() + "\n")
+	}
+	for _, report := range p.RenditionReports {
+		b.WriteString(tagRenditionReport + report.attributes() + "\n")
+	}
+	if p.EndList {
+		b.WriteString(tagEndList + "\n")
+	}
+
+	return b.String()
+}
+
+// Validate 检查切片和部分切片的时长是否符合 EXT-X-TARGETDURATION 和 EXT-X-PART-INF
+func (p *MediaPlaylist) Validate() error {
+	if p.TargetDuration <= 0 {
+		return errors.New("missing #EXT-X-TARGETDURATION")
+	}
+
+	hasParts := false
+	for i, s := range p.Segments {
+		if s.URI == "" && i != len(p.Segments)-1 {
+			return errors.New("segment missing uri")
+		}
+
+		if s.URI != "" && int64(math.Round(s.Duration)) > p.TargetDuration {
+			return fmt.Errorf("segment(%s) duration %s exceeds target duration %d", s.URI, formatDecimal(s.Duration), p.TargetDuration)
+		}
+
+		for _, pt := range s.Parts {
+			hasParts = true
+			if p.PartTarget <= 0 {
+				return errors.New("partial segment without #EXT-X-PART-INF")
+			}
+			if pt.Duration > p.PartTarget {
+				return fmt.Errorf("partial segment(%s) duration %s exceeds part target %s", pt.URI, formatDecimal(pt.Duration), formatDecimal(p.PartTarget))
+			}
+		}
+	}
+
+	if len(p.PreloadHints) > 0 && p.PartTarget <= 0 {
+		return errors.New("preload hint without #EXT-X-PART-INF")
+	}
+
+	if hasParts && !p.EndList {
+		if p.ServerControl == nil || p.ServerControl.PartHoldBack < 2*p.PartTarget {
+			return errors.New("PART-HOLD-BACK must be at least twice the part target")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package m3u8
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testMedia = `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:4
+#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,CAN-SKIP-UNTIL=24.000,PART-HOLD-BACK=1.002
+#EXT-X-PART-INF:PART-TARGET=0.334
+#EXT-X-MEDIA-SEQUENCE:266
+#EXT-X-DISCONTINUITY-SEQUENCE:2
+#EXT-X-CUSTOM-HEADER
+#EXT-X-KEY:METHOD=AES-128,URI="key1.bin"
+#EXT-X-MAP:URI="init.mp4",BYTERANGE="720@0"
+#EXT-X-PROGRAM-DATE-TIME:2019-02-14T02:13:36.106Z
+#EXT-X-DATERANGE:ID="ad1",CLASS="com.example.ad",START-DATE="2019-02-14T02:13:36.106Z",DURATION=15.000,X-AD-ID="1234",SCTE35-OUT=0xFC002F
+#EXTINF:4.00008,title
+#EXT-X-BYTERANGE:1000@720
+fileSequence266.mp4
+#EXTINF:3.500,
+#EXT-X-BYTERANGE:1200
+fileSequence266.mp4
+#EXT-X-DISCONTINUITY
+#EXT-X-KEY:METHOD=NONE
+#EXT-X-GAP
+#EXTINF:4.000,
+fileSequence268.mp4
+#EXT-X-PART:DURATION=0.334,URI="filePart269.0.mp4",INDEPENDENT=YES
+#EXT-X-PART:DURATION=0.334,URI="filePart269.1.mp4",BYTERANGE="100@0"
+#EXTINF:0.668,
+fileSequence269.mp4
+#EXT-X-PART:DURATION=0.334,URI="filePart270.0.mp4",INDEPENDENT=YES
+#EXT-X-PRELOAD-HINT:TYPE=PART,URI="filePart270.1.mp4"
+#EXT-X-RENDITION-REPORT:URI="../1M/waitForMSN.php",LAST-MSN=270,LAST-PART=1
+`
+
+func TestParseMedia(t *testing.T) {
+	at := assert.New(t)
+
+	// case1: 解析
+	pl, err := Parse([]byte(testMedia))
+	at.Nil(err)
+
+	p, ok := pl.(*MediaPlaylist)
+	at.True(ok)
+	at.Equal(7, p.Version)
+	at.Equal(int64(4), p.TargetDuration)
+	at.Equal(&ServerControl{CanBlockReload: true, CanSkipUntil: 24, PartHoldBack: 1.002}, p.ServerControl)
+	at.Equal(0.334, p.PartTarget)
+	at.Equal(uint64(266), p.MediaSequence)
+	at.Equal(uint64(2), p.DiscontinuitySequence)
+	at.Equal([]string{"#EXT-X-CUSTOM-HEADER"}, p.Custom)
+	at.Len(p.Segments, 5)
+
+	s := p.Segments[0]
+	at.Equal("fileSequence266.mp4", s.URI)
+	at.Equal(4.00008, s.Duration)
+	at.Equal("title", s.Title)
+	at.Equal(&ByteRange{Length: 1000, Offset: 720}, s.ByteRange)
+	at.Equal([]*Key{{Method: "AES-128", URI: "key1.bin"}}, s.Keys)
+	at.Equal(&Map{URI: "init.mp4", ByteRange: &ByteRange{Length: 720, Offset: 0}}, s.Map)
+	at.Equal(time.Date(2019, 2, 14, 2, 13, 36, 106000000, time.UTC), s.ProgramDateTime.UTC())
+
+	at.Len(s.DateRanges, 1)
+	dr := s.DateRanges[0]
+	at.Equal("ad1", dr.ID)
+	at.Equal(15.0, *dr.Duration)
+	at.Nil(dr.PlannedDuration)
+	at.Equal([]Attribute{{Key: "X-AD-ID", Value: `"1234"`}, {Key: "SCTE35-OUT", Value: "0xFC002F"}}, dr.ClientAttributes)
+
+	at.Equal(&ByteRange{Length: 1200, Offset: -1}, p.Segments[1].ByteRange)
+	at.True(p.Segments[2].Discontinuity)
+	at.True(p.Segments[2].Gap)
+
+	at.Len(p.Segments[3].Parts, 2)
+	at.Equal(&Part{URI: "filePart269.0.mp4", Duration: 0.334, Independent: true}, p.Segments[3].Parts[0])
+
+	// 正在生成的切片
+	at.Equal("", p.Segments[4].URI)
+	at.Len(p.Segments[4].Parts, 1)
+	at.Equal([]*PreloadHint{{Type: "PART", URI: "filePart270.1.mp4"}}, p.PreloadHints)
+	at.Equal([]*RenditionReport{{URI: "../1M/waitForMSN.php", LastMSN: 270, LastPart: 1}}, p.RenditionReports)
+	at.False(p.EndList)
+
+	// case2: 生成后与原始内容一致
+	at.Equal(testMedia, p.String())
+	at.Nil(p.Validate())
+
+	// case3: 格式错误
+	_, err = ParseMedia([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:4\na.ts\n"))
+	at.NotNil(err)
+	_, err = ParseMedia([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXTINF:a,\na.ts\n"))
+	at.NotNil(err)
+	_, err = ParseMedia([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXTINF:4,\n"))
+	at.NotNil(err)
+	_, err = ParseMedia([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXT-X-KEY:METHOD=AES-128,IV=0x01\n#EXTINF:4,\na.ts\n"))
+	at.NotNil(err)
+	_, err = ParseMedia([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXT-X-PROGRAM-DATE-TIME:now\n#EXTINF:4,\na.ts\n"))
+	at.NotNil(err)
+	_, err = Parse([]byte("#EXTM3U\n"))
+	at.NotNil(err)
+}
+
+func TestMediaPlaylist_String(t *testing.T) {
+	at := assert.New(t)
+
+	p := &MediaPlaylist{
+		Version:        3,
+		TargetDuration: 6,
+		PlaylistType:   PlaylistTypeVOD,
+		Segments: []*Segment{
+			{URI: "a.ts", Duration: 6},
+			{URI: "b.ts", Duration: 5.005, ProgramDateTime: time.Date(2020, 1, 2, 3, 4, 5, 123456789, time.UTC)},
+		},
+		EndList: true,
+	}
+
+	// case1: 时间保留纳秒精度
+	at.Equal("#EXTM3U\n"+
+		"#EXT-X-VERSION:3\n"+
+		"#EXT-X-TARGETDURATION:6\n"+
+		"#EXT-X-MEDIA-SEQUENCE:0\n"+
+		"#EXT-X-PLAYLIST-TYPE:VOD\n"+
+		"#EXTINF:6.000,\na.ts\n"+
+		"#EXT-X-PROGRAM-DATE-TIME:2020-01-02T03:04:05.123456789Z\n"+
+		"#EXTINF:5.005,\nb.ts\n"+
+		"#EXT-X-ENDLIST\n", p.String())
+
+	// case2: 往返解析
+	q, err := ParseMedia([]byte(p.String()))
+	at.Nil(err)
+	at.Equal(p.String(), q.String())
+	at.True(p.Segments[1].ProgramDateTime.Equal(q.Segments[1].ProgramDateTime))
+}
+
+func TestMediaPlaylist_Validate(t *testing.T) {
+	at := assert.New(t)
+
+	// case1: 切片时长超过目标时长
+	p := &MediaPlaylist{
+		TargetDuration: 4,
+		Segments:       []*Segment{{URI: "a.ts", Duration: 4.6}},
+	}
+	at.NotNil(p.Validate())
+
+	p.Segments[0].Duration = 4.4
+	at.Nil(p.Validate())
+
+	// case2: 部分切片需要 EXT-X-PART-INF, 且不能超过目标时长
+	p.Segments = append(p.Segments, &Segment{Parts: []*Part{{URI: "b.0.ts", Duration: 0.5}}})
+	at.NotNil(p.Validate())
+
+	p.PartTarget = 0.4
+	p.ServerControl = &ServerControl{PartHoldBack: 1.2}
+	at.NotNil(p.Validate())
+
+	p.PartTarget = 0.5
+	at.Nil(p.Validate())
+
+	// case3: PART-HOLD-BACK 至少为2倍部分切片目标时长
+	p.ServerControl.PartHoldBack = 0.6
+	at.NotNil(p.Validate())
+
+	// case4: 缺少目标时长
+	at.NotNil((&MediaPlaylist{}).Validate())
+}
@@ -0,0 +1,229 @@
+// Package m3u8 解析和生成HLS的主播放列表和媒体播放列表(RFC 8216, 含LL-HLS扩展)
+package m3u8
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	tagHeader              = "#EXTM3U"
+	tagVersion             = "#EXT-X-VERSION:"
+	tagIndependentSegments = "#EXT-X-INDEPENDENT-SEGMENTS"
+	tagStart               = "#EXT-X-START:"
+)
+
+// 日期时间的格式, 精度为毫秒时使用 timeFormatMs
+const timeFormatMs = "2006-01-02T15:04:05.000Z07:00"
+
+// Playlist 主播放列表(*MasterPlaylist)或媒体播放列表(*MediaPlaylist)
+type Playlist interface {
+	String() string
+}
+
+// Parse 解析播放列表, 根据标签判断是主播放列表还是媒体播放列表
+func Parse(b []byte) (Playlist, error) {
+	lines, err := splitLines(b)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, tagStreamInf),
+			strings.HasPrefix(line, tagIFrameStreamInf),
+			strings.HasPrefix(line, tagMedia),
+			strings.HasPrefix(line, tagSessionData):
+			return parseMaster(lines)
+		case strings.HasPrefix(line, tagInf),
+			strings.HasPrefix(line, tagTargetDuration):
+			return parseMedia(lines)
+		}
+	}
+
+	return nil, errors.New("unknown playlist type")
+}
+
+// 按行切分, 检查 #EXTM3U, 去除空行
+func splitLines(b []byte) ([]string, error) {
+	s := strings.TrimPrefix(string(b), "\ufeff")
+
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	if len(lines) == 0 || lines[0] != tagHeader {
+		return nil, errors.New("missing #EXTM3U")
+	}
+
+	return lines[1:], nil
+}
+
+// 解析 "#TAG:value" 中的属性列表
+func tagAttributes(line, tag string) (attributes, error) {
+	attrs, err := parseAttributes(line[len(tag):])
+	if err != nil {
+		return nil, fmt.Errorf("%s %v", strings.TrimSuffix(tag, ":"), err)
+	}
+
+	return attrs, nil
+}
+
+// Start EXT-X-START
+type Start struct {
+	TimeOffset float64
+	Precise    bool
+}
+
+func parseStart(line string) (*Start, error) {
+	attrs, err := tagAttributes(line, tagStart)
+	if err != nil {
+		return nil, err
+	}
+
+	offset, err := attrs.decimal("TIME-OFFSET")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Start{
+		TimeOffset: offset,
+		Precise:    attrs.yes("PRECISE"),
+	}, nil
+}
+
+func (s *Start) String() string {
+	var w attrWriter
+	w.raw("TIME-OFFSET", formatDecimal(s.TimeOffset))
+	w.yes("PRECISE", s.Precise)
+
+	return tagStart + w.String()
+}
+
+// ByteRange 子范围, EXT-X-BYTERANGE 或 BYTERANGE 属性
+type ByteRange struct {
+	Length int64
+	Offset int64 // 小于0表示未指定, 紧接上一个子范围
+}
+
+func parseByteRange(s string) (*ByteRange, error) {
+	br := &ByteRange{Offset: -1}
+
+	length := s
+	if at := strings.IndexByte(s, '@'); at >= 0 {
+		length = s[:at]
+
+		offset, err := strconv.ParseInt(s[at+1:], 10, 64)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("invalid byte range(%s)", s)
+		}
+		br.Offset = offset
+	}
+
+	n, err := strconv.ParseInt(length, 10, 64)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid byte range(%s)", s)
+	}
+	br.Length = n
+
+	return br, nil
+}
+
+func (br *ByteRange) String() string {
+	if br.Offset < 0 {
+		return strconv.FormatInt(br.Length, 10)
+	}
+
+	return fmt.Sprintf("%d@%d", br.Length, br.Offset)
+}
+
+// 加密方式(EXT-X-KEY METHOD)
+const (
+	KeyMethodNone      = "NONE"
+	KeyMethodAES128    = "AES-128"
+	KeyMethodSampleAES = "SAMPLE-AES"
+)
+
+// Key EXT-X-KEY 或 EXT-X-SESSION-KEY
+type Key struct {
+	Method            string // NONE, AES-128, SAMPLE-AES
+	URI               string
+	IV                []byte // 16字节, 为空表示使用媒体序号
+	KeyFormat         string
+	KeyFormatVersions string
+}
+
+func parseKey(line, tag string) (*Key, error) {
+	attrs, err := tagAttributes(line, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{
+		Method:            attrs.str("METHOD"),
+		URI:               attrs.str("URI"),
+		KeyFormat:         attrs.str("KEYFORMAT"),
+		KeyFormatVersions: attrs.str("KEYFORMATVERSIONS"),
+	}
+	if key.Method == "" {
+		return nil, fmt.Errorf("%s missing METHOD", tag)
+	}
+
+	if iv, ok := attrs.get("IV"); ok {
+		if !strings.HasPrefix(iv, "0x") && !strings.HasPrefix(iv, "0X") {
+			return nil, fmt.Errorf("invalid IV(%s)", iv)
+		}
+
+		key.IV, err = hex.DecodeString(iv[2:])
+		if err != nil || len(key.IV) != 16 {
+			return nil, fmt.Errorf("invalid IV(%s)", iv)
+		}
+	}
+
+	return key, nil
+}
+
+func (k *Key) attributes() string {
+	var w attrWriter
+	w.enum("METHOD", k.Method)
+	w.quoted("URI", k.URI)
+	if len(k.IV) > 0 {
+		w.raw("IV", "0x"+strings.ToUpper(hex.EncodeToString(k.IV)))
+	}
+	w.quoted("KEYFORMAT", k.KeyFormat)
+	w.quoted("KEYFORMATVERSIONS", k.KeyFormatVersions)
+
+	return w.String()
+}
+
+// 解析日期时间(ISO 8601), 兼容不带冒号的时区
+func parseTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err == nil {
+		return t, nil
+	}
+
+	t, err = time.Parse("2006-01-02T15:04:05.999999999Z0700", s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date time(%s)", s)
+	}
+
+	return t, nil
+}
+
+// 精度为毫秒时保留3位小数, 否则使用纳秒精度
+func formatTime(t time.Time) string {
+	if t.Nanosecond()%int(time.Millisecond) == 0 {
+		return t.Format(timeFormatMs)
+	}
+
+	return t.Format(time.RFC3339Nano)
+}
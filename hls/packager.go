@@ -0,0 +1,650 @@
+// Package hls 在ts.Mixer的基础上按关键帧切片, 维护滑动窗口的媒体播放列表
+package hls
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/moggle-mog/goav/container/ts"
+	"github.com/moggle-mog/goav/hls/m3u8"
+	"github.com/moggle-mog/goav/packet"
+)
+
+// 默认配置
+const (
+	defaultTargetDuration = 6 * time.Second
+	defaultWindowSize     = 5
+	defaultPlaylistName   = "index.m3u8"
+	defaultSegmentPrefix  = "segment"
+)
+
+// 距离直播边缘超过 partHoldSegments 个目标时长的切片不再列出部分切片
+const partHoldSegments = 3
+
+// Config 打包配置
+type Config struct {
+	TargetDuration  time.Duration // 目标切片时长, 在关键帧处切片, 默认6秒
+	WindowSize      int           // 播放列表中的切片数量, 默认5个, 移出窗口的切片会被删除
+	PlaylistName    string        // 播放列表的文件名, 默认 index.m3u8
+	SegmentPrefix   string        // 切片文件名的前缀, 默认 segment, 切片名为 <前缀><序号>.ts
+	ProgramDateTime bool          // 是否写入 EXT-X-PROGRAM-DATE-TIME
+	PartTarget      time.Duration // 部分切片的目标时长, 大于0时启用LL-HLS, 部分切片名为 <前缀><序号>.<部分序号>.ts
+
+	// 切片加密
+	Encryption  string      // 加密方式, m3u8.KeyMethodAES128(整段加密) 或 m3u8.KeyMethodSampleAES, 为空时不加密
+	KeyProvider KeyProvider // 提供加密密钥, 启用加密时必须设置
+	KeyRotation int         // 每 KeyRotation 个切片更换一次密钥, 0 表示不更换
+
+	// 切片时长(四舍五入)超过 EXT-X-TARGETDURATION 时调用(如关键帧间隔大于目标时长), 播放列表中的目标时长保持不变
+	OnLongSegment func(name string, duration time.Duration)
+}
+
+// 部分切片信息(LL-HLS)
+type part struct {
+	name        string
+	duration    float64 // 秒
+	independent bool    // 是否以关键帧开始
+}
+
+// 切片信息
+type segment struct {
+	name          string
+	seq           uint64
+	duration      float64 // 秒
+	discontinuity bool
+	dateTime      time.Time
+	parts         []*part
+	key           *Key // 加密密钥, 不加密时为nil
+}
+
+// Packager HLS直播打包器, 实现 packet.Writer
+// 输入为flv解复用后的数据包(Header为flv tag), 视频在关键帧处切片, 纯音频流按时长切片
+type Packager struct {
+	cfg     Config
+	storage Storage
+	mixer   *ts.Mixer
+	now     func() time.Time
+
+	mu      sync.Mutex
+	updated chan struct{} // 播放列表更新时关闭并替换, 用于唤醒阻塞的请求
+
+	buf       *bytes.Buffer // 当前切片的数据
+	segments  []*segment    // 播放列表窗口中的切片
+	current   *segment      // 正在写入的切片
+	seq       uint64        // 下一个切片的序号
+	completed uint64        // 已完成的切片数量
+	discSeq   uint64        // EXT-X-DISCONTINUITY-SEQUENCE
+
+	hasVideo       bool
+	startTs        uint32 // 当前切片第一个包的时间戳(ms)
+	lastTs         uint32 // 最近一个包的时间戳(ms)
+	discontinuity  bool   // 下一个切片前插入 EXT-X-DISCONTINUITY
+	targetDuration int    // 播放列表中的 EXT-X-TARGETDURATION, 由配置确定, 不随切片变化
+	closed         bool
+	key            *Key   // 当前使用的加密密钥
+	keySeq         uint64 // 当前密钥开始使用的切片序号
+
+	// 当前部分切片(LL-HLS)
+	partStart       int    // 在buf中的起始位置
+	partTs          uint32 // 第一个包的时间戳(ms)
+	partIndependent bool
+	frameTs         uint32 // 上一帧的时间戳(ms), 用于估计帧间隔
+
+	lastFrameTs   uint32 // 最近一帧(视频帧或纯音频流的音频帧)的时间戳(ms)
+	frameDuration uint32 // 最近的帧间隔(ms), 结束切片时作为最后一帧的时长
+}
+
+// NewPackager HLS直播打包器
+func NewPackager(storage Storage, cfg Config) *Packager {
+	if cfg.TargetDuration <= 0 {
+		cfg.TargetDuration = defaultTargetDuration
+	}
+	if cfg.WindowSize <= 0 {
+		cfg.WindowSize = defaultWindowSize
+	}
+	if cfg.PlaylistName == "" {
+		cfg.PlaylistName = defaultPlaylistName
+	}
+	if cfg.SegmentPrefix == "" {
+		cfg.SegmentPrefix = defaultSegmentPrefix
+	}
+
+	buf := bytes.NewBuffer(nil)
+
+	return &Packager{
+		cfg:            cfg,
+		storage:        storage,
+		mixer:          ts.NewMixer(buf),
+		now:            time.Now,
+		updated:        make(chan struct{}),
+		buf:            buf,
+		targetDuration: int(math.Ceil(cfg.TargetDuration.Seconds())),
+	}
+}
+
+// Mixer 返回内部的ts混合器, 可用于设置元数据和同步阈值
+func (pk *Packager) Mixer() *ts.Mixer {
+	return pk.mixer
+}
+
+// Discontinuity 在下一个切片前插入 EXT-X-DISCONTINUITY(编码参数或时间戳不连续时调用), 并立即结束当前切片
+func (pk *Packager) Discontinuity() error {
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+
+	pk.discontinuity = true
+	return pk.finishSegment(pk.endTs())
+}
+
+// Write 写入一个数据包
+func (pk *Packager) Write(p *packet.Packet) error {
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+
+	if pk.closed {
+		return fmt.Errorf("hls packager closed")
+	}
+
+	// Mixer会修改p.Media, 使用副本避免影响调用方缓存的数据包
+	q := *p
+
+	switch q.Type {
+	case packet.PktVideo:
+		vh, ok := q.Header.(packet.VideoPacketHeader)
+		if !ok {
+			return fmt.Errorf("invalid video packet header")
+		}
+
+		if vh.IsSeqHdr() {
+			pk.hasVideo = true
+			return pk.saveHeader(pk.mixer.SaveAVCHeader(&q))
+		}
+
+		err := pk.cut(q.TimeStamp, vh.IsKeyFrame())
+		if err != nil {
+			return err
+		}
+
+		return pk.mux(&q, uint32(vh.CompositionTime()))
+	case packet.PktAudio:
+		ah, ok := q.Header.(packet.AudioPacketHeader)
+		if !ok {
+			return fmt.Errorf("invalid audio packet header")
+		}
+
+		if ah.IsSoundAAC() && ah.IsAACSeqHdr() {
+			return pk.saveHeader(pk.mixer.SaveAACHeader(&q))
+		}
+
+		// 纯音频流按时长切片
+		if !pk.hasVideo {
+			err := pk.cut(q.TimeStamp, true)
+			if err != nil {
+				return err
+			}
+		}
+
+		return pk.mux(&q, 0)
+	}
+
+	// 元数据等其他数据包不写入切片
+	return nil
+}
+
+// Close 结束当前切片, 并在播放列表中写入 EXT-X-ENDLIST
+func (pk *Packager) Close() error {
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+
+	if pk.closed {
+		return nil
+	}
+
+	err := pk.finishSegment(pk.endTs())
+	pk.closed = true
+	if err != nil {
+		return err
+	}
+
+	return pk.writePlaylist()
+}
+
+// 切片开始后才收到的序列头可能带来新的流类型, 重新输出 PAT/PMT
+func (pk *Packager) saveHeader(err error) error {
+	if err != nil || pk.current == nil {
+		return err
+	}
+
+	return pk.mixer.SetTsHeader()
+}
+
+// 视频帧或纯音频流的音频帧到达时, 判断是否需要切片; 只在独立帧(视频关键帧或音频帧)处开始新的切片
+func (pk *Packager) cut(ts uint32, independent bool) error {
+	// 时间戳回退, 视为不连续
+	if pk.current != nil && ts < pk.lastTs {
+		pk.discontinuity = true
+		err := pk.finishSegment(pk.endTs())
+		if err != nil {
+			return err
+		}
+	}
+
+	if pk.current != nil {
+		if ts > pk.lastFrameTs {
+			pk.frameDuration = ts - pk.lastFrameTs
+		}
+		pk.lastFrameTs = ts
+
+		elapsed := time.Duration(ts-pk.startTs) * time.Millisecond
+		if !independent || elapsed < pk.cfg.TargetDuration {
+			return pk.cutPart(ts, independent)
+		}
+
+		err := pk.finishSegment(ts)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !independent {
+		return nil
+	}
+
+	return pk.startSegment(ts)
+}
+
+// 部分切片的时长不能超过目标时长: 按最近的帧间隔估计, 加入当前帧后会超过目标时长时, 在当前帧处开始新的部分切片
+func (pk *Packager) cutPart(ts uint32, independent bool) error {
+	if pk.cfg.PartTarget <= 0 {
+		return nil
+	}
+
+	var interval uint32
+	if ts > pk.frameTs {
+		interval = ts - pk.frameTs
+	}
+	pk.frameTs = ts
+
+	elapsed := time.Duration(ts-pk.partTs+interval) * time.Millisecond
+	if ts == pk.partTs || elapsed <= pk.cfg.PartTarget {
+		return nil
+	}
+
+	err := pk.finishPart(ts)
+	if err != nil {
+		return err
+	}
+
+	pk.startPart(ts, independent)
+	return pk.writePlaylist()
+}
+
+// 开始新的切片, 切片以 PAT/PMT 开始
+func (pk *Packager) startSegment(ts uint32) error {
+	key, err := pk.rotateKey(pk.seq)
+	if err != nil {
+		return err
+	}
+
+	// SAMPLE-AES 在复用时加密, 每个切片使用各自的初始向量
+	if pk.cfg.Encryption == m3u8.KeyMethodSampleAES {
+		err = pk.mixer.SetSampleAES(key.Key, key.iv(pk.seq))
+		if err != nil {
+			return err
+		}
+	}
+
+	pk.buf.Reset()
+
+	pk.current = &segment{
+		name:          fmt.Sprintf("%s%d.ts", pk.cfg.SegmentPrefix, pk.seq),
+		seq:           pk.seq,
+		discontinuity: pk.discontinuity && pk.seq > 0,
+		dateTime:      pk.now(),
+		key:           key,
+	}
+	pk.seq++
+	pk.discontinuity = false
+	pk.startTs = ts
+	pk.lastTs = ts
+	pk.lastFrameTs = ts
+	pk.startPart(ts, true)
+
+	return pk.mixer.SetTsHeader()
+}
+
+// 返回序号为seq的切片使用的密钥, 首个切片或到达更换周期时向 KeyProvider 获取新的密钥
+func (pk *Packager) rotateKey(seq uint64) (*Key, error) {
+	switch pk.cfg.Encryption {
+	case "", m3u8.KeyMethodNone:
+		return nil, nil
+	case m3u8.KeyMethodAES128, m3u8.KeyMethodSampleAES:
+	default:
+		return nil, fmt.Errorf("unsupported encryption method(%s)", pk.cfg.Encryption)
+	}
+
+	if pk.key != nil && (pk.cfg.KeyRotation <= 0 || seq-pk.keySeq < uint64(pk.cfg.KeyRotation)) {
+		return pk.key, nil
+	}
+
+	if pk.cfg.KeyProvider == nil {
+		return nil, fmt.Errorf("missing key provider")
+	}
+
+	key, err := pk.cfg.KeyProvider.Key(seq)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, fmt.Errorf("no key for segment %d", seq)
+	}
+
+	err = key.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	pk.key = key
+	pk.keySeq = seq
+	return key, nil
+}
+
+// AES-128 整段加密切片数据; 部分切片各自独立加密, 使用所属切片的初始向量
+func (pk *Packager) encrypt(seg *segment, data []byte) ([]byte, error) {
+	if pk.cfg.Encryption != m3u8.KeyMethodAES128 || seg.key == nil {
+		return data, nil
+	}
+
+	return encryptAES128(seg.key.Key, seg.key.iv(seg.seq), data)
+}
+
+func (pk *Packager) startPart(ts uint32, independent bool) {
+	pk.partStart = pk.buf.Len()
+	pk.partTs = ts
+	pk.partIndependent = independent
+	pk.frameTs = ts
+}
+
+// 当前切片的结束时间: 最后一帧的时间戳加上帧间隔, 不早于最近一个包的时间戳
+func (pk *Packager) endTs() uint32 {
+	end := pk.lastFrameTs + pk.frameDuration
+	if end < pk.lastTs {
+		end = pk.lastTs
+	}
+	return end
+}
+
+// 写入音视频数据, 尚未开始切片(等待首个关键帧)时丢弃
+func (pk *Packager) mux(p *packet.Packet, cts uint32) error {
+	if pk.current == nil {
+		return nil
+	}
+
+	err := pk.mixer.Update(p, p.TimeStamp, cts)
+	if err != nil {
+		return err
+	}
+
+	err = pk.mixer.Mux(p)
+	if err != nil {
+		return err
+	}
+
+	if p.TimeStamp > pk.lastTs {
+		pk.lastTs = p.TimeStamp
+	}
+
+	return nil
+}
+
+// 结束当前部分切片并写入存储
+func (pk *Packager) finishPart(endTs uint32) error {
+	seg := pk.current
+	if seg == nil || pk.cfg.PartTarget <= 0 || pk.partStart >= pk.buf.Len() {
+		return nil
+	}
+
+	pt := &part{
+		name:        fmt.Sprintf("%s%d.%d.ts", pk.cfg.SegmentPrefix, seg.seq, len(seg.parts)),
+		independent: pk.partIndependent,
+	}
+	if endTs > pk.partTs {
+		pt.duration = float64(endTs-pk.partTs) / 1000
+	}
+
+	data, err := pk.encrypt(seg, pk.buf.Bytes()[pk.partStart:])
+	if err != nil {
+		return err
+	}
+
+	err = pk.storage.Write(pt.name, data)
+	if err != nil {
+		return err
+	}
+
+	seg.parts = append(seg.parts, pt)
+	pk.partStart = pk.buf.Len()
+	return nil
+}
+
+// 结束当前切片: 写入存储, 更新播放列表, 删除移出窗口的切片
+func (pk *Packager) finishSegment(endTs uint32) error {
+	seg := pk.current
+	if seg == nil {
+		return nil
+	}
+
+	err := pk.finishPart(endTs)
+	if err != nil {
+		return err
+	}
+	pk.current = nil
+
+	if endTs > pk.startTs {
+		seg.duration = float64(endTs-pk.startTs) / 1000
+	}
+
+	data, err := pk.encrypt(seg, pk.buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	err = pk.storage.Write(seg.name, data)
+	if err != nil {
+		return err
+	}
+
+	pk.segments = append(pk.segments, seg)
+	pk.completed = seg.seq + 1
+	if int(math.Round(seg.duration)) > pk.targetDuration && pk.cfg.OnLongSegment != nil {
+		pk.cfg.OnLongSegment(seg.name, time.Duration(seg.duration*float64(time.Second)))
+	}
+
+	for len(pk.segments) > pk.cfg.WindowSize {
+		old := pk.segments[0]
+		pk.segments = pk.segments[1:]
+
+		// 移出窗口的切片带有 EXT-X-DISCONTINUITY 时计数
+		if old.discontinuity {
+			pk.discSeq++
+		}
+
+		err = pk.removeParts(old)
+		if err != nil {
+			return err
+		}
+
+		err = pk.storage.Remove(old.name)
+		if err != nil {
+			return err
+		}
+	}
+
+	// 远离直播边缘的切片不再列出部分切片
+	var elapsed float64
+	for i := len(pk.segments) - 1; i >= 0; i-- {
+		if elapsed > float64(partHoldSegments*pk.targetDuration) {
+			err = pk.removeParts(pk.segments[i])
+			if err != nil {
+				return err
+			}
+		}
+		elapsed += pk.segments[i].duration
+	}
+
+	return pk.writePlaylist()
+}
+
+func (pk *Packager) removeParts(seg *segment) error {
+	for _, pt := range seg.parts {
+		err := pk.storage.Remove(pt.name)
+		if err != nil {
+			return err
+		}
+	}
+
+	seg.parts = nil
+	return nil
+}
+
+// 生成并写入媒体播放列表, 唤醒等待播放列表更新的请求
+func (pk *Packager) writePlaylist() error {
+	err := pk.storage.Write(pk.cfg.PlaylistName, []byte(pk.playlist()))
+	if err != nil {
+		return err
+	}
+
+	close(pk.updated)
+	pk.updated = make(chan struct{})
+	return nil
+}
+
+// 下一个部分切片的文件名, 用于 EXT-X-PRELOAD-HINT
+func (pk *Packager) preloadHint() string {
+	if pk.cfg.PartTarget <= 0 || pk.current == nil || pk.closed {
+		return ""
+	}
+
+	return fmt.Sprintf("%s%d.%d.ts", pk.cfg.SegmentPrefix, pk.current.seq, len(pk.current.parts))
+}
+
+// 检查播放列表是否已包含序号为msn的切片(partIdx<0)或其第partIdx个部分切片;
+// 未包含时返回播放列表下次更新时关闭的通道
+func (pk *Packager) ready(msn uint64, partIdx int) (bool, <-chan struct{}) {
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+
+	if pk.closed || msn < pk.completed {
+		return true, nil
+	}
+
+	if partIdx >= 0 && pk.current != nil {
+		if pk.current.seq > msn || (pk.current.seq == msn && partIdx < len(pk.current.parts)) {
+			return true, nil
+		}
+	}
+
+	return false, pk.updated
+}
+
+// 检查文件是否是尚未生成的预加载部分切片; 是则返回播放列表下次更新时关闭的通道
+func (pk *Packager) pending(name string) (bool, <-chan struct{}) {
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+
+	if name == "" || name != pk.preloadHint() {
+		return false, nil
+	}
+
+	return true, pk.updated
+}
+
+// 最新切片的序号, 以及是否已有切片
+func (pk *Packager) lastSeq() (uint64, bool) {
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+
+	if pk.seq == 0 {
+		return 0, false
+	}
+
+	return pk.seq - 1, true
+}
+
+func (pk *Packager) playlist() string {
+	p := &m3u8.MediaPlaylist{
+		Version:               3,
+		TargetDuration:        int64(pk.targetDuration),
+		DiscontinuitySequence: pk.discSeq,
+		EndList:               pk.closed,
+	}
+
+	// SAMPLE-AES 需要版本5
+	if pk.cfg.Encryption == m3u8.KeyMethodSampleAES {
+		p.Version = 5
+	}
+
+	lowLatency := pk.cfg.PartTarget > 0
+	if lowLatency {
+		p.Version = 6
+		p.PartTarget = pk.cfg.PartTarget.Seconds()
+		p.ServerControl = &m3u8.ServerControl{
+			CanBlockReload: true,
+			PartHoldBack:   3 * p.PartTarget,
+		}
+	}
+
+	if len(pk.segments) > 0 {
+		p.MediaSequence = pk.segments[0].seq
+	} else if pk.current != nil {
+		p.MediaSequence = pk.current.seq
+	}
+
+	var key *Key
+	for _, seg := range pk.segments {
+		p.Segments = append(p.Segments, pk.mediaSegment(seg, key))
+		key = seg.key
+	}
+
+	// 正在写入的切片只列出已完成的部分切片
+	if lowLatency && pk.current != nil && !pk.closed {
+		p.Segments = append(p.Segments, pk.mediaSegment(pk.current, key))
+		p.PreloadHints = []*m3u8.PreloadHint{{Type: "PART", URI: pk.preloadHint()}}
+	}
+
+	return p.String()
+}
+
+// 转换为播放列表中的切片, 正在写入的切片没有URI; 密钥与上一个切片(prev)不同时写入 EXT-X-KEY
+func (pk *Packager) mediaSegment(seg *segment, prev *Key) *m3u8.Segment {
+	s := &m3u8.Segment{
+		Duration:      seg.duration,
+		Discontinuity: seg.discontinuity,
+	}
+	if seg != pk.current {
+		s.URI = seg.name
+	}
+	if pk.cfg.ProgramDateTime {
+		s.ProgramDateTime = seg.dateTime
+	}
+	if seg.key != nil && seg.key != prev {
+		s.Keys = []*m3u8.Key{{
+			Method: pk.cfg.Encryption,
+			URI:    seg.key.URI,
+			IV:     seg.key.IV,
+		}}
+	}
+
+	for _, pt := range seg.parts {
+		s.Parts = append(s.Parts, &m3u8.Part{
+			URI:         pt.name,
+			Duration:    pt.duration,
+			Independent: pt.independent,
+		})
+	}
+
+	return s
+}
@@ -0,0 +1,290 @@
+package hls
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moggle-mog/goav/container/flv"
+	"github.com/moggle-mog/goav/hls/m3u8"
+	"github.com/moggle-mog/goav/internal/testutil"
+	"github.com/moggle-mog/goav/packet"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testSps = []byte{0x67, 0x4d, 0x00, 0x1e, 0xab, 0x40, 0x5a, 0x12, 0x6c, 0x09, 0x28, 0x28, 0x28, 0x2f, 0x80, 0x00, 0x01, 0xf4, 0x00, 0x00, 0x61, 0xa8, 0x4a}
+	testPps = []byte{0x68, 0xde, 0x31, 0x12}
+	testIdr = []byte{0x65, 0x88, 0x84}
+	testP   = []byte{0x41, 0x9a, 0x02}
+
+	// 1帧 AAC LC, 44100, 双声道
+	testAdts = []byte{0xff, 0xf1, 0x50, 0x80, 0x01, 0x5f, 0xfc, 0x21, 0x00, 0x49}
+)
+
+// 生成duration毫秒的音视频数据包, 视频25fps, 每gop毫秒一个关键帧
+func testPackets(t *testing.T, start, duration, gop uint32, audio bool) []*packet.Packet {
+	avc := flv.NewAvcPacker()
+	aac := flv.NewAacPacker()
+
+	var pkts []*packet.Packet
+	for ts := start; ts < start+duration; ts += 40 {
+		frame := testutil.JoinAnnexb(testP)
+		if (ts-start)%gop == 0 {
+			frame = testutil.JoinAnnexb(testSps, testPps, testIdr)
+		}
+
+		ps, err := avc.Pack(frame, ts, ts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkts = append(pkts, ps...)
+
+		if audio {
+			ps, err = aac.Pack(testAdts, ts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pkts = append(pkts, ps...)
+		}
+	}
+
+	return pkts
+}
+
+func testPlaylist(t *testing.T, s *MemoryStorage) string {
+	b, ok := s.Get(defaultPlaylistName)
+	if !ok {
+		t.Fatal("playlist not found")
+	}
+	return string(b)
+}
+
+func TestPackager_Write(t *testing.T) {
+	at := assert.New(t)
+
+	s := NewMemoryStorage()
+	pk := NewPackager(s, Config{
+		TargetDuration: 4 * time.Second,
+		WindowSize:     2,
+	})
+
+	// 2秒一个关键帧, 共10秒, 4秒切片
+	for _, p := range testPackets(t, 0, 10000, 2000, true) {
+		at.Nil(pk.Write(p))
+	}
+
+	// case1: 在关键帧处切片
+	seg, ok := s.Get("segment0.ts")
+	at.True(ok)
+	at.Equal(0, len(seg)%188)
+
+	// case2: 每个切片以 SDT/PAT/PMT 开始
+	at.Equal(byte(0x47), seg[0])
+	at.Equal([]byte{0x40, 0x11}, seg[1:3])
+	at.Equal([]byte{0x40, 0x00}, seg[188+1:188+3])
+	at.Equal([]byte{0x50, 0x01}, seg[376+1:376+3])
+
+	at.Equal("#EXTM3U\n"+
+		"#EXT-X-VERSION:3\n"+
+		"#EXT-X-TARGETDURATION:4\n"+
+		"#EXT-X-MEDIA-SEQUENCE:0\n"+
+		"#EXTINF:4.000,\nsegment0.ts\n"+
+		"#EXTINF:4.000,\nsegment1.ts\n", testPlaylist(t, s))
+
+	// case3: 结束时输出最后一个切片和 EXT-X-ENDLIST, 窗口外的切片被删除
+	at.Nil(pk.Close())
+
+	_, ok = s.Get("segment0.ts")
+	at.False(ok)
+	at.Equal("#EXTM3U\n"+
+		"#EXT-X-VERSION:3\n"+
+		"#EXT-X-TARGETDURATION:4\n"+
+		"#EXT-X-MEDIA-SEQUENCE:1\n"+
+		"#EXTINF:4.000,\nsegment1.ts\n"+
+		"#EXTINF:2.000,\nsegment2.ts\n"+
+		"#EXT-X-ENDLIST\n", testPlaylist(t, s))
+
+	at.NotNil(pk.Write(&packet.Packet{}))
+}
+
+func TestPackager_Discontinuity(t *testing.T) {
+	at := assert.New(t)
+
+	now := time.Date(2020, 1, 2, 3, 4, 5, 6000000, time.UTC)
+
+	s := NewMemoryStorage()
+	pk := NewPackager(s, Config{
+		TargetDuration:  2 * time.Second,
+		WindowSize:      3,
+		ProgramDateTime: true,
+	})
+	pk.now = func() time.Time {
+		return now
+	}
+
+	// case1: 等待首个关键帧
+	pkts := testPackets(t, 0, 4000, 2000, false)
+	for _, p := range pkts[2:51] {
+		at.Nil(pk.Write(p))
+	}
+	_, ok := s.Get(defaultPlaylistName)
+	at.False(ok)
+
+	for _, p := range pkts {
+		at.Nil(pk.Write(p))
+	}
+
+	// case2: 时间戳回退, 自动插入 EXT-X-DISCONTINUITY
+	for _, p := range testPackets(t, 0, 4000, 2000, false) {
+		at.Nil(pk.Write(p))
+	}
+	at.Nil(pk.Close())
+
+	playlist := testPlaylist(t, s)
+	at.Equal("#EXTM3U\n"+
+		"#EXT-X-VERSION:3\n"+
+		"#EXT-X-TARGETDURATION:2\n"+
+		"#EXT-X-MEDIA-SEQUENCE:1\n"+
+		"#EXT-X-PROGRAM-DATE-TIME:2020-01-02T03:04:05.006Z\n"+
+		"#EXTINF:2.000,\nsegment1.ts\n"+
+		"#EXT-X-DISCONTINUITY\n"+
+		"#EXT-X-PROGRAM-DATE-TIME:2020-01-02T03:04:05.006Z\n"+
+		"#EXTINF:2.000,\nsegment2.ts\n"+
+		"#EXT-X-PROGRAM-DATE-TIME:2020-01-02T03:04:05.006Z\n"+
+		"#EXTINF:2.000,\nsegment3.ts\n"+
+		"#EXT-X-ENDLIST\n", playlist)
+
+	// case3: 带 EXT-X-DISCONTINUITY 的切片移出窗口后, 增加 EXT-X-DISCONTINUITY-SEQUENCE
+	pk = NewPackager(s, Config{TargetDuration: time.Second, WindowSize: 1})
+	for _, p := range testPackets(t, 0, 2000, 1000, false) {
+		at.Nil(pk.Write(p))
+	}
+	at.Nil(pk.Discontinuity())
+
+	// 带 EXT-X-DISCONTINUITY 的切片成为窗口中的第一个切片时, 还不计数
+	checked := false
+	for _, p := range testPackets(t, 5000, 3000, 1000, false) {
+		at.Nil(pk.Write(p))
+
+		playlist = testPlaylist(t, s)
+		if !checked && strings.Contains(playlist, "#EXT-X-MEDIA-SEQUENCE:2\n") {
+			checked = true
+			at.True(strings.Contains(playlist, "#EXT-X-DISCONTINUITY\n"), playlist)
+			at.False(strings.Contains(playlist, "#EXT-X-DISCONTINUITY-SEQUENCE:"), playlist)
+		}
+	}
+	at.True(checked)
+
+	playlist = testPlaylist(t, s)
+	at.True(strings.Contains(playlist, "#EXT-X-MEDIA-SEQUENCE:3\n"), playlist)
+	at.True(strings.Contains(playlist, "#EXT-X-DISCONTINUITY-SEQUENCE:1\n"), playlist)
+	at.False(strings.Contains(playlist, "#EXT-X-DISCONTINUITY\n"), playlist)
+}
+
+func TestPackager_LongSegment(t *testing.T) {
+	at := assert.New(t)
+
+	var long []string
+	s := NewMemoryStorage()
+	pk := NewPackager(s, Config{
+		TargetDuration: 2 * time.Second,
+		OnLongSegment: func(name string, duration time.Duration) {
+			long = append(long, fmt.Sprintf("%s:%v", name, duration))
+		},
+	})
+
+	// 关键帧间隔3秒, 大于目标时长
+	for _, p := range testPackets(t, 0, 6000, 3000, true) {
+		at.Nil(pk.Write(p))
+	}
+	at.Nil(pk.Close())
+
+	// case1: EXT-X-TARGETDURATION 保持配置的值, 过长的切片通过回调报告
+	at.Equal("#EXTM3U\n"+
+		"#EXT-X-VERSION:3\n"+
+		"#EXT-X-TARGETDURATION:2\n"+
+		"#EXT-X-MEDIA-SEQUENCE:0\n"+
+		"#EXTINF:3.000,\nsegment0.ts\n"+
+		"#EXTINF:3.000,\nsegment1.ts\n"+
+		"#EXT-X-ENDLIST\n", testPlaylist(t, s))
+	at.Equal([]string{"segment0.ts:3s", "segment1.ts:3s"}, long)
+}
+
+func TestPackager_AudioOnly(t *testing.T) {
+	at := assert.New(t)
+
+	s := NewMemoryStorage()
+	pk := NewPackager(s, Config{TargetDuration: time.Second})
+
+	aac := flv.NewAacPacker()
+	for i := 0; i < 100; i++ {
+		pkts, err := aac.Pack(testAdts, uint32(i*23))
+		at.Nil(err)
+		for _, p := range pkts {
+			at.Nil(pk.Write(p))
+		}
+	}
+	at.Nil(pk.Close())
+
+	// case1: 纯音频流按时长切片
+	playlist := testPlaylist(t, s)
+	at.True(strings.HasPrefix(playlist, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:1\n#EXT-X-MEDIA-SEQUENCE:0\n#EXTINF:1.012,\nsegment0.ts\n"), playlist)
+
+	seg, ok := s.Get("segment0.ts")
+	at.True(ok)
+	at.True(len(seg) > 3*188)
+}
+
+func TestPackager_LowLatency(t *testing.T) {
+	at := assert.New(t)
+
+	s := NewMemoryStorage()
+	pk := NewPackager(s, Config{
+		TargetDuration: 2 * time.Second,
+		PartTarget:     500 * time.Millisecond,
+	})
+
+	// 1秒一个关键帧, 共2.6秒
+	for _, p := range testPackets(t, 0, 2600, 1000, false) {
+		at.Nil(pk.Write(p))
+	}
+
+	// case1: 部分切片在帧边界处切分且不超过目标时长, 以关键帧开始的部分切片标记 INDEPENDENT
+	at.Equal("#EXTM3U\n"+
+		"#EXT-X-VERSION:6\n"+
+		"#EXT-X-TARGETDURATION:2\n"+
+		"#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=1.500\n"+
+		"#EXT-X-PART-INF:PART-TARGET=0.500\n"+
+		"#EXT-X-MEDIA-SEQUENCE:0\n"+
+		"#EXT-X-PART:DURATION=0.480,URI=\"segment0.0.ts\",INDEPENDENT=YES\n"+
+		"#EXT-X-PART:DURATION=0.480,URI=\"segment0.1.ts\"\n"+
+		"#EXT-X-PART:DURATION=0.480,URI=\"segment0.2.ts\"\n"+
+		"#EXT-X-PART:DURATION=0.480,URI=\"segment0.3.ts\"\n"+
+		"#EXT-X-PART:DURATION=0.080,URI=\"segment0.4.ts\"\n"+
+		"#EXTINF:2.000,\nsegment0.ts\n"+
+		"#EXT-X-PART:DURATION=0.480,URI=\"segment1.0.ts\",INDEPENDENT=YES\n"+
+		"#EXT-X-PRELOAD-HINT:TYPE=PART,URI=\"segment1.1.ts\"\n", testPlaylist(t, s))
+
+	// case2: 播放列表符合目标时长的约束
+	pl, err := m3u8.ParseMedia([]byte(testPlaylist(t, s)))
+	at.Nil(err)
+	at.Nil(pl.Validate())
+
+	// case3: 部分切片拼接后与切片相同
+	var joined []byte
+	for i := 0; i < 5; i++ {
+		b, ok := s.Get("segment0." + string(rune('0'+i)) + ".ts")
+		at.True(ok)
+		joined = append(joined, b...)
+	}
+	seg, _ := s.Get("segment0.ts")
+	at.Equal(seg, joined)
+
+	// case4: 结束时不再输出 EXT-X-PRELOAD-HINT
+	at.Nil(pk.Close())
+	playlist := testPlaylist(t, s)
+	at.False(strings.Contains(playlist, "PRELOAD-HINT"), playlist)
+	at.True(strings.HasSuffix(playlist, "#EXTINF:0.600,\nsegment1.ts\n#EXT-X-ENDLIST\n"), playlist)
+}
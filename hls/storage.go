@@ -0,0 +1,139 @@
+// Package hls 将音视频数据包打包为HLS切片和播放列表
+package hls
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Storage 切片和播放列表的存储接口
+type Storage interface {
+	// Write 写入(覆盖)名为name的文件
+	Write(name string, data []byte) error
+	// Remove 删除名为name的文件
+	Remove(name string) error
+}
+
+// Reader 读取已写入的文件, 供 Handler 使用
+type Reader interface {
+	// Get 读取名为name的文件, 不存在时返回false
+	Get(name string) ([]byte, bool)
+}
+
+// FileStorage 将文件写入本地目录
+type FileStorage struct {
+	dir string
+}
+
+// NewFileStorage 文件存储, 目录不存在时自动创建
+func NewFileStorage(dir string) (*FileStorage, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileStorage{
+		dir: dir,
+	}, nil
+}
+
+// Write 先写入临时文件再重命名, 避免读取到不完整的播放列表
+func (s *FileStorage) Write(name string, data []byte) error {
+	path := filepath.Join(s.dir, name)
+
+	tmp, err := ioutil.TempFile(s.dir, "."+name+".tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	err = os.Chmod(tmp.Name(), 0644)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Remove 删除文件, 文件不存在时不视为错误
+func (s *FileStorage) Remove(name string) error {
+	err := os.Remove(filepath.Join(s.dir, name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// Get 读取文件
+func (s *FileStorage) Get(name string) ([]byte, bool) {
+	b, err := ioutil.ReadFile(filepath.Join(s.dir, filepath.Base(name)))
+	if err != nil {
+		return nil, false
+	}
+
+	return b, true
+}
+
+// MemoryStorage 将文件保存在内存中, 可并发读写
+type MemoryStorage struct {
+	mu    sync.RWMutex
+	files map[string][]byte
+}
+
+// NewMemoryStorage 内存存储
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		files: make(map[string][]byte),
+	}
+}
+
+// Write 保存数据的副本
+func (s *MemoryStorage) Write(name string, data []byte) error {
+	if name == "" {
+		return errors.New("empty file name")
+	}
+
+	b := make([]byte, len(data))
+	copy(b, data)
+
+	s.mu.Lock()
+	s.files[name] = b
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Remove 删除文件
+func (s *MemoryStorage) Remove(name string) error {
+	s.mu.Lock()
+	delete(s.files, name)
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Get 读取文件, 返回的数据不可修改
+func (s *MemoryStorage) Get(name string) ([]byte, bool) {
+	s.mu.RLock()
+	b, ok := s.files[name]
+	s.mu.RUnlock()
+
+	return b, ok
+}
@@ -0,0 +1,65 @@
+package hls
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStorage(t *testing.T) {
+	at := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "hls")
+	at.Nil(err)
+	defer os.RemoveAll(dir)
+
+	// case1: 目录不存在时自动创建
+	s, err := NewFileStorage(filepath.Join(dir, "live"))
+	at.Nil(err)
+
+	// case2: 写入并覆盖
+	at.Nil(s.Write("index.m3u8", []byte("a")))
+	at.Nil(s.Write("index.m3u8", []byte("b")))
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "live", "index.m3u8"))
+	at.Nil(err)
+	at.Equal([]byte("b"), b)
+
+	// case3: 不残留临时文件
+	files, err := ioutil.ReadDir(filepath.Join(dir, "live"))
+	at.Nil(err)
+	at.Len(files, 1)
+
+	// case4: 删除, 重复删除不报错
+	at.Nil(s.Remove("index.m3u8"))
+	at.Nil(s.Remove("index.m3u8"))
+
+	_, err = os.Stat(filepath.Join(dir, "live", "index.m3u8"))
+	at.True(os.IsNotExist(err))
+}
+
+func TestMemoryStorage(t *testing.T) {
+	at := assert.New(t)
+
+	s := NewMemoryStorage()
+
+	// case1: 保存数据的副本
+	data := []byte{0x01, 0x02}
+	at.Nil(s.Write("a.ts", data))
+	data[0] = 0xff
+
+	b, ok := s.Get("a.ts")
+	at.True(ok)
+	at.Equal([]byte{0x01, 0x02}, b)
+
+	// case2: 删除
+	at.Nil(s.Remove("a.ts"))
+	_, ok = s.Get("a.ts")
+	at.False(ok)
+
+	// case3: 文件名为空
+	at.NotNil(s.Write("", nil))
+}
@@ -0,0 +1,12 @@
+// Package testutil 各个包的测试共用的辅助函数
+package testutil
+
+// JoinAnnexb 在每个nalu前加上4字节的start code, 拼接为Annex-b格式的数据
+func JoinAnnexb(nalus ...[]byte) []byte {
+	var b []byte
+	for _, nalu := range nalus {
+		b = append(b, 0x00, 0x00, 0x00, 0x01)
+		b = append(b, nalu...)
+	}
+	return b
+}
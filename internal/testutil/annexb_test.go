@@ -0,0 +1,15 @@
+package testutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJoinAnnexb(t *testing.T) {
+	at := assert.New(t)
+
+	b := JoinAnnexb([]byte{0x09, 0xf0}, []byte{0x65, 0x88})
+	at.Equal([]byte{0x00, 0x00, 0x00, 0x01, 0x09, 0xf0, 0x00, 0x00, 0x00, 0x01, 0x65, 0x88}, b)
+	at.Empty(JoinAnnexb())
+}
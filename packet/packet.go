@@ -15,6 +15,22 @@ const (
 	PktMetadata        // 元数据包
 )
 
+// Enhanced FLV 视频包类型, 即 VideoPacketHeader.PacketType 的返回值
+const (
+	// ExSequenceStart 序列头(0)
+	ExSequenceStart = iota
+	// ExCodedFrames 带CompositionTime的视频帧(1)
+	ExCodedFrames
+	// ExSequenceEnd 序列结束(2)
+	ExSequenceEnd
+	// ExCodedFramesX CompositionTime为0的视频帧(3)
+	ExCodedFramesX
+	// ExMetadata AMF格式的视频元数据(4)
+	ExMetadata
+	// ExMPEG2TSSequenceStart MPEG2-TS格式的序列头(5)
+	ExMPEG2TSSequenceStart
+)
+
 // Packet Header can be converted to AudioHeaderInfo or VideoHeaderInfo
 type Packet struct {
 	Type      int    // 音频, 视频, 元数据, 其它
@@ -47,8 +63,12 @@ type VideoPacketHeader interface {
 	IsSeqHdr() bool
 	IsEndOfSeq() bool
 	IsCodecAvc() bool
+	IsCodecHevc() bool
 	CodecID() uint8
 	CompositionTime() int32
+	IsExHeader() bool
+	PacketType() uint8
+	FourCC() uint32
 }
 
 // Reader 通用读接口
@@ -0,0 +1,173 @@
+package aac
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ADTSHeader adts帧头 adts_fixed_header( ) + adts_variable_header( )
+type ADTSHeader struct {
+	MPEG2            bool // ID, true: MPEG-2, false: MPEG-4
+	ProtectionAbsent bool // protection_absent, false 时带有CRC
+	ObjectType       int  // profile_ObjectType + 1
+	SampleRateIndex  int  // sampling_frequency_index
+	ChannelConfig    int  // channel_configuration
+	FrameLength      int  // aac_frame_length, 包含adts头
+	BufferFullness   int  // adts_buffer_fullness, 0x7ff 表示可变码率
+	RawDataBlocks    int  // number_of_raw_data_blocks_in_frame + 1
+}
+
+// HeaderLength adts头的长度, 带有CRC及多个 raw_data_block 时包含 raw_data_block_position 和 crc_check
+func (h *ADTSHeader) HeaderLength() int {
+	if h.ProtectionAbsent {
+		return adtsHeaderLen
+	}
+
+	return adtsHeaderLen + 2*(h.RawDataBlocks-1) + 2
+}
+
+// SampleRate 采样率
+func (h *ADTSHeader) SampleRate() int {
+	return aacRates[h.SampleRateIndex]
+}
+
+// AudioSpecificConfig 根据adts头生成2字节的 AudioSpecificConfig, 用于flv的AAC序列头
+func (h *ADTSHeader) AudioSpecificConfig() []byte {
+	return []byte{
+		byte(h.ObjectType<<3) | byte(h.SampleRateIndex>>1),
+		byte(h.SampleRateIndex<<7) | byte(h.ChannelConfig<<3),
+	}
+}
+
+// ParseADTSHeader 解析adts帧头
+func ParseADTSHeader(b []byte) (*ADTSHeader, error) {
+	if len(b) < adtsHeaderLen {
+		return nil, errors.New("incomplete adts header, len(b)<7")
+	}
+
+	// syncword: 0xfff, layer: 0
+	if b[0] != 0xff || b[1]&0xf6 != 0xf0 {
+		return nil, errors.New("invalid adts syncword or layer")
+	}
+
+	h := &ADTSHeader{
+		MPEG2:            b[1]&0x08 != 0,
+		ProtectionAbsent: b[1]&0x01 != 0,
+		ObjectType:       int(b[2]>>6) + 1,
+		SampleRateIndex:  int(b[2]>>2) & 0xf,
+		ChannelConfig:    int(b[2]&0x1)<<2 | int(b[3]>>6),
+		FrameLength:      int(b[3]&0x3)<<11 | int(b[4])<<3 | int(b[5]>>5),
+		BufferFullness:   int(b[5]&0x1f)<<6 | int(b[6]>>2),
+		RawDataBlocks:    int(b[6]&0x3) + 1,
+	}
+
+	if h.SampleRateIndex >= len(aacRates) {
+		return nil, fmt.Errorf("invalid adts sampling frequency index(%d)", h.SampleRateIndex)
+	}
+	if h.FrameLength < h.HeaderLength() {
+		return nil, fmt.Errorf("invalid adts frame length(%d)", h.FrameLength)
+	}
+
+	return h, nil
+}
+
+// ADTSFrame 去除adts头后的adts帧
+type ADTSFrame struct {
+	Header *ADTSHeader
+	Blocks [][]byte // raw_data_block, 即flv中的AAC raw数据
+}
+
+// SplitADTS 从b中扫描连续的adts帧, 去除adts头和CRC, 返回完整的帧和已消费的字节数
+// 帧之间的无效数据会被跳过, 末尾不完整的帧不会被消费; checkCRC 为true时校验带有多个 raw_data_block 的帧的
+// adts_header_error_check, 单个 raw_data_block 的CRC覆盖部分语法元素, 需要解码才能校验, 不做检查
+func SplitADTS(b []byte, checkCRC bool) ([]*ADTSFrame, int, error) {
+	var frames []*ADTSFrame
+
+	index := 0
+	for len(b)-index >= adtsHeaderLen {
+		h, err := ParseADTSHeader(b[index:])
+		if err != nil {
+			// 重新同步
+			index++
+			continue
+		}
+
+		if len(b)-index < h.FrameLength {
+			return frames, index, nil
+		}
+
+		frame, err := splitRawDataBlocks(b[index:index+h.FrameLength], h, checkCRC)
+		if err != nil {
+			return frames, index, err
+		}
+
+		frames = append(frames, frame)
+		index += h.FrameLength
+	}
+
+	// 剩余的数据不足一个adts头, 跳过不可能是syncword起始的字节
+	for index < len(b) && b[index] != 0xff {
+		index++
+	}
+
+	return frames, index, nil
+}
+
+// 按 raw_data_block_position 切分adts帧中的 raw_data_block
+func splitRawDataBlocks(b []byte, h *ADTSHeader, checkCRC bool) (*ADTSFrame, error) {
+	frame := &ADTSFrame{Header: h}
+	hdrLen := h.HeaderLength()
+
+	if h.RawDataBlocks == 1 {
+		frame.Blocks = [][]byte{b[hdrLen:]}
+		return frame, nil
+	}
+
+	// 不带CRC时无法确定 raw_data_block 的边界
+	if h.ProtectionAbsent {
+		return nil, errors.New("multiple raw data blocks without position info")
+	}
+
+	if checkCRC {
+		crc := uint16(b[hdrLen-2])<<8 | uint16(b[hdrLen-1])
+		if crc16(b[:hdrLen-2]) != crc {
+			return nil, errors.New("adts header crc mismatch")
+		}
+	}
+
+	// raw_data_block_position[i] 为第i个块相对于第一个块起始位置的偏移, 每个块后跟2字节的CRC
+	positions := []int{0}
+	for i := 1; i < h.RawDataBlocks; i++ {
+		pos := int(b[adtsHeaderLen+2*(i-1)])<<8 | int(b[adtsHeaderLen+2*(i-1)+1])
+		positions = append(positions, pos)
+	}
+	positions = append(positions, len(b)-hdrLen)
+
+	for i := 0; i < h.RawDataBlocks; i++ {
+		start, end := hdrLen+positions[i], hdrLen+positions[i+1]-2
+		if start >= end || end > len(b) {
+			return nil, fmt.Errorf("invalid raw data block position(%d)", positions[i])
+		}
+
+		frame.Blocks = append(frame.Blocks, b[start:end])
+	}
+
+	return frame, nil
+}
+
+// CRC-16, 多项式0x8005, 初始值0xffff
+func crc16(b []byte) uint16 {
+	crc := uint16(0xffff)
+	for _, v := range b {
+		crc ^= uint16(v) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x8005
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
@@ -0,0 +1,96 @@
+package aac
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 生成带有CRC和2个 raw_data_block 的adts帧
+func testMultiBlockADTS(b1, b2 []byte) []byte {
+	frameLen := 11 + len(b1) + 2 + len(b2) + 2
+
+	hdr := []byte{
+		0xff, 0xf0, 0x50, 0x80 | byte(frameLen>>11),
+		byte(frameLen >> 3), byte(frameLen<<5) | 0x1f, 0xfc | 0x01,
+		0x00, byte(len(b1) + 2),
+	}
+	crc := crc16(hdr)
+	hdr = append(hdr, byte(crc>>8), byte(crc))
+
+	frame := append(hdr, b1...)
+	frame = append(frame, 0x00, 0x00)
+	frame = append(frame, b2...)
+	return append(frame, 0x00, 0x00)
+}
+
+func TestParseADTSHeader(t *testing.T) {
+	at := assert.New(t)
+
+	h, err := ParseADTSHeader([]byte{0xff, 0xf1, 0x50, 0x80, 0x02, 0x1f, 0xfc})
+	at.Nil(err)
+	at.False(h.MPEG2)
+	at.True(h.ProtectionAbsent)
+	at.Equal(ObjectTypeLC, h.ObjectType)
+	at.Equal(44100, h.SampleRate())
+	at.Equal(2, h.ChannelConfig)
+	at.Equal(16, h.FrameLength)
+	at.Equal(0x7ff, h.BufferFullness)
+	at.Equal(1, h.RawDataBlocks)
+	at.Equal([]byte{0x12, 0x10}, h.AudioSpecificConfig())
+
+	// case1: syncword错误
+	_, err = ParseADTSHeader([]byte{0xff, 0xe1, 0x50, 0x80, 0x02, 0x1f, 0xfc})
+	at.NotNil(err)
+
+	// case2: 帧长度小于头长度
+	_, err = ParseADTSHeader([]byte{0xff, 0xf1, 0x50, 0x80, 0x00, 0x1f, 0xfc})
+	at.NotNil(err)
+}
+
+func TestSplitADTS(t *testing.T) {
+	at := assert.New(t)
+
+	d := NewParser()
+	w := bytes.NewBuffer(nil)
+	at.Nil(d.Parse([]byte{0x12, 0x10}, SeqHdr, w))
+	at.Nil(d.Parse([]byte{0x21, 0x00, 0x49}, Raw, w))
+	at.Nil(d.Parse([]byte{0x21, 0x10}, Raw, w))
+	adts := w.Bytes()
+
+	// case1: 帧之前的无效数据被跳过, 末尾不完整的帧不被消费
+	data := append([]byte{0x00, 0xff, 0x12}, adts...)
+	data = append(data, adts[:5]...)
+
+	frames, n, err := SplitADTS(data, true)
+	at.Nil(err)
+	at.Len(frames, 2)
+	at.Equal([][]byte{{0x21, 0x00, 0x49}}, frames[0].Blocks)
+	at.Equal([][]byte{{0x21, 0x10}}, frames[1].Blocks)
+	at.Equal(len(data)-5, n)
+
+	// case2: 多个 raw_data_block
+	multi := testMultiBlockADTS([]byte{0x21, 0x00, 0x49}, []byte{0x21, 0x10})
+	frames, n, err = SplitADTS(multi, true)
+	at.Nil(err)
+	at.Equal(len(multi), n)
+	at.Len(frames, 1)
+	at.Equal(2, frames[0].Header.RawDataBlocks)
+	at.Equal([][]byte{{0x21, 0x00, 0x49}, {0x21, 0x10}}, frames[0].Blocks)
+
+	// case3: CRC错误
+	multi[9] ^= 0xff
+	_, _, err = SplitADTS(multi, true)
+	at.NotNil(err)
+
+	frames, _, err = SplitADTS(multi, false)
+	at.Nil(err)
+	at.Len(frames, 1)
+
+	// case4: 没有syncword
+	frames, n, err = SplitADTS([]byte{0x01, 0x02, 0x03}, false)
+	at.Nil(err)
+	at.Empty(frames)
+	at.Equal(3, n)
+}
@@ -0,0 +1,343 @@
+package aac
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/moggle-mog/goav/parser/bits"
+)
+
+// 音频对象类型 audioObjectType
+const (
+	ObjectTypeMain = 1  // AAC Main
+	ObjectTypeLC   = 2  // AAC LC
+	ObjectTypeSSR  = 3  // AAC SSR
+	ObjectTypeLTP  = 4  // AAC LTP
+	ObjectTypeSBR  = 5  // SBR, HE-AAC
+	ObjectTypePS   = 29 // PS, HE-AACv2
+)
+
+// 后向兼容的扩展信令同步字 syncExtensionType
+const (
+	syncExtensionSBR = 0x2b7
+	syncExtensionPS  = 0x548
+)
+
+// channelConfiguration 对应的声道数
+var channelCounts = []int{0, 1, 2, 3, 4, 5, 6, 8}
+
+// Config 音频特定配置 AudioSpecificConfig (ISO/IEC 14496-3 1.6.2.1)
+type Config struct {
+	ObjectType      int // 核心编码的 audioObjectType, HE-AAC 时一般为 AAC LC
+	SampleRateIndex int // samplingFrequencyIndex, 0xf 表示显式采样率
+	SampleRate      int // 核心编码的采样率
+	ChannelConfig   int // channelConfiguration, 0 表示由 program_config_element 定义
+	Channels        int // 声道数
+
+	ExtensionObjectType      int // extensionAudioObjectType, 0: 无扩展, 5: SBR
+	ExtensionSampleRateIndex int // extensionSamplingFrequencyIndex
+	ExtensionSampleRate      int // SBR 输出的采样率
+	SBR                      bool
+	PS                       bool
+
+	FrameLengthFlag    bool // true: 每帧960个采样, false: 每帧1024个采样
+	DependsOnCoreCoder bool
+	CoreCoderDelay     int
+	ExtensionFlag      bool
+
+	PCE *ProgramConfig // channelConfiguration 为0时携带
+}
+
+// ProgramConfig 节目配置 program_config_element( ), 只保留声道布局
+type ProgramConfig struct {
+	ElementInstanceTag int
+	ObjectType         int
+	SampleRateIndex    int
+	FrontChannels      int // 前置声道数, CPE计为2个声道
+	SideChannels       int // 侧置声道数
+	BackChannels       int // 后置声道数
+	LfeChannels        int // 低频声道数
+	Comment            []byte
+}
+
+// Channels 节目配置中的总声道数
+func (pce *ProgramConfig) Channels() int {
+	return pce.FrontChannels + pce.SideChannels + pce.BackChannels + pce.LfeChannels
+}
+
+// OutputSampleRate 解码输出的采样率, 携带SBR时为SBR的采样率
+// 未显式或后向兼容地声明SBR时(隐式信令)无法从配置中得知, 返回核心编码的采样率
+func (c *Config) OutputSampleRate() int {
+	if c.SBR && c.ExtensionSampleRate > 0 {
+		return c.ExtensionSampleRate
+	}
+
+	return c.SampleRate
+}
+
+// SamplesPerFrame 每帧解码输出的采样数, 携带SBR时为核心编码采样数的2倍
+func (c *Config) SamplesPerFrame() int {
+	n := 1024
+	if c.FrameLengthFlag {
+		n = 960
+	}
+
+	if c.SBR && c.ExtensionSampleRate > c.SampleRate {
+		n *= 2
+	}
+
+	return n
+}
+
+// ParseConfig 解析 AudioSpecificConfig
+func ParseConfig(b []byte) (*Config, error) {
+	if len(b) < 2 {
+		return nil, errors.New("audio mpeg-specific, len(src)<2")
+	}
+
+	r := &configReader{Reader: bits.NewReader(b)}
+	c := &Config{}
+
+	c.ObjectType = r.objectType()
+	c.SampleRateIndex, c.SampleRate = r.sampleRate()
+	c.ChannelConfig = int(r.u(4))
+	if c.ChannelConfig < len(channelCounts) {
+		c.Channels = channelCounts[c.ChannelConfig]
+	}
+
+	// 显式的 HE-AAC/HE-AACv2 信令
+	if c.ObjectType == ObjectTypeSBR || c.ObjectType == ObjectTypePS {
+		c.ExtensionObjectType = ObjectTypeSBR
+		c.SBR = true
+		c.PS = c.ObjectType == ObjectTypePS
+		c.ExtensionSampleRateIndex, c.ExtensionSampleRate = r.sampleRate()
+		c.ObjectType = r.objectType()
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	switch c.ObjectType {
+	case 1, 2, 3, 4, 6, 7, 17, 19, 20, 21, 22, 23:
+		err := c.parseGASpecificConfig(r)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		// 其他编码类型的配置不影响采样率和声道数, 不再继续解析
+		return c, nil
+	}
+
+	// epConfig
+	switch c.ObjectType {
+	case 17, 19, 20, 21, 22, 23:
+		r.u(2)
+	}
+
+	// 后向兼容的 HE-AAC/HE-AACv2 信令, 出现在配置的末尾, 数据不完整时忽略
+	if c.ExtensionObjectType != ObjectTypeSBR && r.err == nil && r.Left() >= 16 {
+		c.parseSyncExtension(r)
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return c, nil
+}
+
+// 解析 GASpecificConfig( )
+func (c *Config) parseGASpecificConfig(r *configReader) error {
+	c.FrameLengthFlag = r.flag()
+	c.DependsOnCoreCoder = r.flag()
+	if c.DependsOnCoreCoder {
+		c.CoreCoderDelay = int(r.u(14))
+	}
+	c.ExtensionFlag = r.flag()
+
+	if c.ChannelConfig == 0 {
+		pce, err := parseProgramConfig(r)
+		if err != nil {
+			return err
+		}
+
+		c.PCE = pce
+		c.Channels = pce.Channels()
+	}
+
+	if c.ObjectType == 6 || c.ObjectType == 20 {
+		r.u(3) // layerNr
+	}
+
+	if c.ExtensionFlag {
+		switch c.ObjectType {
+		case 22:
+			r.u(5)  // numOfSubFrame
+			r.u(11) // layer_length
+		case 17, 19, 20, 23:
+			r.u(3) // aacSectionDataResilienceFlag, aacScalefactorDataResilienceFlag, aacSpectralDataResilienceFlag
+		}
+		r.u(1) // extensionFlag3
+	}
+
+	return r.err
+}
+
+// 解析后向兼容的扩展信令
+func (c *Config) parseSyncExtension(r *configReader) {
+	if r.u(11) != syncExtensionSBR {
+		return
+	}
+
+	extType := r.objectType()
+	switch extType {
+	case ObjectTypeSBR:
+		c.ExtensionObjectType = extType
+		c.SBR = r.flag()
+		if !c.SBR {
+			return
+		}
+
+		c.ExtensionSampleRateIndex, c.ExtensionSampleRate = r.sampleRate()
+		if r.err == nil && r.Left() >= 12 && r.u(11) == syncExtensionPS {
+			c.PS = r.flag()
+		}
+	case 22: // ER BSAC
+		c.ExtensionObjectType = extType
+		c.SBR = r.flag()
+		if c.SBR {
+			c.ExtensionSampleRateIndex, c.ExtensionSampleRate = r.sampleRate()
+		}
+		r.u(4) // extensionChannelConfiguration
+	}
+
+	// 扩展信令不完整时视为不携带扩展
+	if r.err != nil {
+		r.err = nil
+		c.ExtensionObjectType = 0
+		c.SBR, c.PS = false, false
+		c.ExtensionSampleRateIndex, c.ExtensionSampleRate = 0, 0
+	}
+}
+
+// 解析 program_config_element( )
+func parseProgramConfig(r *configReader) (*ProgramConfig, error) {
+	pce := &ProgramConfig{}
+
+	pce.ElementInstanceTag = int(r.u(4))
+	pce.ObjectType = int(r.u(2))
+	pce.SampleRateIndex = int(r.u(4))
+
+	numFront := int(r.u(4))
+	numSide := int(r.u(4))
+	numBack := int(r.u(4))
+	numLfe := int(r.u(2))
+	numAssocData := int(r.u(3))
+	numValidCc := int(r.u(4))
+
+	// mono_mixdown, stereo_mixdown, matrix_mixdown
+	if r.flag() {
+		r.u(4)
+	}
+	if r.flag() {
+		r.u(4)
+	}
+	if r.flag() {
+		r.u(3)
+	}
+
+	// 单声道元素(SCE)计为1个声道, 声道对元素(CPE)计为2个声道
+	channelElements := func(n int) int {
+		channels := 0
+		for i := 0; i < n; i++ {
+			if r.flag() {
+				channels += 2
+			} else {
+				channels++
+			}
+			r.u(4) // element_tag_select
+		}
+		return channels
+	}
+
+	pce.FrontChannels = channelElements(numFront)
+	pce.SideChannels = channelElements(numSide)
+	pce.BackChannels = channelElements(numBack)
+	pce.LfeChannels = numLfe
+
+	r.u(4 * numLfe)       // lfe_element_tag_select
+	r.u(4 * numAssocData) // assoc_data_element_tag_select
+	for i := 0; i < numValidCc; i++ {
+		r.u(5) // cc_element_is_ind_sw, valid_cc_element_tag_select
+	}
+
+	// byte_alignment( ), AudioSpecificConfig从字节边界开始
+	r.ByteAlign()
+
+	commentLen := int(r.u(8))
+	for i := 0; i < commentLen && r.err == nil; i++ {
+		pce.Comment = append(pce.Comment, byte(r.u(8)))
+	}
+
+	if r.err != nil {
+		return nil, fmt.Errorf("incomplete program config element: %v", r.err)
+	}
+
+	return pce, nil
+}
+
+// configReader 带错误保持的位读取器, 出现错误后的读取均返回0
+type configReader struct {
+	*bits.Reader
+	err error
+}
+
+func (r *configReader) u(n int) uint32 {
+	if r.err != nil {
+		return 0
+	}
+
+	// 超过32位时分段跳过
+	for n > 32 {
+		r.err = r.Skip(32)
+		if r.err != nil {
+			return 0
+		}
+		n -= 32
+	}
+
+	var v uint32
+	v, r.err = r.ReadBits(n)
+	return v
+}
+
+func (r *configReader) flag() bool {
+	return r.u(1) == 1
+}
+
+// GetAudioObjectType( ), 31 表示扩展类型
+func (r *configReader) objectType() int {
+	t := int(r.u(5))
+	if t == 31 {
+		t = 32 + int(r.u(6))
+	}
+	return t
+}
+
+// samplingFrequencyIndex, 0xf 时后跟24位的采样率
+func (r *configReader) sampleRate() (int, int) {
+	index := int(r.u(4))
+	if index == 0xf {
+		return index, int(r.u(24))
+	}
+
+	if index < len(aacRates) {
+		return index, aacRates[index]
+	}
+
+	if r.err == nil {
+		r.err = fmt.Errorf("invalid sampling frequency index(%d)", index)
+	}
+	return index, 0
+}
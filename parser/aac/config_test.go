@@ -0,0 +1,115 @@
+package aac
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConfig(t *testing.T) {
+	at := assert.New(t)
+
+	// case1: AAC LC, 44100, 双声道
+	c, err := ParseConfig([]byte{0x12, 0x10})
+	at.Nil(err)
+	at.Equal(ObjectTypeLC, c.ObjectType)
+	at.Equal(44100, c.SampleRate)
+	at.Equal(2, c.Channels)
+	at.False(c.SBR)
+	at.Equal(44100, c.OutputSampleRate())
+	at.Equal(1024, c.SamplesPerFrame())
+
+	// case2: HE-AAC 显式信令, 核心22050, 输出44100
+	c, err = ParseConfig([]byte{0x2b, 0x92, 0x08, 0x00})
+	at.Nil(err)
+	at.Equal(ObjectTypeLC, c.ObjectType)
+	at.Equal(ObjectTypeSBR, c.ExtensionObjectType)
+	at.True(c.SBR)
+	at.False(c.PS)
+	at.Equal(22050, c.SampleRate)
+	at.Equal(44100, c.OutputSampleRate())
+	at.Equal(2048, c.SamplesPerFrame())
+
+	// case3: HE-AACv2 显式信令
+	c, err = ParseConfig([]byte{0xeb, 0x8a, 0x08, 0x00})
+	at.Nil(err)
+	at.True(c.SBR)
+	at.True(c.PS)
+	at.Equal(1, c.Channels)
+	at.Equal(44100, c.OutputSampleRate())
+
+	// case4: 后向兼容信令, SBR和PS
+	c, err = ParseConfig([]byte{0x13, 0x90, 0x56, 0xe5, 0xa5, 0x48, 0x80})
+	at.Nil(err)
+	at.Equal(ObjectTypeLC, c.ObjectType)
+	at.True(c.SBR)
+	at.True(c.PS)
+	at.Equal(22050, c.SampleRate)
+	at.Equal(44100, c.OutputSampleRate())
+
+	// case5: 显式采样率
+	c, err = ParseConfig([]byte{0x17, 0x80, 0x56, 0x22, 0x10})
+	at.Nil(err)
+	at.Equal(0xf, c.SampleRateIndex)
+	at.Equal(44100, c.SampleRate)
+	at.Equal(2, c.ChannelConfig)
+
+	// case6: 扩展的编码类型(USAC), 只解析基本信息
+	c, err = ParseConfig([]byte{0xf9, 0x46, 0x40})
+	at.Nil(err)
+	at.Equal(42, c.ObjectType)
+	at.Equal(48000, c.SampleRate)
+	at.Equal(2, c.Channels)
+
+	// case7: program_config_element 定义的5.1声道
+	c, err = ParseConfig([]byte{0x11, 0x80, 0x04, 0xc8, 0x05, 0x00, 0x01, 0x19, 0x00, 0x02, 0x41, 0x42})
+	at.Nil(err)
+	at.Equal(0, c.ChannelConfig)
+	at.Equal(6, c.Channels)
+	at.Equal(3, c.PCE.FrontChannels)
+	at.Equal(2, c.PCE.BackChannels)
+	at.Equal(1, c.PCE.LfeChannels)
+	at.Equal([]byte("AB"), c.PCE.Comment)
+
+	// case8: 数据不完整或采样率索引无效
+	_, err = ParseConfig([]byte{0x12})
+	at.NotNil(err)
+
+	_, err = ParseConfig([]byte{0x16, 0x90})
+	at.NotNil(err)
+
+	_, err = ParseConfig([]byte{0x11, 0x80, 0x04, 0xc8})
+	at.NotNil(err)
+}
+
+func TestParser_Config(t *testing.T) {
+	at := assert.New(t)
+
+	d := NewParser()
+	w := bytes.NewBuffer(nil)
+	at.Nil(d.Config())
+	at.Equal(44100, d.SampleRate())
+
+	// case1: HE-AAC, 采样率为SBR的输出采样率, adts头使用核心编码的参数
+	at.Nil(d.Parse([]byte{0x2b, 0x92, 0x08, 0x00}, SeqHdr, w))
+	at.Equal(44100, d.SampleRate())
+	at.Equal(22050, d.Config().SampleRate)
+
+	at.Nil(d.Parse([]byte{0x21}, Raw, w))
+	at.Equal([]byte{0xff, 0xf1, 0x5c, 0x80, 0x01, 0x1f, 0xfc, 0x21}, w.Bytes())
+
+	// case2: 显式采样率在表中时可以写入adts头
+	w.Reset()
+	at.Nil(d.Parse([]byte{0x17, 0x80, 0x56, 0x22, 0x10}, SeqHdr, w))
+	at.Nil(d.Parse([]byte{0x21}, Raw, w))
+	at.Equal([]byte{0xff, 0xf1, 0x50, 0x80, 0x01, 0x1f, 0xfc, 0x21}, w.Bytes())
+
+	// case3: 显式采样率不在表中, 或编码类型无法写入adts头
+	at.Nil(d.Parse([]byte{0x17, 0x80, 0x18, 0x1c, 0x88}, SeqHdr, w))
+	at.Equal(12345, d.SampleRate())
+	at.NotNil(d.Parse([]byte{0x21}, Raw, w))
+
+	at.Nil(d.Parse([]byte{0xf9, 0x46, 0x40}, SeqHdr, w))
+	at.NotNil(d.Parse([]byte{0x21}, Raw, w))
+}
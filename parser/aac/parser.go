@@ -4,15 +4,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
-
-	"github.com/moggle-mog/goav/container/flv"
 )
 
 // Parser aac解析器
 type Parser struct {
 	gotSpecific bool
 	adtsHeader  []byte
-	cfgInfo     *mpegCfgInfo
+	config      *Config
+	adtsIndex   byte /* adts头中的采样率索引 */
 }
 
 // NewParser aac解析器
@@ -20,7 +19,6 @@ func NewParser() *Parser {
 	return &Parser{
 		gotSpecific: false,
 		adtsHeader:  make([]byte, adtsHeaderLen),
-		cfgInfo:     &mpegCfgInfo{},
 	}
 }
 
@@ -32,42 +30,59 @@ func (p *Parser) Parse(b []byte, types uint8, w io.Writer) error {
 
 	// 根据包类型提取和填充数据
 	switch types {
-	case flv.AacSeqHdr:
+	case SeqHdr:
 		return p.specificInfo(b)
-	case flv.AacRaw:
+	case Raw:
 		return p.addADTSToFrame(b, w)
 	}
 
 	return fmt.Errorf("invalid packet type(%d)", types)
 }
 
-// SampleRate 根据sampleRateIndex, 返回对应的sampleRate, 类似: map[sampleRateIndex] = sampleRate
+// SampleRate 解码输出的采样率(HE-AAC为SBR的采样率), 未收到序列头时返回44100
 func (p *Parser) SampleRate() int {
-	rate := 44100
+	if p.config == nil || p.config.OutputSampleRate() <= 0 {
+		return 44100
+	}
+
+	return p.config.OutputSampleRate()
+}
 
-	if int(p.cfgInfo.sampleRateIndex) < len(aacRates) {
-		rate = aacRates[p.cfgInfo.sampleRateIndex]
+// SamplesPerFrame 每帧解码输出的采样数, 未收到序列头时返回1024
+func (p *Parser) SamplesPerFrame() int {
+	if p.config == nil {
+		return 1024
 	}
 
-	return rate
+	return p.config.SamplesPerFrame()
+}
+
+// Config 返回序列头中的 AudioSpecificConfig, 未收到序列头时返回nil
+func (p *Parser) Config() *Config {
+	return p.config
 }
 
-// 从aac sequence header 中提取specific config信息, 填充到 p.cfgInfo 中
+// 从aac sequence header 中提取specific config信息, 填充到 p.config 中
 // audio specific config
 func (p *Parser) specificInfo(src []byte) error {
-	if len(src) < 2 {
-		return errors.New("audio mpeg-specific, len(src)<2")
+	config, err := ParseConfig(src)
+	if err != nil {
+		return err
 	}
 
-	// 填充数据
 	p.gotSpecific = true
-	p.cfgInfo.objectType = (src[0] >> 3) & 0xff                    /* [0:4]编码类型 */
-	p.cfgInfo.sampleRateIndex = ((src[0] & 0x07) << 1) | src[1]>>7 /* [0:3]音频采样率索引值 */
-	p.cfgInfo.channel = (src[1] >> 3) & 0x0f                       /* [0:3]音频输出声道 */
-
-	// 兼容性报告
-	if p.cfgInfo.sampleRateIndex == 0xf {
-		return errors.New("incompatible extension sampling frequency")
+	p.config = config
+
+	// adts头只能使用采样率索引, 显式采样率需要在表中有对应的索引
+	p.adtsIndex = byte(config.SampleRateIndex)
+	if config.SampleRateIndex == 0xf {
+		p.adtsIndex = 0xf
+		for i, rate := range aacRates {
+			if rate == config.SampleRate {
+				p.adtsIndex = byte(i)
+				break
+			}
+		}
 	}
 
 	return nil
@@ -79,6 +94,16 @@ func (p *Parser) addADTSToFrame(src []byte, w io.Writer) error {
 		return fmt.Errorf("audio data invalid, data size(%d), has specific config(%v)", len(src), p.gotSpecific)
 	}
 
+	// adts头的profile只有2位, 只能表示 AAC Main/LC/SSR/LTP
+	objectType := p.config.ObjectType
+	if objectType < ObjectTypeMain || objectType > ObjectTypeLTP {
+		return fmt.Errorf("incompatible audio object type(%d) for adts", objectType)
+	}
+	if p.adtsIndex == 0xf {
+		return fmt.Errorf("incompatible extension sampling frequency(%d) for adts", p.config.SampleRate)
+	}
+	channel := byte(p.config.ChannelConfig)
+
 	// 音频帧大小
 	aacFrameLen := uint16(len(src))
 
@@ -95,9 +120,9 @@ func (p *Parser) addADTSToFrame(src []byte, w io.Writer) error {
 		[6]private_bit,
 		[7]channel_configuration+
 	*/
-	p.adtsHeader[2] = (p.cfgInfo.objectType - 1) << 6
-	p.adtsHeader[2] |= p.cfgInfo.sampleRateIndex << 2
-	p.adtsHeader[2] |= p.cfgInfo.channel >> 2
+	p.adtsHeader[2] = byte(objectType-1) << 6
+	p.adtsHeader[2] |= p.adtsIndex << 2
+	p.adtsHeader[2] |= channel >> 2
 
 	/*
 		[0:1]+channel_configuration,
@@ -107,7 +132,7 @@ func (p *Parser) addADTSToFrame(src []byte, w io.Writer) error {
 		[5]copyright_identification_start,
 		[6:7]aac_frame_length+
 	*/
-	p.adtsHeader[3] = (p.cfgInfo.channel & 0x3) << 6
+	p.adtsHeader[3] = (channel & 0x3) << 6
 	p.adtsHeader[3] |= byte(frameLen >> 11)
 
 	p.adtsHeader[4] = byte((frameLen & 0x7ff) >> 3) /* [0:7]+aac_frame_length+ */
@@ -0,0 +1,179 @@
+// Package bits 按位读取码流, 支持指数哥伦布编码
+package bits
+
+import (
+	"errors"
+)
+
+// ErrOutOfRange 读取越界
+var ErrOutOfRange = errors.New("bits: read out of range")
+
+// Reader 位读取器(高位在前)
+type Reader struct {
+	data []byte
+	pos  int // 已读取的位数
+}
+
+// NewReader 位读取器
+func NewReader(b []byte) *Reader {
+	return &Reader{
+		data: b,
+	}
+}
+
+// Pos 已读取的位数
+func (r *Reader) Pos() int {
+	return r.pos
+}
+
+// Left 剩余的位数
+func (r *Reader) Left() int {
+	return len(r.data)*8 - r.pos
+}
+
+// Skip 跳过n位
+func (r *Reader) Skip(n int) error {
+	if n < 0 || n > r.Left() {
+		return ErrOutOfRange
+	}
+
+	r.pos += n
+	return nil
+}
+
+// ByteAlign 跳过当前字节剩余的位
+func (r *Reader) ByteAlign() {
+	if r.pos%8 != 0 {
+		r.pos += 8 - r.pos%8
+	}
+}
+
+// ReadBit 读取1位
+func (r *Reader) ReadBit() (uint32, error) {
+	if r.Left() < 1 {
+		return 0, ErrOutOfRange
+	}
+
+	bit := (r.data[r.pos>>3] >> (7 - uint(r.pos&0x7))) & 0x1
+	r.pos++
+
+	return uint32(bit), nil
+}
+
+// ReadFlag 读取1位, 返回是否置位
+func (r *Reader) ReadFlag() (bool, error) {
+	bit, err := r.ReadBit()
+	return bit == 1, err
+}
+
+// ReadBits 读取n位(n<=32)
+func (r *Reader) ReadBits(n int) (uint32, error) {
+	if n < 0 || n > 32 {
+		return 0, errors.New("bits: invalid bit count")
+	}
+	if n > r.Left() {
+		return 0, ErrOutOfRange
+	}
+
+	var v uint32
+	for i := 0; i < n; i++ {
+		bit := (r.data[r.pos>>3] >> (7 - uint(r.pos&0x7))) & 0x1
+		v = v<<1 | uint32(bit)
+		r.pos++
+	}
+
+	return v, nil
+}
+
+// ReadUE 读取无符号指数哥伦布编码 ue(v)
+func (r *Reader) ReadUE() (uint32, error) {
+	// 统计前导0的个数
+	zeros := 0
+	for {
+		bit, err := r.ReadBit()
+		if err != nil {
+			return 0, err
+		}
+		if bit == 1 {
+			break
+		}
+
+		zeros++
+		if zeros > 31 {
+			return 0, errors.New("bits: invalid exp-golomb code")
+		}
+	}
+
+	v, err := r.ReadBits(zeros)
+	if err != nil {
+		return 0, err
+	}
+
+	return (1<<uint(zeros) - 1) + v, nil
+}
+
+// ReadSE 读取有符号指数哥伦布编码 se(v)
+func (r *Reader) ReadSE() (int32, error) {
+	v, err := r.ReadUE()
+	if err != nil {
+		return 0, err
+	}
+
+	// 奇数为正, 偶数为负
+	if v&0x1 == 1 {
+		return int32((v + 1) / 2), nil
+	}
+
+	return -int32(v / 2), nil
+}
+
+// RemoveEmulationPrevention 去除NALU中的防竞争字节(0x000003 -> 0x0000), 得到RBSP
+func RemoveEmulationPrevention(src []byte) []byte {
+	dst := make([]byte, 0, len(src))
+
+	zeros := 0
+	for _, b := range src {
+		if zeros >= 2 && b == 0x03 {
+			zeros = 0
+			continue
+		}
+
+		if b == 0x00 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+
+		dst = append(dst, b)
+	}
+
+	return dst
+}
+
+// AddEmulationPrevention 在RBSP中插入防竞争字节(0x0000 后跟 0x00-0x03 时插入 0x03), 得到NALU
+func AddEmulationPrevention(src []byte) []byte {
+	dst := make([]byte, 0, len(src)+len(src)/64)
+
+	zeros := 0
+	for _, b := range src {
+		if zeros >= 2 && b <= 0x03 {
+			dst = append(dst, 0x03)
+			zeros = 0
+		}
+
+		if b == 0x00 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+
+		dst = append(dst, b)
+	}
+
+	// NALU不能以 0x00 结尾
+	if zeros > 0 {
+		dst = append(dst, 0x03)
+	}
+
+	return dst
+}
@@ -0,0 +1,78 @@
+package bits
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReader_ReadBits(t *testing.T) {
+	at := assert.New(t)
+
+	r := NewReader([]byte{0xa5, 0x0f})
+
+	v, err := r.ReadBits(3)
+	at.Nil(err)
+	at.Equal(uint32(5), v)
+
+	flag, err := r.ReadFlag()
+	at.Nil(err)
+	at.False(flag)
+
+	v, err = r.ReadBits(8)
+	at.Nil(err)
+	at.Equal(uint32(0x50), v)
+	at.Equal(4, r.Left())
+
+	r.ByteAlign()
+	at.Equal(16, r.Pos())
+
+	_, err = r.ReadBit()
+	at.Equal(ErrOutOfRange, err)
+	at.Equal(ErrOutOfRange, r.Skip(1))
+}
+
+func TestReader_ReadUE(t *testing.T) {
+	at := assert.New(t)
+
+	// 1 010 011 00100 0001000 -> 0 1 2 3 7
+	r := NewReader([]byte{0xa6, 0x41, 0x00})
+
+	for _, expected := range []uint32{0, 1, 2, 3, 7} {
+		v, err := r.ReadUE()
+		at.Nil(err)
+		at.Equal(expected, v)
+	}
+
+	// 010 011 00100 00101 -> 1 -1 2 -2
+	r = NewReader([]byte{0x4c, 0x85})
+	for _, expected := range []int32{1, -1, 2, -2} {
+		v, err := r.ReadSE()
+		at.Nil(err)
+		at.Equal(expected, v)
+	}
+
+	// 数据不完整
+	r = NewReader([]byte{0x00})
+	_, err := r.ReadUE()
+	at.NotNil(err)
+}
+
+func TestRemoveEmulationPrevention(t *testing.T) {
+	at := assert.New(t)
+
+	at.Equal([]byte{0x00, 0x00, 0x01, 0x00, 0x00, 0x03, 0x00, 0x00},
+		RemoveEmulationPrevention([]byte{0x00, 0x00, 0x03, 0x01, 0x00, 0x00, 0x03, 0x03, 0x00, 0x00, 0x03}))
+}
+
+func TestAddEmulationPrevention(t *testing.T) {
+	at := assert.New(t)
+
+	// case1: 0x0000 后跟 0x00-0x03 时插入 0x03
+	src := []byte{0x00, 0x00, 0x01, 0x00, 0x00, 0x03, 0x00, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00}
+	dst := AddEmulationPrevention(src)
+	at.Equal([]byte{0x00, 0x00, 0x03, 0x01, 0x00, 0x00, 0x03, 0x03, 0x00, 0x00, 0x04, 0x00, 0x00, 0x03, 0x00, 0x00, 0x03}, dst)
+
+	// case2: 与 RemoveEmulationPrevention 互逆
+	at.Equal(src, RemoveEmulationPrevention(dst))
+}
@@ -0,0 +1,43 @@
+package h264
+
+// SplitAnnexb 按start code(0x000001或0x00000001)切分Annex-b格式的数据, 返回不包含start code的nalu列表
+func SplitAnnexb(b []byte) [][]byte {
+	var nalus [][]byte
+
+	start := -1
+	i := 0
+	for i+2 < len(b) {
+		// 查找 0x000001
+		if b[i] != 0x00 || b[i+1] != 0x00 || b[i+2] != 0x01 {
+			i++
+			continue
+		}
+
+		if start >= 0 {
+			nalus = appendNalu(nalus, b[start:i])
+		}
+
+		i += 3
+		start = i
+	}
+
+	if start >= 0 {
+		nalus = appendNalu(nalus, b[start:])
+	}
+
+	return nalus
+}
+
+// 去除nalu末尾的0(trailing_zero_8bits 以及4字节start code的首字节)后追加
+func appendNalu(nalus [][]byte, nalu []byte) [][]byte {
+	end := len(nalu)
+	for end > 0 && nalu[end-1] == 0x00 {
+		end--
+	}
+
+	if end == 0 {
+		return nalus
+	}
+
+	return append(nalus, nalu[:end])
+}
@@ -0,0 +1,234 @@
+package h264
+
+import (
+	"errors"
+)
+
+// FrameInfo 访问单元(一帧)的信息
+type FrameInfo struct {
+	Type        byte   // 帧类型: IFrame, PFrame 或 BFrame, 多个片时取预测方式最复杂的片
+	IsReference bool   // 是否是参考帧, 非参考帧可以在拥塞时丢弃
+	IsIDR       bool   // 是否是IDR帧
+	FrameNum    uint32 // frame_num
+	POC         int32  // 图像顺序号 PicOrderCnt, 场图像时为该场的顺序号
+}
+
+// Analyzer 跟踪SPS/PPS, 解析访问单元中的片头并计算POC(8.2.1)
+// 未解析 dec_ref_pic_marking( ), 因此不处理 memory_management_control_operation 等于5的情况
+type Analyzer struct {
+	spsMap map[uint32]*SPS
+	ppsMap map[uint32]*PPS
+
+	// POC type 0
+	prevPocMsb int32
+	prevPocLsb int32
+
+	// POC type 1/2
+	prevFrameNum       uint32
+	prevFrameNumOffset int64
+}
+
+// NewAnalyzer 访问单元分析器
+func NewAnalyzer() *Analyzer {
+	return &Analyzer{
+		spsMap: make(map[uint32]*SPS),
+		ppsMap: make(map[uint32]*PPS),
+	}
+}
+
+// AddParamSet 解析并保存SPS或PPS, 其他类型的nalu被忽略
+func (a *Analyzer) AddParamSet(nalu []byte) error {
+	if len(nalu) == 0 {
+		return errors.New("empty nalu")
+	}
+
+	switch nalu[0] & 0x1f {
+	case naluTypeSps:
+		sps, err := ParseSPS(nalu)
+		if err != nil {
+			return err
+		}
+		a.spsMap[sps.ID] = sps
+	case naluTypePps:
+		pps, err := ParsePPS(nalu)
+		if err != nil {
+			return err
+		}
+		a.ppsMap[pps.ID] = pps
+	}
+
+	return nil
+}
+
+// Analyze 分析一个访问单元, nalus不包含start code或长度字段; 访问单元中的SPS/PPS会先被保存
+func (a *Analyzer) Analyze(nalus [][]byte) (*FrameInfo, error) {
+	var info *FrameInfo
+	var first *SliceHeader
+
+	for _, nalu := range nalus {
+		if len(nalu) == 0 {
+			continue
+		}
+
+		switch nalu[0] & 0x1f {
+		case naluTypeSps, naluTypePps:
+			err := a.AddParamSet(nalu)
+			if err != nil {
+				return nil, err
+			}
+		case naluTypeSlice, naluTypeIdr:
+			h, err := ParseSliceHeader(nalu, a.spsMap, a.ppsMap)
+			if err != nil {
+				return nil, err
+			}
+
+			if info == nil {
+				first = h
+				info = &FrameInfo{
+					Type:        h.FrameType(),
+					IsReference: h.NalRefIdc != 0,
+					IsIDR:       h.IDR,
+					FrameNum:    h.FrameNum,
+				}
+				continue
+			}
+
+			// I < P < B
+			if t := h.FrameType(); t > info.Type {
+				info.Type = t
+			}
+		}
+	}
+
+	if info == nil {
+		return nil, errors.New("no slice in access unit")
+	}
+
+	sps := a.spsMap[a.ppsMap[first.PPSID].SPSID]
+	info.POC = a.picOrderCnt(sps, first)
+
+	return info, nil
+}
+
+// 计算POC, 并更新解码下一帧所需的状态
+func (a *Analyzer) picOrderCnt(sps *SPS, h *SliceHeader) int32 {
+	switch sps.PicOrderCntType {
+	case 0:
+		return a.picOrderCntType0(sps, h)
+	case 1:
+		return a.picOrderCntType1(sps, h)
+	}
+
+	return a.picOrderCntType2(sps, h)
+}
+
+// 8.2.1.1 pic_order_cnt_type 等于0
+func (a *Analyzer) picOrderCntType0(sps *SPS, h *SliceHeader) int32 {
+	if h.IDR {
+		a.prevPocMsb = 0
+		a.prevPocLsb = 0
+	}
+
+	maxLsb := int32(1) << sps.Log2MaxPicOrderCntLsb
+	lsb := int32(h.PicOrderCntLsb)
+
+	msb := a.prevPocMsb
+	if lsb < a.prevPocLsb && a.prevPocLsb-lsb >= maxLsb/2 {
+		msb += maxLsb
+	} else if lsb > a.prevPocLsb && lsb-a.prevPocLsb > maxLsb/2 {
+		msb -= maxLsb
+	}
+
+	if h.NalRefIdc != 0 {
+		a.prevPocMsb = msb
+		a.prevPocLsb = lsb
+	}
+
+	top := msb + lsb
+	if h.FieldPic {
+		return top
+	}
+
+	bottom := top + h.DeltaPicOrderCntBottom
+	if bottom < top {
+		return bottom
+	}
+	return top
+}
+
+// FrameNumOffset, 8.2.1.2 和 8.2.1.3 共用
+func (a *Analyzer) frameNumOffset(sps *SPS, h *SliceHeader) int64 {
+	offset := a.prevFrameNumOffset
+	if h.IDR {
+		offset = 0
+	} else if a.prevFrameNum > h.FrameNum {
+		offset += int64(1) << sps.Log2MaxFrameNum
+	}
+
+	a.prevFrameNum = h.FrameNum
+	a.prevFrameNumOffset = offset
+
+	return offset
+}
+
+// 8.2.1.2 pic_order_cnt_type 等于1
+func (a *Analyzer) picOrderCntType1(sps *SPS, h *SliceHeader) int32 {
+	offset := a.frameNumOffset(sps, h)
+	num := int64(len(sps.OffsetForRefFrame))
+
+	var absFrameNum int64
+	if num != 0 {
+		absFrameNum = offset + int64(h.FrameNum)
+	}
+	if h.NalRefIdc == 0 && absFrameNum > 0 {
+		absFrameNum--
+	}
+
+	var expected int64
+	if absFrameNum > 0 {
+		var expectedDelta int64
+		for _, v := range sps.OffsetForRefFrame {
+			expectedDelta += int64(v)
+		}
+
+		cycleCnt := (absFrameNum - 1) / num
+		inCycle := (absFrameNum - 1) % num
+
+		expected = cycleCnt * expectedDelta
+		for i := int64(0); i <= inCycle; i++ {
+			expected += int64(sps.OffsetForRefFrame[i])
+		}
+	}
+	if h.NalRefIdc == 0 {
+		expected += int64(sps.OffsetForNonRefPic)
+	}
+
+	top := expected + int64(h.DeltaPicOrderCnt[0])
+	if h.FieldPic {
+		if h.BottomField {
+			return int32(expected + int64(sps.OffsetForTopToBottomField) + int64(h.DeltaPicOrderCnt[0]))
+		}
+		return int32(top)
+	}
+
+	bottom := top + int64(sps.OffsetForTopToBottomField) + int64(h.DeltaPicOrderCnt[1])
+	if bottom < top {
+		return int32(bottom)
+	}
+	return int32(top)
+}
+
+// 8.2.1.3 pic_order_cnt_type 等于2, 输出顺序与解码顺序相同
+func (a *Analyzer) picOrderCntType2(sps *SPS, h *SliceHeader) int32 {
+	offset := a.frameNumOffset(sps, h)
+	if h.IDR {
+		return 0
+	}
+
+	poc := 2 * (offset + int64(h.FrameNum))
+	if h.NalRefIdc == 0 {
+		poc--
+	}
+
+	return int32(poc)
+}
@@ -0,0 +1,253 @@
+package h264
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 按位写入, 用于构造测试用的参数集和片头
+type testBitWriter struct {
+	data []byte
+	n    int
+}
+
+func (w *testBitWriter) u(n int, v uint32) *testBitWriter {
+	for i := n - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		w.data[len(w.data)-1] |= byte((v>>uint(i))&0x1) << (7 - uint(w.n%8))
+		w.n++
+	}
+	return w
+}
+
+func (w *testBitWriter) ue(v uint32) *testBitWriter {
+	v++
+	n := 0
+	for v>>uint(n) > 1 {
+		n++
+	}
+	return w.u(n, 0).u(n+1, v)
+}
+
+func (w *testBitWriter) se(v int32) *testBitWriter {
+	if v > 0 {
+		return w.ue(uint32(2*v - 1))
+	}
+	return w.ue(uint32(-2 * v))
+}
+
+// 写入 rbsp_trailing_bits 并加上nalu头
+func (w *testBitWriter) nalu(header byte) []byte {
+	w.u(1, 1)
+	for w.n%8 != 0 {
+		w.u(1, 0)
+	}
+	return append([]byte{header}, w.data...)
+}
+
+// Baseline profile, 320x240, log2_max_frame_num=4
+func testBaselineSps(pocType uint32) []byte {
+	w := (&testBitWriter{}).u(8, 66).u(8, 0).u(8, 30).ue(0).ue(0).ue(pocType)
+
+	switch pocType {
+	case 0:
+		w.ue(2) // log2_max_pic_order_cnt_lsb=6
+	case 1:
+		w.u(1, 0).se(-1).se(0).ue(1).se(2)
+	}
+
+	return w.ue(1).u(1, 0).ue(19).ue(14).u(1, 1).u(1, 1).u(1, 0).u(1, 0).nalu(0x67)
+}
+
+func testBaselinePps() []byte {
+	w := (&testBitWriter{}).ue(0).ue(0).u(1, 0).u(1, 0).ue(0).ue(0).ue(0)
+	return w.u(1, 0).u(2, 0).se(0).se(0).se(0).u(1, 1).u(1, 0).u(1, 0).nalu(0x68)
+}
+
+// 片头, pocType为0时写入 pic_order_cnt_lsb
+func testSlice(header byte, sliceType, frameNum uint32, pocType uint32, lsb uint32) []byte {
+	w := (&testBitWriter{}).ue(0).ue(sliceType).ue(0).u(4, frameNum)
+	if header&0x1f == naluTypeIdr {
+		w.ue(0)
+	}
+	if pocType == 0 {
+		w.u(6, lsb)
+	}
+	return w.u(8, 0xa5).nalu(header)
+}
+
+func TestParsePPS(t *testing.T) {
+	at := assert.New(t)
+
+	pps, err := ParsePPS(testPps)
+	at.Nil(err)
+	at.Equal(uint32(0), pps.ID)
+	at.Equal(uint32(0), pps.SPSID)
+	at.False(pps.EntropyCodingMode)
+	at.Equal(uint32(1), pps.NumSliceGroups)
+
+	pps, err = ParsePPS(testBaselinePps())
+	at.Nil(err)
+	at.False(pps.EntropyCodingMode)
+	at.Equal(uint32(1), pps.NumRefIdxL0DefaultActive)
+	at.Equal(int32(26), pps.PicInitQp)
+	at.True(pps.DeblockingFilterControlPresent)
+
+	// 不是PPS
+	_, err = ParsePPS(testSps)
+	at.NotNil(err)
+}
+
+func TestParseSliceHeader(t *testing.T) {
+	at := assert.New(t)
+
+	sps, err := ParseSPS(testBaselineSps(0))
+	at.Nil(err)
+	pps, err := ParsePPS(testBaselinePps())
+	at.Nil(err)
+
+	spsMap := map[uint32]*SPS{0: sps}
+	ppsMap := map[uint32]*PPS{0: pps}
+
+	h, err := ParseSliceHeader(testSlice(0x65, 7, 0, 0, 0), spsMap, ppsMap)
+	at.Nil(err)
+	at.True(h.IDR)
+	at.Equal(byte(3), h.NalRefIdc)
+	at.Equal(IFrame, h.FrameType())
+
+	h, err = ParseSliceHeader(testSlice(0x01, 1, 3, 0, 10), spsMap, ppsMap)
+	at.Nil(err)
+	at.False(h.IDR)
+	at.Equal(byte(0), h.NalRefIdc)
+	at.Equal(BFrame, h.FrameType())
+	at.Equal(uint32(3), h.FrameNum)
+	at.Equal(uint32(10), h.PicOrderCntLsb)
+
+	// case1: 引用的PPS不存在
+	_, err = ParseSliceHeader(testSlice(0x41, 5, 1, 0, 2), spsMap, map[uint32]*PPS{})
+	at.NotNil(err)
+
+	// case2: 不是片
+	_, err = ParseSliceHeader(testSps, spsMap, ppsMap)
+	at.NotNil(err)
+}
+
+func TestAnalyzer_PicOrderCntType0(t *testing.T) {
+	at := assert.New(t)
+
+	a := NewAnalyzer()
+	at.Nil(a.AddParamSet(testBaselineSps(0)))
+	at.Nil(a.AddParamSet(testBaselinePps()))
+
+	// 解码顺序: I0 P6 B2(非参考) B4(非参考) P30 P50 P4(lsb回绕)
+	frames := []struct {
+		slice []byte
+		typ   byte
+		ref   bool
+		poc   int32
+	}{
+		{testSlice(0x65, 7, 0, 0, 0), IFrame, true, 0},
+		{testSlice(0x41, 5, 1, 0, 6), PFrame, true, 6},
+		{testSlice(0x01, 6, 2, 0, 2), BFrame, false, 2},
+		{testSlice(0x01, 6, 2, 0, 4), BFrame, false, 4},
+		{testSlice(0x41, 5, 2, 0, 30), PFrame, true, 30},
+		{testSlice(0x41, 5, 3, 0, 50), PFrame, true, 50},
+		{testSlice(0x41, 5, 4, 0, 4), PFrame, true, 68},
+	}
+
+	for _, f := range frames {
+		info, err := a.Analyze([][]byte{f.slice})
+		at.Nil(err)
+		at.Equal(f.typ, info.Type)
+		at.Equal(f.ref, info.IsReference)
+		at.Equal(f.poc, info.POC)
+	}
+
+	// 访问单元中没有片
+	_, err := a.Analyze([][]byte{testBaselinePps()})
+	at.NotNil(err)
+}
+
+func TestAnalyzer_PicOrderCntType1And2(t *testing.T) {
+	at := assert.New(t)
+
+	// case1: pic_order_cnt_type=1, offset_for_ref_frame={2}, offset_for_non_ref_pic=-1
+	a := NewAnalyzer()
+	for i, f := range []struct {
+		slice []byte
+		poc   int32
+	}{
+		{testSlice(0x65, 7, 0, 1, 0), 0},
+		{testSlice(0x41, 5, 1, 1, 0), 2},
+		{testSlice(0x01, 6, 2, 1, 0), 1},
+	} {
+		nalus := [][]byte{f.slice}
+		if i == 0 {
+			nalus = [][]byte{testBaselineSps(1), testBaselinePps(), f.slice}
+		}
+
+		info, err := a.Analyze(nalus)
+		at.Nil(err)
+		at.Equal(f.poc, info.POC)
+	}
+
+	// case2: pic_order_cnt_type=2, frame_num回绕
+	a = NewAnalyzer()
+	at.Nil(a.AddParamSet(testBaselineSps(2)))
+	at.Nil(a.AddParamSet(testBaselinePps()))
+
+	for _, f := range []struct {
+		slice []byte
+		poc   int32
+	}{
+		{testSlice(0x65, 7, 0, 2, 0), 0},
+		{testSlice(0x41, 5, 1, 2, 0), 2},
+		{testSlice(0x01, 5, 15, 2, 0), 29},
+		{testSlice(0x41, 5, 0, 2, 0), 32},
+	} {
+		info, err := a.Analyze([][]byte{f.slice})
+		at.Nil(err)
+		at.Equal(f.poc, info.POC)
+	}
+}
+
+func TestParser_FrameInfo(t *testing.T) {
+	at := assert.New(t)
+
+	seq, err := MarshalSequenceHeader([][]byte{testBaselineSps(0)}, [][]byte{testBaselinePps()})
+	at.Nil(err)
+
+	d := NewParser()
+	w := bytes.NewBuffer(nil)
+	at.Nil(d.Parse(seq, true, w))
+	at.Nil(d.FrameInfo())
+
+	slice := testSlice(0x41, 5, 1, 0, 6)
+	l := len(slice)
+	at.Nil(d.Parse(append([]byte{0, 0, 0, byte(l)}, slice...), false, w))
+
+	info := d.FrameInfo()
+	at.NotNil(info)
+	at.Equal(PFrame, info.Type)
+	at.Equal(int32(6), info.POC)
+
+	// Packer 同样输出帧信息
+	pk := NewPacker()
+	_, _, err = pk.Pack(append(append([]byte{}, startCode...), slice...))
+	at.Nil(err)
+	at.Nil(pk.FrameInfo())
+
+	var annexb []byte
+	for _, nalu := range [][]byte{testBaselineSps(0), testBaselinePps(), testSlice(0x65, 7, 0, 0, 0)} {
+		annexb = append(annexb, startCode...)
+		annexb = append(annexb, nalu...)
+	}
+	_, _, err = pk.Pack(annexb)
+	at.Nil(err)
+	at.True(pk.FrameInfo().IsIDR)
+	at.Equal(IFrame, pk.FrameInfo().Type)
+}
@@ -0,0 +1,144 @@
+package h264
+
+import (
+	"bytes"
+	"errors"
+)
+
+// Packer 将Annex-b格式的访问单元转换为AVCC格式, 并跟踪SPS/PPS的变化
+type Packer struct {
+	sps      [][]byte   /* 当前使用的SPS, 不包含start code */
+	pps      [][]byte   /* 当前使用的PPS, 不包含start code */
+	seqHdr   []byte     /* 当前的 AVCDecoderConfigurationRecord */
+	changed  bool       /* 最近一次转换是否更新了序列头 */
+	analyzer *Analyzer  /* 片头解析及POC计算 */
+	frame    *FrameInfo /* 最近一次转换的帧信息 */
+}
+
+// NewPacker Annex-b -> AVCC 转换器
+func NewPacker() *Packer {
+	return &Packer{
+		analyzer: NewAnalyzer(),
+	}
+}
+
+// SequenceHeader 返回当前SPS/PPS对应的 AVCDecoderConfigurationRecord, 尚未收到SPS/PPS时返回nil
+func (p *Packer) SequenceHeader() []byte {
+	return p.seqHdr
+}
+
+// FrameInfo 返回最近一次转换的帧类型, 参考帧标志和POC, 片头无法解析时返回nil
+func (p *Packer) FrameInfo() *FrameInfo {
+	return p.frame
+}
+
+// SeqHdrChanged 最近一次转换是否更新了序列头
+func (p *Packer) SeqHdrChanged() bool {
+	return p.changed
+}
+
+// Pack 将一个Annex-b格式的访问单元转换为AVCC格式(nalu长度字段为4字节), 并返回是否是关键帧
+// AUD, SPS和PPS不会写入AVCC数据, SPS和PPS用于更新序列头; 访问单元只包含参数集时返回的数据为空
+func (p *Packer) Pack(annexb []byte) ([]byte, bool, error) {
+	nalus := SplitAnnexb(annexb)
+	if len(nalus) == 0 {
+		return nil, false, errors.New("no nalu in annex-b data")
+	}
+
+	var sps, pps [][]byte
+	var avcc []byte
+	isKeyFrame := false
+
+	for _, nalu := range nalus {
+		switch nalu[0] & 0x1f {
+		case naluTypeAud:
+		case naluTypeSps:
+			sps = append(sps, nalu)
+		case naluTypePps:
+			pps = append(pps, nalu)
+		case naluTypeIdr:
+			isKeyFrame = true
+			fallthrough
+		default:
+			l := len(nalu)
+			avcc = append(avcc, byte(l>>24), byte(l>>16), byte(l>>8), byte(l))
+			avcc = append(avcc, nalu...)
+		}
+	}
+
+	err := p.updateParamSets(sps, pps)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// 帧信息用于推导显示时间和拥塞丢帧, 分析失败时不影响转换
+	p.frame, err = p.analyzer.Analyze(nalus)
+	if err != nil {
+		p.frame = nil
+	}
+
+	return avcc, isKeyFrame, nil
+}
+
+// 参数集发生变化时重新生成序列头
+func (p *Packer) updateParamSets(sps, pps [][]byte) error {
+	p.changed = false
+
+	if len(sps) == 0 && len(pps) == 0 {
+		return nil
+	}
+
+	newSps, newPps := p.sps, p.pps
+	if len(sps) > 0 {
+		newSps = sps
+	}
+	if len(pps) > 0 {
+		newPps = pps
+	}
+
+	if equalParamSets(newSps, p.sps) && equalParamSets(newPps, p.pps) {
+		return nil
+	}
+
+	// 参数集来自调用方的缓冲区, 复制后保存, 避免缓冲区复用后与自身比较
+	p.sps, p.pps = copyParamSets(newSps), copyParamSets(newPps)
+
+	// SPS和PPS都收到后才能生成序列头
+	if len(p.sps) == 0 || len(p.pps) == 0 {
+		return nil
+	}
+
+	seqHdr, err := MarshalSequenceHeader(p.sps, p.pps)
+	if err != nil {
+		return err
+	}
+
+	p.seqHdr = seqHdr
+	p.changed = true
+
+	return nil
+}
+
+// 复制参数集
+func copyParamSets(nalus [][]byte) [][]byte {
+	dst := make([][]byte, 0, len(nalus))
+	for _, n := range nalus {
+		dst = append(dst, append([]byte(nil), n...))
+	}
+	return dst
+}
+
+// 比较两组参数集是否相同
+func equalParamSets(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,80 @@
+package h264
+
+import (
+	"testing"
+
+	"github.com/moggle-mog/goav/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPacker_Pack(t *testing.T) {
+	at := assert.New(t)
+
+	p := NewPacker()
+	idr := []byte{0x65, 0x88, 0x84}
+	slice := []byte{0x41, 0x9a, 0x02}
+
+	// case1: 关键帧带有参数集, 生成序列头, AUD/SPS/PPS不写入AVCC数据
+	avcc, isKeyFrame, err := p.Pack(testutil.JoinAnnexb(naluAud[4:], testSps, testPps, idr))
+	at.Nil(err)
+	at.True(isKeyFrame)
+	at.Equal(append([]byte{0x00, 0x00, 0x00, 0x03}, idr...), avcc)
+	at.True(p.SeqHdrChanged())
+
+	seq, _ := MarshalSequenceHeader([][]byte{testSps}, [][]byte{testPps})
+	at.Equal(seq, p.SequenceHeader())
+
+	// case2: 非关键帧
+	avcc, isKeyFrame, err = p.Pack(testutil.JoinAnnexb(slice))
+	at.Nil(err)
+	at.False(isKeyFrame)
+	at.Equal(append([]byte{0x00, 0x00, 0x00, 0x03}, slice...), avcc)
+	at.False(p.SeqHdrChanged())
+
+	// case3: 参数集不变, 不重新生成序列头
+	_, _, err = p.Pack(testutil.JoinAnnexb(testSps, testPps, idr))
+	at.Nil(err)
+	at.False(p.SeqHdrChanged())
+
+	// case4: 只有PPS变化, 沿用之前的SPS
+	avcc, _, err = p.Pack(testutil.JoinAnnexb(testPps2))
+	at.Nil(err)
+	at.Empty(avcc)
+	at.True(p.SeqHdrChanged())
+
+	seq, _ = MarshalSequenceHeader([][]byte{testSps}, [][]byte{testPps2})
+	at.Equal(seq, p.SequenceHeader())
+
+	// case5: 调用方复用缓冲区时仍能发现参数集变化
+	pps3 := append([]byte{}, testPps...)
+	pps3[len(pps3)-1] ^= 0xff
+
+	buf := append(make([]byte, 0, 64), testutil.JoinAnnexb(testPps)...)
+	_, _, err = p.Pack(buf)
+	at.Nil(err)
+	at.True(p.SeqHdrChanged())
+
+	buf = append(buf[:0], testutil.JoinAnnexb(pps3)...)
+	_, _, err = p.Pack(buf)
+	at.Nil(err)
+	at.True(p.SeqHdrChanged())
+
+	seq, _ = MarshalSequenceHeader([][]byte{testSps}, [][]byte{pps3})
+	at.Equal(seq, p.SequenceHeader())
+
+	// case6: 不是Annex-b数据
+	_, _, err = p.Pack(idr)
+	at.NotNil(err)
+}
+
+func TestPacker_PackWithoutParamSets(t *testing.T) {
+	at := assert.New(t)
+
+	p := NewPacker()
+
+	// 只有SPS时无法生成序列头
+	_, _, err := p.Pack(append(append([]byte{}, startCode...), testSps...))
+	at.Nil(err)
+	at.False(p.SeqHdrChanged())
+	at.Nil(p.SequenceHeader())
+}
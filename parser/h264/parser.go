@@ -9,17 +9,62 @@ import (
 
 // Parser H264解析器
 type Parser struct {
-	specificInfo []byte        /* {0: sps, 1: pps}, 均包含start code */
-	spsPps       *bytes.Buffer /* sps和pps共用, 均包含start code */
+	specificInfo []byte         /* {0: sps, 1: pps}, 均包含start code */
+	spsPps       *bytes.Buffer  /* sps和pps共用, 均包含start code */
+	sps          *SPS           /* 最近一次解析成功的sps */
+	naluLen      int            /* [AVCC]nalu长度字段所占的字节数: 1, 2或4 */
+	policies     [32]NaluPolicy /* 各nalu类型的处理策略 */
+	analyzer     *Analyzer      /* 片头解析及POC计算 */
+	frame        *FrameInfo     /* 最近一个视频包的帧信息 */
+	seq          sequenceHeader
 }
 
 // NewParser 初始化h264解析器(pps/sps)
 func NewParser() *Parser {
 	return &Parser{
-		spsPps: bytes.NewBuffer(make([]byte, maxSpsPpsLen)),
+		spsPps:   bytes.NewBuffer(make([]byte, maxSpsPpsLen)),
+		naluLen:  naluBytesLen,
+		analyzer: NewAnalyzer(),
 	}
 }
 
+// SPS 返回最近一次从序列头或视频包中解析出的SPS, 没有可用的SPS时返回nil
+func (p *Parser) SPS() *SPS {
+	return p.sps
+}
+
+// FrameInfo 返回最近一个视频包的帧类型, 参考帧标志和POC, 片头无法解析时返回nil
+func (p *Parser) FrameInfo() *FrameInfo {
+	return p.frame
+}
+
+// 分析访问单元, 分析失败时不影响码流转换
+func (p *Parser) analyze(nalus [][]byte) {
+	frame, err := p.analyzer.Analyze(nalus)
+	if err != nil {
+		frame = nil
+	}
+	p.frame = frame
+}
+
+// 解析SPS, 解析失败时保留之前的结果(SPS语义解析不影响码流转换)
+func (p *Parser) updateSPS(nalu []byte) {
+	sps, err := ParseSPS(nalu)
+	if err == nil {
+		p.sps = sps
+	}
+}
+
+// SetNaluPolicy 设置AVCC转换为Annex-b时某一nalu类型的处理策略, 默认全部透传; AUD由转换器统一处理, 不受策略影响
+func (p *Parser) SetNaluPolicy(nalType byte, policy NaluPolicy) error {
+	if nalType > 0x1f {
+		return fmt.Errorf("invalid nalu type number=%d", nalType)
+	}
+
+	p.policies[nalType] = policy
+	return nil
+}
+
 // Parse 将H264打包格式转换为 Annex-b 的网络流格式, 写入w中
 func (p *Parser) Parse(b []byte, isSeqHdr bool, w io.Writer) error {
 	if len(b) == 0 || w == nil {
@@ -33,6 +78,8 @@ func (p *Parser) Parse(b []byte, isSeqHdr bool, w io.Writer) error {
 
 	// [Annex-b格式]直接写入以Nalu开头的数据
 	if p.isStartAtNaluHeader(b) {
+		p.analyze(SplitAnnexb(b))
+
 		_, err := w.Write(b)
 		if err != nil {
 			return err
@@ -45,15 +92,12 @@ func (p *Parser) Parse(b []byte, isSeqHdr bool, w io.Writer) error {
 	return p.getAnnexbH264(b, w)
 }
 
-// [AVCC格式]向specificInfo填充SPS和PPS, specificInfo的值: {0: sps数据, 1: pps数据}
+// [AVCC格式]解析 AVCDecoderConfigurationRecord, 向specificInfo依次填充全部的SPS和PPS
 func (p *Parser) parseSpecificInfo(src []byte) error {
-	if len(src) < 9 {
-		return errors.New("incomplete data, len(src)<9")
+	if len(src) < 7 {
+		return errors.New("incomplete data, len(src)<7")
 	}
 
-	var sps []byte
-	var pps []byte
-
 	var seq sequenceHeader
 
 	// 填充 AVCDecoderConfigurationRecord
@@ -65,35 +109,97 @@ func (p *Parser) parseSpecificInfo(src []byte) error {
 	seq.naluLen = src[4]&0x3 + 1
 	seq.reserved2 = src[5] >> 5
 
+	// nalu长度字段只能是1, 2或4字节
+	if seq.naluLen == 3 {
+		return errors.New("invalid nalu length size")
+	}
+
+	var err error
+
 	// 提取SPS
-	seq.spsNum = src[5] & 0x1f                /* [3:7]SPS数量, 一般为1 */
-	seq.spsLen = int(src[6])<<8 | int(src[7]) /* [0:15]SPS长度 */
-	if len(src[8:]) < seq.spsLen || seq.spsLen <= 0 {
-		return errors.New("incomplete sps data")
+	seq.spsNum = src[5] & 0x1f /* [3:7]SPS数量, 一般为1 */
+	index := 6
+
+	seq.sps, index, err = readParamSets(src, index, int(seq.spsNum))
+	if err != nil {
+		return fmt.Errorf("incomplete sps data: %v", err)
 	}
-	sps = append(sps, startCode...)
-	sps = append(sps, src[8:(8+seq.spsLen)]...)
 
 	// 提取PPS
-	tmpBuf := src[(8 + seq.spsLen):]
-	if len(tmpBuf) < 4 {
+	if len(src) <= index {
 		return errors.New("incomplete pps header")
 	}
-	seq.ppsNum = tmpBuf[0]                          /* PPS数量 */
-	seq.ppsLen = int(tmpBuf[1])<<8 | int(tmpBuf[2]) /* [0:15]PPS长度 */
-	if len(tmpBuf[3:]) < seq.ppsLen || seq.ppsLen <= 0 {
-		return errors.New("incomplete pps data")
+	seq.ppsNum = src[index] /* PPS数量 */
+	index++
+
+	seq.pps, index, err = readParamSets(src, index, int(seq.ppsNum))
+	if err != nil {
+		return fmt.Errorf("incomplete pps data: %v", err)
+	}
+
+	if len(seq.sps) == 0 || len(seq.pps) == 0 {
+		return errors.New("no sps or pps in sequence header")
+	}
+
+	// High profile 扩展, 部分编码器不写入该字段, 不完整时忽略
+	if hasHighProfileExt(seq.avcProfileIndication) && len(src[index:]) >= 4 {
+		seq.chromaFormat = src[index] & 0x3
+		seq.bitDepthLumaMinus8 = src[index+1] & 0x7
+		seq.bitDepthChromaMinus8 = src[index+2] & 0x7
+		seq.spsExtNum = src[index+3]
+
+		seq.spsExt, _, err = readParamSets(src, index+4, int(seq.spsExtNum))
+		if err != nil {
+			seq.spsExt = nil
+		}
 	}
-	pps = append(pps, startCode...)
-	pps = append(pps, tmpBuf[3:]...)
 
 	// 向specificInfo填充SPS和PPS
-	p.specificInfo = append(p.specificInfo, sps...)
-	p.specificInfo = append(p.specificInfo, pps...)
+	var specificInfo []byte
+	for _, sps := range seq.sps {
+		specificInfo = append(specificInfo, startCode...)
+		specificInfo = append(specificInfo, sps...)
+	}
+	for _, pps := range seq.pps {
+		specificInfo = append(specificInfo, startCode...)
+		specificInfo = append(specificInfo, pps...)
+	}
+
+	p.seq = seq
+	p.naluLen = int(seq.naluLen)
+	p.specificInfo = specificInfo
+	p.updateSPS(seq.sps[0])
+
+	for _, nalu := range append(seq.sps, seq.pps...) {
+		_ = p.analyzer.AddParamSet(nalu)
+	}
 
 	return nil
 }
 
+// 从src[index:]读取num个以2字节长度开头的参数集, 返回参数集和新的读取位置
+func readParamSets(src []byte, index int, num int) ([][]byte, int, error) {
+	var sets [][]byte
+
+	for i := 0; i < num; i++ {
+		if len(src[index:]) < 2 {
+			return nil, index, errors.New("incomplete length")
+		}
+
+		l := int(src[index])<<8 | int(src[index+1]) /* [0:15]参数集长度 */
+		index += 2
+
+		if len(src[index:]) < l || l <= 0 {
+			return nil, index, errors.New("incomplete body")
+		}
+
+		sets = append(sets, src[index:index+l])
+		index += l
+	}
+
+	return sets, index, nil
+}
+
 // 判断数据是否是以NALU头开始, Annex-b格式以NALU头开始
 func (p *Parser) isStartAtNaluHeader(src []byte) bool {
 	if len(src) < naluBytesLen {
@@ -103,19 +209,15 @@ func (p *Parser) isStartAtNaluHeader(src []byte) bool {
 	return src[0] == 0x00 && src[1] == 0x00 && src[2] == 0x00 && src[3] == 0x01
 }
 
-// [AVCC格式] 提取NALU的长度
+// [AVCC格式] 提取NALU的长度, 长度字段的字节数由序列头中的lengthSizeMinusOne决定
 func (p *Parser) naluSize(src []byte) (int, error) {
-	if len(src) < naluBytesLen {
-		return 0, errors.New("[hvcc]incomplete nalu data")
+	if len(src) < p.naluLen {
+		return 0, errors.New("[avcc]incomplete nalu data")
 	}
 
-	// [0:31] nalu单元的长度，不包括长度字段
-	buf := src[:naluBytesLen]
-	l := len(buf)
-
 	var size = 0
-	for i := 0; i < l; i++ {
-		size = size<<8 + int(buf[i])
+	for i := 0; i < p.naluLen; i++ {
+		size = size<<8 + int(src[i])
 	}
 
 	return size, nil
@@ -125,19 +227,23 @@ func (p *Parser) naluSize(src []byte) (int, error) {
 func (p *Parser) getAnnexbH264(src []byte, w io.Writer) error {
 	dataSize := len(src)
 
-	if dataSize == 0 || dataSize < naluBytesLen {
+	if dataSize == 0 || dataSize < p.naluLen {
 		return errors.New("incomplete h264 header")
 	}
 
-	// 写入音频的nalu
-	_, err := w.Write(naluAud)
-	if err != nil {
-		return err
+	// 视频包以AUD开始时沿用原有的AUD, 否则写入新的AUD
+	startsWithAud := dataSize > p.naluLen && src[p.naluLen]&0x1f == naluTypeAud
+	if !startsWithAud {
+		_, err := w.Write(naluAud)
+		if err != nil {
+			return err
+		}
 	}
 
 	index := 0
 	hasSpsPps := false
 	hasWriteSpsPps := false
+	var nalus [][]byte
 
 	// 重置sps/pps的值
 	p.spsPps.Reset()
@@ -154,8 +260,8 @@ func (p *Parser) getAnnexbH264(src []byte, w io.Writer) error {
 			return errors.New("invalid nalu body size")
 		}
 
-		index += naluBytesLen
-		dataSize -= naluBytesLen
+		index += p.naluLen
+		dataSize -= p.naluLen
 
 		// 紧跟着 Nalu size 后面的是 NALU 数据，没有四个字节 start code，直接从 h264 头开始
 		if dataSize < nalLen {
@@ -163,9 +269,34 @@ func (p *Parser) getAnnexbH264(src []byte, w io.Writer) error {
 		}
 
 		nalType := src[index] & 0x1f /* [3:7]nal_unit_type 帧类型 */
+		nalus = append(nalus, src[index:index+nalLen])
+
+		// AUD由转换器统一处理, 其余类型按策略处理
+		if nalType != naluTypeAud {
+			switch p.policies[nalType] {
+			case NaluDrop:
+				index += nalLen
+				dataSize -= nalLen
+				continue
+			case NaluError:
+				return fmt.Errorf("incompatible nalu type number=%d", nalType)
+			}
+		}
 
 		switch nalType {
 		case naluTypeAud:
+			// 只保留位于首位的AUD, 避免输出多个AUD
+			if index == p.naluLen {
+				_, err = w.Write(startCode)
+				if err != nil {
+					return err
+				}
+
+				_, err = w.Write(src[index : index+nalLen])
+				if err != nil {
+					return err
+				}
+			}
 		case naluTypeIdr:
 			// 如果未接入SPS和PPS信息, 则写入SPS和PPS,
 			// 如果视频包中有SPS或者PPS, 则从视频包提取该数据, 否则从缓存的数据里提取SPS和PPS
@@ -186,21 +317,20 @@ func (p *Parser) getAnnexbH264(src []byte, w io.Writer) error {
 				}
 			}
 			fallthrough
-		case naluTypeSlice:
-			fallthrough
-		case naluTypeSei:
+		default:
 			// 写入 start code
 			_, err = w.Write(startCode)
 			if err != nil {
 				return err
 			}
 
-			// 写入 sei 数据
+			// 写入 nalu 数据
 			_, err = w.Write(src[index : index+nalLen])
 			if err != nil {
 				return err
 			}
 		case naluTypeSps:
+			p.updateSPS(src[index : index+nalLen])
 			fallthrough
 		case naluTypePps:
 			hasSpsPps = true
@@ -216,13 +346,13 @@ func (p *Parser) getAnnexbH264(src []byte, w io.Writer) error {
 			if err != nil {
 				return err
 			}
-		default:
-			return fmt.Errorf("incompatible nalu type number=%d", nalType)
 		}
 
 		index += nalLen
 		dataSize -= nalLen
 	}
 
+	p.analyze(nalus)
+
 	return nil
 }
@@ -94,3 +94,133 @@ func TestH264Mp4DemuxException2(t *testing.T) {
 
 	at.NotNil(d.Parse(nalu, false, w))
 }
+
+// 序列头中包含多个PPS, nalu长度字段为2字节
+func TestH264MultiPpsDemux(t *testing.T) {
+	at := assert.New(t)
+
+	seq := []byte{0x01, 0x4d, 0x00, 0x1e, 0xfd, 0xe1, 0x00, 0x17}
+	seq = append(seq, testSps...)
+	seq = append(seq, 0x02, 0x00, 0x04)
+	seq = append(seq, testPps...)
+	seq = append(seq, 0x00, 0x04)
+	seq = append(seq, testPps2...)
+
+	d := NewParser()
+	w := bytes.NewBuffer(nil)
+
+	at.Nil(d.Parse(seq, true, w))
+	at.Equal(2, d.naluLen)
+
+	expected := append([]byte{}, startCode...)
+	expected = append(expected, testSps...)
+	expected = append(expected, startCode...)
+	expected = append(expected, testPps...)
+	expected = append(expected, startCode...)
+	expected = append(expected, testPps2...)
+	at.Equal(expected, d.specificInfo)
+
+	// 重复的序列头不会累加
+	at.Nil(d.Parse(seq, true, w))
+	at.Equal(expected, d.specificInfo)
+
+	// 2字节长度的关键帧
+	at.Nil(d.Parse([]byte{0x00, 0x02, 0x65, 0x23, 0x00, 0x02, 0x41, 0x9a}, false, w))
+
+	expected = append(append([]byte{}, naluAud...), expected...)
+	expected = append(expected, 0x00, 0x00, 0x00, 0x01, 0x65, 0x23, 0x00, 0x00, 0x00, 0x01, 0x41, 0x9a)
+	at.Equal(expected, w.Bytes())
+
+	// nalu长度字段为3字节
+	seq[4] = 0xfe
+	at.NotNil(d.Parse(seq, true, w))
+}
+
+// 按nalu类型处理: 透传, 丢弃, 返回错误
+func TestParser_SetNaluPolicy(t *testing.T) {
+	at := assert.New(t)
+
+	filler := []byte{0x0c, 0xff, 0xff, 0x80}
+	slice := []byte{0x41, 0x9a}
+	eoSeq := []byte{0x0a}
+	src := []byte{0x00, 0x00, 0x00, 0x04}
+	src = append(src, filler...)
+	src = append(src, 0x00, 0x00, 0x00, 0x02)
+	src = append(src, slice...)
+	src = append(src, 0x00, 0x00, 0x00, 0x01)
+	src = append(src, eoSeq...)
+
+	// case1: 默认透传
+	d := NewParser()
+	w := bytes.NewBuffer(nil)
+
+	at.Nil(d.Parse(src, false, w))
+
+	expected := append([]byte{}, naluAud...)
+	expected = append(expected, startCode...)
+	expected = append(expected, filler...)
+	expected = append(expected, startCode...)
+	expected = append(expected, slice...)
+	expected = append(expected, startCode...)
+	expected = append(expected, eoSeq...)
+	at.Equal(expected, w.Bytes())
+
+	// case2: 丢弃填充数据
+	w.Reset()
+	at.Nil(d.SetNaluPolicy(naluTypeFiller, NaluDrop))
+	at.Nil(d.Parse(src, false, w))
+
+	expected = append([]byte{}, naluAud...)
+	expected = append(expected, startCode...)
+	expected = append(expected, slice...)
+	expected = append(expected, startCode...)
+	expected = append(expected, eoSeq...)
+	at.Equal(expected, w.Bytes())
+
+	// case3: 序列结束返回错误
+	at.Nil(d.SetNaluPolicy(naluTypeEOSeq, NaluError))
+	at.NotNil(d.Parse(src, false, bytes.NewBuffer(nil)))
+
+	at.NotNil(d.SetNaluPolicy(32, NaluDrop))
+
+	// case4: 透传SPS扩展, 丢弃SVC的前缀nalu
+	spsExt := []byte{0x6d, 0x00, 0x80}
+	prefix := []byte{0x6e, 0xc0, 0x80, 0x0f}
+	src = []byte{0x00, 0x00, 0x00, 0x03}
+	src = append(src, spsExt...)
+	src = append(src, 0x00, 0x00, 0x00, 0x04)
+	src = append(src, prefix...)
+	src = append(src, 0x00, 0x00, 0x00, 0x02)
+	src = append(src, slice...)
+
+	d = NewParser()
+	at.Nil(d.SetNaluPolicy(naluTypeSpsExt, NaluPass))
+	at.Nil(d.SetNaluPolicy(naluTypePrefix, NaluDrop))
+	w.Reset()
+	at.Nil(d.Parse(src, false, w))
+
+	expected = append([]byte{}, naluAud...)
+	expected = append(expected, startCode...)
+	expected = append(expected, spsExt...)
+	expected = append(expected, startCode...)
+	expected = append(expected, slice...)
+	at.Equal(expected, w.Bytes())
+}
+
+// 视频包自带AUD时不重复写入
+func TestH264AudDemux(t *testing.T) {
+	at := assert.New(t)
+
+	d := NewParser()
+	w := bytes.NewBuffer(nil)
+
+	at.Nil(d.Parse([]byte{
+		0x00, 0x00, 0x00, 0x02, 0x09, 0x30,
+		0x00, 0x00, 0x00, 0x02, 0x41, 0x9a,
+		0x00, 0x00, 0x00, 0x02, 0x09, 0x30,
+	}, false, w))
+	at.Equal([]byte{
+		0x00, 0x00, 0x00, 0x01, 0x09, 0x30,
+		0x00, 0x00, 0x00, 0x01, 0x41, 0x9a,
+	}, w.Bytes())
+}
@@ -0,0 +1,100 @@
+package h264
+
+import (
+	"errors"
+)
+
+// PPS 图像参数集 pic_parameter_set_rbsp( ), 只解析到 redundant_pic_cnt_present_flag
+type PPS struct {
+	ID    uint32 // pic_parameter_set_id
+	SPSID uint32 // seq_parameter_set_id
+
+	EntropyCodingMode                 bool   // entropy_coding_mode_flag, true: CABAC
+	BottomFieldPicOrderInFramePresent bool   // bottom_field_pic_order_in_frame_present_flag
+	NumSliceGroups                    uint32 // num_slice_groups_minus1 + 1
+
+	NumRefIdxL0DefaultActive uint32 // num_ref_idx_l0_default_active_minus1 + 1
+	NumRefIdxL1DefaultActive uint32 // num_ref_idx_l1_default_active_minus1 + 1
+	WeightedPred             bool   // weighted_pred_flag
+	WeightedBipredIdc        uint32 // weighted_bipred_idc
+
+	PicInitQp                      int32 // pic_init_qp_minus26 + 26
+	PicInitQs                      int32 // pic_init_qs_minus26 + 26
+	ChromaQpIndexOffset            int32 // chroma_qp_index_offset
+	DeblockingFilterControlPresent bool  // deblocking_filter_control_present_flag
+	ConstrainedIntraPred           bool  // constrained_intra_pred_flag
+	RedundantPicCntPresent         bool  // redundant_pic_cnt_present_flag
+}
+
+// ParsePPS 解析PPS, nalu包含1字节的nalu头, 不包含start code
+func ParsePPS(nalu []byte) (*PPS, error) {
+	if len(nalu) < 2 {
+		return nil, errors.New("incomplete pps, len(nalu)<2")
+	}
+	if nalu[0]&0x1f != naluTypePps {
+		return nil, errors.New("not a pps nalu")
+	}
+
+	r := newRbspReader(nalu[1:])
+	s := &PPS{}
+
+	s.ID = r.ue()
+	s.SPSID = r.ue()
+	if s.ID > 255 || s.SPSID > 31 {
+		return nil, errors.New("invalid pps or sps id")
+	}
+
+	s.EntropyCodingMode = r.flag()
+	s.BottomFieldPicOrderInFramePresent = r.flag()
+	s.NumSliceGroups = r.ue() + 1
+
+	// 片组(FMO), 只在 Baseline/Extended profile 中出现
+	if s.NumSliceGroups > 1 {
+		if s.NumSliceGroups > 8 {
+			return nil, errors.New("invalid num_slice_groups_minus1")
+		}
+
+		switch r.ue() { // slice_group_map_type
+		case 0:
+			for i := uint32(0); i < s.NumSliceGroups; i++ {
+				r.ue() // run_length_minus1
+			}
+		case 2:
+			for i := uint32(0); i < s.NumSliceGroups-1; i++ {
+				r.ue() // top_left
+				r.ue() // bottom_right
+			}
+		case 3, 4, 5:
+			r.u(1) // slice_group_change_direction_flag
+			r.ue() // slice_group_change_rate_minus1
+		case 6:
+			size := r.ue() + 1 // pic_size_in_map_units_minus1 + 1
+
+			// slice_group_id 占 Ceil(Log2(num_slice_groups_minus1+1)) 位
+			n := 0
+			for 1<<uint(n) < s.NumSliceGroups {
+				n++
+			}
+			for i := uint32(0); i < size && r.err == nil; i++ {
+				r.u(n)
+			}
+		}
+	}
+
+	s.NumRefIdxL0DefaultActive = r.ue() + 1
+	s.NumRefIdxL1DefaultActive = r.ue() + 1
+	s.WeightedPred = r.flag()
+	s.WeightedBipredIdc = r.u(2)
+	s.PicInitQp = r.se() + 26
+	s.PicInitQs = r.se() + 26
+	s.ChromaQpIndexOffset = r.se()
+	s.DeblockingFilterControlPresent = r.flag()
+	s.ConstrainedIntraPred = r.flag()
+	s.RedundantPicCntPresent = r.flag()
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return s, nil
+}
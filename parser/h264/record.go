@@ -0,0 +1,89 @@
+package h264
+
+import (
+	"errors"
+)
+
+// MarshalSequenceHeader 根据SPS和PPS(均不包含start code)生成 AVCDecoderConfigurationRecord, nalu长度字段固定为4字节
+func MarshalSequenceHeader(sps [][]byte, pps [][]byte) ([]byte, error) {
+	if len(sps) == 0 || len(pps) == 0 {
+		return nil, errors.New("no sps or pps")
+	}
+	if len(sps) > 0x1f || len(pps) > 0xff {
+		return nil, errors.New("too many sps or pps")
+	}
+	if len(sps[0]) < 4 {
+		return nil, errors.New("incomplete sps, len(sps)<4")
+	}
+
+	b := []byte{
+		0x01,      /* configurationVersion */
+		sps[0][1], /* AVCProfileIndication */
+		sps[0][2], /* profile_compatibility */
+		sps[0][3], /* AVCLevelIndication */
+		0xff,      /* [0:5]reserved, [6:7]lengthSizeMinusOne: 3 */
+		0xe0 | byte(len(sps)),
+	}
+
+	var err error
+
+	b, err = appendParamSets(b, sps)
+	if err != nil {
+		return nil, err
+	}
+
+	b = append(b, byte(len(pps)))
+	b, err = appendParamSets(b, pps)
+	if err != nil {
+		return nil, err
+	}
+
+	// High profile 扩展
+	if hasHighProfileExt(sps[0][1]) {
+		chromaFormat, bitDepthLuma, bitDepthChroma := uint32(1), uint32(8), uint32(8)
+
+		s, err := ParseSPS(sps[0])
+		if err == nil {
+			chromaFormat, bitDepthLuma, bitDepthChroma = s.ChromaFormatIdc, s.BitDepthLuma, s.BitDepthChroma
+		}
+
+		b = append(b,
+			0xfc|byte(chromaFormat&0x3),
+			0xf8|byte((bitDepthLuma-8)&0x7),
+			0xf8|byte((bitDepthChroma-8)&0x7),
+			0x00, /* numOfSequenceParameterSetExt */
+		)
+	}
+
+	return b, nil
+}
+
+// SequenceHeaderFromAnnexb 从Annex-b格式的数据中提取SPS和PPS, 生成 AVCDecoderConfigurationRecord
+func SequenceHeaderFromAnnexb(b []byte) ([]byte, error) {
+	var sps, pps [][]byte
+
+	for _, nalu := range SplitAnnexb(b) {
+		switch nalu[0] & 0x1f {
+		case naluTypeSps:
+			sps = append(sps, nalu)
+		case naluTypePps:
+			pps = append(pps, nalu)
+		}
+	}
+
+	return MarshalSequenceHeader(sps, pps)
+}
+
+// 追加以2字节长度开头的参数集
+func appendParamSets(b []byte, sets [][]byte) ([]byte, error) {
+	for _, set := range sets {
+		if len(set) == 0 || len(set) > 0xffff {
+			return nil, errors.New("invalid parameter set length")
+		}
+
+		b = append(b, byte(len(set)>>8), byte(len(set)))
+		b = append(b, set...)
+	}
+
+	return b, nil
+}
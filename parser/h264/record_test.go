@@ -0,0 +1,78 @@
+package h264
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testSps  = []byte{0x67, 0x4d, 0x00, 0x1e, 0xab, 0x40, 0x5a, 0x12, 0x6c, 0x09, 0x28, 0x28, 0x28, 0x2f, 0x80, 0x00, 0x01, 0xf4, 0x00, 0x00, 0x61, 0xa8, 0x4a}
+	testPps  = []byte{0x68, 0xde, 0x31, 0x12}
+	testPps2 = []byte{0x68, 0xce, 0x38, 0x80}
+)
+
+func TestSplitAnnexb(t *testing.T) {
+	at := assert.New(t)
+
+	nalus := SplitAnnexb([]byte{
+		0x00, 0x00, 0x00, 0x01, 0x09, 0xf0,
+		0x00, 0x00, 0x01, 0x65, 0x88, 0x00,
+		0x00, 0x00, 0x00, 0x01, 0x41, 0x9a,
+	})
+	at.Equal([][]byte{{0x09, 0xf0}, {0x65, 0x88}, {0x41, 0x9a}}, nalus)
+
+	at.Nil(SplitAnnexb([]byte{0x65, 0x88}))
+}
+
+func TestMarshalSequenceHeader(t *testing.T) {
+	at := assert.New(t)
+
+	// case1: 1个SPS, 2个PPS
+	seq, err := MarshalSequenceHeader([][]byte{testSps}, [][]byte{testPps, testPps2})
+	at.Nil(err)
+
+	expected := []byte{0x01, 0x4d, 0x00, 0x1e, 0xff, 0xe1, 0x00, 0x17}
+	expected = append(expected, testSps...)
+	expected = append(expected, 0x02, 0x00, 0x04)
+	expected = append(expected, testPps...)
+	expected = append(expected, 0x00, 0x04)
+	expected = append(expected, testPps2...)
+	at.Equal(expected, seq)
+
+	// case2: 解析生成的序列头
+	d := NewParser()
+	at.Nil(d.Parse(seq, true, bytes.NewBuffer(nil)))
+	at.Equal([][]byte{testSps}, d.seq.sps)
+	at.Equal([][]byte{testPps, testPps2}, d.seq.pps)
+
+	// case3: 从Annex-b数据生成
+	annexb := append([]byte{}, startCode...)
+	annexb = append(annexb, testSps...)
+	annexb = append(annexb, startCode...)
+	annexb = append(annexb, testPps...)
+	annexb = append(annexb, startCode...)
+	annexb = append(annexb, testPps2...)
+
+	seq2, err := SequenceHeaderFromAnnexb(annexb)
+	at.Nil(err)
+	at.Equal(seq, seq2)
+
+	// case4: High profile 扩展
+	highSps := []byte{
+		0x67, 0x64, 0x00, 0x28, 0xac, 0xd9, 0x40, 0x78, 0x02, 0x27, 0xe5, 0x84,
+		0x00, 0x00, 0x03, 0x00, 0x04, 0x00, 0x00, 0x03, 0x00, 0xf0, 0x3c, 0x60,
+		0xc6, 0x58,
+	}
+	seq, err = MarshalSequenceHeader([][]byte{highSps}, [][]byte{testPps})
+	at.Nil(err)
+	at.Equal([]byte{0xfd, 0xf8, 0xf8, 0x00}, seq[len(seq)-4:])
+
+	at.Nil(d.Parse(seq, true, bytes.NewBuffer(nil)))
+	at.Equal(byte(1), d.seq.chromaFormat)
+
+	// case5: 缺少PPS
+	_, err = MarshalSequenceHeader([][]byte{testSps}, nil)
+	at.NotNil(err)
+}
@@ -0,0 +1,112 @@
+package h264
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SliceHeader 片头 slice_header( ), 只解析到计算POC所需的字段
+type SliceHeader struct {
+	NalRefIdc byte // nal_ref_idc, 0表示非参考帧
+	IDR       bool // IdrPicFlag
+
+	FirstMbInSlice uint32 // first_mb_in_slice
+	SliceType      uint32 // slice_type, 0~9
+	PPSID          uint32 // pic_parameter_set_id
+	ColourPlaneID  uint32 // colour_plane_id
+	FrameNum       uint32 // frame_num
+	FieldPic       bool   // field_pic_flag
+	BottomField    bool   // bottom_field_flag
+	IdrPicID       uint32 // idr_pic_id
+
+	PicOrderCntLsb         uint32   // pic_order_cnt_lsb
+	DeltaPicOrderCntBottom int32    // delta_pic_order_cnt_bottom
+	DeltaPicOrderCnt       [2]int32 // delta_pic_order_cnt[0..1]
+}
+
+// FrameType 片类型对应的帧类型: IFrame, PFrame 或 BFrame
+func (h *SliceHeader) FrameType() byte {
+	switch h.SliceType % 5 {
+	case 0, 3: // P, SP
+		return PFrame
+	case 1: // B
+		return BFrame
+	}
+
+	return IFrame // I, SI
+}
+
+// ParseSliceHeader 使用片引用的SPS/PPS解析片头, nalu包含1字节的nalu头, 不包含start code
+// spsMap和ppsMap分别以 seq_parameter_set_id 和 pic_parameter_set_id 为键
+func ParseSliceHeader(nalu []byte, spsMap map[uint32]*SPS, ppsMap map[uint32]*PPS) (*SliceHeader, error) {
+	if len(nalu) < 2 {
+		return nil, errors.New("incomplete slice, len(nalu)<2")
+	}
+
+	nalType := nalu[0] & 0x1f
+	if nalType != naluTypeSlice && nalType != naluTypeIdr {
+		return nil, fmt.Errorf("not a slice nalu, type number=%d", nalType)
+	}
+
+	r := newRbspReader(nalu[1:])
+	h := &SliceHeader{
+		NalRefIdc: (nalu[0] >> 5) & 0x3,
+		IDR:       nalType == naluTypeIdr,
+	}
+
+	h.FirstMbInSlice = r.ue()
+	h.SliceType = r.ue()
+	h.PPSID = r.ue()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if h.SliceType > 9 {
+		return nil, fmt.Errorf("invalid slice type number=%d", h.SliceType)
+	}
+
+	pps, ok := ppsMap[h.PPSID]
+	if !ok {
+		return nil, fmt.Errorf("pps not found, id=%d", h.PPSID)
+	}
+	sps, ok := spsMap[pps.SPSID]
+	if !ok {
+		return nil, fmt.Errorf("sps not found, id=%d", pps.SPSID)
+	}
+
+	if sps.SeparateColourPlane {
+		h.ColourPlaneID = r.u(2)
+	}
+	h.FrameNum = r.u(int(sps.Log2MaxFrameNum))
+
+	if !sps.FrameMbsOnly {
+		h.FieldPic = r.flag()
+		if h.FieldPic {
+			h.BottomField = r.flag()
+		}
+	}
+
+	if h.IDR {
+		h.IdrPicID = r.ue()
+	}
+
+	switch sps.PicOrderCntType {
+	case 0:
+		h.PicOrderCntLsb = r.u(int(sps.Log2MaxPicOrderCntLsb))
+		if pps.BottomFieldPicOrderInFramePresent && !h.FieldPic {
+			h.DeltaPicOrderCntBottom = r.se()
+		}
+	case 1:
+		if !sps.DeltaPicOrderAlwaysZero {
+			h.DeltaPicOrderCnt[0] = r.se()
+			if pps.BottomFieldPicOrderInFramePresent && !h.FieldPic {
+				h.DeltaPicOrderCnt[1] = r.se()
+			}
+		}
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return h, nil
+}
@@ -0,0 +1,378 @@
+package h264
+
+import (
+	"errors"
+
+	"github.com/moggle-mog/goav/parser/bits"
+)
+
+// SPS 序列参数集 seq_parameter_set_rbsp( )
+type SPS struct {
+	ProfileIdc      uint8  // profile_idc, 66: Baseline, 77: Main, 100: High
+	ConstraintFlags uint8  // constraint_set0_flag ~ constraint_set5_flag
+	LevelIdc        uint8  // level_idc, 30表示3.0
+	ID              uint32 // seq_parameter_set_id
+
+	ChromaFormatIdc     uint32 // chroma_format_idc, 0: 单色, 1: 4:2:0, 2: 4:2:2, 3: 4:4:4
+	SeparateColourPlane bool   // separate_colour_plane_flag
+	BitDepthLuma        uint32 // 亮度位深
+	BitDepthChroma      uint32 // 色度位深
+
+	Log2MaxFrameNum           uint32  // log2_max_frame_num_minus4 + 4
+	PicOrderCntType           uint32  // pic_order_cnt_type
+	Log2MaxPicOrderCntLsb     uint32  // log2_max_pic_order_cnt_lsb_minus4 + 4
+	DeltaPicOrderAlwaysZero   bool    // delta_pic_order_always_zero_flag
+	OffsetForNonRefPic        int32   // offset_for_non_ref_pic
+	OffsetForTopToBottomField int32   // offset_for_top_to_bottom_field
+	OffsetForRefFrame         []int32 // offset_for_ref_frame[]
+
+	MaxNumRefFrames uint32 // max_num_ref_frames
+	FrameMbsOnly    bool   // frame_mbs_only_flag
+
+	// 经过裁剪修正的分辨率
+	Width  int
+	Height int
+
+	// 裁剪区域 frame_crop_*_offset
+	CropLeft   uint32
+	CropRight  uint32
+	CropTop    uint32
+	CropBottom uint32
+
+	// VUI
+	VUIPresent bool
+
+	SarWidth  uint32 // 像素宽高比: 宽
+	SarHeight uint32 // 像素宽高比: 高
+
+	VideoFullRange          bool  // video_full_range_flag
+	ColourDescription       bool  // colour_description_present_flag
+	ColourPrimaries         uint8 // colour_primaries
+	TransferCharacteristics uint8 // transfer_characteristics
+	MatrixCoefficients      uint8 // matrix_coefficients
+
+	TimingInfoPresent bool   // timing_info_present_flag
+	NumUnitsInTick    uint32 // num_units_in_tick
+	TimeScale         uint32 // time_scale
+	FixedFrameRate    bool   // fixed_frame_rate_flag
+
+	MaxNumReorderFrames int // max_num_reorder_frames, 未携带时为-1
+}
+
+// 像素宽高比 Table E-1
+var sarTable = [][2]uint32{
+	{0, 0}, {1, 1}, {12, 11}, {10, 11}, {16, 11}, {40, 33}, {24, 11}, {20, 11},
+	{32, 11}, {80, 33}, {18, 11}, {15, 11}, {64, 33}, {160, 99}, {4, 3}, {3, 2}, {2, 1},
+}
+
+// FrameRate 根据VUI中的时间信息计算帧率, 未携带时间信息时返回0
+func (s *SPS) FrameRate() float64 {
+	if !s.TimingInfoPresent || s.NumUnitsInTick == 0 {
+		return 0
+	}
+
+	// 一帧包含两个场, 每个场一个时钟周期
+	return float64(s.TimeScale) / float64(2*s.NumUnitsInTick)
+}
+
+// ChromaArrayType 色度数组类型
+func (s *SPS) ChromaArrayType() uint32 {
+	if s.SeparateColourPlane {
+		return 0
+	}
+	return s.ChromaFormatIdc
+}
+
+// ParseSPS 解析SPS, nalu包含1字节的nalu头, 不包含start code
+func ParseSPS(nalu []byte) (*SPS, error) {
+	if len(nalu) < 4 {
+		return nil, errors.New("incomplete sps, len(nalu)<4")
+	}
+	if nalu[0]&0x1f != naluTypeSps {
+		return nil, errors.New("not a sps nalu")
+	}
+
+	r := newRbspReader(nalu[1:])
+	s := &SPS{
+		ChromaFormatIdc:     1,
+		BitDepthLuma:        8,
+		BitDepthChroma:      8,
+		MaxNumReorderFrames: -1,
+	}
+
+	s.ProfileIdc = uint8(r.u(8))
+	s.ConstraintFlags = uint8(r.u(8))
+	s.LevelIdc = uint8(r.u(8))
+	s.ID = r.ue()
+
+	// High profile 扩展
+	switch s.ProfileIdc {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		s.ChromaFormatIdc = r.ue()
+		if s.ChromaFormatIdc == 3 {
+			s.SeparateColourPlane = r.flag()
+		}
+		s.BitDepthLuma = r.ue() + 8
+		s.BitDepthChroma = r.ue() + 8
+		r.u(1) // qpprime_y_zero_transform_bypass_flag
+
+		// seq_scaling_matrix_present_flag
+		if r.flag() {
+			count := 8
+			if s.ChromaFormatIdc == 3 {
+				count = 12
+			}
+
+			for i := 0; i < count; i++ {
+				// seq_scaling_list_present_flag
+				if !r.flag() {
+					continue
+				}
+
+				if i < 6 {
+					r.scalingList(16)
+				} else {
+					r.scalingList(64)
+				}
+			}
+		}
+	}
+
+	s.Log2MaxFrameNum = r.ue() + 4
+	s.PicOrderCntType = r.ue()
+
+	switch s.PicOrderCntType {
+	case 0:
+		s.Log2MaxPicOrderCntLsb = r.ue() + 4
+	case 1:
+		s.DeltaPicOrderAlwaysZero = r.flag()
+		s.OffsetForNonRefPic = r.se()
+		s.OffsetForTopToBottomField = r.se()
+
+		num := r.ue()
+		if num > 255 {
+			return nil, errors.New("invalid num_ref_frames_in_pic_order_cnt_cycle")
+		}
+		for i := uint32(0); i < num && r.err == nil; i++ {
+			s.OffsetForRefFrame = append(s.OffsetForRefFrame, r.se())
+		}
+	}
+
+	s.MaxNumRefFrames = r.ue()
+	r.u(1) // gaps_in_frame_num_value_allowed_flag
+
+	widthInMbs := r.ue() + 1
+	heightInMapUnits := r.ue() + 1
+
+	s.FrameMbsOnly = r.flag()
+	if !s.FrameMbsOnly {
+		r.u(1) // mb_adaptive_frame_field_flag
+	}
+	r.u(1) // direct_8x8_inference_flag
+
+	// frame_cropping_flag
+	if r.flag() {
+		s.CropLeft = r.ue()
+		s.CropRight = r.ue()
+		s.CropTop = r.ue()
+		s.CropBottom = r.ue()
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	// 计算裁剪后的分辨率
+	frameHeightFactor := uint32(2)
+	if s.FrameMbsOnly {
+		frameHeightFactor = 1
+	}
+
+	cropUnitX := uint32(1)
+	cropUnitY := frameHeightFactor
+	switch s.ChromaArrayType() {
+	case 1:
+		cropUnitX, cropUnitY = 2, 2*frameHeightFactor
+	case 2:
+		cropUnitX, cropUnitY = 2, frameHeightFactor
+	case 3:
+		cropUnitX, cropUnitY = 1, frameHeightFactor
+	}
+
+	s.Width = int(widthInMbs*16) - int(cropUnitX*(s.CropLeft+s.CropRight))
+	s.Height = int(frameHeightFactor*heightInMapUnits*16) - int(cropUnitY*(s.CropTop+s.CropBottom))
+	if s.Width <= 0 || s.Height <= 0 {
+		return nil, errors.New("invalid sps frame cropping")
+	}
+
+	// vui_parameters_present_flag
+	s.VUIPresent = r.flag()
+	if s.VUIPresent {
+		err := s.parseVUI(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// 解析 vui_parameters( ), 时间信息之后的字段缺失时不视为错误
+func (s *SPS) parseVUI(r *rbspReader) error {
+	// aspect_ratio_info_present_flag
+	if r.flag() {
+		idc := r.u(8)
+		if idc == 255 {
+			s.SarWidth = r.u(16)
+			s.SarHeight = r.u(16)
+		} else if int(idc) < len(sarTable) {
+			s.SarWidth = sarTable[idc][0]
+			s.SarHeight = sarTable[idc][1]
+		}
+	}
+
+	// overscan_info_present_flag
+	if r.flag() {
+		r.u(1) // overscan_appropriate_flag
+	}
+
+	// video_signal_type_present_flag
+	if r.flag() {
+		r.u(3) // video_format
+		s.VideoFullRange = r.flag()
+
+		s.ColourDescription = r.flag()
+		if s.ColourDescription {
+			s.ColourPrimaries = uint8(r.u(8))
+			s.TransferCharacteristics = uint8(r.u(8))
+			s.MatrixCoefficients = uint8(r.u(8))
+		}
+	}
+
+	// chroma_loc_info_present_flag
+	if r.flag() {
+		r.ue() // chroma_sample_loc_type_top_field
+		r.ue() // chroma_sample_loc_type_bottom_field
+	}
+
+	s.TimingInfoPresent = r.flag()
+	if s.TimingInfoPresent {
+		s.NumUnitsInTick = r.u(32)
+		s.TimeScale = r.u(32)
+		s.FixedFrameRate = r.flag()
+	}
+
+	if r.err != nil {
+		return r.err
+	}
+
+	// nal_hrd_parameters_present_flag, vcl_hrd_parameters_present_flag
+	nalHrd := r.flag()
+	if nalHrd {
+		r.hrdParameters()
+	}
+	vclHrd := r.flag()
+	if vclHrd {
+		r.hrdParameters()
+	}
+	if nalHrd || vclHrd {
+		r.u(1) // low_delay_hrd_flag
+	}
+	r.u(1) // pic_struct_present_flag
+
+	// bitstream_restriction_flag
+	if r.flag() {
+		r.u(1) // motion_vectors_over_pic_boundaries_flag
+		r.ue() // max_bytes_per_pic_denom
+		r.ue() // max_bits_per_mb_denom
+		r.ue() // log2_max_mv_length_horizontal
+		r.ue() // log2_max_mv_length_vertical
+
+		reorder := r.ue()
+		if r.err == nil {
+			s.MaxNumReorderFrames = int(reorder)
+		}
+	}
+
+	return nil
+}
+
+// rbspReader 带错误保持的位读取器, 出现错误后的读取均返回0
+type rbspReader struct {
+	*bits.Reader
+	err error
+}
+
+// 去除防竞争字节后读取
+func newRbspReader(b []byte) *rbspReader {
+	return &rbspReader{
+		Reader: bits.NewReader(bits.RemoveEmulationPrevention(b)),
+	}
+}
+
+func (r *rbspReader) u(n int) uint32 {
+	if r.err != nil {
+		return 0
+	}
+
+	var v uint32
+	v, r.err = r.ReadBits(n)
+	return v
+}
+
+func (r *rbspReader) flag() bool {
+	return r.u(1) == 1
+}
+
+func (r *rbspReader) ue() uint32 {
+	if r.err != nil {
+		return 0
+	}
+
+	var v uint32
+	v, r.err = r.ReadUE()
+	return v
+}
+
+func (r *rbspReader) se() int32 {
+	if r.err != nil {
+		return 0
+	}
+
+	var v int32
+	v, r.err = r.ReadSE()
+	return v
+}
+
+// 跳过 scaling_list( )
+func (r *rbspReader) scalingList(size int) {
+	lastScale := int32(8)
+	nextScale := int32(8)
+
+	for i := 0; i < size && r.err == nil; i++ {
+		if nextScale != 0 {
+			delta := r.se()
+			nextScale = (lastScale + delta + 256) % 256
+		}
+		if nextScale != 0 {
+			lastScale = nextScale
+		}
+	}
+}
+
+// 跳过 hrd_parameters( )
+func (r *rbspReader) hrdParameters() {
+	cpbCnt := r.ue() + 1
+	r.u(4) // bit_rate_scale
+	r.u(4) // cpb_size_scale
+
+	for i := uint32(0); i < cpbCnt && i < 32 && r.err == nil; i++ {
+		r.ue() // bit_rate_value_minus1
+		r.ue() // cpb_size_value_minus1
+		r.u(1) // cbr_flag
+	}
+
+	// initial_cpb_removal_delay_length_minus1, cpb_removal_delay_length_minus1,
+	// dpb_output_delay_length_minus1, time_offset_length
+	r.u(20)
+}
@@ -0,0 +1,77 @@
+package h264
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSPS(t *testing.T) {
+	at := assert.New(t)
+
+	// case1: Main profile, 720x576, 25fps, 带VUI
+	sps, err := ParseSPS([]byte{
+		0x67, 0x4d, 0x00, 0x1e, 0xab, 0x40, 0x5a, 0x12, 0x6c, 0x09, 0x28, 0x28,
+		0x28, 0x2f, 0x80, 0x00, 0x01, 0xf4, 0x00, 0x00, 0x61, 0xa8, 0x4a,
+	})
+	at.Nil(err)
+	at.Equal(uint8(77), sps.ProfileIdc)
+	at.Equal(uint8(30), sps.LevelIdc)
+	at.Equal(uint32(1), sps.ChromaFormatIdc)
+	at.Equal(uint32(8), sps.BitDepthLuma)
+	at.Equal(uint32(0), sps.PicOrderCntType)
+	at.Equal(uint32(5), sps.Log2MaxFrameNum)
+	at.Equal(uint32(6), sps.Log2MaxPicOrderCntLsb)
+	at.False(sps.FrameMbsOnly)
+	at.Equal(720, sps.Width)
+	at.Equal(576, sps.Height)
+	at.Equal(uint32(12), sps.SarWidth)
+	at.Equal(uint32(11), sps.SarHeight)
+	at.True(sps.ColourDescription)
+	at.Equal(uint8(5), sps.ColourPrimaries)
+	at.True(sps.TimingInfoPresent)
+	at.True(sps.FixedFrameRate)
+	at.Equal(float64(25), sps.FrameRate())
+
+	// case2: High profile, 1920x1080(裁剪), 无VUI
+	sps, err = ParseSPS([]byte{
+		0x67, 0x64, 0x00, 0x28, 0xac, 0xd9, 0x40, 0x78, 0x02, 0x27, 0xe5, 0x84,
+		0x00, 0x00, 0x03, 0x00, 0x04, 0x00, 0x00, 0x03, 0x00, 0xf0, 0x3c, 0x60,
+		0xc6, 0x58,
+	})
+	at.Nil(err)
+	at.Equal(uint8(100), sps.ProfileIdc)
+	at.Equal(uint8(40), sps.LevelIdc)
+	at.Equal(1920, sps.Width)
+	at.Equal(1080, sps.Height)
+	at.Equal(uint32(4), sps.CropBottom)
+	at.True(sps.FrameMbsOnly)
+
+	// case3: 数据不完整或不是SPS
+	_, err = ParseSPS([]byte{0x67, 0x4d, 0x00})
+	at.NotNil(err)
+
+	_, err = ParseSPS([]byte{0x68, 0xde, 0x31, 0x12})
+	at.NotNil(err)
+}
+
+func TestParser_SPS(t *testing.T) {
+	at := assert.New(t)
+
+	d := NewParser()
+	at.Nil(d.SPS())
+
+	seq := []byte{
+		0x01, 0x4d, 0x00, 0x1e, 0xff, 0xe1, 0x00, 0x17, 0x67, 0x4d, 0x00,
+		0x1e, 0xab, 0x40, 0x5a, 0x12, 0x6c, 0x09, 0x28, 0x28, 0x28, 0x2f,
+		0x80, 0x00, 0x01, 0xf4, 0x00, 0x00, 0x61, 0xa8, 0x4a, 0x01, 0x00,
+		0x04, 0x68, 0xde, 0x31, 0x12,
+	}
+	at.Nil(d.Parse(seq, true, bytes.NewBuffer(nil)))
+
+	sps := d.SPS()
+	at.NotNil(sps)
+	at.Equal(720, sps.Width)
+	at.Equal(576, sps.Height)
+}
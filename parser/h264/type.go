@@ -1,10 +1,10 @@
 package h264
 
-// 帧类型
+// 帧类型, SP帧归为P帧, SI帧归为I帧
 const (
-	iFrame byte = iota
-	pFrame
-	bFrame
+	IFrame byte = iota
+	PFrame
+	BFrame
 )
 
 // nalu 类型
@@ -22,6 +22,20 @@ const (
 	naluTypeEOSeq     byte = 10 // end_of_seq_rbsp( )
 	naluTypeEOStream  byte = 11 // end_of_stream_rbsp( )
 	naluTypeFiller    byte = 12 // filler_data_rbsp( )
+	naluTypeSpsExt    byte = 13 // seq_parameter_set_extension_rbsp( )
+	naluTypePrefix    byte = 14 // prefix_nal_unit_rbsp( )
+)
+
+// NaluPolicy AVCC转换为Annex-b时对nalu的处理策略
+type NaluPolicy byte
+
+const (
+	// NaluPass 透传(默认)
+	NaluPass NaluPolicy = iota
+	// NaluDrop 丢弃
+	NaluDrop
+	// NaluError 返回错误
+	NaluError
 )
 
 const (
@@ -32,17 +46,31 @@ const (
 var startCode = []byte{0x00, 0x00, 0x00, 0x01}
 var naluAud = []byte{0x00, 0x00, 0x00, 0x01, 0x09, 0xf0} // 音频nalu
 
-// [AVCC]序列头
+// [AVCC]序列头 AVCDecoderConfigurationRecord
 type sequenceHeader struct {
-	configurationVersion byte // 8bits
-	avcProfileIndication byte // 8bits
-	profileCompatility   byte // 8bits
-	avcLevelIndication   byte // 8bits
-	reserved1            byte // 6bits
-	naluLen              byte // 2bits
-	reserved2            byte // 3bits
-	spsNum               byte // 5bits
-	ppsNum               byte // 8bits
-	spsLen               int
-	ppsLen               int
+	configurationVersion byte     // 8bits
+	avcProfileIndication byte     // 8bits
+	profileCompatility   byte     // 8bits
+	avcLevelIndication   byte     // 8bits
+	reserved1            byte     // 6bits
+	naluLen              byte     // 2bits, lengthSizeMinusOne + 1
+	reserved2            byte     // 3bits
+	spsNum               byte     // 5bits
+	sps                  [][]byte // 不包含start code
+	ppsNum               byte     // 8bits
+	pps                  [][]byte // 不包含start code
+	chromaFormat         byte     // 2bits, High profile 扩展
+	bitDepthLumaMinus8   byte     // 3bits, High profile 扩展
+	bitDepthChromaMinus8 byte     // 3bits, High profile 扩展
+	spsExtNum            byte     // 8bits, High profile 扩展
+	spsExt               [][]byte // 不包含start code
+}
+
+// 序列头中是否携带 High profile 扩展字段
+func hasHighProfileExt(profile byte) bool {
+	switch profile {
+	case 100, 110, 122, 144:
+		return true
+	}
+	return false
 }
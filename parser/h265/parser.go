@@ -0,0 +1,241 @@
+package h265
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Parser H265解析器
+type Parser struct {
+	naluLen      int           /* nalu长度字段所占的字节数 */
+	specificInfo []byte        /* {vps, sps, pps}, 均包含start code */
+	paramSets    *bytes.Buffer /* 视频包中的vps/sps/pps, 均包含start code */
+	seq          sequenceHeader
+}
+
+// NewParser 初始化h265解析器(vps/sps/pps)
+func NewParser() *Parser {
+	return &Parser{
+		naluLen:   4,
+		paramSets: bytes.NewBuffer(make([]byte, 0, maxSpsPpsLen)),
+	}
+}
+
+// Parse 将H265打包格式转换为 Annex-b 的网络流格式, 写入w中
+func (p *Parser) Parse(b []byte, isSeqHdr bool, w io.Writer) error {
+	if len(b) == 0 || w == nil {
+		return errors.New("no data to parse or nil writer")
+	}
+
+	// [HVCC格式]如果是序列头, 则解析出VPS, SPS和PPS
+	if isSeqHdr {
+		return p.parseSpecificInfo(b)
+	}
+
+	// [Annex-b格式]直接写入以Nalu开头的数据
+	if p.isStartAtNaluHeader(b) {
+		_, err := w.Write(b)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	// [HVCC格式]转换为Annex-b格式并写入数据
+	return p.getAnnexbH265(b, w)
+}
+
+// [HVCC格式]解析 HEVCDecoderConfigurationRecord, 向specificInfo填充VPS, SPS和PPS
+func (p *Parser) parseSpecificInfo(src []byte) error {
+	if len(src) < seqHdrLen {
+		return errors.New("incomplete data, len(src)<23")
+	}
+
+	var seq sequenceHeader
+
+	seq.configurationVersion = src[0]
+	seq.generalProfileSpace = src[1] >> 6
+	seq.generalTierFlag = (src[1] >> 5) & 0x1
+	seq.generalProfileIdc = src[1] & 0x1f
+	seq.generalProfileCompatibilityFlags = binary.BigEndian.Uint32(src[2:6])
+	seq.generalConstraintIndicatorFlags = uint64(binary.BigEndian.Uint16(src[6:8]))<<32 | uint64(binary.BigEndian.Uint32(src[8:12]))
+	seq.generalLevelIdc = src[12]
+	seq.minSpatialSegmentationIdc = binary.BigEndian.Uint16(src[13:15]) & 0x0fff
+	seq.parallelismType = src[15] & 0x3
+	seq.chromaFormat = src[16] & 0x3
+	seq.bitDepthLumaMinus8 = src[17] & 0x7
+	seq.bitDepthChromaMinus8 = src[18] & 0x7
+	seq.avgFrameRate = binary.BigEndian.Uint16(src[19:21])
+	seq.constantFrameRate = src[21] >> 6
+	seq.numTemporalLayers = (src[21] >> 3) & 0x7
+	seq.temporalIDNested = (src[21] >> 2) & 0x1
+	seq.lengthSizeMinusOne = src[21] & 0x3
+	seq.numOfArrays = src[22]
+
+	if seq.lengthSizeMinusOne == 2 {
+		return errors.New("invalid nalu length size")
+	}
+
+	var specificInfo []byte
+
+	// 逐个提取参数集数组
+	index := seqHdrLen
+	for i := 0; i < int(seq.numOfArrays); i++ {
+		if len(src[index:]) < 3 {
+			return errors.New("incomplete nalu array header")
+		}
+
+		// [0]array_completeness, reserved, NAL_unit_type; [1:2]numNalus
+		numNalus := int(binary.BigEndian.Uint16(src[index+1 : index+3]))
+		index += 3
+
+		for j := 0; j < numNalus; j++ {
+			if len(src[index:]) < 2 {
+				return errors.New("incomplete nalu length")
+			}
+
+			nalLen := int(binary.BigEndian.Uint16(src[index : index+2]))
+			index += 2
+
+			if len(src[index:]) < nalLen || nalLen <= 0 {
+				return errors.New("incomplete nalu data")
+			}
+
+			specificInfo = append(specificInfo, startCode...)
+			specificInfo = append(specificInfo, src[index:index+nalLen]...)
+			index += nalLen
+		}
+	}
+
+	p.seq = seq
+	p.naluLen = int(seq.lengthSizeMinusOne) + 1
+	p.specificInfo = specificInfo
+
+	return nil
+}
+
+// 判断数据是否是以NALU头开始, Annex-b格式以NALU头开始
+func (p *Parser) isStartAtNaluHeader(src []byte) bool {
+	if len(src) < len(startCode) {
+		return false
+	}
+
+	return src[0] == 0x00 && src[1] == 0x00 && src[2] == 0x00 && src[3] == 0x01
+}
+
+// [HVCC格式] 提取NALU的长度
+func (p *Parser) naluSize(src []byte) (int, error) {
+	if len(src) < p.naluLen {
+		return 0, errors.New("[hvcc]incomplete nalu data")
+	}
+
+	var size = 0
+	for i := 0; i < p.naluLen; i++ {
+		size = size<<8 + int(src[i])
+	}
+
+	return size, nil
+}
+
+// 判断是否是随机接入帧(IRAP: BLA, IDR, CRA)
+func isIrap(nalType byte) bool {
+	return nalType >= naluTypeBlaWLp && nalType <= naluTypeRsvIrap
+}
+
+// [HVCC->Annex-b]将以 HVCC 作为打包格式转换为以 Annex-b 作为打包格式的H265数据写入w中
+func (p *Parser) getAnnexbH265(src []byte, w io.Writer) error {
+	dataSize := len(src)
+
+	if dataSize < p.naluLen {
+		return errors.New("incomplete h265 header")
+	}
+
+	// 写入访问单元分隔符
+	_, err := w.Write(naluAud)
+	if err != nil {
+		return err
+	}
+
+	index := 0
+	hasParamSets := false
+	hasWriteParamSets := false
+
+	// 重置vps/sps/pps的值
+	p.paramSets.Reset()
+
+	// 从HVCC的打包格式转换为Annex-b的打包格式; 随机接入帧之前写入VPS, SPS和PPS
+	for dataSize > 0 {
+		// 取出nalu的size
+		nalLen, err := p.naluSize(src[index:])
+		if err != nil {
+			return err
+		}
+
+		if nalLen <= 0 {
+			return errors.New("invalid nalu body size")
+		}
+
+		index += p.naluLen
+		dataSize -= p.naluLen
+
+		if dataSize < nalLen {
+			return errors.New("invalid nalu body")
+		}
+
+		nalType := (src[index] >> 1) & 0x3f /* [1:6]nal_unit_type 帧类型 */
+
+		switch {
+		case nalType == naluTypeAud:
+		case nalType == naluTypeVps || nalType == naluTypeSps || nalType == naluTypePps:
+			hasParamSets = true
+
+			// 写入 start code
+			_, err = p.paramSets.Write(startCode)
+			if err != nil {
+				return err
+			}
+
+			// 写入 VPS, SPS 或 PPS 的数据
+			_, err = p.paramSets.Write(src[index : index+nalLen])
+			if err != nil {
+				return err
+			}
+		default:
+			// 如果未写入参数集, 则在随机接入帧之前写入,
+			// 如果视频包中有参数集, 则从视频包提取该数据, 否则从缓存的数据里提取
+			if isIrap(nalType) && !hasWriteParamSets {
+				hasWriteParamSets = true
+
+				paramSets := p.specificInfo
+				if hasParamSets {
+					paramSets = p.paramSets.Bytes()
+				}
+
+				_, err = w.Write(paramSets)
+				if err != nil {
+					return err
+				}
+			}
+
+			// 写入 start code
+			_, err = w.Write(startCode)
+			if err != nil {
+				return err
+			}
+
+			// 写入 nalu 数据
+			_, err = w.Write(src[index : index+nalLen])
+			if err != nil {
+				return err
+			}
+		}
+
+		index += nalLen
+		dataSize -= nalLen
+	}
+
+	return nil
+}
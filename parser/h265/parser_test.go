@@ -0,0 +1,121 @@
+package h265
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testVps = []byte{0x40, 0x01, 0x0c, 0x01, 0xff, 0xff, 0x01, 0x60, 0x00, 0x00, 0x03, 0x00, 0x90, 0x00, 0x00, 0x03, 0x00, 0x00, 0x03, 0x00, 0x5d, 0x95, 0x98, 0x09}
+	testSps = []byte{0x42, 0x01, 0x01, 0x01, 0x60, 0x00, 0x00, 0x03, 0x00, 0x90, 0x00, 0x00, 0x03, 0x00, 0x00, 0x03, 0x00, 0x5d, 0xa0, 0x02, 0x80, 0x80, 0x2d, 0x16, 0x59, 0x59, 0xa4, 0x93, 0x2b, 0xc0, 0x5a}
+	testPps = []byte{0x44, 0x01, 0xc1, 0x72, 0xb4, 0x62, 0x40}
+)
+
+// 生成 HEVCDecoderConfigurationRecord
+func testSeqHdr() []byte {
+	seq := []byte{
+		0x01, 0x01, 0x60, 0x00, 0x00, 0x00, 0x90, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x5d, 0xf0, 0x00, 0xfc,
+		0xfd, 0xf8, 0xf8, 0x00, 0x00, 0x0f, 0x03,
+	}
+
+	for _, nalu := range [][]byte{testVps, testSps, testPps} {
+		seq = append(seq, 0x80|(nalu[0]>>1)&0x3f, 0x00, 0x01, 0x00, byte(len(nalu)))
+		seq = append(seq, nalu...)
+	}
+
+	return seq
+}
+
+func annexb(nalus ...[]byte) []byte {
+	var b []byte
+	for _, nalu := range nalus {
+		b = append(b, startCode...)
+		b = append(b, nalu...)
+	}
+	return b
+}
+
+func hvcc(nalus ...[]byte) []byte {
+	var b []byte
+	for _, nalu := range nalus {
+		l := len(nalu)
+		b = append(b, byte(l>>24), byte(l>>16), byte(l>>8), byte(l))
+		b = append(b, nalu...)
+	}
+	return b
+}
+
+// 解复用序列头测试
+func TestH265SeqDemux(t *testing.T) {
+	at := assert.New(t)
+
+	d := NewParser()
+	w := bytes.NewBuffer(nil)
+
+	at.Nil(d.Parse(testSeqHdr(), true, w))
+	at.Equal(0, w.Len())
+	at.Equal(4, d.naluLen)
+	at.Equal(byte(1), d.seq.generalProfileIdc)
+	at.Equal(byte(0x5d), d.seq.generalLevelIdc)
+	at.Equal(annexb(testVps, testSps, testPps), d.specificInfo)
+
+	// 数据不完整
+	at.NotNil(d.Parse(testSeqHdr()[:30], true, w))
+}
+
+// HVCC转换为Annex-b, 随机接入帧前插入参数集
+func TestH265HvccDemux(t *testing.T) {
+	at := assert.New(t)
+
+	d := NewParser()
+	w := bytes.NewBuffer(nil)
+	at.Nil(d.Parse(testSeqHdr(), true, w))
+
+	idr := []byte{0x26, 0x01, 0xaf, 0x1d}
+	trail := []byte{0x02, 0x01, 0xd0, 0x09}
+	sei := []byte{0x4e, 0x01, 0x05, 0x01}
+
+	// case1: 关键帧, 使用序列头中的参数集
+	at.Nil(d.Parse(hvcc(sei, idr), false, w))
+
+	expected := append([]byte{}, naluAud...)
+	expected = append(expected, annexb(sei)...)
+	expected = append(expected, annexb(testVps, testSps, testPps, idr)...)
+	at.Equal(expected, w.Bytes())
+
+	// case2: 非关键帧
+	w.Reset()
+	at.Nil(d.Parse(hvcc(trail), false, w))
+
+	expected = append([]byte{}, naluAud...)
+	expected = append(expected, annexb(trail)...)
+	at.Equal(expected, w.Bytes())
+
+	// case3: 关键帧中带有参数集, 原有的AUD会被替换
+	w.Reset()
+	aud := []byte{0x46, 0x01, 0x10}
+	at.Nil(d.Parse(hvcc(aud, testSps, testPps, idr), false, w))
+
+	expected = append([]byte{}, naluAud...)
+	expected = append(expected, annexb(testSps, testPps, idr)...)
+	at.Equal(expected, w.Bytes())
+
+	// case4: Annex-b数据直接写入
+	w.Reset()
+	at.Nil(d.Parse(annexb(idr), false, w))
+	at.Equal(annexb(idr), w.Bytes())
+}
+
+func TestH265HvccDemuxException(t *testing.T) {
+	at := assert.New(t)
+
+	d := NewParser()
+	w := bytes.NewBuffer(nil)
+
+	at.NotNil(d.Parse(nil, false, w))
+	at.NotNil(d.Parse([]byte{0x00, 0x00, 0x00, 0x29, 0x26, 0x01}, false, w))
+	at.NotNil(d.Parse([]byte{0x00, 0x00, 0x00, 0x00, 0x26, 0x01}, false, w))
+}
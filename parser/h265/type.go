@@ -0,0 +1,47 @@
+package h265
+
+// nalu 类型
+const (
+	naluTypeBlaWLp   byte = 16 // BLA_W_LP, IRAP起始
+	naluTypeCraNut   byte = 21 // CRA_NUT
+	naluTypeRsvIrap  byte = 23 // RSV_IRAP_VCL23, IRAP结束
+	naluTypeVps      byte = 32 // video_parameter_set_rbsp( )
+	naluTypeSps      byte = 33 // seq_parameter_set_rbsp( )
+	naluTypePps      byte = 34 // pic_parameter_set_rbsp( )
+	naluTypeAud      byte = 35 // access_unit_delimiter_rbsp( )
+	naluTypeEOSeq    byte = 36 // end_of_seq_rbsp( )
+	naluTypeEOStream byte = 37 // end_of_bitstream_rbsp( )
+	naluTypeFiller   byte = 38 // filler_data_rbsp( )
+	naluTypeSeiPre   byte = 39 // sei_rbsp( ), prefix
+	naluTypeSeiSuf   byte = 40 // sei_rbsp( ), suffix
+)
+
+const (
+	seqHdrLen    int = 23
+	maxSpsPpsLen int = 2 * 1024
+)
+
+var startCode = []byte{0x00, 0x00, 0x00, 0x01}
+var naluAud = []byte{0x00, 0x00, 0x00, 0x01, 0x46, 0x01, 0x50} // 访问单元分隔符, pic_type=2
+
+// [HVCC]序列头 HEVCDecoderConfigurationRecord
+type sequenceHeader struct {
+	configurationVersion             byte   // 8bits
+	generalProfileSpace              byte   // 2bits
+	generalTierFlag                  byte   // 1bit
+	generalProfileIdc                byte   // 5bits
+	generalProfileCompatibilityFlags uint32 // 32bits
+	generalConstraintIndicatorFlags  uint64 // 48bits
+	generalLevelIdc                  byte   // 8bits
+	minSpatialSegmentationIdc        uint16 // 12bits
+	parallelismType                  byte   // 2bits
+	chromaFormat                     byte   // 2bits
+	bitDepthLumaMinus8               byte   // 3bits
+	bitDepthChromaMinus8             byte   // 3bits
+	avgFrameRate                     uint16 // 16bits
+	constantFrameRate                byte   // 2bits
+	numTemporalLayers                byte   // 3bits
+	temporalIDNested                 byte   // 1bit
+	lengthSizeMinusOne               byte   // 2bits
+	numOfArrays                      byte   // 8bits
+}
@@ -0,0 +1,167 @@
+package mp3
+
+import (
+	"errors"
+)
+
+// 版本号, 与帧头中的2位版本字段取值相同
+const (
+	Version25 = 0 // MPEG-2.5
+	Version2  = 2 // MPEG-2
+	Version1  = 3 // MPEG-1
+)
+
+// 声道模式
+const (
+	ChannelStereo      = iota // 立体声
+	ChannelJointStereo        // 联合立体声
+	ChannelDual               // 双声道
+	ChannelMono               // 单声道
+)
+
+const headerLen = 4
+
+// 码率表(kbps), [MPEG-1, MPEG-2/2.5][layer-1][bitrate_index]
+var bitrates = [2][3][15]int{
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	},
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	},
+}
+
+// 采样率表, [version][sampling_frequency]
+var sampleRates = map[int][3]int{
+	Version1:  {44100, 48000, 32000},
+	Version2:  {22050, 24000, 16000},
+	Version25: {11025, 12000, 8000},
+}
+
+// Header MPEG音频帧头
+type Header struct {
+	Version         int  // Version1, Version2 或 Version25
+	Layer           int  // 1, 2 或 3
+	Protected       bool // protection_bit 为0, 帧头后跟16位CRC
+	Bitrate         int  // 码率, 单位: bit/s
+	SampleRate      int  // 采样率, 单位: HZ
+	Padding         bool // padding_bit
+	ChannelMode     int  // 声道模式
+	Channels        int  // 声道数
+	FrameLength     int  // 帧长度, 包含帧头
+	SamplesPerFrame int  // 每帧的采样数: 384, 1152 或 576
+}
+
+// ParseHeader 解析4字节的MPEG音频帧头, 不支持自由格式码率
+func ParseHeader(b []byte) (*Header, error) {
+	if len(b) < headerLen {
+		return nil, errors.New("incomplete mp3 header, len(b)<4")
+	}
+
+	// 11位同步字
+	if b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+		return nil, errors.New("invalid mp3 syncword")
+	}
+
+	h := &Header{
+		Version:     int(b[1]>>3) & 0x3,
+		Layer:       4 - int(b[1]>>1)&0x3,
+		Protected:   b[1]&0x1 == 0,
+		Padding:     b[2]&0x2 != 0,
+		ChannelMode: int(b[3] >> 6),
+	}
+
+	if h.Version == 1 {
+		return nil, errors.New("reserved mp3 version")
+	}
+	if h.Layer == 4 {
+		return nil, errors.New("reserved mp3 layer")
+	}
+
+	bitrateIndex := int(b[2] >> 4)
+	if bitrateIndex == 0 {
+		return nil, errors.New("free format mp3 bitrate is not supported")
+	}
+	if bitrateIndex == 0xf {
+		return nil, errors.New("invalid mp3 bitrate index")
+	}
+
+	rateIndex := int(b[2]>>2) & 0x3
+	if rateIndex == 3 {
+		return nil, errors.New("invalid mp3 rate index")
+	}
+
+	table := 0
+	if h.Version != Version1 {
+		table = 1
+	}
+	h.Bitrate = bitrates[table][h.Layer-1][bitrateIndex] * 1000
+	h.SampleRate = sampleRates[h.Version][rateIndex]
+
+	h.Channels = 2
+	if h.ChannelMode == ChannelMono {
+		h.Channels = 1
+	}
+
+	padding := 0
+	if h.Padding {
+		padding = 1
+	}
+
+	switch {
+	case h.Layer == 1:
+		h.SamplesPerFrame = 384
+		h.FrameLength = (12*h.Bitrate/h.SampleRate + padding) * 4
+	case h.Layer == 3 && h.Version != Version1:
+		h.SamplesPerFrame = 576
+		h.FrameLength = 72*h.Bitrate/h.SampleRate + padding
+	default:
+		h.SamplesPerFrame = 1152
+		h.FrameLength = 144*h.Bitrate/h.SampleRate + padding
+	}
+
+	return h, nil
+}
+
+// Frame MPEG音频帧
+type Frame struct {
+	Header *Header
+	Data   []byte // 包含帧头的完整帧
+}
+
+// SplitFrames 从b中扫描连续的MPEG音频帧, 返回完整的帧和已消费的字节数
+// 帧之间的无效数据会被跳过, 末尾不完整的帧不会被消费
+func SplitFrames(b []byte) ([]*Frame, int) {
+	var frames []*Frame
+
+	index := 0
+	for len(b)-index >= headerLen {
+		h, err := ParseHeader(b[index:])
+		if err != nil {
+			// 重新同步
+			index++
+			continue
+		}
+
+		if len(b)-index < h.FrameLength {
+			return frames, index
+		}
+
+		frames = append(frames, &Frame{
+			Header: h,
+			Data:   b[index : index+h.FrameLength],
+		})
+		index += h.FrameLength
+	}
+
+	// 剩余的数据不足一个帧头, 跳过不可能是同步字起始的字节
+	for index < len(b) && b[index] != 0xff {
+		index++
+	}
+
+	return frames, index
+}
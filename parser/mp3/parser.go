@@ -1,45 +1,45 @@
 package mp3
 
-import (
-	"errors"
-)
-
 // Parser mp3解析器
 type Parser struct {
-	samplingFrequency int
+	header *Header
 }
 
 // NewParser mp3解析器
 func NewParser() *Parser {
-	return &Parser{
-		samplingFrequency: 44100,
-	}
+	return &Parser{}
 }
 
-// sampling_frequency - indicates the sampling frequency, according to the following table.
-// '00' 44.1 kHz
-// '01' 48 kHz
-// '10' 32 kHz
-// '11' reserved
-var mp3Rates = []int{44100, 48000, 32000}
-
-// Parse 解析mp3数据
+// Parse 解析mp3数据中第一个帧的帧头
 func (p *Parser) Parse(src []byte) error {
-	if len(src) < 3 {
-		return errors.New("incomplete mp3 data, len(src)<3")
+	h, err := ParseHeader(src)
+	if err != nil {
+		return err
 	}
 
-	// 提取出采样率
-	index := (src[2] >> 1) & 0x3
-	if int(index) < len(mp3Rates) {
-		p.samplingFrequency = mp3Rates[index]
-		return nil
-	}
+	p.header = h
+	return nil
+}
 
-	return errors.New("invalid rate index")
+// Header 最近一次解析出的帧头, 未解析时返回nil
+func (p *Parser) Header() *Header {
+	return p.header
 }
 
-// SampleRate mp3采样率
+// SampleRate mp3采样率, 未解析时返回44100
 func (p *Parser) SampleRate() int {
-	return p.samplingFrequency
+	if p.header == nil {
+		return 44100
+	}
+
+	return p.header.SampleRate
+}
+
+// SamplesPerFrame 每帧的采样数, 未解析时返回1152
+func (p *Parser) SamplesPerFrame() int {
+	if p.header == nil {
+		return 1152
+	}
+
+	return p.header.SamplesPerFrame
 }
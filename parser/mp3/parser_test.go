@@ -10,7 +10,103 @@ func TestParser_SampleRate(t *testing.T) {
 	at := assert.New(t)
 
 	p := NewParser()
-	at.Nil(p.Parse([]byte{0x62, 0x70, 0x6C}))
+	at.Nil(p.Header())
+	at.Equal(44100, p.SampleRate())
 
+	// MPEG-1 layer 3, 128kbps, 32000
+	at.Nil(p.Parse([]byte{0xff, 0xfb, 0x98, 0x64}))
 	at.Equal(32000, p.SampleRate())
+	at.Equal(1152, p.SamplesPerFrame())
+
+	// MPEG-2 layer 3, 64kbps, 22050
+	at.Nil(p.Parse([]byte{0xff, 0xf3, 0x80, 0xc4}))
+	at.Equal(22050, p.SampleRate())
+	at.Equal(576, p.SamplesPerFrame())
+
+	// 不是mp3帧头时保留之前的结果
+	at.NotNil(p.Parse([]byte{0x62, 0x70, 0x6c}))
+	at.Equal(22050, p.SampleRate())
+}
+
+func TestParseHeader(t *testing.T) {
+	at := assert.New(t)
+
+	// case1: MPEG-1 layer 3, 128kbps, 44100, 联合立体声
+	h, err := ParseHeader([]byte{0xff, 0xfb, 0x90, 0x64})
+	at.Nil(err)
+	at.Equal(Version1, h.Version)
+	at.Equal(3, h.Layer)
+	at.False(h.Protected)
+	at.Equal(128000, h.Bitrate)
+	at.Equal(44100, h.SampleRate)
+	at.Equal(ChannelJointStereo, h.ChannelMode)
+	at.Equal(2, h.Channels)
+	at.Equal(417, h.FrameLength)
+	at.Equal(1152, h.SamplesPerFrame)
+
+	// case2: 带填充位
+	h, err = ParseHeader([]byte{0xff, 0xfb, 0x92, 0x64})
+	at.Nil(err)
+	at.Equal(418, h.FrameLength)
+
+	// case3: MPEG-2.5 layer 3, 64kbps, 11025, 单声道
+	h, err = ParseHeader([]byte{0xff, 0xe3, 0x80, 0xc4})
+	at.Nil(err)
+	at.Equal(Version25, h.Version)
+	at.Equal(11025, h.SampleRate)
+	at.Equal(1, h.Channels)
+	at.Equal(417, h.FrameLength)
+	at.Equal(576, h.SamplesPerFrame)
+
+	// case4: MPEG-1 layer 2, 带CRC, 192kbps, 48000
+	h, err = ParseHeader([]byte{0xff, 0xfc, 0xa4, 0x00})
+	at.Nil(err)
+	at.Equal(2, h.Layer)
+	at.True(h.Protected)
+	at.Equal(576, h.FrameLength)
+
+	// case5: MPEG-1 layer 1, 384kbps, 48000
+	h, err = ParseHeader([]byte{0xff, 0xff, 0xc4, 0x00})
+	at.Nil(err)
+	at.Equal(1, h.Layer)
+	at.Equal(384, h.SamplesPerFrame)
+	at.Equal(384, h.FrameLength)
+
+	// case6: 无效的帧头
+	for _, b := range [][]byte{
+		{0xff, 0xfb, 0x90},       // 不完整
+		{0xfe, 0xfb, 0x90, 0x64}, // 同步字错误
+		{0xff, 0xeb, 0x90, 0x64}, // 保留的版本号
+		{0xff, 0xf9, 0x90, 0x64}, // 保留的layer
+		{0xff, 0xfb, 0x00, 0x64}, // 自由格式码率
+		{0xff, 0xfb, 0xf0, 0x64}, // 无效的码率
+		{0xff, 0xfb, 0x9c, 0x64}, // 无效的采样率
+	} {
+		_, err = ParseHeader(b)
+		at.NotNil(err)
+	}
+}
+
+func TestSplitFrames(t *testing.T) {
+	at := assert.New(t)
+
+	// 2个 MPEG-2 layer 3, 8kbps, 16000 的帧, 帧长为36字节
+	frame := make([]byte, 36)
+	copy(frame, []byte{0xff, 0xf3, 0x18, 0xc4})
+
+	data := []byte{0x00, 0x01}
+	data = append(data, frame...)
+	data = append(data, frame...)
+	data = append(data, frame[:10]...)
+
+	frames, n := SplitFrames(data)
+	at.Len(frames, 2)
+	at.Equal(frame, frames[0].Data)
+	at.Equal(16000, frames[1].Header.SampleRate)
+	at.Equal(len(data)-10, n)
+
+	// 没有同步字
+	frames, n = SplitFrames([]byte{0x01, 0x02, 0x03, 0x04, 0x05})
+	at.Empty(frames)
+	at.Equal(5, n)
 }
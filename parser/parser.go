@@ -8,6 +8,7 @@ import (
 	"github.com/moggle-mog/goav/packet"
 	"github.com/moggle-mog/goav/parser/aac"
 	"github.com/moggle-mog/goav/parser/h264"
+	"github.com/moggle-mog/goav/parser/h265"
 	"github.com/moggle-mog/goav/parser/mp3"
 )
 
@@ -16,6 +17,7 @@ type CodecParser struct {
 	aac  *aac.Parser
 	mp3  *mp3.Parser
 	h264 *h264.Parser
+	h265 *h265.Parser
 }
 
 // NewCodecParser [音频/视频]新建解析器
@@ -34,6 +36,12 @@ func (c *CodecParser) Parse(p *packet.Packet, w io.Writer) error {
 	case packet.PktVideo:
 		// 根据视频编码器做不同的处理
 		vh := p.Header.(packet.VideoPacketHeader)
+
+		// 扩展视频头中的元数据和序列结束不包含视频帧
+		if vh.IsExHeader() && (vh.PacketType() == packet.ExMetadata || vh.PacketType() == packet.ExSequenceEnd) {
+			return nil
+		}
+
 		if vh.IsCodecAvc() {
 			// 初始化一个h264解析器
 			if c.h264 == nil {
@@ -43,6 +51,15 @@ func (c *CodecParser) Parse(p *packet.Packet, w io.Writer) error {
 			// 将H264打包格式转换为 Annex-b 的网络流格式, 写入w中
 			return c.h264.Parse(p.Media, vh.IsSeqHdr(), w)
 		}
+		if vh.IsCodecHevc() {
+			// 初始化一个h265解析器
+			if c.h265 == nil {
+				c.h265 = h265.NewParser()
+			}
+
+			// 将H265打包格式转换为 Annex-b 的网络流格式, 写入w中
+			return c.h265.Parse(p.Media, vh.IsSeqHdr(), w)
+		}
 
 		// 默认返回错误
 		return fmt.Errorf("unexpected video codec number: %d", vh.CodecID())
@@ -61,7 +78,14 @@ func (c *CodecParser) Parse(p *packet.Packet, w io.Writer) error {
 				c.mp3 = mp3.NewParser()
 			}
 
-			return c.mp3.Parse(p.Media)
+			// mp3帧本身可以直接作为基本流, 原样写入
+			err := c.mp3.Parse(p.Media)
+			if err != nil {
+				return err
+			}
+
+			_, err = w.Write(p.Media)
+			return err
 		}
 
 		// 默认返回错误
@@ -84,3 +108,16 @@ func (c *CodecParser) SampleRate() (int, error) {
 
 	return c.mp3.SampleRate(), nil
 }
+
+// SamplesPerFrame [音频]每帧解码输出的采样数, AAC为1024/960(HE-AAC为2048/1920), mp3为1152/576/384
+func (c *CodecParser) SamplesPerFrame() (int, error) {
+	if c.aac == nil && c.mp3 == nil {
+		return 0, errors.New("unexpected audio codec, support aac or mp3 only")
+	}
+
+	if c.aac != nil {
+		return c.aac.SamplesPerFrame(), nil
+	}
+
+	return c.mp3.SamplesPerFrame(), nil
+}
@@ -158,3 +158,67 @@ func TestDemuxer_Demux(t *testing.T) {
 	at.Nil(err)
 	at.Equal(44100, n)
 }
+
+func TestCodecParser_ParseHevc(t *testing.T) {
+	at := assert.New(t)
+	d := flv.NewDemuxer()
+	parse := NewCodecParser()
+	buffer := bytes.NewBuffer(nil)
+
+	// case1: 扩展视频头的hevc序列头
+	p := packet.Packet{
+		Type: packet.PktVideo,
+		Data: []byte{
+			0x90, 0x68, 0x76, 0x63, 0x31,
+			0x01, 0x01, 0x60, 0x00, 0x00, 0x00, 0x90, 0x00,
+			0x00, 0x00, 0x00, 0x00, 0x5d, 0xf0, 0x00, 0xfc,
+			0xfd, 0xf8, 0xf8, 0x00, 0x00, 0x0f, 0x01,
+			0xa1, 0x00, 0x01, 0x00, 0x04, 0x42, 0x01, 0x01, 0x01,
+		},
+	}
+
+	at.Nil(d.Demux(&p))
+	at.Nil(parse.Parse(&p, buffer))
+	at.Equal(0, buffer.Len())
+
+	// case2: 传统视频头(CodecID=12)的hevc关键帧
+	p = packet.Packet{
+		Type: packet.PktVideo,
+		Data: []byte{
+			0x1c, 0x01, 0x00, 0x00, 0x00,
+			0x00, 0x00, 0x00, 0x03, 0x26, 0x01, 0xaf,
+		},
+	}
+
+	at.Nil(d.Demux(&p))
+	at.Nil(parse.Parse(&p, buffer))
+	at.Equal([]byte{
+		0x00, 0x00, 0x00, 0x01, 0x46, 0x01, 0x50,
+		0x00, 0x00, 0x00, 0x01, 0x42, 0x01, 0x01, 0x01,
+		0x00, 0x00, 0x00, 0x01, 0x26, 0x01, 0xaf,
+	}, buffer.Bytes())
+
+	// case3: 扩展视频头中的元数据
+	buffer.Reset()
+	p = packet.Packet{
+		Type: packet.PktVideo,
+		Data: []byte{
+			0x94, 0x68, 0x76, 0x63, 0x31, 0x02, 0x00,
+		},
+	}
+
+	at.Nil(d.Demux(&p))
+	at.Nil(parse.Parse(&p, buffer))
+	at.Equal(0, buffer.Len())
+
+	// case4: 不支持的视频编码
+	p = packet.Packet{
+		Type: packet.PktVideo,
+		Data: []byte{
+			0x91, 0x61, 0x76, 0x30, 0x31, 0x12,
+		},
+	}
+
+	at.Nil(d.Demux(&p))
+	at.NotNil(parse.Parse(&p, buffer))
+}